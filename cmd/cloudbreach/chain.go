@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloudsecops/internal/attack"
+	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/report"
+)
+
+// graphFile 攻击图输入文件格式
+type graphFile struct {
+	Name  string               `json:"name"`
+	Nodes []*attack.AttackNode `json:"nodes"`
+	Edges []*attack.AttackEdge `json:"edges"`
+}
+
+// inventoryFile 云资源清单输入文件格式
+type inventoryFile struct {
+	Resources     []cloud.Resource      `json:"resources"`
+	Relationships []attack.Relationship `json:"relationships"`
+}
+
+// runChain 执行 chain 子命令
+func runChain(args []string, stdout, stderr io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "analyze":
+			return runChainAnalyze(args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintln(stderr, "Usage: cloudbreach chain analyze [--input graph.json] [flags]")
+	return fmt.Errorf("unknown chain command")
+}
+
+// runChainAnalyze 执行 chain analyze 子命令
+func runChainAnalyze(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("chain analyze", stderr)
+	var out outputFlags
+	formats := []string{report.FormatTable, report.FormatJSON}
+	out.register(fs, formats)
+	input := fs.String("input", "", "attack graph JSON with nodes and edges")
+	var scans stringList
+	fs.Var(&scans, "scan", "saved scan result JSON whose findings feed the attack graph (repeatable)")
+	inventory := fs.String("inventory", "", "cloud inventory JSON with resources and relationships")
+	name := fs.String("name", "", "attack chain name")
+	top := fs.Int("top", attack.DefaultTopK, "number of most likely and highest-risk paths to report")
+	maxDepth := fs.Int("max-depth", 0, "maximum number of nodes in a path (0 for no limit)")
+	timeout := fs.Duration("timeout", 0, "abort the analysis after this duration (0 for no limit)")
+	chokePoints := fs.Bool("choke-points", false, "rank choke points, remediations and minimum cuts between entry points and data stores")
+	failOnRisk := fs.Float64("fail-on-risk", 0, "exit 1 if the chain risk score is at or above this value (0 to disable)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cloudbreach chain analyze [--input graph.json | --scan scan.json --inventory inventory.json] [flags]")
+		fmt.Fprintln(stderr, "Without inputs the built-in sample graph is analyzed.")
+		fs.PrintDefaults()
+	}
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *top < 1 {
+		return fmt.Errorf("--top must be at least 1")
+	}
+	if *maxDepth < 0 {
+		return fmt.Errorf("--max-depth must not be negative")
+	}
+	if err := out.validate(formats); err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(*timeout)
+	defer cancel()
+	opts := attack.PathOptions{MaxDepth: *maxDepth, MaxPaths: *top}
+
+	log := out.logger(stderr)
+	var g *attack.AttackGraph
+	var defaultName string
+	switch {
+	case *input != "" && (len(scans) > 0 || *inventory != ""):
+		return fmt.Errorf("--input cannot be combined with --scan or --inventory")
+	case len(scans) > 0 || *inventory != "":
+		graphInput, err := loadGraphInput(scans, *inventory)
+		if err != nil {
+			return err
+		}
+		g = attack.BuildGraph(graphInput, log)
+	case *input == "":
+		analyzer := attack.NewChainAnalyzer(log)
+		analyzer.LoadSampleData()
+		g, defaultName = analyzer.Graph(), "sample"
+	default:
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			return err
+		}
+		var graph graphFile
+		if err := json.Unmarshal(data, &graph); err != nil {
+			return fmt.Errorf("invalid attack graph %s: %w", *input, err)
+		}
+		g = attack.NewAttackGraph(log)
+		for _, node := range graph.Nodes {
+			g.AddNode(node)
+		}
+		for _, edge := range graph.Edges {
+			g.AddEdge(edge)
+		}
+		defaultName = graph.Name
+	}
+
+	chain, err := g.AnalyzeAttackChain(ctx, chainName(*name, defaultName), opts)
+	if err != nil {
+		return err
+	}
+	if chain != nil && *chokePoints {
+		if chain.ChokePoints, err = g.AnalyzeChokePoints(ctx, attack.PathOptions{MaxDepth: *maxDepth}); err != nil {
+			return err
+		}
+	}
+
+	if err := out.write(stdout, func(w io.Writer) error {
+		if out.format == report.FormatJSON {
+			return writeJSON(w, chain)
+		}
+		return writeChainTable(w, chain)
+	}); err != nil {
+		return err
+	}
+
+	if chain != nil && *failOnRisk > 0 && chain.RiskScore >= *failOnRisk {
+		log.Warnf("attack chain risk score %.2f is at or above %.2f", chain.RiskScore, *failOnRisk)
+		return errThreshold
+	}
+	return nil
+}
+
+// loadGraphInput 读取扫描结果中的IaC发现和云资源清单
+func loadGraphInput(scans []string, inventory string) (attack.GraphInput, error) {
+	var input attack.GraphInput
+	for _, path := range scans {
+		result, err := loadScanResult(path)
+		if err != nil {
+			return input, err
+		}
+		for _, finding := range result.Findings {
+			if finding.FilePath == "" {
+				finding.FilePath = result.FilePath
+			}
+			input.Findings = append(input.Findings, finding)
+		}
+	}
+	if inventory != "" {
+		data, err := os.ReadFile(inventory)
+		if err != nil {
+			return input, err
+		}
+		var inv inventoryFile
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return input, fmt.Errorf("invalid inventory %s: %w", inventory, err)
+		}
+		input.Resources = inv.Resources
+		input.Relationships = inv.Relationships
+	}
+	return input, nil
+}
+
+// withTimeout timeout 大于0时返回带超时的上下文
+func withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// chainName 返回攻击链名称，未指定时使用默认值
+func chainName(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return "attack-chain"
+}
+
+// writeChainTable 以表格形式输出攻击链
+func writeChainTable(w io.Writer, chain *attack.AttackChain) error {
+	if chain == nil {
+		_, err := fmt.Fprintln(w, "No attack path from an entry node to an exfiltration node.")
+		return err
+	}
+
+	fmt.Fprintf(w, "Attack chain %s\n", chain.Name)
+	fmt.Fprintf(w, "Risk score %.2f, success probability %.1f%%, estimated time %s\n\n",
+		chain.RiskScore, chain.Summary.SuccessProbability, chain.Summary.EstimatedTime)
+
+	nodes := make(map[string]attack.AttackNode, len(chain.Nodes))
+	for _, node := range chain.Nodes {
+		nodes[node.ID] = node
+	}
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, "STEP\tNODE\tTYPE\tSEVERITY\tMITRE\tLABEL")
+	for i, id := range chain.Summary.MostLikelyPath {
+		node := nodes[id]
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, id, node.Type, strings.ToUpper(node.Severity), node.MITRE, strings.ReplaceAll(node.Label, "\n", " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if err := writePathTable(w, "Most likely paths", chain.LikelyPaths); err != nil {
+		return err
+	}
+	if err := writePathTable(w, "Highest-risk paths", chain.RiskiestPaths); err != nil {
+		return err
+	}
+
+	if len(chain.Summary.RiskFactors) > 0 {
+		fmt.Fprintf(w, "\nRisk factors: %s\n", strings.Join(chain.Summary.RiskFactors, ", "))
+	}
+	if chain.ChokePoints != nil {
+		return writeChokePoints(w, chain.ChokePoints)
+	}
+	return nil
+}
+
+// writeChokePoints 输出瓶颈点、修复建议的路径消除比例和最小割，列表只显示前10项。
+// 路径数达到上限时注明占比只基于成功概率最高的路径
+func writeChokePoints(w io.Writer, analysis *attack.ChokePointAnalysis) error {
+	const limit = 10
+	if analysis.Complete {
+		fmt.Fprintf(w, "\nChoke points (all %d paths)\n", analysis.Paths)
+	} else {
+		fmt.Fprintf(w, "\nChoke points (the %d most likely paths only, percentages exclude the remaining paths)\n", analysis.MaxPaths)
+	}
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, "NODE\tTYPE\tPATHS\tCOVERAGE\tWEIGHTED\tCOST")
+	for i, cp := range analysis.ChokePoints {
+		if i == limit {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f%%\t%.1f%%\t%g\n", cp.NodeID, cp.Type, cp.Paths, cp.Coverage, cp.Weighted, cp.Cost)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nRemediations")
+	tw = newTabWriter(w)
+	fmt.Fprintln(tw, "ELIMINATES\tPATHS\tCOST\tREMEDIATION")
+	for i, r := range analysis.Remediations {
+		if i == limit {
+			break
+		}
+		fmt.Fprintf(tw, "%.1f%%\t%d\t%g\t%s\n", r.Percentage, r.Paths, r.Cost, r.Remediation)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nMinimum node cut (cost %g): %s\n", analysis.NodeCut.Cost, strings.Join(analysis.NodeCut.Nodes, ", "))
+	_, err := fmt.Fprintf(w, "Minimum edge cut (size %g): %s\n", analysis.EdgeCut.Cost, strings.Join(analysis.EdgeCut.Edges, ", "))
+	return err
+}
+
+// writePathTable 输出路径列表
+func writePathTable(w io.Writer, title string, paths []attack.AttackPath) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\n%s\n", title)
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, "RANK\tPROBABILITY\tRISK\tSTEPS\tPATH")
+	for i, p := range paths {
+		fmt.Fprintf(tw, "%d\t%.1f%%\t%.2f\t%d\t%s\n", i+1, p.Probability*100, p.RiskScore, len(p.Nodes), strings.Join(p.Nodes, " -> "))
+	}
+	return tw.Flush()
+}
+
+// stringList 可重复的字符串参数
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// writeJSON 输出格式化的JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// newTabWriter 创建表格输出
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
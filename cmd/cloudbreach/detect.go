@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/detection"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/iac"
+	"cloudsecops/internal/logger"
+	"cloudsecops/internal/report"
+)
+
+// expectDirective 事件文件中声明预期命中规则的注释，如 "# expect: Write to cgroup release_agent"
+const expectDirective = "# expect:"
+
+// detectResult 单个事件文件的检测结果
+type detectResult struct {
+	File       string           `json:"file"`
+	Events     int              `json:"events"`
+	Detections []eventDetection `json:"detections"`
+	Expected   []string         `json:"expected,omitempty"`
+	Missing    []string         `json:"missing,omitempty"`
+}
+
+// eventDetection 某个事件命中的规则，Event 为事件在文件中的序号（从1开始）
+type eventDetection struct {
+	Event int `json:"event"`
+	ebpf.Detection
+}
+
+// eventCollector 按顺序收集处理完成的事件
+type eventCollector struct {
+	mu     sync.Mutex
+	events []ebpf.Event
+}
+
+func (c *eventCollector) Write(event ebpf.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+// runDetect 执行 detect 子命令：用回放事件源将录制的事件送入与服务端相同的处理流程，
+// 包括网络流上下文和检测规则，并检查文件中声明的预期命中
+func runDetect(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("detect", stderr)
+	var out outputFlags
+	formats := []string{report.FormatTable, report.FormatJSON}
+	out.register(fs, formats)
+	rulesPath := fs.String("rules", "", "additional rules file or directory, loaded after the built-in rules")
+	noDefaults := fs.Bool("no-default-rules", false, "do not load the built-in rules")
+	learning := fs.Int("learning-period", 0, "seconds a container is observed before new network destinations are flagged")
+	baseline := fs.String("profile-baseline", "", "event file replayed first to learn behavior profiles, which are then locked")
+	failOn := fs.String("fail-on", "none", "exit 1 if any detection is at or above this severity (none to disable)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cloudbreach detect [flags] <events.jsonl>...")
+		fs.PrintDefaults()
+	}
+
+	files, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fs.Usage()
+		return fmt.Errorf("detect expects at least one event file")
+	}
+	if err := out.validate(formats); err != nil {
+		return err
+	}
+	threshold, err := parseThreshold(*failOn)
+	if err != nil {
+		return err
+	}
+
+	log := out.logger(stderr)
+	// 监控器使用全局日志器，避免其输出混入结果
+	logger.GetLogger().SetOutput(stderr)
+	logger.GetLogger().SetLevel(log.GetLevel())
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.Detection.RulesPath = *rulesPath
+	cfg.Detection.DefaultRules = !*noDefaults
+	engine, err := detection.NewEngine(cfg.Detection, log)
+	if err != nil {
+		return err
+	}
+
+	ebpfCfg := cfg.EBPF
+	ebpfCfg.Source = ebpf.SourceReplay
+	ebpfCfg.ReplaySpeed = 0
+	ebpfCfg.ReplayLoop = false
+	ebpfCfg.FlowLearningPeriod = *learning
+	// 行为画像只在本次回放中建立，不读写服务端保存的画像
+	ebpfCfg.Profile.Dir = ""
+	if *baseline != "" {
+		dir, err := learnProfiles(*baseline, ebpfCfg)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		ebpfCfg.Profile.Dir = dir
+	}
+
+	var results []detectResult
+	for _, file := range files {
+		result, err := detectFile(file, ebpfCfg, engine)
+		if err != nil {
+			return err
+		}
+		results = append(results, *result)
+	}
+
+	if err := out.write(stdout, func(w io.Writer) error {
+		if out.format == report.FormatJSON {
+			return writeJSON(w, results)
+		}
+		return writeDetectTable(w, results)
+	}); err != nil {
+		return err
+	}
+
+	failed := false
+	for _, result := range results {
+		if len(result.Missing) > 0 {
+			log.Warnf("%s: expected rules did not fire: %s", result.File, strings.Join(result.Missing, ", "))
+			failed = true
+		}
+		if threshold == "none" {
+			continue
+		}
+		for _, d := range result.Detections {
+			if iac.SeverityRank(d.Severity) >= iac.SeverityRank(threshold) {
+				failed = true
+				break
+			}
+		}
+	}
+	if failed {
+		return errThreshold
+	}
+	return nil
+}
+
+// detectFile 回放单个事件文件并收集命中结果，每个文件使用独立的监控器，网络流状态互不影响
+func detectFile(path string, cfg config.EBPFConfig, engine *detection.Engine) (*detectResult, error) {
+	expected, err := readExpectations(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ReplayPath = path
+	monitor, err := ebpf.NewMonitor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	monitor.SetDetector(engine)
+	collector := &eventCollector{}
+	monitor.AddSink(collector)
+
+	if err := replay(monitor, path); err != nil {
+		return nil, err
+	}
+
+	result := &detectResult{File: path, Events: len(collector.events), Detections: []eventDetection{}, Expected: expected}
+	fired := make(map[string]bool)
+	for i, event := range collector.events {
+		for _, d := range event.Detections {
+			result.Detections = append(result.Detections, eventDetection{Event: i + 1, Detection: d})
+			fired[d.Rule] = true
+		}
+	}
+	for _, rule := range expected {
+		if !fired[rule] {
+			result.Missing = append(result.Missing, rule)
+		}
+	}
+	return result, nil
+}
+
+// learnProfiles 回放基线事件文件建立行为画像并全部锁定，返回保存画像的临时目录。
+// 回放的事件时间为当前时间，学习期在一次回放中不会结束，因此由基线文件代替学习期
+func learnProfiles(path string, cfg config.EBPFConfig) (string, error) {
+	dir, err := os.MkdirTemp("", "cloudbreach-profiles-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	cfg.ReplayPath = path
+	cfg.Profile.Dir = dir
+	monitor, err := ebpf.NewMonitor(cfg)
+	if err == nil {
+		err = replay(monitor, path)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	for _, p := range monitor.Profiles() {
+		if _, err := monitor.LockProfile(p.ID); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// replay 运行监控器直到回放事件源结束
+func replay(monitor *ebpf.Monitor, path string) error {
+	if err := monitor.Start(); err != nil {
+		return err
+	}
+	status := monitor.SourceStatus()
+	for status.State == ebpf.SourceStateRunning {
+		time.Sleep(10 * time.Millisecond)
+		status = monitor.SourceStatus()
+	}
+	monitor.Stop()
+
+	if status.State == ebpf.SourceStateFailed {
+		return fmt.Errorf("%s: %s", path, status.Error)
+	}
+	if stats := monitor.Stats(); stats.DecodeErrors > 0 {
+		return fmt.Errorf("%s: %d events could not be decoded: %s", path, stats.DecodeErrors, stats.LastError)
+	}
+	return nil
+}
+
+// readExpectations 读取事件文件中声明的预期命中规则
+func readExpectations(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var expected []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rule, ok := strings.CutPrefix(line, expectDirective); ok {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				expected = append(expected, rule)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return expected, nil
+}
+
+// writeDetectTable 以表格形式输出检测结果
+func writeDetectTable(w io.Writer, results []detectResult) error {
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, "FILE\tEVENT\tSEVERITY\tRULE\tOUTPUT")
+	for _, result := range results {
+		for _, d := range result.Detections {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", result.File, d.Event, strings.ToUpper(d.Severity), d.Rule, d.Output)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	for _, result := range results {
+		status := "ok"
+		switch {
+		case len(result.Missing) > 0:
+			status = "FAIL missing " + strings.Join(result.Missing, ", ")
+		case len(result.Expected) == 0:
+			status = "no expectations"
+		}
+		fmt.Fprintf(w, "%s: %d events, %d detections, %s\n", result.File, result.Events, len(result.Detections), status)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// cloudbreach 是不依赖服务端的命令行工具，可在CI中直接扫描IaC配置、
+// 比较扫描结果、分析攻击链并生成合规报告。
+//
+// 退出码：0 表示成功且未超过阈值，1 表示存在超过阈值的问题，2 表示执行出错
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloudsecops/internal/iac"
+	"cloudsecops/internal/report"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 退出码
+const (
+	exitOK        = 0
+	exitThreshold = 1
+	exitError     = 2
+)
+
+// errThreshold 表示命令执行成功但结果超过了失败阈值
+var errThreshold = errors.New("threshold exceeded")
+
+const usage = `Usage: cloudbreach <command> [flags]
+
+Commands:
+  scan <path|archive|git-url>   扫描文件、目录、zip/tar.gz归档或Git仓库
+  diff --base X --head Y        比较两次扫描，仅新增问题参与阈值判断
+  rules list                    列出内置扫描规则
+  chain analyze                 分析攻击图中的攻击链
+  report --input scan.json      转换已保存的扫描结果或生成合规报告
+  detect <events.jsonl>...      回放录制的监控事件并运行检测规则
+
+Run 'cloudbreach <command> -h' for command flags.
+
+Exit codes: 0 ok, 1 findings at or above --fail-on, 2 error
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 分发子命令并将错误转换为退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	var err error
+	switch args[0] {
+	case "scan":
+		err = runScan(args[1:], stdout, stderr)
+	case "diff":
+		err = runDiff(args[1:], stdout, stderr)
+	case "rules":
+		err = runRules(args[1:], stdout, stderr)
+	case "chain":
+		err = runChain(args[1:], stdout, stderr)
+	case "report":
+		err = runReport(args[1:], stdout, stderr)
+	case "detect":
+		err = runDetect(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command: %s\n\n%s", args[0], usage)
+		return exitError
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errThreshold):
+		return exitThreshold
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "cloudbreach: %v\n", err)
+		return exitError
+	}
+}
+
+// outputFlags 输出相关的公共参数
+type outputFlags struct {
+	format  string
+	output  string
+	verbose bool
+}
+
+// register 注册输出参数
+func (o *outputFlags) register(fs *flag.FlagSet, formats []string) {
+	fs.StringVar(&o.format, "format", report.FormatTable, "output format: "+strings.Join(formats, ", "))
+	fs.StringVar(&o.output, "output", "", "write output to file instead of stdout")
+	fs.BoolVar(&o.verbose, "verbose", false, "log progress to stderr")
+}
+
+// validate 检查输出格式
+func (o *outputFlags) validate(formats []string) error {
+	for _, f := range formats {
+		if f == o.format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format %q, expected one of: %s", o.format, strings.Join(formats, ", "))
+}
+
+// writer 打开输出目标，返回的关闭函数需在写入完成后调用
+func (o *outputFlags) writer(stdout io.Writer) (io.Writer, func() error, error) {
+	if o.output == "" || o.output == "-" {
+		return stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(o.output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return file, file.Close, nil
+}
+
+// write 将内容写入输出目标
+func (o *outputFlags) write(stdout io.Writer, fn func(w io.Writer) error) error {
+	w, closeFn, err := o.writer(stdout)
+	if err != nil {
+		return err
+	}
+	if err := fn(w); err != nil {
+		closeFn()
+		return err
+	}
+	return closeFn()
+}
+
+// logger 创建输出到stderr的日志器，避免污染结构化输出
+func (o *outputFlags) logger(stderr io.Writer) *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(stderr)
+	log.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	if o.verbose {
+		log.SetLevel(logrus.DebugLevel)
+	} else {
+		log.SetLevel(logrus.WarnLevel)
+	}
+	return log
+}
+
+// parseFlags 解析参数，允许参数和位置参数交替出现，
+// 例如 cloudbreach scan ./infra --format sarif
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newFlagSet 创建子命令参数集
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("cloudbreach "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseThreshold 解析失败阈值，none 表示不因问题失败
+func parseThreshold(value string) (string, error) {
+	value = strings.ToLower(value)
+	if value == "none" || iac.ValidSeverity(value) {
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid --fail-on %q, expected critical, high, medium, low, info or none", value)
+}
+
+// atOrAbove 统计严重程度不低于阈值的问题数量
+func atOrAbove(findings []iac.Finding, threshold string) int {
+	if threshold == "none" {
+		return 0
+	}
+	rank := iac.SeverityRank(threshold)
+	count := 0
+	for _, f := range findings {
+		if iac.SeverityRank(f.Severity) >= rank {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloudsecops/internal/iac"
+)
+
+// publicBucket 触发 TF002（critical）的Terraform配置
+const publicBucket = `resource "aws_s3_bucket" "data" {
+  bucket = "data"
+  acl    = "public-read"
+}
+`
+
+// writeFile 在临时目录中写入文件并返回路径
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCLI 执行命令行并返回退出码、标准输出和标准错误
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	insecure := writeFile(t, dir, "main.tf", publicBucket)
+	clean := writeFile(t, dir, "clean.tf", "variable \"region\" {}\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no command", nil, exitError},
+		{"help", []string{"help"}, exitOK},
+		{"unknown command", []string{"deploy"}, exitError},
+		{"subcommand help", []string{"scan", "-h"}, exitOK},
+		{"findings above default threshold", []string{"scan", insecure}, exitThreshold},
+		{"findings at threshold", []string{"scan", insecure, "--fail-on", "critical"}, exitThreshold},
+		{"threshold disabled", []string{"scan", insecure, "--fail-on", "none"}, exitOK},
+		{"no findings", []string{"scan", clean}, exitOK},
+		{"invalid threshold", []string{"scan", insecure, "--fail-on", "severe"}, exitError},
+		{"invalid format", []string{"scan", insecure, "--format", "html"}, exitError},
+		{"unknown flag", []string{"scan", insecure, "--colour"}, exitError},
+		{"missing target", []string{"scan", filepath.Join(dir, "missing.tf")}, exitError},
+		{"two targets", []string{"scan", insecure, clean}, exitError},
+		{"ref on a local path", []string{"scan", insecure, "--ref", "main"}, exitError},
+		{"rules list", []string{"rules", "list"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runCLI(tt.args...); code != tt.want {
+				t.Errorf("run(%v) = %d, want %d\n%s", tt.args, code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRunScanInterleavedFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.tf", publicBucket)
+
+	code, stdout, stderr := runCLI("scan", "--fail-on", "none", dir, "--format", "json")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d\n%s", code, exitOK, stderr)
+	}
+	var result iac.ScanResult
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if result.Summary.Critical == 0 {
+		t.Errorf("summary = %+v, want a critical finding", result.Summary)
+	}
+	if len(result.Findings) == 0 || len(result.Findings[0].Compliance) == 0 {
+		t.Errorf("findings are not annotated with compliance controls: %+v", result.Findings)
+	}
+}
+
+func TestRunScanOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	insecure := writeFile(t, dir, "main.tf", publicBucket)
+	output := filepath.Join(dir, "results.sarif")
+
+	code, stdout, _ := runCLI("scan", insecure, "--format", "sarif", "--output", output)
+	if code != exitThreshold {
+		t.Errorf("exit code = %d, want %d", code, exitThreshold)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want output only in the file", stdout)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !bytes.Contains(data, []byte(`"ruleId": "TF002"`)) {
+		t.Errorf("SARIF output = %s, %v", data, err)
+	}
+}
+
+func TestRunDiffExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	clean := writeFile(t, dir, "clean.tf", "variable \"region\" {}\n")
+	insecure := writeFile(t, dir, "main.tf", publicBucket)
+
+	// 保存基线扫描结果，diff 同时支持扫描结果JSON和本地路径
+	code, stdout, stderr := runCLI("scan", insecure, "--format", "json", "--fail-on", "none")
+	if code != exitOK {
+		t.Fatalf("scan: exit code %d\n%s", code, stderr)
+	}
+	baseline := writeFile(t, dir, "baseline.json", stdout)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"new critical finding", []string{"--base", clean, "--head", insecure}, exitThreshold},
+		{"new finding below threshold", []string{"--base", clean, "--head", insecure, "--fail-on", "none"}, exitOK},
+		{"only fixed findings", []string{"--base", insecure, "--head", clean}, exitOK},
+		{"unchanged findings against saved scan", []string{"--base", baseline, "--head", insecure}, exitOK},
+		{"missing head", []string{"--base", clean}, exitError},
+		{"subdir without repo", []string{"--base", clean, "--head", insecure, "--subdir", "infra"}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"diff"}, tt.args...)
+			if code, _, stderr := runCLI(args...); code != tt.want {
+				t.Errorf("run(%v) = %d, want %d\n%s", args, code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRunReportThresholds(t *testing.T) {
+	dir := t.TempDir()
+	insecure := writeFile(t, dir, "main.tf", publicBucket)
+	_, stdout, _ := runCLI("scan", insecure, "--format", "json", "--fail-on", "none")
+	saved := writeFile(t, dir, "scan.json", stdout)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"convert", []string{"--input", saved, "--format", "junit"}, exitOK},
+		{"convert with threshold", []string{saved, "--fail-on", "high"}, exitThreshold},
+		{"failing compliance score", []string{"--input", saved, "--framework", "cis-aws", "--min-score", "100"}, exitThreshold},
+		{"framework without covered resources", []string{"--input", saved, "--framework", "cis-kubernetes"}, exitThreshold},
+		{"unknown framework", []string{"--input", saved, "--framework", "iso-27001"}, exitError},
+		{"compliance as sarif", []string{"--input", saved, "--framework", "cis-aws", "--format", "sarif"}, exitError},
+		{"missing input", nil, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"report"}, tt.args...)
+			if code, _, stderr := runCLI(args...); code != tt.want {
+				t.Errorf("run(%v) = %d, want %d\n%s", args, code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		format     string
+	}{
+		{[]string{"./infra"}, []string{"./infra"}, "table"},
+		{[]string{"./infra", "--format", "sarif"}, []string{"./infra"}, "sarif"},
+		{[]string{"--format=json", "a.tf", "b.tf"}, []string{"a.tf", "b.tf"}, "json"},
+		{[]string{"a.tf", "--format", "junit", "b.tf"}, []string{"a.tf", "b.tf"}, "junit"},
+		// -- 之后的参数都是位置参数
+		{[]string{"a.tf", "--", "--format", "json"}, []string{"a.tf", "--format", "json"}, "table"},
+		{nil, nil, "table"},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		format := fs.String("format", "table", "")
+		positional, err := parseFlags(fs, tt.args)
+		if err != nil {
+			t.Fatalf("parseFlags(%v): %v", tt.args, err)
+		}
+		if !reflect.DeepEqual(positional, tt.positional) || *format != tt.format {
+			t.Errorf("parseFlags(%v) = %v, format %q, want %v, format %q", tt.args, positional, *format, tt.positional, tt.format)
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseFlags(fs, []string{"a.tf", "--unknown"}); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("parseFlags with an undefined flag: err = %v", err)
+	}
+}
+
+func TestAtOrAbove(t *testing.T) {
+	findings := []iac.Finding{{Severity: "critical"}, {Severity: "high"}, {Severity: "medium"}, {Severity: "low"}, {Severity: "info"}}
+	for threshold, want := range map[string]int{"critical": 1, "high": 2, "medium": 3, "low": 4, "info": 5, "none": 0} {
+		if got := atOrAbove(findings, threshold); got != want {
+			t.Errorf("atOrAbove(%s) = %d, want %d", threshold, got, want)
+		}
+	}
+}
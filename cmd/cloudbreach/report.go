@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"cloudsecops/internal/compliance"
+	"cloudsecops/internal/iac"
+	"cloudsecops/internal/report"
+)
+
+// runReport 执行 report 子命令。未指定框架时将单个扫描结果转换为其他格式，
+// 指定框架时基于所有输入的扫描结果生成合规报告
+func runReport(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("report", stderr)
+	var out outputFlags
+	out.register(fs, report.Formats)
+	var inputs stringList
+	fs.Var(&inputs, "input", "saved scan result JSON (repeatable)")
+	framework := fs.String("framework", "", "compliance framework: cis-aws, cis-azure, cis-kubernetes, nist-800-53, pci-dss")
+	failOn := fs.String("fail-on", "none", "exit 1 if any finding is at or above this severity")
+	minScore := fs.Float64("min-score", 0, "exit 1 if the compliance score is below this percentage")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cloudbreach report --input scan.json [--framework name] [flags]")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	inputs = append(inputs, positional...)
+	if len(inputs) == 0 {
+		fs.Usage()
+		return fmt.Errorf("report expects at least one --input")
+	}
+	if err := out.validate(report.Formats); err != nil {
+		return err
+	}
+	threshold, err := parseThreshold(*failOn)
+	if err != nil {
+		return err
+	}
+
+	var scans []*iac.ScanResult
+	var findings []iac.Finding
+	for _, input := range inputs {
+		result, err := loadScanResult(input)
+		if err != nil {
+			return err
+		}
+		scans = append(scans, result)
+		findings = append(findings, result.Findings...)
+	}
+
+	log := out.logger(stderr)
+	catalog := compliance.DefaultCatalog()
+
+	if *framework == "" {
+		if len(scans) > 1 {
+			return fmt.Errorf("converting scan results takes a single --input, use --framework to combine several")
+		}
+		catalog.AnnotateScan(scans[0])
+		if err := out.write(stdout, func(w io.Writer) error {
+			return report.WriteScan(w, out.format, scans[0], iac.NewScanner().Rules())
+		}); err != nil {
+			return err
+		}
+	} else {
+		fw, ok := compliance.ParseFramework(*framework)
+		if !ok {
+			return fmt.Errorf("unknown framework: %s", *framework)
+		}
+		if out.format != report.FormatTable && out.format != report.FormatJSON {
+			return fmt.Errorf("compliance reports support table and json formats")
+		}
+
+		result := catalog.Evaluate(fw, scans, nil)
+		if err := out.write(stdout, func(w io.Writer) error {
+			if out.format == report.FormatJSON {
+				return writeJSON(w, result)
+			}
+			return writeComplianceTable(w, result)
+		}); err != nil {
+			return err
+		}
+
+		// 扫描结果中没有框架对应平台的资源时，通过率没有意义，不能视为通过
+		if result.Summary.Passed+result.Summary.Failed == 0 {
+			log.Warnf("no scanned resources cover %s, all %d controls are not evaluated", result.Framework, result.Summary.Total)
+			return errThreshold
+		}
+		if *minScore > 0 && result.Summary.Score < *minScore {
+			log.Warnf("compliance score %.1f%% is below %.1f%%", result.Summary.Score, *minScore)
+			return errThreshold
+		}
+	}
+
+	if n := atOrAbove(findings, threshold); n > 0 {
+		log.Warnf("%d finding(s) at or above %s", n, threshold)
+		return errThreshold
+	}
+	return nil
+}
+
+// writeComplianceTable 以表格形式输出合规报告
+func writeComplianceTable(w io.Writer, result *compliance.Report) error {
+	fmt.Fprintf(w, "Compliance %s (%d scans)\n\n", result.Framework, result.Scans)
+
+	tw := newTabWriter(w)
+	fmt.Fprintln(tw, "CONTROL\tSTATUS\tEVIDENCE\tTITLE")
+	for _, control := range result.Controls {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", control.ID, strings.ToUpper(control.Status), len(control.Evidence), control.Title)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	s := result.Summary
+	if s.Passed+s.Failed == 0 {
+		_, err := fmt.Fprintf(w, "\n%d controls: NOT EVALUATED, the scans contain no resources for %s\n", s.Total, result.Framework)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d controls: %d passed, %d failed, %d not evaluated, score %.1f%%\n",
+		s.Total, s.Passed, s.Failed, s.NotEvaluated, s.Score)
+	return err
+}
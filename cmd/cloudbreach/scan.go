@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloudsecops/internal/compliance"
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/iac"
+	"cloudsecops/internal/report"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scanTarget 扫描目标参数
+type scanTarget struct {
+	ref    string
+	subdir string
+}
+
+// runScan 执行 scan 子命令
+func runScan(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("scan", stderr)
+	var out outputFlags
+	out.register(fs, report.Formats)
+	var target scanTarget
+	fs.StringVar(&target.ref, "ref", "", "branch, tag or commit SHA when scanning a Git URL")
+	fs.StringVar(&target.subdir, "subdir", "", "subdirectory to scan inside a Git repository")
+	failOn := fs.String("fail-on", "high", "exit 1 if any finding is at or above this severity (none to disable)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cloudbreach scan [flags] <file|dir|archive|git-url>")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("scan expects exactly one target")
+	}
+	if err := out.validate(report.Formats); err != nil {
+		return err
+	}
+	threshold, err := parseThreshold(*failOn)
+	if err != nil {
+		return err
+	}
+
+	log := out.logger(stderr)
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	scanner := iac.NewScanner()
+	result, err := scanPath(context.Background(), scanner, positional[0], target, cfg.IaC, log)
+	if err != nil {
+		return err
+	}
+	compliance.DefaultCatalog().AnnotateScan(result)
+
+	if err := out.write(stdout, func(w io.Writer) error {
+		return report.WriteScan(w, out.format, result, scanner.Rules())
+	}); err != nil {
+		return err
+	}
+
+	if n := atOrAbove(result.Findings, threshold); n > 0 {
+		log.Warnf("%d finding(s) at or above %s", n, threshold)
+		return errThreshold
+	}
+	return nil
+}
+
+// scanPath 根据目标类型选择扫描方式：本地文件、目录、归档或Git仓库
+func scanPath(ctx context.Context, scanner *iac.Scanner, path string, target scanTarget, cfg config.IaCConfig, log *logrus.Logger) (*iac.ScanResult, error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		if isGitURL(path) {
+			log.Debugf("Cloning %s", path)
+			return scanner.ScanGitRepository(ctx, iac.GitSource{URL: path, Ref: target.ref, Subdir: target.subdir}, gitOptions(cfg))
+		}
+		return nil, fmt.Errorf("target not found: %s", path)
+	}
+	if target.ref != "" || target.subdir != "" {
+		return nil, fmt.Errorf("--ref and --subdir only apply to Git URLs")
+	}
+
+	if info.IsDir() {
+		log.Debugf("Scanning directory %s", path)
+		return scanner.ScanDirectory(path)
+	}
+
+	format := iac.ArchiveFormat(path)
+	if format == "" {
+		log.Debugf("Scanning file %s", path)
+		return scanner.ScanFile(path)
+	}
+
+	dir, err := os.MkdirTemp("", "cloudbreach-archive-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stats, err := iac.ExtractArchive(path, format, dir, iac.ArchiveLimitsFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract archive: %w", err)
+	}
+	log.Debugf("Extracted %d files (%d bytes, %d skipped) from %s", stats.Files, stats.Bytes, stats.Skipped, path)
+
+	result, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		return nil, err
+	}
+	result.FilePath = filepath.Base(path)
+	result.FileType = "archive"
+	return result, nil
+}
+
+// gitOptions 命令行以本地用户身份运行，不需要服务端的限制：允许本地仓库，未设置 GIT_ALLOWED_HOSTS 时
+// 允许任意主机，未设置 GIT_KNOWN_HOSTS_FILE 时使用用户的 ~/.ssh/known_hosts
+func gitOptions(cfg config.IaCConfig) iac.GitOptions {
+	opts := iac.GitOptionsFromConfig(cfg)
+	opts.AllowLocal = true
+	if os.Getenv("GIT_ALLOWED_HOSTS") == "" {
+		opts.AllowedHosts = []string{"*"}
+	}
+	if opts.KnownHostsFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if path := filepath.Join(home, ".ssh", "known_hosts"); fileExists(path) {
+				opts.KnownHostsFile = path
+			}
+		}
+	}
+	return opts
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// isGitURL 判断目标是否为远程Git仓库地址
+func isGitURL(target string) bool {
+	return strings.Contains(target, "://") ||
+		strings.HasPrefix(target, "git@") ||
+		strings.HasSuffix(target, ".git")
+}
+
+// repoLocation 将本地仓库路径转换为绝对路径，克隆时 git 在临时目录中解析相对路径
+func repoLocation(repo string) (string, error) {
+	if isGitURL(repo) && !strings.HasSuffix(repo, ".git") {
+		return repo, nil
+	}
+	if _, err := os.Stat(repo); err != nil {
+		if isGitURL(repo) {
+			return repo, nil
+		}
+		return "", fmt.Errorf("repository not found: %s", repo)
+	}
+	return filepath.Abs(repo)
+}
+
+// runDiff 执行 diff 子命令。--base 和 --head 可以是已保存的扫描结果JSON、
+// 本地路径，或在指定 --repo 时为同一仓库的两个Git引用
+func runDiff(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("diff", stderr)
+	var out outputFlags
+	out.register(fs, report.Formats)
+	base := fs.String("base", "", "base scan JSON, path, or Git ref when --repo is set")
+	head := fs.String("head", "", "head scan JSON, path, or Git ref when --repo is set")
+	repo := fs.String("repo", "", "Git repository URL to diff refs of")
+	subdir := fs.String("subdir", "", "subdirectory to scan inside the repository")
+	failOn := fs.String("fail-on", "high", "exit 1 if any new finding is at or above this severity (none to disable)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cloudbreach diff --base X --head Y [--repo URL] [flags]")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || *base == "" || *head == "" {
+		fs.Usage()
+		return fmt.Errorf("diff expects --base and --head")
+	}
+	if err := out.validate(report.Formats); err != nil {
+		return err
+	}
+	threshold, err := parseThreshold(*failOn)
+	if err != nil {
+		return err
+	}
+
+	log := out.logger(stderr)
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ctx := context.Background()
+	scanner := iac.NewScanner()
+	var diff *iac.DiffResult
+	if *repo != "" {
+		repoURL, err := repoLocation(*repo)
+		if err != nil {
+			return err
+		}
+		diff, _, _, err = scanner.DiffGitRefs(ctx, repoURL, *base, *head, *subdir, gitOptions(cfg.IaC))
+		if err != nil {
+			return err
+		}
+	} else {
+		if *subdir != "" {
+			return fmt.Errorf("--subdir requires --repo")
+		}
+		baseResult, err := loadOrScan(ctx, scanner, *base, cfg.IaC, log)
+		if err != nil {
+			return fmt.Errorf("base: %w", err)
+		}
+		headResult, err := loadOrScan(ctx, scanner, *head, cfg.IaC, log)
+		if err != nil {
+			return fmt.Errorf("head: %w", err)
+		}
+		diff = iac.DiffResults(baseResult, headResult)
+	}
+
+	if err := out.write(stdout, func(w io.Writer) error {
+		return report.WriteDiff(w, out.format, diff, scanner.Rules())
+	}); err != nil {
+		return err
+	}
+
+	if n := atOrAbove(diff.New, threshold); n > 0 {
+		log.Warnf("%d new finding(s) at or above %s", n, threshold)
+		return errThreshold
+	}
+	return nil
+}
+
+// loadOrScan 读取已保存的扫描结果，目标不是扫描结果时直接扫描
+func loadOrScan(ctx context.Context, scanner *iac.Scanner, path string, cfg config.IaCConfig, log *logrus.Logger) (*iac.ScanResult, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		result, err := loadScanResult(path)
+		if err == nil {
+			return result, nil
+		}
+		log.Debugf("%s is not a saved scan result, scanning it: %v", path, err)
+	}
+	return scanPath(ctx, scanner, path, scanTarget{}, cfg, log)
+}
+
+// loadScanResult 读取JSON格式的扫描结果
+func loadScanResult(path string) (*iac.ScanResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result iac.ScanResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("invalid scan result %s: %w", path, err)
+	}
+	if result.ID == "" {
+		return nil, fmt.Errorf("invalid scan result %s: missing id", path)
+	}
+	return &result, nil
+}
+
+// runRules 执行 rules 子命令
+func runRules(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(stderr, "Usage: cloudbreach rules list [--format table|json]")
+		return fmt.Errorf("unknown rules command")
+	}
+
+	fs := newFlagSet("rules list", stderr)
+	var out outputFlags
+	formats := []string{report.FormatTable, report.FormatJSON}
+	out.register(fs, formats)
+	if _, err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if err := out.validate(formats); err != nil {
+		return err
+	}
+
+	catalog := compliance.DefaultCatalog()
+	type ruleInfo struct {
+		ID          string   `json:"id"`
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Severity    string   `json:"severity"`
+		Category    string   `json:"category"`
+		FileTypes   []string `json:"file_types"`
+		Compliance  []string `json:"compliance"`
+	}
+	var rules []ruleInfo
+	for _, rule := range iac.NewScanner().Rules() {
+		rules = append(rules, ruleInfo{
+			ID:          rule.ID,
+			Title:       rule.Title,
+			Description: rule.Description,
+			Severity:    rule.Severity,
+			Category:    rule.Category,
+			FileTypes:   rule.FileTypes,
+			Compliance:  catalog.ControlRefs(rule.ID),
+		})
+	}
+
+	return out.write(stdout, func(w io.Writer) error {
+		if out.format == report.FormatJSON {
+			return writeJSON(w, rules)
+		}
+		tw := newTabWriter(w)
+		fmt.Fprintln(tw, "ID\tSEVERITY\tCATEGORY\tFILE TYPES\tTITLE")
+		for _, rule := range rules {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rule.ID, strings.ToUpper(rule.Severity), rule.Category, strings.Join(rule.FileTypes, ","), rule.Title)
+		}
+		return tw.Flush()
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// git 在目录中执行 git 命令
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestRunDiffLocalRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git(t, dir, "init", "--quiet", "-b", "main")
+	writeFile(t, dir, "main.tf", "variable \"region\" {}\n")
+	git(t, dir, "add", "main.tf")
+	git(t, dir, "commit", "--quiet", "-m", "initial")
+	git(t, dir, "tag", "v1")
+	writeFile(t, dir, "main.tf", publicBucket)
+	git(t, dir, "commit", "--quiet", "-am", "public bucket")
+
+	// 相对路径需相对于当前目录而不是克隆使用的临时目录解析
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, repo := range []string{".", dir, "file://" + filepath.ToSlash(dir)} {
+		code, stdout, stderr := runCLI("diff", "--repo", repo, "--base", "v1", "--head", "main")
+		if code != exitThreshold {
+			t.Errorf("diff --repo %s: exit code = %d, want %d\n%s%s", repo, code, exitThreshold, stdout, stderr)
+		}
+	}
+	if code, _, stderr := runCLI("diff", "--repo", filepath.Join(dir, "missing"), "--base", "v1", "--head", "main"); code != exitError {
+		t.Errorf("missing repository: exit code = %d, want %d\n%s", code, exitError, stderr)
+	}
+}
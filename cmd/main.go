@@ -10,10 +10,16 @@ import (
 	"time"
 
 	"cloudsecops/internal/api"
+	"cloudsecops/internal/attack"
 	"cloudsecops/internal/config"
 	"cloudsecops/internal/database"
+	"cloudsecops/internal/detection"
 	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/eventstore"
+	"cloudsecops/internal/iac"
 	"cloudsecops/internal/logger"
+	"cloudsecops/internal/response"
+	"cloudsecops/internal/workload"
 	"cloudsecops/pkg/auth"
 
 	"github.com/gin-gonic/gin"
@@ -63,16 +69,78 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	// 初始化监控事件存储，关闭时在数据库连接关闭前写入剩余事件
+	var eventStore *eventstore.Store
+	if cfg.EventStore.Enabled {
+		eventStore, err = eventstore.NewStore(db, cfg.EventStore, log)
+		if err != nil {
+			log.Fatalf("Failed to initialize event store: %v", err)
+		}
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 30*time.Second)
+		err := eventStore.Migrate(migrateCtx)
+		cancelMigrate()
+		if err != nil {
+			log.Fatalf("Failed to initialize event store: %v", err)
+		}
+		storeCtx, stopStore := context.WithCancel(context.Background())
+		storeDone := make(chan struct{})
+		go func() {
+			defer close(storeDone)
+			eventStore.Run(storeCtx)
+		}()
+		defer func() {
+			stopStore()
+			<-storeDone
+		}()
+	}
+
 	// 初始化JWT认证
 	authService := auth.NewService(cfg.JWT.Secret)
 
 	// 初始化eBPF监控器
-	ebpfMonitor, err := ebpf.NewMonitor()
+	ebpfMonitor, err := ebpf.NewMonitor(cfg.EBPF)
 	if err != nil {
 		log.Fatalf("Failed to initialize eBPF monitor: %v", err)
 	}
 	defer ebpfMonitor.Close()
 
+	// 初始化工作负载解析器，为监控事件补全容器和Pod信息
+	workloads := workload.NewResolver(cfg.Workload, log)
+	workloadCtx, stopWorkloads := context.WithCancel(context.Background())
+	defer stopWorkloads()
+	go workloads.Run(workloadCtx)
+	ebpfMonitor.SetWorkloadResolver(workloads)
+
+	// 加载运行时检测规则
+	detector, err := detection.NewEngine(cfg.Detection, log)
+	if err != nil {
+		log.Fatalf("Failed to load detection rules: %v", err)
+	}
+	ebpfMonitor.SetDetector(detector)
+	if eventStore != nil {
+		ebpfMonitor.AddSink(eventStore)
+	}
+
+	// 初始化响应动作，对命中绑定规则的事件执行隔离操作
+	var responder *response.Responder
+	if cfg.Response.Enabled {
+		responder, err = response.NewResponder(cfg, ebpfMonitor, log)
+		if err != nil {
+			log.Fatalf("Failed to initialize response actions: %v", err)
+		}
+		responseCtx, stopResponse := context.WithCancel(context.Background())
+		responseDone := make(chan struct{})
+		go func() {
+			defer close(responseDone)
+			responder.Run(responseCtx)
+		}()
+		defer func() {
+			stopResponse()
+			<-responseDone
+		}()
+		ebpfMonitor.AddSink(responder)
+	}
+
 	// 启动eBPF监控
 	go func() {
 		if err := ebpfMonitor.Start(); err != nil {
@@ -80,6 +148,12 @@ func main() {
 		}
 	}()
 
+	// 初始化扫描工作区并定期回收过期目录
+	workspaces := iac.NewWorkspaceManager(cfg.IaC.WorkspaceDir, time.Duration(cfg.IaC.WorkspaceTTL)*time.Minute, log)
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	go workspaces.Run(gcCtx, 10*time.Minute)
+
 	// 设置Gin模式
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,7 +170,14 @@ func main() {
 		Redis:       redisClient,
 		Auth:        authService,
 		EBPFMonitor: ebpfMonitor,
+		Detection:   detector,
+		Events:      eventStore,
+		Response:    responder,
+		Scans:       iac.NewResultStore(500),
+		Chains:      attack.NewChainStore(200),
+		Workspaces:  workspaces,
 		Config:      cfg,
+		Logger:      log,
 	})
 
 	// 创建HTTP服务器
@@ -36,8 +36,7 @@ import {
   Security as SecurityIcon
 } from '@mui/icons-material';
 import { LineChart, Line, XAxis, YAxis, CartesianGrid, Tooltip as RechartsTooltip, ResponsiveContainer } from 'recharts';
-import io from 'socket.io-client';
-import { monitorAPI } from '../services/api';
+import { monitorAPI, createWebSocketConnection } from '../services/api';
 import { useTheme } from '../contexts/ThemeContext';
 import { useLanguage } from '../contexts/LanguageContext';
 
@@ -120,22 +119,29 @@ const Monitor: React.FC = () => {
   
   // WebSocket连接
   useEffect(() => {
-    let socket: any;
+    let socket: WebSocket;
     
     if (isMonitoring) {
-      socket = io('ws://localhost:8080', {
-        transports: ['websocket']
-      });
-
-      socket.on('monitor_event', (event: MonitorEvent) => {
+      socket = createWebSocketConnection((message: any) => {
+        if (message.type !== 'event' || !message.event) {
+          return;
+        }
+        const raw = message.event;
+        const event: MonitorEvent = {
+          id: `${raw.timestamp}-${raw.pid}-${raw.tid}`,
+          timestamp: new Date(raw.timestamp * 1000).toISOString(),
+          pid: raw.pid,
+          uid: raw.uid,
+          containerName: raw.workload?.pod_name || raw.workload?.container_name || raw.container_id || 'host',
+          eventType: raw.event_type,
+          severity: raw.severity,
+          message: raw.description,
+          details: raw
+        };
         setEvents(prev => [event, ...prev.slice(0, 99)]); // 保持最新100条
         updateStats(event);
       });
 
-      socket.on('monitor_stats', (newStats: MonitorStats) => {
-        setStats(newStats);
-      });
-
       // 实时数据更新
       const interval = setInterval(async () => {
         try {
@@ -170,7 +176,7 @@ const Monitor: React.FC = () => {
       }, 2000);
 
       return () => {
-        socket.disconnect();
+        socket.close();
         clearInterval(interval);
       };
     }
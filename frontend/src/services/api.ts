@@ -205,9 +205,18 @@ export const reportsAPI = {
   },
 };
 
-// WebSocket连接
-export const createWebSocketConnection = (onMessage: (data: any) => void) => {
-  const wsUrl = API_BASE_URL.replace('http', 'ws').replace('/api/v1', '/ws');
+// WebSocket连接，浏览器无法为WebSocket设置请求头，令牌通过查询参数传递。
+// filters 对应后端的 severity、min_severity、type、container 过滤参数
+export const createWebSocketConnection = (
+  onMessage: (data: any) => void,
+  filters: Record<string, string> = {}
+) => {
+  const params = new URLSearchParams(filters);
+  const token = localStorage.getItem('token');
+  if (token) {
+    params.set('token', token);
+  }
+  const wsUrl = `${API_BASE_URL.replace('http', 'ws').replace('/api/v1', '/ws')}?${params.toString()}`;
   const ws = new WebSocket(wsUrl);
   
   ws.onopen = () => {
@@ -227,8 +236,8 @@ export const createWebSocketConnection = (onMessage: (data: any) => void) => {
     console.error('WebSocket错误:', error);
   };
   
-  ws.onclose = () => {
-    console.log('WebSocket连接已关闭');
+  ws.onclose = (event) => {
+    console.log('WebSocket连接已关闭', event.reason);
   };
   
   return ws;
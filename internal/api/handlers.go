@@ -1,22 +1,29 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"cloudsecops/internal/attack"
 	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/compliance"
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/eventstore"
 	"cloudsecops/internal/iac"
 	"cloudsecops/internal/remediation"
 	"cloudsecops/pkg/auth"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 )
 
 // 认证相关处理器
@@ -50,7 +57,7 @@ func loginHandler(deps *Dependencies) gin.HandlerFunc {
 		}
 
 		// 生成JWT令牌
-		token, err := deps.Auth.GenerateToken("1", req.Username, []string{"admin"}, 24*time.Hour)
+		token, err := deps.Auth.GenerateToken("1", req.Username, []string{auth.RoleAdmin}, 24*time.Hour)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 			return
@@ -99,16 +106,39 @@ func authMiddleware(authService *auth.Service) gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("roles", claims.Roles)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
+// requireRole 要求已认证的用户具有指定角色，需在认证中间件之后使用
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("claims")
+		claims, ok := value.(*auth.Claims)
+		if !ok || !claims.HasRole(role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Role %s required", role)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireAdmin 要求管理员角色
+func requireAdmin() gin.HandlerFunc {
+	return requireRole(auth.RoleAdmin)
+}
+
 // IaC扫描处理器
 
 // ScanRequest 扫描请求
 type ScanRequest struct {
-	Path     string `json:"path" binding:"required"`
-	ScanType string `json:"scan_type"` // "file" or "directory"
+	Path       string `json:"path"`
+	ScanType   string `json:"scan_type"`  // "file", "directory" or "git"
+	Repository string `json:"repository"` // Git仓库地址，scan_type为git时必填
+	Ref        string `json:"ref"`        // 分支、标签或提交SHA
+	Subdir     string `json:"subdir"`     // 仓库内需要扫描的子目录
 }
 
 // iacScanHandler IaC扫描处理器
@@ -120,6 +150,16 @@ func iacScanHandler(deps *Dependencies) gin.HandlerFunc {
 			return
 		}
 
+		if req.ScanType == "git" {
+			if req.Repository == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Repository is required for git scans"})
+				return
+			}
+		} else if req.Path == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Path is required"})
+			return
+		}
+
 		// 创建扫描器
 		scanner := iac.NewScanner()
 
@@ -127,9 +167,18 @@ func iacScanHandler(deps *Dependencies) gin.HandlerFunc {
 		var err error
 
 		// 根据扫描类型执行扫描
-		if req.ScanType == "directory" {
+		switch req.ScanType {
+		case "git":
+			src := iac.GitSource{URL: req.Repository, Ref: req.Ref, Subdir: req.Subdir}
+			result, err = scanner.ScanGitRepository(c.Request.Context(), src, iac.GitOptionsFromConfig(deps.Config.IaC))
+			if err != nil {
+				deps.Logger.WithError(err).Warn("Git repository scan failed")
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		case "directory":
 			result, err = scanner.ScanDirectory(req.Path)
-		} else {
+		default:
 			// 检查文件是否存在
 			if _, statErr := os.Stat(req.Path); os.IsNotExist(statErr) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "File not found"})
@@ -143,10 +192,17 @@ func iacScanHandler(deps *Dependencies) gin.HandlerFunc {
 			return
 		}
 
+		saveScan(deps, result)
 		c.JSON(http.StatusOK, result)
 	}
 }
 
+// saveScan 标注合规控制项并保存扫描结果
+func saveScan(deps *Dependencies, result *iac.ScanResult) {
+	compliance.DefaultCatalog().AnnotateScan(result)
+	deps.Scans.Save(result)
+}
+
 // getScanResultHandler 获取扫描结果处理器
 func getScanResultHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -156,14 +212,13 @@ func getScanResultHandler(deps *Dependencies) gin.HandlerFunc {
 			return
 		}
 
-		// TODO: 从数据库获取扫描结果
-		// 这里返回模拟数据
-		c.JSON(http.StatusOK, gin.H{
-			"id":        scanID,
-			"status":    "completed",
-			"timestamp": time.Now(),
-			"findings":  []interface{}{},
-		})
+		result, ok := deps.Scans.Get(scanID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scan not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
 	}
 }
 
@@ -185,229 +240,1071 @@ func listScansHandler(deps *Dependencies) gin.HandlerFunc {
 			}
 		}
 
-		// TODO: 从数据库获取扫描历史
-		// 这里返回模拟数据
-		scans := []gin.H{
-			{
-				"id":         "scan_001",
-				"path":       "/path/to/config",
-				"type":       "terraform",
-				"status":     "completed",
-				"timestamp":  time.Now().Add(-time.Hour),
-				"findings":   15,
-				"critical":   2,
-				"high":       5,
-				"medium":     6,
-				"low":        2,
-			},
-			{
-				"id":         "scan_002",
-				"path":       "/path/to/k8s",
-				"type":       "kubernetes",
-				"status":     "completed",
-				"timestamp":  time.Now().Add(-2*time.Hour),
-				"findings":   8,
-				"critical":   1,
-				"high":       3,
-				"medium":     3,
-				"low":        1,
-			},
+		results, total := deps.Scans.List(limit, offset)
+		scans := make([]gin.H, 0, len(results))
+		for _, result := range results {
+			scans = append(scans, gin.H{
+				"id":         result.ID,
+				"path":       result.FilePath,
+				"type":       result.FileType,
+				"status":     result.Status,
+				"timestamp":  result.Timestamp,
+				"commit_sha": result.CommitSHA,
+				"findings":   result.Summary.TotalFindings,
+				"critical":   result.Summary.Critical,
+				"high":       result.Summary.High,
+				"medium":     result.Summary.Medium,
+				"low":        result.Summary.Low,
+			})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"scans":  scans,
-			"total":  len(scans),
+			"total":  total,
 			"limit":  limit,
 			"offset": offset,
 		})
 	}
 }
 
-// uploadConfigHandler 上传配置文件
+// scanDiffHandler 比较两次扫描的差异处理器。
+// base/head 默认为扫描ID；指定 repository 时视为同一仓库的两个Git引用
+func scanDiffHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		baseID := c.Query("base")
+		headID := c.Query("head")
+		if baseID == "" || headID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Both base and head are required"})
+			return
+		}
+
+		failOn := c.Query("fail_on")
+		if failOn != "" && !iac.ValidSeverity(failOn) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fail_on severity"})
+			return
+		}
+
+		var diff *iac.DiffResult
+		if repository := c.Query("repository"); repository != "" {
+			scanner := iac.NewScanner()
+			var base, head *iac.ScanResult
+			var err error
+			diff, base, head, err = scanner.DiffGitRefs(c.Request.Context(), repository, baseID, headID,
+				c.Query("subdir"), iac.GitOptionsFromConfig(deps.Config.IaC))
+			if err != nil {
+				deps.Logger.WithError(err).Warn("Git diff scan failed")
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			saveScan(deps, base)
+			saveScan(deps, head)
+		} else {
+			base, ok := deps.Scans.Get(baseID)
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Base scan not found"})
+				return
+			}
+			head, ok := deps.Scans.Get(headID)
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Head scan not found"})
+				return
+			}
+			diff = iac.DiffResults(base, head)
+		}
+
+		response := gin.H{"diff": diff}
+		if failOn != "" {
+			blocking := diff.NewAtOrAbove(failOn)
+			response["gate"] = gin.H{
+				"fail_on":  failOn,
+				"passed":   len(blocking) == 0,
+				"blocking": len(blocking),
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// unsafeFilenameChars 上传文件名中不允许的字符
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// sanitizeFilename 清理客户端提供的文件名，只保留基础名中的安全字符
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimLeft(unsafeFilenameChars.ReplaceAllString(name, "_"), ".")
+	if name == "" {
+		name = "upload"
+	}
+	return name
+}
+
+// uploadConfigHandler 上传配置文件或项目归档（zip/tar.gz）并直接扫描
 func uploadConfigHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		maxUpload := int64(deps.Config.IaC.MaxUploadMB) << 20
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUpload)
+
 		file, header, err := c.Request.FormFile("file")
 		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload exceeds size limit"})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 			return
 		}
 		defer file.Close()
 
 		// 检查文件类型
-		filename := header.Filename
-		ext := filepath.Ext(filename)
-		if ext != ".tf" && ext != ".yaml" && ext != ".yml" {
+		filename := sanitizeFilename(header.Filename)
+		format := iac.ArchiveFormat(filename)
+		ext := strings.ToLower(filepath.Ext(filename))
+		if format == "" && ext != ".tf" && ext != ".yaml" && ext != ".yml" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file type"})
 			return
 		}
 
-		// 创建临时文件
-		tempDir := "/tmp/cloudsecops-uploads"
-		os.MkdirAll(tempDir, 0755)
-		tempFile := filepath.Join(tempDir, fmt.Sprintf("%d_%s", time.Now().Unix(), filename))
-
-		// 保存文件
-		out, err := os.Create(tempFile)
+		// 为本次上传创建独立工作区
+		uploadID, workspace, err := deps.Workspaces.Create("upload-")
 		if err != nil {
+			deps.Logger.WithError(err).Error("Failed to create upload workspace")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 			return
 		}
-		defer out.Close()
 
-		// 复制文件内容
-		if _, err := file.Seek(0, 0); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		// 保存上传内容，文件名由服务端决定
+		savedPath := filepath.Join(workspace, "upload"+ext)
+		if format != "" {
+			savedPath = filepath.Join(workspace, "archive")
+		}
+		if err := saveUpload(file, savedPath); err != nil {
+			deps.Workspaces.Remove(uploadID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 			return
 		}
 
-		buf := make([]byte, 1024)
-		for {
-			n, err := file.Read(buf)
-			if n > 0 {
-				out.Write(buf[:n])
-			}
+		scanner := iac.NewScanner()
+		var result *iac.ScanResult
+		var stats *iac.ExtractStats
+
+		if format != "" {
+			srcDir := filepath.Join(workspace, "src")
+			stats, err = iac.ExtractArchive(savedPath, format, srcDir, iac.ArchiveLimitsFromConfig(deps.Config.IaC))
+			os.Remove(savedPath)
 			if err != nil {
-				break
+				deps.Workspaces.Remove(uploadID)
+				deps.Logger.WithError(err).WithField("filename", filename).Warn("Rejected uploaded archive")
+				status := http.StatusBadRequest
+				if errors.Is(err, iac.ErrArchiveLimit) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
 			}
+			result, err = scanner.ScanDirectory(srcDir)
+			if err == nil {
+				result.FileType = "archive"
+			}
+		} else {
+			result, err = scanner.ScanFile(savedPath)
+		}
+
+		if err != nil {
+			deps.Workspaces.Remove(uploadID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
+		result.FilePath = filename
+		result.UploadID = uploadID
+		saveScan(deps, result)
+
 		c.JSON(http.StatusOK, gin.H{
-			"message":  "File uploaded successfully",
-			"filename": filename,
-			"path":     tempFile,
+			"message":   "File uploaded and scanned successfully",
+			"upload_id": uploadID,
+			"filename":  filename,
+			"extracted": stats,
+			"result":    result,
 		})
 	}
 }
 
+// saveUpload 将上传内容写入服务端指定的路径
+func saveUpload(src io.Reader, path string) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // eBPF监控处理器
 
 // monitorStatusHandler 监控状态处理器
 func monitorStatusHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"status":  "running",
-			"running": deps.EBPFMonitor.IsRunning(),
+			"status":    "running",
+			"running":   deps.EBPFMonitor.IsRunning(),
+			"stats":     deps.EBPFMonitor.Stats(),
+			"source":    deps.EBPFMonitor.SourceStatus(),
+			"workloads": deps.EBPFMonitor.WorkloadStatus(),
+			"storage":   eventStoreStats(deps),
+			"recording": deps.EBPFMonitor.Recording(),
+			"replay":    deps.EBPFMonitor.Replay(),
 		})
 	}
 }
 
-// getEventsHandler 获取事件处理器
+// eventStoreStats 返回事件存储统计，未启用时仅返回 enabled=false
+func eventStoreStats(deps *Dependencies) eventstore.Stats {
+	if deps.Events == nil {
+		return eventstore.Stats{}
+	}
+	return deps.Events.Stats()
+}
+
+// getEventsHandler 查询已存储的监控事件，按时间倒序返回，使用 next_cursor 翻页
 func getEventsHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		limitStr := c.DefaultQuery("limit", "100")
-		limit, _ := strconv.Atoi(limitStr)
-		
-		events := []gin.H{}
-		for i := 0; i < limit && i < 10; i++ {
-			events = append(events, gin.H{
-				"id":        i + 1,
-				"timestamp": time.Now().Unix(),
-				"type":      "syscall",
-				"severity":  "medium",
-			})
+		if deps.Events == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event store is disabled"})
+			return
+		}
+
+		query, err := eventQueryFromRequest(c)
+		if err == nil {
+			err = query.Validate()
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		page, err := deps.Events.Query(c.Request.Context(), query)
+		if err != nil {
+			deps.Logger.Errorf("Failed to query monitor events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"events":      page.Events,
+			"count":       len(page.Events),
+			"next_cursor": page.NextCursor,
+		})
+	}
+}
+
+// eventQueryFromRequest 从查询参数解析事件查询条件：
+// since、until 为 RFC3339 时间、Unix 秒或相对当前的时长（如 1h），
+// severity、type、container、pid 为逗号分隔的列表，q 为文本搜索
+func eventQueryFromRequest(c *gin.Context) (eventstore.Query, error) {
+	query := eventstore.Query{
+		MinSeverity: c.Query("min_severity"),
+		Severities:  splitQuery(c.Query("severity")),
+		Types:       splitQuery(c.Query("type")),
+		Containers:  splitQuery(c.Query("container")),
+		Text:        strings.TrimSpace(c.Query("q")),
+		Cursor:      c.Query("cursor"),
+	}
+
+	var err error
+	if query.Since, err = parseTimeParam(c.Query("since")); err != nil {
+		return query, fmt.Errorf("invalid since: %w", err)
+	}
+	if query.Until, err = parseTimeParam(c.Query("until")); err != nil {
+		return query, fmt.Errorf("invalid until: %w", err)
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %s", limit)
+		}
+	}
+	for _, value := range splitQuery(c.Query("pid")) {
+		pid, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return query, fmt.Errorf("invalid pid: %s", value)
+		}
+		query.PIDs = append(query.PIDs, uint32(pid))
+	}
+	return query, nil
+}
+
+// parseTimeParam 解析时间参数，空值返回零值
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("expected RFC3339 time, unix seconds or duration: %s", value)
+}
+
+// getEventRollupsHandler 查询降采样后的每小时事件计数，默认返回最近24小时
+func getEventRollupsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deps.Events == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event store is disabled"})
+			return
+		}
+
+		since, err := parseTimeParam(c.DefaultQuery("since", "24h"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+			return
+		}
+		until, err := parseTimeParam(c.Query("until"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+			return
+		}
+		if until.IsZero() {
+			until = time.Now()
+		}
+
+		rollups, err := deps.Events.Rollups(c.Request.Context(), since, until)
+		if err != nil {
+			deps.Logger.Errorf("Failed to query event rollups: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query event rollups"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rollups": rollups, "total": len(rollups)})
+	}
+}
+
+// containerProcessTreeHandler 返回容器内的进程树，id 可以是容器ID前缀
+func containerProcessTreeHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if len(id) < 4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "container id must be at least 4 characters"})
+			return
+		}
+
+		tree, ok := deps.EBPFMonitor.ProcessTree(id)
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Process tracking requires the kernel event source"})
+			return
+		}
+		if len(tree) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No processes found for container"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"container_id": id,
+			"processes":    tree,
+		})
+	}
+}
+
+// getFlowsHandler 查询网络流，按最近活动时间倒序
+func getFlowsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := ebpf.FlowQuery{
+			Container: c.Query("container"),
+			Protocol:  c.Query("protocol"),
+			Direction: c.Query("direction"),
+		}
+		if value := c.Query("internal"); value != "" {
+			internal, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid internal: " + value})
+				return
+			}
+			query.Internal = &internal
+		}
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + value})
+				return
+			}
+			query.Limit = limit
+		}
+		if err := query.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		flows, total := deps.EBPFMonitor.Flows(query)
+		c.JSON(http.StatusOK, gin.H{
+			"flows": flows,
+			"total": total,
+		})
+	}
+}
+
+// getKernelFilterHandler 返回内核侧事件过滤配置
+func getKernelFilterHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"filter": deps.EBPFMonitor.KernelFilter(),
+			"stats":  deps.EBPFMonitor.Stats().KernelFilter,
+		})
+	}
+}
+
+// updateKernelFilterHandler 替换内核侧事件过滤配置，内核事件源运行中时立即生效
+func updateKernelFilterHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter config.KernelFilterConfig
+		if err := c.ShouldBindJSON(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+		filter, err := ebpf.NormalizeKernelFilter(filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := deps.EBPFMonitor.SetKernelFilter(filter); err != nil {
+			deps.Logger.Errorf("Failed to update kernel filter: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update kernel filter"})
+			return
 		}
-		
-		c.JSON(http.StatusOK, gin.H{"events": events})
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Kernel filter updated",
+			"filter":  deps.EBPFMonitor.KernelFilter(),
+		})
 	}
 }
 
-// streamEventsHandler 事件流处理器
-func streamEventsHandler(deps *Dependencies) gin.HandlerFunc {
+// getIntegrityHandler 返回文件完整性监视状态和内容已漂移的文件
+func getIntegrityHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{"message": "WebSocket streaming not implemented yet"})
+		c.JSON(http.StatusOK, deps.EBPFMonitor.Integrity())
+	}
+}
+
+// acceptIntegrityBaselineHandler 将已漂移文件的当前内容接受为新基线，未指定路径时接受全部
+func acceptIntegrityBaselineHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ContainerID string `json:"container_id"`
+			Path        string `json:"path"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+				return
+			}
+		}
+
+		accepted := deps.EBPFMonitor.AcceptIntegrityBaseline(req.ContainerID, req.Path)
+		c.JSON(http.StatusOK, gin.H{
+			"accepted":  accepted,
+			"integrity": deps.EBPFMonitor.Integrity(),
+		})
+	}
+}
+
+// listRecordingsHandler 列出录制文件，同时返回正在进行的录制和回放
+func listRecordingsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		captures, err := deps.EBPFMonitor.Recordings()
+		if err != nil {
+			deps.Logger.Errorf("Failed to list recordings: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list recordings"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"recordings": captures,
+			"total":      len(captures),
+			"active":     deps.EBPFMonitor.Recording(),
+			"replay":     deps.EBPFMonitor.Replay(),
+		})
+	}
+}
+
+// startRecordingHandler 开始录制监控事件，可指定录制时长（秒）和事件数上限
+func startRecordingHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Name      string `json:"name"`
+			Duration  int    `json:"duration"`
+			MaxEvents uint64 `json:"max_events"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+				return
+			}
+		}
+		if request.Duration < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration must not be negative"})
+			return
+		}
+
+		info, err := deps.EBPFMonitor.StartRecording(ebpf.RecordingOptions{
+			Name:      request.Name,
+			Duration:  time.Duration(request.Duration) * time.Second,
+			MaxEvents: request.MaxEvents,
+		})
+		if errors.Is(err, ebpf.ErrRecordingActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			deps.Logger.Errorf("Failed to start recording: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start recording"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message":   "Recording started",
+			"recording": info,
+		})
+	}
+}
+
+// stopRecordingHandler 停止当前录制
+func stopRecordingHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, err := deps.EBPFMonitor.StopRecording()
+		if errors.Is(err, ebpf.ErrNotRecording) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			deps.Logger.Errorf("Failed to stop recording: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop recording"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Recording stopped",
+			"recording": info,
+		})
+	}
+}
+
+// downloadRecordingHandler 下载录制文件
+func downloadRecordingHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		path, err := deps.EBPFMonitor.CapturePath(id)
+		if err != nil {
+			c.JSON(captureErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.FileAttachment(path, filepath.Base(path))
+	}
+}
+
+// replayRecordingHandler 将录制文件送入监控处理流程，speed 默认为 1 即原始速度，0 表示尽快回放
+func replayRecordingHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Speed *float64 `json:"speed"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+				return
+			}
+		}
+		speed := 1.0
+		if request.Speed != nil {
+			speed = *request.Speed
+		}
+		if speed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "speed must not be negative"})
+			return
+		}
+
+		status, err := deps.EBPFMonitor.ReplayCapture(c.Param("id"), speed)
+		if err != nil {
+			c.JSON(captureErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Capture replay started",
+			"replay":  status,
+		})
+	}
+}
+
+// getReplayHandler 返回最近一次录制回放的状态
+func getReplayHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"replay": deps.EBPFMonitor.Replay()})
+	}
+}
+
+// stopReplayHandler 停止正在进行的录制回放
+func stopReplayHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := deps.EBPFMonitor.StopReplay(); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Capture replay stopped",
+			"replay":  deps.EBPFMonitor.Replay(),
+		})
+	}
+}
+
+// captureErrorStatus 将录制相关的错误映射为HTTP状态码
+func captureErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ebpf.ErrInvalidCaptureID):
+		return http.StatusBadRequest
+	case errors.Is(err, ebpf.ErrCaptureNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ebpf.ErrRecordingActive), errors.Is(err, ebpf.ErrReplayActive):
+		return http.StatusConflict
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// listProfilesHandler 列出工作负载行为画像的概要
+func listProfilesHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profiles := deps.EBPFMonitor.Profiles()
+		c.JSON(http.StatusOK, gin.H{
+			"profiles": profiles,
+			"total":    len(profiles),
+		})
+	}
+}
+
+// getProfileHandler 返回行为画像的全部项
+func getProfileHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := deps.EBPFMonitor.Profile(c.Param("id"))
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// updateProfileHandler 替换行为画像的项，请求中未出现的类别保持不变
+func updateProfileHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var update ebpf.ProfileUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+		profile, err := deps.EBPFMonitor.UpdateProfile(c.Param("id"), update)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Profile updated",
+			"profile": profile,
+		})
+	}
+}
+
+// lockProfileHandler 立即锁定行为画像
+func lockProfileHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := deps.EBPFMonitor.LockProfile(c.Param("id"))
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Profile locked",
+			"profile": profile,
+		})
+	}
+}
+
+// relearnProfileHandler 让行为画像重新进入学习期，window 为学习期秒数，reset 为true时清空已学习的项
+func relearnProfileHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Window int  `json:"window"`
+			Reset  bool `json:"reset"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+				return
+			}
+		}
+		if request.Window < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must not be negative"})
+			return
+		}
+
+		profile, err := deps.EBPFMonitor.RelearnProfile(c.Param("id"), time.Duration(request.Window)*time.Second, request.Reset)
+		if err != nil {
+			c.JSON(profileErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Profile learning restarted",
+			"profile": profile,
+		})
+	}
+}
+
+// deleteProfileHandler 删除行为画像
+func deleteProfileHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := deps.EBPFMonitor.DeleteProfile(c.Param("id")); err != nil {
+			if errors.Is(err, ebpf.ErrProfileNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			deps.Logger.Errorf("Failed to delete profile: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete profile"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Profile deleted"})
+	}
+}
+
+// profileErrorStatus 将行为画像错误映射为HTTP状态码，其余错误为无效的项
+func profileErrorStatus(err error) int {
+	if errors.Is(err, ebpf.ErrProfileNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// listDetectionRulesHandler 检测规则列表处理器
+func listDetectionRulesHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := deps.Detection.Rules()
+		c.JSON(http.StatusOK, gin.H{
+			"rules": rules,
+			"total": len(rules),
+		})
+	}
+}
+
+// reloadDetectionRulesHandler 重新加载检测规则处理器，规则有误时保留原有规则
+func reloadDetectionRulesHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := deps.Detection.Reload(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Detection rules reloaded",
+			"total":   len(deps.Detection.Rules()),
+		})
+	}
+}
+
+// listConnectionBlocksHandler 列出内核中的连接阻断项
+func listConnectionBlocksHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		blocks, err := deps.EBPFMonitor.BlockedConnections()
+		if err != nil {
+			c.JSON(blockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"blocks": blocks,
+			"total":  len(blocks),
+		})
+	}
+}
+
+// createConnectionBlockHandler 手动添加连接阻断项
+func createConnectionBlockHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var block ebpf.ConnectionBlock
+		if err := c.ShouldBindJSON(&block); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+		if err := deps.EBPFMonitor.BlockConnection(block); err != nil {
+			c.JSON(blockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Connection blocked",
+			"block":   block,
+		})
+	}
+}
+
+// deleteConnectionBlockHandler 删除连接阻断项，恢复被阻断的连接
+func deleteConnectionBlockHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var block ebpf.ConnectionBlock
+		if err := c.ShouldBindJSON(&block); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			return
+		}
+		if err := deps.EBPFMonitor.UnblockConnection(block); err != nil {
+			c.JSON(blockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Connection unblocked"})
+	}
+}
+
+// blockErrorStatus 将连接阻断错误映射为HTTP状态码，其余错误为无效的阻断项
+func blockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ebpf.ErrBlockingUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ebpf.ErrBlockNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// 响应动作处理器
+
+// getResponseStatusHandler 返回响应动作状态和当前绑定
+func getResponseStatusHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deps.Response == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Response actions are disabled"})
+			return
+		}
+		c.JSON(http.StatusOK, deps.Response.Status())
+	}
+}
+
+// listResponseActionsHandler 返回最近的响应动作审计记录，支持按 rule 和 status 过滤
+func listResponseActionsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deps.Response == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Response actions are disabled"})
+			return
+		}
+		limit := 100
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = parsed
+		}
+
+		records := deps.Response.Records(c.Query("rule"), c.Query("status"), limit)
+		c.JSON(http.StatusOK, gin.H{
+			"actions": records,
+			"total":   len(records),
+		})
+	}
+}
+
+// setResponseDryRunHandler 切换模拟执行模式，关闭后绑定的动作会真正执行
+func setResponseDryRunHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deps.Response == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Response actions are disabled"})
+			return
+		}
+		var request struct {
+			DryRun *bool `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.DryRun == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run is required"})
+			return
+		}
+
+		deps.Response.SetDryRun(*request.DryRun, c.GetString("username"))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Response mode updated",
+			"dry_run": *request.DryRun,
+		})
+	}
+}
+
+// reloadResponsePolicyHandler 重新加载响应绑定文件，文件有误时保留原有绑定
+func reloadResponsePolicyHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deps.Response == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Response actions are disabled"})
+			return
+		}
+		if err := deps.Response.Reload(c.GetString("username")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Response policy reloaded",
+			"bindings": deps.Response.Status().Bindings,
+		})
 	}
 }
 
 // 攻击链分析处理器
 
-// analyzeAttackChainHandler 分析攻击链处理器
+// analyzeAttackChainHandler 分析攻击链处理器。攻击图由指定扫描结果中的IaC发现、
+// 请求中的发现和云资源、已配置云提供商的资源清单以及资源关系构建
 func analyzeAttackChainHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var request struct {
-			Name string `json:"name"`
-			Type string `json:"type"` // full, quick, targeted
+			Name          string                `json:"name"`
+			Type          string                `json:"type"` // full, quick, targeted
+			ScanIDs       []string              `json:"scan_ids"`
+			Cloud         bool                  `json:"cloud"`
+			Findings      []iac.Finding         `json:"findings"`
+			Resources     []cloud.Resource      `json:"resources"`
+			Relationships []attack.Relationship `json:"relationships"`
+			TopK          int                   `json:"top_k"`     // 返回的路径数，默认5
+			MaxDepth      int                   `json:"max_depth"` // 路径最多包含的节点数，不超过配置的上限
+			ChokePoints   bool                  `json:"choke_points"`
+			IncludeGraph  bool                  `json:"include_graph"`
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 			return
 		}
+		if len(request.ScanIDs) == 0 && !request.Cloud && len(request.Findings) == 0 && len(request.Resources) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one of scan_ids, findings, resources or cloud is required"})
+			return
+		}
+		attackCfg := deps.Config.Attack
+		if request.TopK < 0 || (attackCfg.MaxTopK > 0 && request.TopK > attackCfg.MaxTopK) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("top_k must be between 1 and %d", attackCfg.MaxTopK)})
+			return
+		}
+		if request.MaxDepth < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_depth must not be negative"})
+			return
+		}
+		if attackCfg.MaxDepth > 0 && (request.MaxDepth == 0 || request.MaxDepth > attackCfg.MaxDepth) {
+			request.MaxDepth = attackCfg.MaxDepth
+		}
 
 		if request.Name == "" {
 			request.Name = fmt.Sprintf("攻击链分析 %s", time.Now().Format("15:04:05"))
 		}
 
-		// 创建攻击链分析器
+		input := attack.GraphInput{
+			Findings:      request.Findings,
+			Resources:     request.Resources,
+			Relationships: request.Relationships,
+		}
+		for _, id := range request.ScanIDs {
+			result, ok := deps.Scans.Get(id)
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan result %s not found", id)})
+				return
+			}
+			for _, finding := range result.Findings {
+				if finding.FilePath == "" {
+					finding.FilePath = result.FilePath
+				}
+				input.Findings = append(input.Findings, finding)
+			}
+		}
+		if request.Cloud {
+			resources, err := cloud.NewService(deps.Config, deps.Logger).GetAllResources(c.Request.Context())
+			if err != nil {
+				deps.Logger.WithError(err).Error("获取云资源失败")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取云资源失败"})
+				return
+			}
+			for _, provider := range []cloud.CloudProvider{cloud.AWS, cloud.Azure} {
+				input.Resources = append(input.Resources, resources[provider]...)
+			}
+		}
+
+		// 构建攻击图并执行分析
 		analyzer := attack.NewChainAnalyzer(deps.Logger)
-		analyzer.LoadSampleData()
+		analyzer.Build(input)
+		graph := analyzer.Graph()
 
-		// 执行分析
-		chain := analyzer.AnalyzeChain(request.Name)
+		ctx := c.Request.Context()
+		if attackCfg.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(attackCfg.Timeout)*time.Second)
+			defer cancel()
+		}
+		chain, err := analyzer.AnalyzeChain(ctx, request.Name, attack.PathOptions{MaxDepth: request.MaxDepth, MaxPaths: request.TopK})
+		if err == nil && chain != nil && request.ChokePoints {
+			chain.ChokePoints, err = graph.AnalyzeChokePoints(ctx, attack.PathOptions{MaxDepth: request.MaxDepth})
+		}
+		if err != nil {
+			deps.Logger.WithError(err).Warn("攻击链分析未完成")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Attack chain analysis did not finish in time, retry with a smaller max_depth or top_k"})
+			return
+		}
 		if chain == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze attack chain"})
+			response := gin.H{"error": "No attack path from an entry point to sensitive data"}
+			if request.IncludeGraph {
+				response["graph"] = gin.H{"nodes": graph.Nodes(), "edges": graph.Edges()}
+			}
+			c.JSON(http.StatusUnprocessableEntity, response)
 			return
 		}
+		deps.Chains.Save(chain)
 
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"message":     "Attack chain analysis completed",
 			"analysis_id": chain.ID,
 			"chain":       chain,
-		})
+		}
+		if request.IncludeGraph {
+			response["graph"] = gin.H{"nodes": graph.Nodes(), "edges": graph.Edges()}
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
 // getAttackChainHandler 获取攻击链处理器
 func getAttackChainHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		chainID := c.Param("id")
-		
-		// 创建分析器并加载数据
-		analyzer := attack.NewChainAnalyzer(deps.Logger)
-		analyzer.LoadSampleData()
-		
-		// 生成示例攻击链
-		chain := analyzer.AnalyzeChain("示例攻击链")
-		if chain == nil {
+		chain, ok := deps.Chains.Get(c.Param("id"))
+		if !ok {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Attack chain not found"})
 			return
 		}
-		
-		// 设置正确的ID
-		chain.ID = chainID
 		c.JSON(http.StatusOK, chain)
 	}
 }
 
-// listAttackChainsHandler 列出攻击链处理器
+// listAttackChainsHandler 列出攻击链处理器，按分析时间倒序
 func listAttackChainsHandler(deps *Dependencies) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 创建分析器并加载示例数据
-		analyzer := attack.NewChainAnalyzer(deps.Logger)
-		analyzer.LoadSampleData()
-		
-		// 生成示例攻击链列表
-		chains := []gin.H{
-			{
-				"id":          "chain_001",
-				"name":        "云环境横向移动攻击链",
-				"severity":    "high",
-				"status":      "active",
-				"created_at":  time.Now().Add(-2*time.Hour),
-				"steps_count": 5,
-			},
-			{
-				"id":          "chain_002",
-				"name":        "权限提升攻击链",
-				"severity":    "critical",
-				"status":      "completed",
-				"created_at":  time.Now().Add(-4*time.Hour),
-				"steps_count": 3,
-			},
-		}
-		
+		limit, offset := 50, 0
+		if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+			offset = o
+		}
+
+		stored, total := deps.Chains.List(limit, offset)
+		chains := make([]gin.H, 0, len(stored))
+		for _, chain := range stored {
+			chains = append(chains, gin.H{
+				"id":          chain.ID,
+				"name":        chain.Name,
+				"risk_score":  chain.RiskScore,
+				"status":      chain.Status,
+				"created_at":  chain.CreatedAt,
+				"steps_count": chain.Summary.TotalSteps,
+			})
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"chains": chains,
-			"total":  len(chains),
+			"total":  total,
 		})
 	}
 }
@@ -540,6 +1437,7 @@ func getAWSResourcesHandler(deps *Dependencies) gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取AWS资源失败"})
 				return
 			}
+			compliance.DefaultCatalog().AnnotateResources(resources)
 			c.JSON(http.StatusOK, gin.H{"resources": resources})
 		} else {
 			// 获取所有AWS资源
@@ -549,6 +1447,7 @@ func getAWSResourcesHandler(deps *Dependencies) gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取云资源失败"})
 				return
 			}
+			compliance.DefaultCatalog().AnnotateResources(allResources[cloud.AWS])
 			c.JSON(http.StatusOK, gin.H{"resources": allResources[cloud.AWS]})
 		}
 	}
@@ -571,6 +1470,7 @@ func getAzureResourcesHandler(deps *Dependencies) gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取Azure资源失败"})
 				return
 			}
+			compliance.DefaultCatalog().AnnotateResources(resources)
 			c.JSON(http.StatusOK, gin.H{"resources": resources})
 		} else {
 			// 获取所有Azure资源
@@ -580,6 +1480,7 @@ func getAzureResourcesHandler(deps *Dependencies) gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取云资源失败"})
 				return
 			}
+			compliance.DefaultCatalog().AnnotateResources(allResources[cloud.Azure])
 			c.JSON(http.StatusOK, gin.H{"resources": allResources[cloud.Azure]})
 		}
 	}
@@ -688,6 +1589,69 @@ func exportResourcesHandler(deps *Dependencies) gin.HandlerFunc {
 	}
 }
 
+// 合规处理器
+
+// listComplianceFrameworksHandler 列出合规框架及控制项处理器
+func listComplianceFrameworksHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		catalog := compliance.DefaultCatalog()
+
+		frameworks := []gin.H{}
+		for _, framework := range catalog.Frameworks() {
+			frameworks = append(frameworks, gin.H{
+				"framework": framework,
+				"controls":  catalog.Controls(framework),
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"frameworks": frameworks})
+	}
+}
+
+// getComplianceReportHandler 计算合规控制项通过情况处理器。
+// 默认使用每个扫描目标最新的扫描结果，也可通过 scans=id1,id2 指定。
+// 云资源清单目前为模拟数据，仅在 include_cloud=true 时纳入评估
+func getComplianceReportHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		framework, ok := compliance.ParseFramework(c.Query("framework"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or missing framework"})
+			return
+		}
+
+		var scans []*iac.ScanResult
+		if ids := c.Query("scans"); ids != "" {
+			for _, id := range strings.Split(ids, ",") {
+				result, found := deps.Scans.Get(strings.TrimSpace(id))
+				if !found {
+					c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Scan not found: %s", id)})
+					return
+				}
+				scans = append(scans, result)
+			}
+		} else {
+			scans, _ = deps.Scans.List(0, 0)
+		}
+
+		var resources []cloud.Resource
+		if c.Query("include_cloud") == "true" {
+			cloudService := cloud.NewService(deps.Config, deps.Logger)
+			allResources, err := cloudService.GetAllResources(c.Request.Context())
+			if err != nil {
+				deps.Logger.WithError(err).Error("获取云资源失败")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取云资源失败"})
+				return
+			}
+			for _, provider := range []cloud.CloudProvider{cloud.AWS, cloud.Azure} {
+				resources = append(resources, allResources[provider]...)
+			}
+		}
+
+		report := compliance.DefaultCatalog().Evaluate(framework, scans, resources)
+		c.JSON(http.StatusOK, report)
+	}
+}
+
 // 报告和可视化处理器
 
 // getDashboardDataHandler 获取仪表盘数据处理器
@@ -716,34 +1680,3 @@ func getMetricsHandler(deps *Dependencies) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"metrics": gin.H{}})
 	}
 }
-
-// WebSocket处理器
-
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 在生产环境中应该检查来源
-	},
-}
-
-// websocketHandler WebSocket处理器
-func websocketHandler(deps *Dependencies) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade connection"})
-			return
-		}
-		defer conn.Close()
-
-		// 简单的WebSocket回显
-		for {
-			messageType, message, err := conn.ReadMessage()
-			if err != nil {
-				break
-			}
-			if err := conn.WriteMessage(messageType, message); err != nil {
-				break
-			}
-		}
-	}
-}
\ No newline at end of file
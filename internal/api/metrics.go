@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"cloudsecops/internal/ebpf"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsContentType Prometheus 文本格式
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// pipelineSeverities 丢弃计数输出的严重程度，从高到低
+var pipelineSeverities = []string{"critical", "high", "medium", "low", "info"}
+
+// monitorMetricsHandler 以 Prometheus 文本格式输出事件采集和流水线各阶段的计数
+func monitorMetricsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats := deps.EBPFMonitor.Stats()
+		stages := stats.Pipeline
+		if deps.Events != nil {
+			stages = append(stages, deps.Events.QueueStats())
+		}
+
+		var b strings.Builder
+		writeMonitorMetrics(&b, stats, stages)
+		c.Data(http.StatusOK, metricsContentType, []byte(b.String()))
+	}
+}
+
+// writeMonitorMetrics 写入监控指标
+func writeMonitorMetrics(w io.Writer, stats ebpf.MonitorStats, stages []ebpf.QueueStats) {
+	counter(w, "cloudbreach_monitor_events_received_total", "Events decoded from the event source.", stats.Received)
+	counter(w, "cloudbreach_monitor_events_lost_total", "Records lost because the kernel buffer was full.", stats.Lost)
+	counter(w, "cloudbreach_monitor_decode_errors_total", "Records that could not be decoded.", stats.DecodeErrors)
+	counter(w, "cloudbreach_monitor_subscribers_evicted_total", "Stream subscribers evicted for falling behind.", stats.Evicted)
+
+	if f := stats.KernelFilter; f != nil {
+		header(w, "cloudbreach_kernel_filtered_total", "counter", "Records dropped in the kernel by filters.")
+		for _, reason := range []struct {
+			name  string
+			value uint64
+		}{{"path", f.FilteredPath}, {"comm", f.FilteredComm}, {"uid", f.FilteredUID}, {"cgroup", f.FilteredCgroup}} {
+			fmt.Fprintf(w, "cloudbreach_kernel_filtered_total{reason=%q} %d\n", reason.name, reason.value)
+		}
+		counter(w, "cloudbreach_kernel_throttled_total", "Records dropped in the kernel by per-cgroup rate limits.", f.Throttled)
+	}
+
+	header(w, "cloudbreach_pipeline_queued", "gauge", "Events waiting in memory at each pipeline stage.")
+	for _, s := range stages {
+		fmt.Fprintf(w, "cloudbreach_pipeline_queued{stage=%q} %d\n", s.Stage, s.Queued)
+	}
+	header(w, "cloudbreach_pipeline_capacity", "gauge", "In-memory queue capacity of each pipeline stage.")
+	for _, s := range stages {
+		if s.Capacity > 0 {
+			fmt.Fprintf(w, "cloudbreach_pipeline_capacity{stage=%q} %d\n", s.Stage, s.Capacity)
+		}
+	}
+	header(w, "cloudbreach_pipeline_enqueued_total", "counter", "Events offered to each pipeline stage.")
+	for _, s := range stages {
+		fmt.Fprintf(w, "cloudbreach_pipeline_enqueued_total{stage=%q} %d\n", s.Stage, s.Enqueued)
+	}
+	header(w, "cloudbreach_pipeline_dropped_total", "counter", "Events dropped at each pipeline stage, by severity for priority queues.")
+	for _, s := range stages {
+		if s.Capacity == 0 {
+			// 订阅者缓冲区不区分严重程度
+			fmt.Fprintf(w, "cloudbreach_pipeline_dropped_total{stage=%q} %d\n", s.Stage, s.Dropped)
+			continue
+		}
+		for _, severity := range pipelineSeverities {
+			fmt.Fprintf(w, "cloudbreach_pipeline_dropped_total{stage=%q,severity=%q} %d\n", s.Stage, severity, s.DroppedBySeverity[severity])
+		}
+	}
+	header(w, "cloudbreach_pipeline_spilled_total", "counter", "Events written to the spill file at each pipeline stage.")
+	for _, s := range stages {
+		fmt.Fprintf(w, "cloudbreach_pipeline_spilled_total{stage=%q} %d\n", s.Stage, s.Spilled)
+	}
+	header(w, "cloudbreach_pipeline_spill_pending", "gauge", "Spilled events not yet read back.")
+	for _, s := range stages {
+		fmt.Fprintf(w, "cloudbreach_pipeline_spill_pending{stage=%q} %d\n", s.Stage, s.SpillPending)
+	}
+	header(w, "cloudbreach_pipeline_spill_bytes", "gauge", "Size of the spill file at each pipeline stage.")
+	for _, s := range stages {
+		fmt.Fprintf(w, "cloudbreach_pipeline_spill_bytes{stage=%q} %d\n", s.Stage, s.SpillBytes)
+	}
+}
+
+// header 写入指标的 HELP 和 TYPE 行
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// counter 写入没有标签的计数器
+func counter(w io.Writer, name, help string, value uint64) {
+	header(w, name, "counter", help)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
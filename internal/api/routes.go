@@ -4,8 +4,13 @@ import (
 	"database/sql"
 	"net/http"
 
+	"cloudsecops/internal/attack"
 	"cloudsecops/internal/config"
+	"cloudsecops/internal/detection"
 	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/eventstore"
+	"cloudsecops/internal/iac"
+	"cloudsecops/internal/response"
 	"cloudsecops/pkg/auth"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +24,12 @@ type Dependencies struct {
 	Redis       *redis.Client
 	Auth        *auth.Service
 	EBPFMonitor *ebpf.Monitor
+	Detection   *detection.Engine
+	Events      *eventstore.Store
+	Response    *response.Responder
+	Scans       *iac.ResultStore
+	Chains      *attack.ChainStore
+	Workspaces  *iac.WorkspaceManager
 	Config      *config.Config
 	Logger      *logrus.Logger
 }
@@ -38,6 +49,9 @@ func SetupRoutes(router *gin.Engine, deps *Dependencies) {
 			auth.POST("/refresh", refreshTokenHandler(deps))
 		}
 
+		// 实时事件流（SSE），认证同时接受 token 查询参数
+		v1.GET("/monitor/events/stream", streamAuthMiddleware(deps.Auth), streamEventsHandler(deps))
+
 		// 需要认证的路由
 		protected := v1.Group("/")
 		protected.Use(authMiddleware(deps.Auth))
@@ -48,6 +62,7 @@ func SetupRoutes(router *gin.Engine, deps *Dependencies) {
 				iac.POST("/scan", iacScanHandler(deps))
 				iac.GET("/scan/:id", getScanResultHandler(deps))
 				iac.GET("/scans", listScansHandler(deps))
+				iac.GET("/scans/diff", scanDiffHandler(deps))
 				iac.POST("/upload", uploadConfigHandler(deps))
 			}
 
@@ -55,8 +70,42 @@ func SetupRoutes(router *gin.Engine, deps *Dependencies) {
 			monitor := protected.Group("/monitor")
 			{
 				monitor.GET("/status", monitorStatusHandler(deps))
+				monitor.GET("/metrics", monitorMetricsHandler(deps))
 				monitor.GET("/events", getEventsHandler(deps))
-				monitor.GET("/events/stream", streamEventsHandler(deps))
+				monitor.GET("/events/rollups", getEventRollupsHandler(deps))
+				monitor.GET("/containers/:id/processes", containerProcessTreeHandler(deps))
+				monitor.GET("/flows", getFlowsHandler(deps))
+				monitor.GET("/filters", getKernelFilterHandler(deps))
+				monitor.PUT("/filters", updateKernelFilterHandler(deps))
+				monitor.GET("/integrity", getIntegrityHandler(deps))
+				monitor.POST("/integrity/baseline", acceptIntegrityBaselineHandler(deps))
+				monitor.GET("/profiles", listProfilesHandler(deps))
+				monitor.GET("/profiles/:id", getProfileHandler(deps))
+				monitor.PUT("/profiles/:id", updateProfileHandler(deps))
+				monitor.DELETE("/profiles/:id", deleteProfileHandler(deps))
+				monitor.POST("/profiles/:id/lock", lockProfileHandler(deps))
+				monitor.POST("/profiles/:id/learn", relearnProfileHandler(deps))
+				monitor.GET("/recordings", listRecordingsHandler(deps))
+				monitor.POST("/recordings", startRecordingHandler(deps))
+				monitor.POST("/recordings/stop", stopRecordingHandler(deps))
+				monitor.GET("/recordings/:id/download", downloadRecordingHandler(deps))
+				monitor.POST("/recordings/:id/replay", replayRecordingHandler(deps))
+				monitor.GET("/replay", getReplayHandler(deps))
+				monitor.POST("/replay/stop", stopReplayHandler(deps))
+				monitor.GET("/rules", listDetectionRulesHandler(deps))
+				monitor.POST("/rules/reload", reloadDetectionRulesHandler(deps))
+				monitor.GET("/blocks", listConnectionBlocksHandler(deps))
+				monitor.POST("/blocks", requireAdmin(), createConnectionBlockHandler(deps))
+				monitor.DELETE("/blocks", requireAdmin(), deleteConnectionBlockHandler(deps))
+			}
+
+			// 响应动作
+			resp := protected.Group("/response")
+			{
+				resp.GET("/status", getResponseStatusHandler(deps))
+				resp.GET("/actions", listResponseActionsHandler(deps))
+				resp.PUT("/dry-run", requireAdmin(), setResponseDryRunHandler(deps))
+				resp.POST("/reload", requireAdmin(), reloadResponsePolicyHandler(deps))
 			}
 
 			// 攻击链分析
@@ -87,6 +136,13 @@ func SetupRoutes(router *gin.Engine, deps *Dependencies) {
 				cloud.GET("/resources/export", exportResourcesHandler(deps))
 			}
 
+			// 合规映射
+			compliance := protected.Group("/compliance")
+			{
+				compliance.GET("/frameworks", listComplianceFrameworksHandler(deps))
+				compliance.GET("/report", getComplianceReportHandler(deps))
+			}
+
 			// 报告和可视化
 			reports := protected.Group("/reports")
 			{
@@ -98,7 +154,7 @@ func SetupRoutes(router *gin.Engine, deps *Dependencies) {
 	}
 
 	// WebSocket端点
-	router.GET("/ws", websocketHandler(deps))
+	router.GET("/ws", streamAuthMiddleware(deps.Auth), websocketHandler(deps))
 }
 
 // healthCheck 健康检查处理器
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未启动的监控器没有阻断表，阻断请求返回503
+	monitor, err := ebpf.NewMonitor(cfg.EBPF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := &Dependencies{Auth: auth.NewService("test-secret"), EBPFMonitor: monitor, Config: cfg, Logger: log}
+	router := gin.New()
+	SetupRoutes(router, deps)
+
+	token := func(roles ...string) string {
+		tok, err := deps.Auth.GenerateToken("1", "alice", roles, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	viewer, admin := token("viewer"), token(auth.RoleAdmin)
+
+	routes := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/api/v1/response/dry-run", `{"dry_run": false}`},
+		{http.MethodPost, "/api/v1/response/reload", ``},
+		{http.MethodPost, "/api/v1/monitor/blocks", `{"cgroup_id": 1, "addr": "203.0.113.50"}`},
+		{http.MethodDelete, "/api/v1/monitor/blocks", `{"cgroup_id": 1, "addr": "203.0.113.50"}`},
+	}
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			for _, tt := range []struct {
+				token     string
+				forbidden bool
+			}{
+				{viewer, true},
+				{admin, false},
+			} {
+				req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if got := w.Code == http.StatusForbidden; got != tt.forbidden {
+					t.Errorf("forbidden = %v (status %d), want %v", got, w.Code, tt.forbidden)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/pkg/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 实时事件流参数
+const (
+	streamWriteTimeout = 10 * time.Second
+	streamPongTimeout  = 60 * time.Second
+	streamPingInterval = 30 * time.Second
+	streamReadLimit    = 4096
+)
+
+// streamMessage WebSocket消息
+type streamMessage struct {
+	Type         string            `json:"type"` // subscribed、event、filter、error、evicted
+	Subscription uint64            `json:"subscription,omitempty"`
+	Event        *ebpf.Event       `json:"event,omitempty"`
+	Filter       *ebpf.EventFilter `json:"filter,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// streamAuthMiddleware 事件流认证中间件。浏览器的 WebSocket 和 EventSource 无法设置请求头，
+// 因此除 Authorization 头外也接受 token 查询参数
+func streamAuthMiddleware(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("token")
+		}
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or token parameter required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := authService.ValidateToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("roles", claims.Roles)
+		c.Set("claims", claims)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expiry", claims.ExpiresAt.Time)
+		}
+		c.Next()
+	}
+}
+
+// tokenExpiry 返回令牌过期时间的计时通道，长连接在令牌过期后关闭
+func tokenExpiry(c *gin.Context) (<-chan time.Time, func()) {
+	expiry, ok := c.Get("token_expiry")
+	if !ok {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(expiry.(time.Time)))
+	return timer.C, func() { timer.Stop() }
+}
+
+// originChecker 检查WebSocket请求来源：非浏览器请求（无Origin）、同源请求和配置允许的来源可以连接
+func originChecker(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, a := range allowed {
+			if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// eventFilterFromQuery 从查询参数解析事件过滤条件：
+// severity、type、container 为逗号分隔的列表，min_severity 为最低严重程度
+func eventFilterFromQuery(c *gin.Context) (ebpf.EventFilter, error) {
+	filter := ebpf.EventFilter{
+		MinSeverity: c.Query("min_severity"),
+		Severities:  splitQuery(c.Query("severity")),
+		Types:       splitQuery(c.Query("type")),
+		Containers:  splitQuery(c.Query("container")),
+	}
+	return filter, filter.Validate()
+}
+
+// splitQuery 拆分逗号分隔的查询参数
+func splitQuery(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// subscribe 按查询参数订阅事件，失败时写入错误响应
+func subscribe(c *gin.Context, deps *Dependencies) (*ebpf.Subscription, bool) {
+	filter, err := eventFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	sub, err := deps.EBPFMonitor.Subscribe(filter)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ebpf.ErrTooManySubscribers) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return sub, true
+}
+
+// websocketHandler WebSocket事件流处理器。连接建立后按过滤条件推送事件，
+// 客户端可发送 {"type":"filter","filter":{...}} 更新过滤条件
+func websocketHandler(deps *Dependencies) gin.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: originChecker(deps.Config.Server.AllowedOrigins),
+	}
+
+	return func(c *gin.Context) {
+		sub, ok := subscribe(c, deps)
+		if !ok {
+			return
+		}
+		defer deps.EBPFMonitor.Unsubscribe(sub)
+
+		// 升级失败时 upgrader 已写入错误响应
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		expired, stopExpiry := tokenExpiry(c)
+		defer stopExpiry()
+
+		// 读取协程处理过滤条件更新，回复交给写循环发送，保证同一时间只有一个写者
+		replies := make(chan streamMessage, 4)
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			conn.SetReadLimit(streamReadLimit)
+			conn.SetReadDeadline(time.Now().Add(streamPongTimeout))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(streamPongTimeout))
+			})
+			for {
+				var msg streamMessage
+				if err := conn.ReadJSON(&msg); err != nil {
+					return
+				}
+				reply := streamMessage{Type: "filter"}
+				switch {
+				case msg.Type != "filter" || msg.Filter == nil:
+					reply = streamMessage{Type: "error", Error: "unsupported message"}
+				default:
+					if err := sub.SetFilter(*msg.Filter); err != nil {
+						reply = streamMessage{Type: "error", Error: err.Error()}
+					} else {
+						filter := sub.Filter()
+						reply.Filter = &filter
+					}
+				}
+				select {
+				case replies <- reply:
+				default:
+				}
+			}
+		}()
+
+		write := func(msg streamMessage) error {
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			return conn.WriteJSON(msg)
+		}
+		closeWith := func(code int, reason string) {
+			message := websocket.FormatCloseMessage(code, reason)
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(streamWriteTimeout))
+		}
+
+		filter := sub.Filter()
+		if err := write(streamMessage{Type: "subscribed", Subscription: sub.ID(), Filter: &filter}); err != nil {
+			return
+		}
+
+		ping := time.NewTicker(streamPingInterval)
+		defer ping.Stop()
+
+		for {
+			select {
+			case event := <-sub.Events():
+				if err := write(streamMessage{Type: "event", Event: &event}); err != nil {
+					return
+				}
+			case reply := <-replies:
+				if err := write(reply); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+					return
+				}
+			case <-sub.Done():
+				reason := "subscription closed"
+				if err := sub.Err(); err != nil {
+					reason = err.Error()
+					write(streamMessage{Type: "evicted", Error: reason})
+				}
+				closeWith(websocket.CloseTryAgainLater, reason)
+				return
+			case <-expired:
+				closeWith(websocket.ClosePolicyViolation, "token expired")
+				return
+			case <-closed:
+				return
+			}
+		}
+	}
+}
+
+// streamEventsHandler 事件流处理器（Server-Sent Events），用于无法使用WebSocket的客户端
+func streamEventsHandler(deps *Dependencies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, ok := subscribe(c, deps)
+		if !ok {
+			return
+		}
+		defer deps.EBPFMonitor.Unsubscribe(sub)
+
+		expired, stopExpiry := tokenExpiry(c)
+		defer stopExpiry()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+		c.Status(http.StatusOK)
+
+		w := c.Writer
+		fmt.Fprintf(w, "event: subscribed\ndata: {\"subscription\":%d}\n\n", sub.ID())
+		w.Flush()
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event := <-sub.Events():
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: event\ndata: %s\n\n", data); err != nil {
+					return
+				}
+				w.Flush()
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				w.Flush()
+			case <-sub.Done():
+				if err := sub.Err(); err != nil {
+					data, _ := json.Marshal(gin.H{"error": err.Error()})
+					fmt.Fprintf(w, "event: evicted\ndata: %s\n\n", data)
+					w.Flush()
+				}
+				return
+			case <-expired:
+				fmt.Fprint(w, "event: expired\ndata: {\"error\":\"token expired\"}\n\n")
+				w.Flush()
+				return
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,872 @@
+package attack
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/iac"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 资源关系类型
+const (
+	RelNetwork       = "network"        // From 可以通过网络访问 To，From 为 internet 时 To 暴露在公网
+	RelUsesRole      = "uses_role"      // 计算资源 From 以身份 To 运行，可从实例元数据获取凭证
+	RelCanAccess     = "can_access"     // 身份 From 可以读取数据资源 To
+	RelSecurityGroup = "security_group" // 计算资源 From 受安全组 To 保护
+)
+
+// internetID 关系中表示公网的端点
+const internetID = "internet"
+
+// Relationship 资源之间的网络或IAM关系。端点为云资源ID或名称，或IaC扫描结果中的资源名
+type Relationship struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// GraphInput 构建攻击图的输入
+type GraphInput struct {
+	Findings      []iac.Finding    `json:"findings"`
+	Resources     []cloud.Resource `json:"resources"`
+	Relationships []Relationship   `json:"relationships"`
+}
+
+// 资产类别
+const (
+	kindCompute   = "compute"
+	kindContainer = "container"
+	kindNetwork   = "network"
+	kindIdentity  = "identity"
+	kindStorage   = "storage"
+	kindDatabase  = "database"
+	kindSecret    = "secret"
+	kindOther     = "other"
+)
+
+// weakness 资产上的漏洞或配置问题
+type weakness struct {
+	ID          string
+	Title       string
+	Severity    string
+	CVSS        float64
+	Remediation string
+	Exploitable bool // 云资源上报的漏洞，可被远程利用获得代码执行
+}
+
+// asset 攻击图中的资产，由云资源或同一文件中同名的IaC发现构成
+type asset struct {
+	key        string
+	name       string
+	kind       string
+	provider   string
+	source     string // cloud 或 iac
+	group      string // IaC文件路径，同一文件中的资源视为同一部署
+	weaknesses []weakness
+
+	exposed  bool     // 网络资产：允许公网入站
+	ports    []string // 公网开放的端口
+	public   bool     // 数据资产：允许匿名访问
+	admin    bool     // 身份：管理员或通配权限
+	readsS3  bool     // 身份：对象存储读取权限
+	escape   bool     // 容器：特权、危险能力或宿主机网络
+	root     bool     // 容器：以root运行
+	publicIP bool     // 计算资源：分配了公网IP
+
+	securityGroups []*asset
+	roles          []*asset
+	access         []*asset
+	network        []*asset
+	internet       bool // 通过关系声明暴露在公网
+}
+
+// edgeRule 边生成规则名，记录在边的条件中
+type edgeRule struct {
+	name string
+	p    float64
+}
+
+var (
+	ruleExploit      = edgeRule{"exploit-vulnerability", 0}
+	ruleExposed      = edgeRule{"exposed-service", 0.3}
+	ruleFoothold     = edgeRule{"code-execution", 0.9}
+	ruleInstanceRole = edgeRule{"instance-role-credentials", 0.9}
+	ruleInferredRole = edgeRule{"deployment-role", 0.6}
+	ruleEscape       = edgeRule{"container-escape", 0.8}
+	ruleAdminData    = edgeRule{"admin-data-access", 0.95}
+	ruleRoleData     = edgeRule{"role-data-access", 0.85}
+	rulePublicData   = edgeRule{"public-data-access", 0.95}
+	ruleLateralData  = edgeRule{"network-data-access", 0.5}
+	ruleLateral      = edgeRule{"lateral-movement", 0.2}
+)
+
+// GraphBuilder 根据IaC发现、云资源及其漏洞、资源关系生成攻击图
+type GraphBuilder struct {
+	logger *logrus.Logger
+	assets map[string]*asset
+	byName map[string][]*asset
+	graph  *AttackGraph
+	edges  map[string]*AttackEdge
+}
+
+// NewGraphBuilder 创建攻击图构建器
+func NewGraphBuilder(logger *logrus.Logger) *GraphBuilder {
+	return &GraphBuilder{logger: logger}
+}
+
+// Build 构建攻击图。边由规则生成，例如：
+// 公网开放的安全组 + 有漏洞的实例 → 代码执行 → 实例角色凭证 → 读取S3存储桶
+func (b *GraphBuilder) Build(input GraphInput) *AttackGraph {
+	b.assets = make(map[string]*asset)
+	b.byName = make(map[string][]*asset)
+	b.graph = NewAttackGraph(b.logger)
+	b.edges = make(map[string]*AttackEdge)
+
+	for i := range input.Resources {
+		b.addResource(&input.Resources[i])
+	}
+	for _, finding := range input.Findings {
+		b.addFinding(finding)
+	}
+	b.linkMetadata(input.Resources)
+	for _, rel := range input.Relationships {
+		b.addRelationship(rel)
+	}
+
+	assets := make([]*asset, 0, len(b.assets))
+	for _, a := range b.assets {
+		assets = append(assets, a)
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].key < assets[j].key })
+
+	for _, a := range assets {
+		b.buildEntry(a, assets)
+	}
+	// 横向移动会产生新的代码执行节点，直到没有新节点为止
+	done := make(map[string]bool)
+	for progress := true; progress; {
+		progress = false
+		for _, a := range assets {
+			if !done[a.key] && b.graph.nodes["foothold:"+a.key] != nil {
+				done[a.key] = true
+				progress = true
+				b.buildMovement(a, assets)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(b.edges))
+	for key := range b.edges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		edge := b.edges[key]
+		edge.ID = fmt.Sprintf("e%d", i+1)
+		b.graph.AddEdge(edge)
+	}
+
+	b.logger.WithFields(logrus.Fields{
+		"assets": len(assets),
+		"nodes":  len(b.graph.nodes),
+		"edges":  len(keys),
+	}).Info("Attack graph built")
+	return b.graph
+}
+
+// BuildGraph 使用默认规则构建攻击图
+func BuildGraph(input GraphInput, logger *logrus.Logger) *AttackGraph {
+	return NewGraphBuilder(logger).Build(input)
+}
+
+// addResource 将云资源转换为资产
+func (b *GraphBuilder) addResource(r *cloud.Resource) {
+	a := &asset{
+		key:      r.ID,
+		name:     r.Name,
+		provider: string(r.Provider),
+		source:   "cloud",
+	}
+	switch r.Type {
+	case cloud.EC2Instance, cloud.VirtualMachine:
+		a.kind = kindCompute
+		a.publicIP = metaString(r.Metadata, "public_ip") != ""
+	case cloud.S3Bucket, cloud.StorageAccount:
+		a.kind = kindStorage
+		a.public = metaBool(r.Metadata, "public_access")
+	case cloud.KeyVault:
+		a.kind = kindSecret
+		a.public = metaBool(r.Metadata, "public_access")
+	case cloud.IAMRole:
+		a.kind = kindIdentity
+		for _, policy := range metaStrings(r.Metadata, "attached_policies") {
+			a.applyPolicy(policy)
+		}
+	case cloud.SecurityGroup:
+		a.kind = kindNetwork
+		a.ports, a.exposed = openIngress(r.Metadata["inbound_rules"])
+	default:
+		a.kind = kindOther
+	}
+	for _, v := range r.Vulnerabilities {
+		a.weaknesses = append(a.weaknesses, weakness{
+			ID:          v.ID,
+			Title:       v.Title,
+			Severity:    v.Severity,
+			CVSS:        v.CVSS,
+			Remediation: v.Remediation,
+			Exploitable: a.kind == kindCompute,
+		})
+	}
+	b.register(a)
+}
+
+// applyPolicy 根据附加的托管策略名判断身份权限
+func (a *asset) applyPolicy(policy string) {
+	name := policy[strings.LastIndex(policy, "/")+1:]
+	switch {
+	case name == "AdministratorAccess" || name == "PowerUserAccess":
+		a.admin = true
+	case strings.Contains(name, "S3") && (strings.Contains(name, "Read") || strings.Contains(name, "FullAccess")):
+		a.readsS3 = true
+	}
+}
+
+// addFinding 将IaC发现归入资产：资源名与云资源ID或名称相同时归入该云资源，
+// 否则按文件和资源名归入IaC资产
+func (b *GraphBuilder) addFinding(f iac.Finding) {
+	var a *asset
+	if id := f.Metadata["resource_id"]; id != "" && b.assets[id] != nil {
+		a = b.assets[id]
+	} else if matches := b.byName[f.Resource]; len(matches) == 1 && matches[0].source == "cloud" {
+		a = matches[0]
+	} else {
+		key := "iac:" + f.FilePath + "#" + f.Resource
+		if a = b.assets[key]; a == nil {
+			a = &asset{
+				key:      key,
+				name:     f.Resource,
+				kind:     iacKind(f),
+				provider: iacProvider(f.Resource),
+				source:   "iac",
+				group:    f.FilePath,
+			}
+			b.register(a)
+		}
+	}
+
+	text := strings.ToLower(f.Title + " " + f.Description)
+	switch {
+	case f.Rule == "TF003" || (a.kind == kindNetwork && strings.Contains(text, "0.0.0.0/0")):
+		a.exposed = true
+	case f.Rule == "TF002" || ((a.kind == kindStorage || a.kind == kindSecret) && strings.Contains(text, "public")):
+		a.public = true
+	case f.Rule == "TF001" || (a.kind == kindIdentity && (strings.Contains(text, "'*'") || strings.Contains(text, "permissive") || strings.Contains(text, "admin"))):
+		a.admin = true
+	case f.Rule == "K8S002" || f.Rule == "K8S004" || f.Rule == "K8S005" ||
+		strings.Contains(text, "privileged") || strings.Contains(text, "capabilit") || strings.Contains(text, "host network"):
+		a.escape = true
+	case f.Rule == "K8S001" || strings.Contains(text, "as root"):
+		a.root = true
+	}
+
+	a.weaknesses = append(a.weaknesses, weakness{
+		ID:          findingID(f),
+		Title:       f.Title,
+		Severity:    f.Severity,
+		CVSS:        f.CVSS,
+		Remediation: fmt.Sprintf("修复 %s：%s", findingID(f), f.Title),
+	})
+}
+
+// findingID 返回发现的标识，优先使用规则ID
+func findingID(f iac.Finding) string {
+	if f.Rule != "" {
+		return f.Rule
+	}
+	return f.ID
+}
+
+// iacKind 根据资源名和类别判断IaC资产类别
+func iacKind(f iac.Finding) string {
+	resource := strings.ToLower(f.Resource)
+	switch {
+	case strings.Contains(resource, "security_group") || strings.Contains(resource, "firewall") || strings.Contains(resource, "network_security"):
+		return kindNetwork
+	case strings.Contains(resource, "s3_bucket") || strings.Contains(resource, "storage"):
+		return kindStorage
+	case strings.Contains(resource, "db_instance") || strings.Contains(resource, "rds") || strings.Contains(resource, "sql") || strings.Contains(resource, "database"):
+		return kindDatabase
+	case strings.Contains(resource, "key_vault") || strings.Contains(resource, "secret") || strings.Contains(resource, "kms"):
+		return kindSecret
+	case strings.Contains(resource, "iam") || strings.Contains(resource, "role") || strings.Contains(resource, "policy"):
+		return kindIdentity
+	case strings.Contains(resource, "pod") || strings.Contains(resource, "container") || strings.Contains(resource, "deployment"):
+		return kindContainer
+	case strings.Contains(resource, "instance") || strings.Contains(resource, "virtual_machine"):
+		return kindCompute
+	}
+	switch f.Category {
+	case "Network":
+		return kindNetwork
+	case "Storage":
+		return kindStorage
+	case "Database":
+		return kindDatabase
+	case "IAM":
+		return kindIdentity
+	}
+	return kindOther
+}
+
+// iacProvider 根据资源类型前缀判断云提供商
+func iacProvider(resource string) string {
+	switch {
+	case strings.HasPrefix(resource, "aws_"):
+		return string(cloud.AWS)
+	case strings.HasPrefix(resource, "azurerm_"):
+		return string(cloud.Azure)
+	case strings.HasPrefix(resource, "google_"):
+		return "gcp"
+	}
+	return ""
+}
+
+// register 登记资产，支持按ID和名称查找
+func (b *GraphBuilder) register(a *asset) {
+	b.assets[a.key] = a
+	b.byName[a.name] = append(b.byName[a.name], a)
+}
+
+// resolve 将关系端点解析为资产，依次按资产键、云资源ID和名称匹配
+func (b *GraphBuilder) resolve(ref string) []*asset {
+	if a := b.assets[ref]; a != nil {
+		return []*asset{a}
+	}
+	return b.byName[ref]
+}
+
+// linkMetadata 根据云资源元数据中的 security_groups、iam_role 和 instance_profile 建立关系
+func (b *GraphBuilder) linkMetadata(resources []cloud.Resource) {
+	for i := range resources {
+		r := &resources[i]
+		for _, sg := range metaStrings(r.Metadata, "security_groups") {
+			b.addRelationship(Relationship{From: r.ID, To: sg, Type: RelSecurityGroup})
+		}
+		for _, key := range []string{"iam_role", "instance_profile"} {
+			if role := metaString(r.Metadata, key); role != "" {
+				b.addRelationship(Relationship{From: r.ID, To: role, Type: RelUsesRole})
+			}
+		}
+	}
+}
+
+// addRelationship 记录资源关系，无法解析的端点被忽略
+func (b *GraphBuilder) addRelationship(rel Relationship) {
+	to := b.resolve(rel.To)
+	if len(to) == 0 {
+		b.logger.Debugf("Ignoring %s relationship to unknown resource %s", rel.Type, rel.To)
+		return
+	}
+	if rel.Type == RelNetwork && rel.From == internetID {
+		for _, t := range to {
+			t.internet = true
+		}
+		return
+	}
+	from := b.resolve(rel.From)
+	for _, f := range from {
+		for _, t := range to {
+			switch rel.Type {
+			case RelSecurityGroup:
+				f.securityGroups = appendAsset(f.securityGroups, t)
+			case RelUsesRole:
+				f.roles = appendAsset(f.roles, t)
+			case RelCanAccess:
+				f.access = appendAsset(f.access, t)
+			case RelNetwork:
+				f.network = appendAsset(f.network, t)
+			default:
+				b.logger.Debugf("Ignoring unknown relationship type %s", rel.Type)
+			}
+		}
+	}
+}
+
+func appendAsset(list []*asset, a *asset) []*asset {
+	for _, existing := range list {
+		if existing == a {
+			return list
+		}
+	}
+	return append(list, a)
+}
+
+// workload 判断资产是否为可获得代码执行的工作负载
+func (a *asset) workload() bool {
+	return a.kind == kindCompute || a.kind == kindContainer
+}
+
+// dataStore 判断资产是否为攻击目标数据
+func (a *asset) dataStore() bool {
+	return a.kind == kindStorage || a.kind == kindDatabase || a.kind == kindSecret
+}
+
+// exposure 返回工作负载的公网暴露方式：关系声明、公网开放的安全组、同一部署中公网开放的网络资源，
+// 或未关联安全组信息时的公网IP
+func (a *asset) exposure(assets []*asset) (bool, []*asset) {
+	if a.internet {
+		return true, nil
+	}
+	var via []*asset
+	for _, sg := range a.securityGroups {
+		if sg.exposed {
+			via = append(via, sg)
+		}
+	}
+	if len(a.securityGroups) == 0 && a.group != "" {
+		for _, other := range assets {
+			if other.group == a.group && other.kind == kindNetwork && other.exposed {
+				via = append(via, other)
+			}
+		}
+	}
+	if len(via) > 0 {
+		return true, via
+	}
+	return len(a.securityGroups) == 0 && a.publicIP, nil
+}
+
+// buildEntry 生成入口：公网暴露的工作负载（云上实例需有可利用漏洞），以及可匿名访问的数据
+func (b *GraphBuilder) buildEntry(a *asset, assets []*asset) {
+	switch {
+	case a.workload():
+		// 云资源上报了漏洞信息，没有可利用漏洞的实例不作为入口；IaC资产没有漏洞信息，按未知漏洞处理
+		exposed, via := a.exposure(assets)
+		if exposed && (a.source != "cloud" || len(exploitable(a.weaknesses)) > 0) {
+			b.exposeWorkload(a, via)
+		}
+	case a.kind == kindNetwork && a.exposed:
+		// 没有关联工作负载的公网开放网络资源，代表其后的工作负载
+		for _, other := range assets {
+			if other.workload() && (other.group == a.group && a.group != "" || containsAsset(other.securityGroups, a)) {
+				return
+			}
+		}
+		b.exposeWorkload(a, []*asset{a})
+	case a.dataStore() && a.public:
+		entry := b.node(&AttackNode{
+			ID:          "entry:" + a.key,
+			Label:       "公开访问\n(" + a.name + ")",
+			Type:        "entry",
+			Severity:    maxSeverity(a.weaknesses, "high"),
+			Description: fmt.Sprintf("%s 允许匿名访问", a.name),
+			MITRE:       "T1530",
+			Remediation: remediation(a.weaknesses, "禁用公开访问并配置适当的访问策略"),
+			CVSS:        maxCVSS(a.weaknesses, 7.5),
+		}, a)
+		b.edge(entry, b.exfil(a), rulePublicData.name, rulePublicData.p, a.name+" 允许匿名访问")
+	}
+}
+
+// exposeWorkload 生成公网入口到工作负载代码执行的路径
+func (b *GraphBuilder) exposeWorkload(a *asset, via []*asset) {
+	var conditions []string
+	var exposure []weakness
+	var ports []string
+	for _, sg := range via {
+		exposure = append(exposure, sg.weaknesses...)
+		ports = append(ports, sg.ports...)
+		conditions = append(conditions, fmt.Sprintf("%s 允许 0.0.0.0/0 入站", sg.name))
+	}
+	if len(via) == 0 {
+		conditions = append(conditions, a.name+" 可从公网访问")
+	}
+	description := fmt.Sprintf("%s 暴露在公网", a.name)
+	if len(ports) > 0 {
+		description += "，开放端口 " + strings.Join(ports, ", ")
+	}
+	severity := "medium"
+	for _, port := range ports {
+		if port == "22" || port == "3389" || port == "all" {
+			severity = "high"
+		}
+	}
+
+	entry := b.node(&AttackNode{
+		ID:          "entry:" + a.key,
+		Label:       "公网暴露\n(" + a.name + ")",
+		Type:        "entry",
+		Severity:    maxSeverity(exposure, severity),
+		Description: description,
+		MITRE:       "T1190",
+		Remediation: remediation(exposure, "限制入站访问来源，仅开放必要的端口"),
+		CVSS:        maxCVSS(exposure, 5.3),
+	}, a)
+	b.exploit(entry, a, ruleExposed, conditions)
+}
+
+// exploit 从已能访问工作负载的节点生成到代码执行的边：有可利用漏洞时经由漏洞节点，
+// 否则按 fallback 规则以较低概率直接到达
+func (b *GraphBuilder) exploit(from *AttackNode, a *asset, fallback edgeRule, conditions []string) {
+	foothold := b.foothold(a)
+	exploitable := false
+	for _, w := range a.weaknesses {
+		if !w.Exploitable {
+			continue
+		}
+		exploitable = true
+		vuln := b.node(&AttackNode{
+			ID:          "vuln:" + a.key + ":" + w.ID,
+			Label:       w.ID + "\n(" + a.name + ")",
+			Type:        "vulnerability",
+			Severity:    w.Severity,
+			Description: w.Title,
+			MITRE:       "T1190",
+			Remediation: w.Remediation,
+			CVSS:        w.CVSS,
+		}, a)
+		b.edge(from, vuln, ruleExploit.name, exploitability(w.CVSS), append(conditions, fmt.Sprintf("%s (CVSS %.1f)", w.ID, w.CVSS))...)
+		b.edge(vuln, foothold, ruleFoothold.name, ruleFoothold.p, w.Title)
+	}
+	if !exploitable {
+		b.edge(from, foothold, fallback.name, fallback.p, append(conditions, "服务可能存在未知漏洞")...)
+	}
+}
+
+// buildMovement 生成代码执行之后的移动：容器逃逸、获取身份凭证、访问数据和横向移动
+func (b *GraphBuilder) buildMovement(a *asset, assets []*asset) {
+	foothold := b.graph.nodes["foothold:"+a.key]
+
+	// 容器逃逸后获得节点权限，可使用部署中的身份
+	from := foothold
+	if a.kind == kindContainer && a.escape {
+		p := ruleEscape.p
+		if a.root {
+			p = 0.9
+		}
+		escape := b.node(&AttackNode{
+			ID:          "escape:" + a.key,
+			Label:       "容器逃逸\n(" + a.name + ")",
+			Type:        "privilege",
+			Severity:    "critical",
+			Description: a.name + " 以特权、危险能力或宿主机网络运行，可逃逸到节点",
+			MITRE:       "T1611",
+			Remediation: remediationFor(a.weaknesses, []string{"K8S002", "K8S005", "K8S004"}, "移除特权模式、危险能力和宿主机网络"),
+			CVSS:        maxCVSS(a.weaknesses, 8.8),
+		}, a)
+		b.edge(foothold, escape, ruleEscape.name, p, a.name+" 可逃逸到节点")
+		from = escape
+	}
+
+	for _, role := range a.roles {
+		b.edge(from, b.privilege(role), ruleInstanceRole.name, ruleInstanceRole.p, fmt.Sprintf("%s 以 %s 运行", a.name, role.name))
+	}
+	if a.group != "" && (a.kind != kindContainer || a.escape) {
+		for _, other := range assets {
+			if other.group == a.group && other.kind == kindIdentity && !containsAsset(a.roles, other) {
+				b.edge(from, b.privilege(other), ruleInferredRole.name, ruleInferredRole.p, fmt.Sprintf("%s 与 %s 在同一部署中", a.name, other.name))
+			}
+		}
+	}
+
+	for _, target := range a.network {
+		switch {
+		case target.dataStore():
+			b.edge(foothold, b.exfil(target), ruleLateralData.name, ruleLateralData.p, fmt.Sprintf("%s 可通过网络访问 %s", a.name, target.name))
+		case target.workload() && target != a:
+			b.exploit(foothold, target, ruleLateral, []string{fmt.Sprintf("%s 可通过网络访问 %s", a.name, target.name)})
+		}
+	}
+	if a.group != "" {
+		for _, other := range assets {
+			if other.group == a.group && other.kind == kindDatabase && !containsAsset(a.network, other) {
+				b.edge(foothold, b.exfil(other), ruleLateralData.name, 0.4, fmt.Sprintf("%s 与 %s 在同一部署中", a.name, other.name))
+			}
+		}
+	}
+
+	for _, role := range a.roles {
+		b.roleAccess(role, assets)
+	}
+	if a.group != "" {
+		for _, other := range assets {
+			if other.group == a.group && other.kind == kindIdentity {
+				b.roleAccess(other, assets)
+			}
+		}
+	}
+}
+
+// roleAccess 生成身份到其可读取数据的边
+func (b *GraphBuilder) roleAccess(role *asset, assets []*asset) {
+	priv := b.privilege(role)
+	for _, target := range role.access {
+		if target.dataStore() {
+			b.edge(priv, b.exfil(target), ruleRoleData.name, ruleRoleData.p, fmt.Sprintf("%s 可以访问 %s", role.name, target.name))
+		}
+	}
+	for _, target := range assets {
+		if !target.dataStore() || containsAsset(role.access, target) {
+			continue
+		}
+		// 云上的身份只能访问同一云提供商的资源，IaC中的身份只能访问同一文件中的资源
+		sameScope := target.source == "cloud" && target.provider == role.provider
+		if role.source == "iac" {
+			sameScope = target.group == role.group
+		}
+		switch {
+		case role.admin && sameScope:
+			b.edge(priv, b.exfil(target), ruleAdminData.name, ruleAdminData.p, role.name+" 拥有管理员或通配权限")
+		case role.readsS3 && sameScope && target.kind == kindStorage && target.provider == string(cloud.AWS):
+			b.edge(priv, b.exfil(target), ruleRoleData.name, ruleRoleData.p, role.name+" 拥有S3读取权限")
+		}
+	}
+}
+
+// foothold 返回工作负载的代码执行节点
+func (b *GraphBuilder) foothold(a *asset) *AttackNode {
+	return b.node(&AttackNode{
+		ID:          "foothold:" + a.key,
+		Label:       "代码执行\n(" + a.name + ")",
+		Type:        "exploit",
+		Severity:    maxSeverity(a.weaknesses, "high"),
+		Description: "在 " + a.name + " 上获得代码执行能力",
+		MITRE:       "T1059",
+		Remediation: remediation(exploitable(a.weaknesses), "加固 "+a.name+"：修补对外服务并启用运行时监控"),
+		CVSS:        maxCVSS(a.weaknesses, 7.0),
+	}, a)
+}
+
+// privilege 返回获取身份凭证的节点
+func (b *GraphBuilder) privilege(role *asset) *AttackNode {
+	severity, cvss := "high", 6.5
+	if role.admin {
+		severity, cvss = "critical", 9.0
+	}
+	return b.node(&AttackNode{
+		ID:          "priv:" + role.key,
+		Label:       "获取角色凭证\n(" + role.name + ")",
+		Type:        "privilege",
+		Severity:    maxSeverity(role.weaknesses, severity),
+		Description: "通过实例元数据或部署配置获取 " + role.name + " 的凭证",
+		MITRE:       "T1552.005",
+		Remediation: remediation(role.weaknesses, "根据实际需要限制角色权限，遵循最小权限原则"),
+		CVSS:        maxCVSS(role.weaknesses, cvss),
+	}, role)
+}
+
+// exfil 返回读取数据的节点
+func (b *GraphBuilder) exfil(a *asset) *AttackNode {
+	mitre := "T1530"
+	if a.kind == kindSecret {
+		mitre = "T1555.006"
+	}
+	return b.node(&AttackNode{
+		ID:          "exfil:" + a.key,
+		Label:       "数据窃取\n(" + a.name + ")",
+		Type:        "exfiltration",
+		Severity:    maxSeverity(a.weaknesses, "critical"),
+		Description: "读取并外传 " + a.name + " 中的数据",
+		MITRE:       mitre,
+		Remediation: "限制可访问 " + a.name + " 的身份和网络来源，启用加密和访问日志",
+		CVSS:        maxCVSS(a.weaknesses, 7.5),
+	}, a)
+}
+
+// node 添加节点，已存在时返回已有节点
+func (b *GraphBuilder) node(n *AttackNode, a *asset) *AttackNode {
+	if existing := b.graph.nodes[n.ID]; existing != nil {
+		return existing
+	}
+	n.Metadata = map[string]string{
+		"resource":   a.key,
+		"name":       a.name,
+		"asset_type": a.kind,
+		"source":     a.source,
+	}
+	if a.provider != "" {
+		n.Metadata["provider"] = a.provider
+	}
+	if a.group != "" {
+		n.Metadata["file"] = a.group
+	}
+	b.graph.AddNode(n)
+	return n
+}
+
+// edge 添加边，同一对节点由多条规则生成时保留概率最高的一条
+func (b *GraphBuilder) edge(from, to *AttackNode, rule string, p float64, conditions ...string) {
+	if from.ID == to.ID {
+		return
+	}
+	key := from.ID + "\x00" + to.ID
+	if existing := b.edges[key]; existing != nil && existing.Probability >= p {
+		return
+	}
+	b.edges[key] = &AttackEdge{
+		From:        from.ID,
+		To:          to.ID,
+		Label:       fmt.Sprintf("%.0f%%", p*100),
+		Probability: p,
+		Weight:      math.Round(-math.Log(p)*1000) / 1000,
+		Conditions:  append([]string{"rule: " + rule}, conditions...),
+	}
+}
+
+// exploitable 返回可远程利用的漏洞
+func exploitable(ws []weakness) []weakness {
+	var result []weakness
+	for _, w := range ws {
+		if w.Exploitable {
+			result = append(result, w)
+		}
+	}
+	return result
+}
+
+// exploitability 将CVSS评分换算为利用成功概率
+func exploitability(cvss float64) float64 {
+	return math.Max(0.05, math.Min(0.95, 0.2+cvss*0.075))
+}
+
+// severityRank 严重程度排序
+var severityRank = map[string]int{"critical": 4, "high": 3, "medium": 2, "low": 1}
+
+// maxSeverity 返回最高的严重程度，不低于默认值
+func maxSeverity(ws []weakness, fallback string) string {
+	severity := fallback
+	for _, w := range ws {
+		if severityRank[w.Severity] > severityRank[severity] {
+			severity = w.Severity
+		}
+	}
+	return severity
+}
+
+// maxCVSS 返回最高的CVSS评分，没有时使用默认值
+func maxCVSS(ws []weakness, fallback float64) float64 {
+	cvss := 0.0
+	for _, w := range ws {
+		cvss = math.Max(cvss, w.CVSS)
+	}
+	if cvss == 0 {
+		return fallback
+	}
+	return cvss
+}
+
+// remediation 返回最严重问题的修复建议
+func remediation(ws []weakness, fallback string) string {
+	return remediationFor(ws, nil, fallback)
+}
+
+// remediationFor 返回指定问题中最严重者的修复建议，ids 为空时考虑所有问题
+func remediationFor(ws []weakness, ids []string, fallback string) string {
+	best := -1.0
+	result := fallback
+	for _, w := range ws {
+		if w.Remediation == "" || (len(ids) > 0 && !containsString(ids, w.ID)) {
+			continue
+		}
+		if score := float64(severityRank[w.Severity])*100 + w.CVSS; score > best {
+			best, result = score, w.Remediation
+		}
+	}
+	return result
+}
+
+func containsAsset(list []*asset, a *asset) bool {
+	for _, existing := range list {
+		if existing == a {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// openIngress 解析安全组入站规则，返回对公网开放的端口
+func openIngress(value interface{}) ([]string, bool) {
+	var rules []map[string]interface{}
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		rules = v
+	case []interface{}:
+		for _, item := range v {
+			if rule, ok := item.(map[string]interface{}); ok {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	var ports []string
+	for _, rule := range rules {
+		source := metaString(rule, "source")
+		if source != "0.0.0.0/0" && source != "::/0" {
+			continue
+		}
+		port := metaString(rule, "port")
+		if port == "" || port == "0" || port == "-1" {
+			port = "all"
+		}
+		if !containsString(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports, len(ports) > 0
+}
+
+// metaString 读取元数据中的字符串，数字转换为字符串
+func metaString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// metaBool 读取元数据中的布尔值
+func metaBool(m map[string]interface{}, key string) bool {
+	v, _ := m[key].(bool)
+	return v
+}
+
+// metaStrings 读取元数据中的字符串列表，兼容JSON解码后的 []interface{}
+func metaStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package attack
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/iac"
+
+	"github.com/sirupsen/logrus"
+)
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// edgeSet 返回图中的边，格式为 起点 -> 终点 (规则)
+func edgeSet(g *AttackGraph) []string {
+	var edges []string
+	for _, e := range g.Edges() {
+		edges = append(edges, e.From+" -> "+e.To+" ("+e.Conditions[0]+")")
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+func nodeIDs(g *AttackGraph) []string {
+	var ids []string
+	for _, n := range g.Nodes() {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func securityGroup(id, source string) cloud.Resource {
+	return cloud.Resource{
+		ID:       id,
+		Name:     id,
+		Type:     cloud.SecurityGroup,
+		Provider: cloud.AWS,
+		Metadata: map[string]interface{}{
+			"inbound_rules": []interface{}{
+				map[string]interface{}{"protocol": "tcp", "port": 22, "source": source},
+			},
+		},
+	}
+}
+
+func instance(id, sg string, vulns ...cloud.Vulnerability) cloud.Resource {
+	return cloud.Resource{
+		ID:       id,
+		Name:     id,
+		Type:     cloud.EC2Instance,
+		Provider: cloud.AWS,
+		Metadata: map[string]interface{}{
+			"public_ip":       "198.51.100.10",
+			"security_groups": []interface{}{sg},
+			"iam_role":        "arn:aws:iam::111122223333:role/app",
+		},
+		Vulnerabilities: vulns,
+	}
+}
+
+func TestBuildCloudInventory(t *testing.T) {
+	input := GraphInput{
+		Resources: []cloud.Resource{
+			securityGroup("sg-public", "0.0.0.0/0"),
+			securityGroup("sg-private", "10.0.0.0/8"),
+			instance("i-web", "sg-public", cloud.Vulnerability{ID: "CVE-2021-44228", Title: "Log4j", Severity: "critical", CVSS: 10}),
+			instance("i-private", "sg-private", cloud.Vulnerability{ID: "CVE-2023-38545", Title: "curl", Severity: "high", CVSS: 8.8}),
+			instance("i-clean", "sg-public"),
+			{
+				ID:       "arn:aws:iam::111122223333:role/app",
+				Name:     "app",
+				Type:     cloud.IAMRole,
+				Provider: cloud.AWS,
+				Metadata: map[string]interface{}{"attached_policies": []interface{}{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"}},
+			},
+			{ID: "arn:aws:s3:::data", Name: "data", Type: cloud.S3Bucket, Provider: cloud.AWS},
+		},
+		// 资源名与云资源相同的IaC发现归入该云资源
+		Findings: []iac.Finding{
+			{Rule: "TF004", Title: "S3 bucket without encryption", Severity: "medium", Resource: "data", FilePath: "main.tf"},
+		},
+	}
+	g := BuildGraph(input, quietLogger())
+
+	const role = "arn:aws:iam::111122223333:role/app"
+	wantNodes := []string{
+		"entry:i-web",
+		"exfil:arn:aws:s3:::data",
+		"foothold:i-web",
+		"priv:" + role,
+		"vuln:i-web:CVE-2021-44228",
+	}
+	if got := nodeIDs(g); !reflect.DeepEqual(got, wantNodes) {
+		t.Errorf("nodes = %v, want %v", got, wantNodes)
+	}
+	wantEdges := []string{
+		"entry:i-web -> vuln:i-web:CVE-2021-44228 (rule: exploit-vulnerability)",
+		"foothold:i-web -> priv:" + role + " (rule: instance-role-credentials)",
+		"priv:" + role + " -> exfil:arn:aws:s3:::data (rule: role-data-access)",
+		"vuln:i-web:CVE-2021-44228 -> foothold:i-web (rule: code-execution)",
+	}
+	if got := edgeSet(g); !reflect.DeepEqual(got, wantEdges) {
+		t.Errorf("edges = %v, want %v", got, wantEdges)
+	}
+
+	for _, e := range g.Edges() {
+		if e.From == "entry:i-web" && e.Probability != exploitability(10) {
+			t.Errorf("exploit probability = %v, want %v", e.Probability, exploitability(10))
+		}
+	}
+	if severity := g.nodes["exfil:arn:aws:s3:::data"].Severity; severity != "critical" {
+		t.Errorf("exfil severity = %s, want critical", severity)
+	}
+}
+
+func TestBuildIaCFindings(t *testing.T) {
+	input := GraphInput{
+		Findings: []iac.Finding{
+			{Rule: "TF003", Title: "Security Group Allows All Traffic", Severity: "high", Resource: "aws_security_group.web", FilePath: "main.tf"},
+			{Rule: "TF006", Title: "EBS volume not encrypted", Severity: "medium", Resource: "aws_instance.web", FilePath: "main.tf"},
+			{Rule: "TF001", Title: "IAM Policy with Wildcard Actions", Severity: "critical", Resource: "aws_iam_role.app", FilePath: "main.tf"},
+			{Rule: "TF004", Title: "S3 bucket without encryption", Severity: "medium", Resource: "aws_s3_bucket.data", FilePath: "main.tf"},
+			// 其他文件中的存储桶不在同一部署中
+			{Rule: "TF004", Title: "S3 bucket without encryption", Severity: "medium", Resource: "aws_s3_bucket.logs", FilePath: "other.tf"},
+		},
+	}
+	g := BuildGraph(input, quietLogger())
+
+	const (
+		web    = "iac:main.tf#aws_instance.web"
+		role   = "iac:main.tf#aws_iam_role.app"
+		bucket = "iac:main.tf#aws_s3_bucket.data"
+	)
+	wantEdges := []string{
+		"entry:" + web + " -> foothold:" + web + " (rule: exposed-service)",
+		"foothold:" + web + " -> priv:" + role + " (rule: deployment-role)",
+		"priv:" + role + " -> exfil:" + bucket + " (rule: admin-data-access)",
+	}
+	if got := edgeSet(g); !reflect.DeepEqual(got, wantEdges) {
+		t.Errorf("edges = %v, want %v", got, wantEdges)
+	}
+}
+
+func TestBuildNoEntryForPrivateOrUnvulnerableInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource cloud.Resource
+		sg       string
+	}{
+		{"private", instance("i-1", "sg-1", cloud.Vulnerability{ID: "CVE-2021-44228", CVSS: 10}), "10.0.0.0/8"},
+		{"unvulnerable", instance("i-1", "sg-1"), "0.0.0.0/0"},
+		{"private ip without security group", cloud.Resource{
+			ID: "i-1", Name: "i-1", Type: cloud.EC2Instance, Provider: cloud.AWS,
+			Vulnerabilities: []cloud.Vulnerability{{ID: "CVE-2021-44228", CVSS: 10}},
+		}, "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildGraph(GraphInput{Resources: []cloud.Resource{securityGroup("sg-1", tt.sg), tt.resource}}, quietLogger())
+			for _, n := range g.Nodes() {
+				if n.Type == "entry" {
+					t.Errorf("unexpected entry node %s", n.ID)
+				}
+			}
+			if edges := g.Edges(); len(edges) != 0 {
+				t.Errorf("edges = %v, want none", edgeSet(g))
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package attack
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -42,6 +45,9 @@ type AttackChain struct {
 	Status    string        `json:"status"`
 	CreatedAt time.Time     `json:"created_at"`
 	Summary   ChainSummary  `json:"summary"`
+	LikelyPaths   []AttackPath `json:"likely_paths,omitempty"`   // 成功概率最高的路径，按概率从高到低
+	RiskiestPaths []AttackPath `json:"riskiest_paths,omitempty"` // 风险评分最高的路径，按风险从高到低
+	ChokePoints   *ChokePointAnalysis `json:"choke_points,omitempty"` // 瓶颈点和最小割，按请求生成
 }
 
 // ChainSummary 攻击链摘要
@@ -51,6 +57,9 @@ type ChainSummary struct {
 	EstimatedTime      string  `json:"estimated_time"`
 	SuccessProbability float64 `json:"success_probability"`
 	MostLikelyPath     []string `json:"most_likely_path"`
+	HighestRiskPath    []string `json:"highest_risk_path,omitempty"`
+	EntryPoints        int      `json:"entry_points,omitempty"` // 分析的入口节点数
+	Targets            int      `json:"targets,omitempty"`      // 分析的数据窃取节点数
 	RiskFactors        []string `json:"risk_factors"`
 }
 
@@ -86,38 +95,134 @@ func (ag *AttackGraph) AddEdge(edge *AttackEdge) {
 	ag.adjList[edge.From] = append(ag.adjList[edge.From], edge.To)
 }
 
-// FindAllPaths 查找所有攻击路径
-func (ag *AttackGraph) FindAllPaths(startNodeID, endNodeID string) [][]string {
-	var allPaths [][]string
-	var currentPath []string
-	visited := make(map[string]bool)
+// Nodes 返回所有节点，按ID排序
+func (ag *AttackGraph) Nodes() []AttackNode {
+	nodes := make([]AttackNode, 0, len(ag.nodes))
+	for _, node := range ag.nodes {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Edges 返回所有边，按起点和终点排序
+func (ag *AttackGraph) Edges() []AttackEdge {
+	var edges []AttackEdge
+	for _, list := range ag.edges {
+		for _, edge := range list {
+			edges = append(edges, *edge)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
 
-	ag.dfsAllPaths(startNodeID, endNodeID, visited, currentPath, &allPaths)
-	return allPaths
+// FindAllPaths 查找从起点到终点的无环路径，最多返回 opts.MaxPaths 条（默认 DefaultMaxPaths），
+// 路径最多包含 opts.MaxDepth 个节点。路径数量随图的规模指数增长，只适合导出小图的路径；
+// 排序查询应使用 FindMostLikelyPath、TopLikelyPaths 等多项式时间的方法
+func (ag *AttackGraph) FindAllPaths(ctx context.Context, startNodeID, endNodeID string, opts PathOptions) ([][]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.MaxPaths <= 0 {
+		opts.MaxPaths = DefaultMaxPaths
+	}
+	search := &pathSearch{
+		ctx:      ctx,
+		graph:    ag,
+		target:   endNodeID,
+		opts:     opts,
+		distance: ag.hopsTo(endNodeID),
+		visited:  make(map[string]bool),
+	}
+	if _, ok := search.distance[startNodeID]; !ok {
+		return nil, nil
+	}
+	if err := search.dfs(startNodeID); err != nil && err != errPathLimit {
+		return nil, err
+	}
+	return search.paths, nil
 }
 
-// dfsAllPaths 深度优先搜索所有路径
-func (ag *AttackGraph) dfsAllPaths(current, target string, visited map[string]bool, path []string, allPaths *[][]string) {
-	visited[current] = true
-	path = append(path, current)
+// errPathLimit 路径数达到上限，停止搜索
+var errPathLimit = errors.New("path limit reached")
+
+// pathSearch 有限制的深度优先路径搜索
+type pathSearch struct {
+	ctx      context.Context
+	graph    *AttackGraph
+	target   string
+	opts     PathOptions
+	distance map[string]int // 到终点的最少边数，不在其中的节点无法到达终点
+	visited  map[string]bool
+	path     []string
+	paths    [][]string
+	steps    int
+}
 
-	if current == target {
+// dfs 深度优先搜索，剪去无法到达终点或超过深度限制的分支
+func (s *pathSearch) dfs(current string) error {
+	if s.steps++; s.steps&1023 == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	s.visited[current] = true
+	s.path = append(s.path, current)
+	defer func() {
+		s.visited[current] = false
+		s.path = s.path[:len(s.path)-1]
+	}()
+
+	if current == s.target {
 		// 找到目标，复制路径
-		pathCopy := make([]string, len(path))
-		copy(pathCopy, path)
-		*allPaths = append(*allPaths, pathCopy)
-	} else {
-		// 继续搜索邻接节点
-		for _, neighbor := range ag.adjList[current] {
-			if !visited[neighbor] {
-				ag.dfsAllPaths(neighbor, target, visited, path, allPaths)
-			}
+		s.paths = append(s.paths, append([]string(nil), s.path...))
+		if len(s.paths) >= s.opts.MaxPaths {
+			return errPathLimit
 		}
+		return nil
 	}
+	for _, neighbor := range s.graph.adjList[current] {
+		hops, ok := s.distance[neighbor]
+		if !ok || s.visited[neighbor] {
+			continue
+		}
+		if s.opts.MaxDepth > 0 && len(s.path)+1+hops > s.opts.MaxDepth {
+			continue
+		}
+		if err := s.dfs(neighbor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// 回溯
-	visited[current] = false
-	path = path[:len(path)-1]
+// hopsTo 反向广度优先搜索，返回每个能到达终点的节点到终点的最少边数
+func (ag *AttackGraph) hopsTo(target string) map[string]int {
+	reverse := make(map[string][]string)
+	for from, neighbors := range ag.adjList {
+		for _, to := range neighbors {
+			reverse[to] = append(reverse[to], from)
+		}
+	}
+	distance := map[string]int{target: 0}
+	queue := []string{target}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, prev := range reverse[current] {
+			if _, ok := distance[prev]; !ok {
+				distance[prev] = distance[current] + 1
+				queue = append(queue, prev)
+			}
+		}
+	}
+	return distance
 }
 
 // CalculatePathProbability 计算路径成功概率
@@ -182,106 +287,98 @@ func (ag *AttackGraph) getSeverityMultiplier(severity string) float64 {
 	}
 }
 
-// FindMostLikelyPath 查找最可能的攻击路径
-func (ag *AttackGraph) FindMostLikelyPath(startNodeID, endNodeID string) []string {
-	allPaths := ag.FindAllPaths(startNodeID, endNodeID)
-	if len(allPaths) == 0 {
-		return nil
-	}
-
-	var bestPath []string
-	bestProbability := 0.0
-
-	for _, path := range allPaths {
-		probability := ag.CalculatePathProbability(path)
-		if probability > bestProbability {
-			bestProbability = probability
-			bestPath = path
-		}
+// FindMostLikelyPath 查找成功概率最高的攻击路径，没有路径时返回nil
+func (ag *AttackGraph) FindMostLikelyPath(ctx context.Context, startNodeID, endNodeID string, opts PathOptions) ([]string, error) {
+	opts.MaxPaths = 1
+	paths, err := ag.TopLikelyPaths(ctx, []string{startNodeID}, []string{endNodeID}, opts)
+	if err != nil || len(paths) == 0 {
+		return nil, err
 	}
-
-	return bestPath
+	return paths[0].Nodes, nil
 }
 
-// FindHighestRiskPath 查找风险最高的攻击路径
-func (ag *AttackGraph) FindHighestRiskPath(startNodeID, endNodeID string) []string {
-	allPaths := ag.FindAllPaths(startNodeID, endNodeID)
-	if len(allPaths) == 0 {
-		return nil
+// FindHighestRiskPath 查找风险评分最高的攻击路径，没有路径时返回nil
+func (ag *AttackGraph) FindHighestRiskPath(ctx context.Context, startNodeID, endNodeID string, opts PathOptions) ([]string, error) {
+	opts.MaxPaths = 1
+	paths, err := ag.TopRiskPaths(ctx, []string{startNodeID}, []string{endNodeID}, opts)
+	if err != nil || len(paths) == 0 {
+		return nil, err
 	}
-
-	var riskiestPath []string
-	highestRisk := 0.0
-
-	for _, path := range allPaths {
-		risk := ag.CalculatePathRisk(path)
-		if risk > highestRisk {
-			highestRisk = risk
-			riskiestPath = path
-		}
-	}
-
-	return riskiestPath
+	return paths[0].Nodes, nil
 }
 
-// AnalyzeAttackChain 分析攻击链
-func (ag *AttackGraph) AnalyzeAttackChain(name string) *AttackChain {
+// AnalyzeAttackChain 分析从所有入口节点到所有数据窃取节点的攻击路径，返回成功概率最高和风险最高的
+// 各 opts.MaxPaths 条路径（默认 DefaultTopK）。链的节点和边为这些路径经过的节点和边，
+// 摘要描述成功概率最高的路径。没有攻击路径时返回nil，ctx 取消时返回错误
+func (ag *AttackGraph) AnalyzeAttackChain(ctx context.Context, name string, opts PathOptions) (*AttackChain, error) {
 	// 查找入口和出口节点
 	entryNodes := ag.findNodesByType("entry")
 	exfilNodes := ag.findNodesByType("exfiltration")
 
 	if len(entryNodes) == 0 || len(exfilNodes) == 0 {
 		ag.logger.Warn("No entry or exfiltration nodes found")
-		return nil
+		return nil, nil
 	}
 
-	// 使用第一个入口和出口节点
-	startNode := entryNodes[0]
-	endNode := exfilNodes[0]
-
-	// 查找所有路径
-	allPaths := ag.FindAllPaths(startNode, endNode)
-	if len(allPaths) == 0 {
+	likelyPaths, err := ag.TopLikelyPaths(ctx, entryNodes, exfilNodes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank attack paths: %w", err)
+	}
+	if len(likelyPaths) == 0 {
 		ag.logger.Warn("No attack paths found")
-		return nil
+		return nil, nil
+	}
+	riskPaths, err := ag.TopRiskPaths(ctx, entryNodes, exfilNodes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank attack paths: %w", err)
 	}
-
-	// 找到最可能的路径
-	mostLikelyPath := ag.FindMostLikelyPath(startNode, endNode)
-	highestRiskPath := ag.FindHighestRiskPath(startNode, endNode)
 
 	// 计算统计信息
+	mostLikelyPath := likelyPaths[0].Nodes
 	totalSteps := len(mostLikelyPath)
 	criticalVulns := ag.countCriticalVulns(mostLikelyPath)
-	successProbability := ag.CalculatePathProbability(mostLikelyPath) * 100
-	riskScore := ag.CalculatePathRisk(highestRiskPath)
+	successProbability := likelyPaths[0].Probability * 100
+	riskScore := riskPaths[0].RiskScore
 
 	// 估算攻击时间
 	estimatedTime := ag.estimateAttackTime(totalSteps, criticalVulns)
 
+	var covered [][]string
+	for _, p := range likelyPaths {
+		covered = append(covered, p.Nodes)
+	}
+	for _, p := range riskPaths {
+		covered = append(covered, p.Nodes)
+	}
+
 	// 构建攻击链
 	chain := &AttackChain{
-		ID:        fmt.Sprintf("chain-%d", time.Now().Unix()),
-		Name:      name,
-		Nodes:     ag.getNodesFromPath(mostLikelyPath),
-		Edges:     ag.getEdgesFromPath(mostLikelyPath),
-		RiskScore: riskScore,
-		Status:    "completed",
-		CreatedAt: time.Now(),
+		ID:            fmt.Sprintf("chain-%d", time.Now().UnixNano()),
+		Name:          name,
+		Nodes:         ag.getNodesFromPaths(covered),
+		Edges:         ag.getEdgesFromPaths(covered),
+		RiskScore:     riskScore,
+		Status:        "completed",
+		CreatedAt:     time.Now(),
+		LikelyPaths:   likelyPaths,
+		RiskiestPaths: riskPaths,
 		Summary: ChainSummary{
 			TotalSteps:         totalSteps,
 			CriticalVulns:      criticalVulns,
 			EstimatedTime:      estimatedTime,
 			SuccessProbability: successProbability,
 			MostLikelyPath:     mostLikelyPath,
+			HighestRiskPath:    riskPaths[0].Nodes,
+			EntryPoints:        len(entryNodes),
+			Targets:            len(exfilNodes),
 			RiskFactors:        ag.identifyRiskFactors(mostLikelyPath),
 		},
 	}
 
-	return chain
+	return chain, nil
 }
 
-// findNodesByType 根据类型查找节点
+// findNodesByType 根据类型查找节点，按ID排序
 func (ag *AttackGraph) findNodesByType(nodeType string) []string {
 	var nodes []string
 	for id, node := range ag.nodes {
@@ -289,6 +386,7 @@ func (ag *AttackGraph) findNodesByType(nodeType string) []string {
 			nodes = append(nodes, id)
 		}
 	}
+	sort.Strings(nodes)
 	return nodes
 }
 
@@ -354,6 +452,37 @@ func (ag *AttackGraph) getEdgesFromPath(path []string) []AttackEdge {
 	return edges
 }
 
+// getNodesFromPaths 获取多条路径经过的节点，按首次出现的顺序去重
+func (ag *AttackGraph) getNodesFromPaths(paths [][]string) []AttackNode {
+	var nodes []AttackNode
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		for _, node := range ag.getNodesFromPath(path) {
+			if !seen[node.ID] {
+				seen[node.ID] = true
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
+// getEdgesFromPaths 获取多条路径经过的边，按首次出现的顺序去重
+func (ag *AttackGraph) getEdgesFromPaths(paths [][]string) []AttackEdge {
+	var edges []AttackEdge
+	seen := make(map[[2]string]bool)
+	for _, path := range paths {
+		for _, edge := range ag.getEdgesFromPath(path) {
+			key := [2]string{edge.From, edge.To}
+			if !seen[key] {
+				seen[key] = true
+				edges = append(edges, edge)
+			}
+		}
+	}
+	return edges
+}
+
 // identifyRiskFactors 识别风险因素
 func (ag *AttackGraph) identifyRiskFactors(path []string) []string {
 	var factors []string
@@ -403,6 +532,16 @@ func NewChainAnalyzer(logger *logrus.Logger) *ChainAnalyzer {
 	}
 }
 
+// Build 根据IaC发现、云资源和资源关系构建攻击图，替换已加载的数据
+func (ca *ChainAnalyzer) Build(input GraphInput) {
+	ca.graph = BuildGraph(input, ca.logger)
+}
+
+// Graph 返回分析使用的攻击图
+func (ca *ChainAnalyzer) Graph() *AttackGraph {
+	return ca.graph
+}
+
 // LoadSampleData 加载示例数据
 func (ca *ChainAnalyzer) LoadSampleData() {
 	// 添加攻击节点
@@ -487,10 +626,10 @@ func (ca *ChainAnalyzer) LoadSampleData() {
 	}
 }
 
-// AnalyzeChain 分析攻击链
-func (ca *ChainAnalyzer) AnalyzeChain(name string) *AttackChain {
+// AnalyzeChain 分析攻击链，返回成功概率最高和风险最高的各 opts.MaxPaths 条路径
+func (ca *ChainAnalyzer) AnalyzeChain(ctx context.Context, name string, opts PathOptions) (*AttackChain, error) {
 	ca.logger.Info("Starting attack chain analysis: ", name)
-	return ca.graph.AnalyzeAttackChain(name)
+	return ca.graph.AnalyzeAttackChain(ctx, name, opts)
 }
 
 // GetAllChains 获取所有攻击链
@@ -0,0 +1,404 @@
+package attack
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DefaultChokePaths 瓶颈点分析默认统计的路径数
+const DefaultChokePaths = 200
+
+// remediationCosts 各类节点的默认修复代价：关闭公网暴露或收紧角色较容易，
+// 修补漏洞需要发布，改造数据存储的访问方式代价最高。节点元数据 remediation_cost 可覆盖
+var remediationCosts = map[string]float64{
+	"entry":         1,
+	"vulnerability": 2,
+	"privilege":     2,
+	"exploit":       3,
+	"persistence":   3,
+	"exfiltration":  4,
+}
+
+// ChokePoint 节点在攻击路径中的覆盖情况，修复该节点即消除经过它的路径
+type ChokePoint struct {
+	NodeID      string  `json:"node_id"`
+	Label       string  `json:"label"`
+	Type        string  `json:"type"`
+	Paths       int     `json:"paths"`             // 经过该节点的路径数
+	Coverage    float64 `json:"coverage"`          // 经过该节点的路径占比，百分比
+	Weighted    float64 `json:"weighted_coverage"` // 按路径成功概率加权的占比，百分比
+	Remediation string  `json:"remediation,omitempty"`
+	Cost        float64 `json:"cost"`
+}
+
+// RemediationImpact 一条修复建议消除的攻击路径。同一修复建议可能对应多个节点
+type RemediationImpact struct {
+	Remediation string   `json:"remediation"`
+	Nodes       []string `json:"nodes"`
+	Paths       int      `json:"paths"`      // 消除的路径数
+	Percentage  float64  `json:"percentage"` // 消除的路径占比
+	Cost        float64  `json:"cost"`       // 涉及节点的修复代价之和
+}
+
+// GraphCut 分隔所有入口节点和数据窃取节点的最小割
+type GraphCut struct {
+	Nodes []string `json:"nodes,omitempty"`
+	Edges []string `json:"edges,omitempty"` // 边ID，没有ID的边为 from->to
+	Cost  float64  `json:"cost"`
+}
+
+// ChokePointAnalysis 瓶颈点分析结果
+type ChokePointAnalysis struct {
+	Paths        int                 `json:"paths"`     // 参与覆盖统计的路径数
+	MaxPaths     int                 `json:"max_paths"` // 统计的路径数上限，Complete 为false时占比只基于成功概率最高的这些路径
+	Complete     bool                `json:"complete"`  // 统计的路径是否包含了深度限制内的所有路径
+	ChokePoints  []ChokePoint        `json:"choke_points"`
+	Remediations []RemediationImpact `json:"remediations"`
+	NodeCut      GraphCut            `json:"node_cut"` // 按修复代价加权的最小节点割
+	EdgeCut      GraphCut            `json:"edge_cut"` // 每条边代价为1的最小边割，即最少需要切断的关系
+}
+
+// RemediationCost 节点的修复代价，元数据 remediation_cost 为正数时使用该值，否则按节点类型取默认值
+func RemediationCost(node *AttackNode) float64 {
+	if v, err := strconv.ParseFloat(node.Metadata["remediation_cost"], 64); err == nil && v > 0 {
+		return v
+	}
+	if cost, ok := remediationCosts[node.Type]; ok {
+		return cost
+	}
+	return 3
+}
+
+// AnalyzeChokePoints 分析修复哪些节点能切断最多的攻击路径。覆盖统计基于从所有入口到所有数据窃取节点
+// 成功概率最高的 opts.MaxPaths 条路径（默认 DefaultChokePaths），路径数少于该值时即为全部路径；
+// 最小割基于整个攻击图，不受路径数和深度限制
+func (ag *AttackGraph) AnalyzeChokePoints(ctx context.Context, opts PathOptions) (*ChokePointAnalysis, error) {
+	if opts.MaxPaths <= 0 {
+		opts.MaxPaths = DefaultChokePaths
+	}
+	entries := ag.findNodesByType("entry")
+	targets := ag.findNodesByType("exfiltration")
+	analysis := &ChokePointAnalysis{MaxPaths: opts.MaxPaths, ChokePoints: []ChokePoint{}, Remediations: []RemediationImpact{}}
+
+	paths, err := ag.TopLikelyPaths(ctx, entries, targets, opts)
+	if err != nil {
+		return nil, err
+	}
+	analysis.Paths = len(paths)
+	analysis.Complete = len(paths) < opts.MaxPaths
+	ag.coverage(analysis, paths)
+
+	if analysis.NodeCut, err = ag.minNodeCut(ctx, entries, targets); err != nil {
+		return nil, err
+	}
+	if analysis.EdgeCut, err = ag.minEdgeCut(ctx, entries, targets); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// coverage 统计每个节点和每条修复建议消除的路径
+func (ag *AttackGraph) coverage(analysis *ChokePointAnalysis, paths []AttackPath) {
+	if len(paths) == 0 {
+		return
+	}
+	totalProbability := 0.0
+	for _, p := range paths {
+		totalProbability += p.Probability
+	}
+	percent := func(part, total float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return math.Round(part/total*10000) / 100
+	}
+
+	nodePaths := make(map[string]int)
+	nodeProbability := make(map[string]float64)
+	fixPaths := make(map[string]int)
+	for _, p := range paths {
+		fixes := make(map[string]bool)
+		for _, id := range p.Nodes {
+			nodePaths[id]++
+			nodeProbability[id] += p.Probability
+			if r := ag.nodes[id].Remediation; r != "" {
+				fixes[r] = true
+			}
+		}
+		for r := range fixes {
+			fixPaths[r]++
+		}
+	}
+
+	for id, count := range nodePaths {
+		node := ag.nodes[id]
+		analysis.ChokePoints = append(analysis.ChokePoints, ChokePoint{
+			NodeID:      id,
+			Label:       node.Label,
+			Type:        node.Type,
+			Paths:       count,
+			Coverage:    percent(float64(count), float64(len(paths))),
+			Weighted:    percent(nodeProbability[id], totalProbability),
+			Remediation: node.Remediation,
+			Cost:        RemediationCost(node),
+		})
+	}
+	sort.Slice(analysis.ChokePoints, func(i, j int) bool {
+		a, b := analysis.ChokePoints[i], analysis.ChokePoints[j]
+		if a.Paths != b.Paths {
+			return a.Paths > b.Paths
+		}
+		if a.Weighted != b.Weighted {
+			return a.Weighted > b.Weighted
+		}
+		if a.Cost != b.Cost {
+			return a.Cost < b.Cost
+		}
+		return a.NodeID < b.NodeID
+	})
+
+	fixes := make(map[string]*RemediationImpact)
+	for _, id := range sortedNodeIDs(ag.nodes) {
+		node := ag.nodes[id]
+		if node.Remediation == "" {
+			continue
+		}
+		impact, ok := fixes[node.Remediation]
+		if !ok {
+			impact = &RemediationImpact{Remediation: node.Remediation, Paths: fixPaths[node.Remediation]}
+			impact.Percentage = percent(float64(impact.Paths), float64(len(paths)))
+			fixes[node.Remediation] = impact
+		}
+		impact.Nodes = append(impact.Nodes, id)
+		impact.Cost += RemediationCost(node)
+	}
+	for _, impact := range fixes {
+		analysis.Remediations = append(analysis.Remediations, *impact)
+	}
+	sort.Slice(analysis.Remediations, func(i, j int) bool {
+		a, b := analysis.Remediations[i], analysis.Remediations[j]
+		if a.Paths != b.Paths {
+			return a.Paths > b.Paths
+		}
+		if a.Cost != b.Cost {
+			return a.Cost < b.Cost
+		}
+		return a.Remediation < b.Remediation
+	})
+}
+
+// minNodeCut 修复代价之和最小、使入口无法到达任何数据窃取节点的节点集合。
+// 每个节点拆分为入点和出点，之间的容量为修复代价，攻击边的容量为无穷大
+func (ag *AttackGraph) minNodeCut(ctx context.Context, entries, targets []string) (GraphCut, error) {
+	ids := sortedNodeIDs(ag.nodes)
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	in := func(i int) int { return 2 + 2*i }
+	out := func(i int) int { return 3 + 2*i }
+
+	infinite := 1.0
+	for _, id := range ids {
+		infinite += RemediationCost(ag.nodes[id])
+	}
+	f := newFlowNetwork(2 + 2*len(ids))
+	for i, id := range ids {
+		f.addEdge(in(i), out(i), RemediationCost(ag.nodes[id]))
+	}
+	for _, edge := range ag.Edges() {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if ok1 && ok2 && edge.Probability > 0 {
+			f.addEdge(out(from), in(to), infinite)
+		}
+	}
+	for _, id := range entries {
+		f.addEdge(superSource, in(index[id]), infinite)
+	}
+	for _, id := range targets {
+		f.addEdge(out(index[id]), superSink, infinite)
+	}
+
+	if _, err := f.maxFlow(ctx, superSource, superSink); err != nil {
+		return GraphCut{}, err
+	}
+	reach := f.reachable(superSource)
+	cut := GraphCut{}
+	for i, id := range ids {
+		if reach[in(i)] && !reach[out(i)] {
+			cut.Nodes = append(cut.Nodes, id)
+			cut.Cost += RemediationCost(ag.nodes[id])
+		}
+	}
+	return cut, nil
+}
+
+// minEdgeCut 数量最少、使入口无法到达任何数据窃取节点的攻击边集合
+func (ag *AttackGraph) minEdgeCut(ctx context.Context, entries, targets []string) (GraphCut, error) {
+	ids := sortedNodeIDs(ag.nodes)
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i + 2
+	}
+
+	type arc struct {
+		from, to int
+		label    string
+	}
+	var arcs []arc
+	seen := make(map[[2]int]bool)
+	f := newFlowNetwork(2 + len(ids))
+	for _, edge := range ag.Edges() {
+		from, ok1 := index[edge.From]
+		to, ok2 := index[edge.To]
+		if !ok1 || !ok2 || edge.Probability <= 0 || seen[[2]int{from, to}] {
+			continue
+		}
+		seen[[2]int{from, to}] = true
+		label := edge.ID
+		if label == "" {
+			label = edge.From + "->" + edge.To
+		}
+		f.addEdge(from, to, 1)
+		arcs = append(arcs, arc{from: from, to: to, label: label})
+	}
+	infinite := float64(len(arcs) + 1)
+	for _, id := range entries {
+		f.addEdge(superSource, index[id], infinite)
+	}
+	for _, id := range targets {
+		f.addEdge(index[id], superSink, infinite)
+	}
+
+	if _, err := f.maxFlow(ctx, superSource, superSink); err != nil {
+		return GraphCut{}, err
+	}
+	reach := f.reachable(superSource)
+	cut := GraphCut{}
+	for _, a := range arcs {
+		if reach[a.from] && !reach[a.to] {
+			cut.Edges = append(cut.Edges, a.label)
+			cut.Cost++
+		}
+	}
+	return cut, nil
+}
+
+func sortedNodeIDs(nodes map[string]*AttackNode) []string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// flowNetwork Dinic最大流，用于计算最小割
+type flowNetwork struct {
+	to    []int
+	cap   []float64
+	adj   [][]int
+	level []int
+	next  []int
+}
+
+// flowEpsilon 剩余容量小于该值视为0
+const flowEpsilon = 1e-9
+
+func newFlowNetwork(n int) *flowNetwork {
+	return &flowNetwork{adj: make([][]int, n), level: make([]int, n), next: make([]int, n)}
+}
+
+// addEdge 添加容量为 capacity 的有向边及其反向边，返回正向边的编号
+func (f *flowNetwork) addEdge(from, to int, capacity float64) int {
+	id := len(f.to)
+	f.to = append(f.to, to, from)
+	f.cap = append(f.cap, capacity, 0)
+	f.adj[from] = append(f.adj[from], id)
+	f.adj[to] = append(f.adj[to], id+1)
+	return id
+}
+
+// maxFlow 计算从 s 到 t 的最大流，每轮分层前检查 ctx
+func (f *flowNetwork) maxFlow(ctx context.Context, s, t int) (float64, error) {
+	total := 0.0
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if !f.bfs(s, t) {
+			return total, nil
+		}
+		for i := range f.next {
+			f.next[i] = 0
+		}
+		for {
+			pushed := f.dfs(s, t, math.Inf(1))
+			if pushed <= flowEpsilon {
+				break
+			}
+			total += pushed
+		}
+	}
+}
+
+// bfs 在剩余网络上分层，返回 t 是否可达
+func (f *flowNetwork) bfs(s, t int) bool {
+	for i := range f.level {
+		f.level[i] = -1
+	}
+	f.level[s] = 0
+	queue := []int{s}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, e := range f.adj[u] {
+			if v := f.to[e]; f.cap[e] > flowEpsilon && f.level[v] < 0 {
+				f.level[v] = f.level[u] + 1
+				queue = append(queue, v)
+			}
+		}
+	}
+	return f.level[t] >= 0
+}
+
+// dfs 沿分层图寻找增广路径
+func (f *flowNetwork) dfs(u, t int, limit float64) float64 {
+	if u == t {
+		return limit
+	}
+	for ; f.next[u] < len(f.adj[u]); f.next[u]++ {
+		e := f.adj[u][f.next[u]]
+		v := f.to[e]
+		if f.cap[e] <= flowEpsilon || f.level[v] != f.level[u]+1 {
+			continue
+		}
+		if pushed := f.dfs(v, t, math.Min(limit, f.cap[e])); pushed > flowEpsilon {
+			f.cap[e] -= pushed
+			f.cap[e^1] += pushed
+			return pushed
+		}
+	}
+	return 0
+}
+
+// reachable 最大流后剩余网络中从 s 可达的节点，可达与不可达之间的饱和边构成最小割
+func (f *flowNetwork) reachable(s int) []bool {
+	reach := make([]bool, len(f.adj))
+	reach[s] = true
+	queue := []int{s}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, e := range f.adj[u] {
+			if v := f.to[e]; f.cap[e] > flowEpsilon && !reach[v] {
+				reach[v] = true
+				queue = append(queue, v)
+			}
+		}
+	}
+	return reach
+}
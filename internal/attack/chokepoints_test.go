@@ -0,0 +1,110 @@
+package attack
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// chokeGraph 三个入口经两个漏洞汇聚到同一代码执行节点和角色，再到两个数据窃取节点，共6条路径。
+// 修复角色 p（代价2）比关闭三个入口（代价3）或修补两个漏洞（代价4）更便宜
+func chokeGraph(roleCost string) *AttackGraph {
+	g := NewAttackGraph(quietLogger())
+	nodes := []struct{ id, nodeType string }{
+		{"e1", "entry"}, {"e2", "entry"}, {"e3", "entry"},
+		{"v1", "vulnerability"}, {"v2", "vulnerability"},
+		{"x", "exploit"}, {"p", "privilege"},
+		{"d1", "exfiltration"}, {"d2", "exfiltration"},
+	}
+	for _, n := range nodes {
+		node := &AttackNode{ID: n.id, Label: n.id, Type: n.nodeType, Severity: "high", CVSS: 7}
+		if n.nodeType == "entry" {
+			node.Remediation = "restrict ingress"
+		}
+		if n.id == "p" && roleCost != "" {
+			node.Metadata = map[string]string{"remediation_cost": roleCost}
+		}
+		g.AddNode(node)
+	}
+	for _, e := range []testEdge{
+		{"e1", "v1", 0.9}, {"e2", "v2", 0.8}, {"e3", "v2", 0.7},
+		{"v1", "x", 0.9}, {"v2", "x", 0.9},
+		{"x", "p", 0.9},
+		{"p", "d1", 0.9}, {"p", "d2", 0.5},
+	} {
+		g.AddEdge(&AttackEdge{ID: e.from + "-" + e.to, From: e.from, To: e.to, Probability: e.p})
+	}
+	return g
+}
+
+func TestAnalyzeChokePoints(t *testing.T) {
+	analysis, err := chokeGraph("").AnalyzeChokePoints(context.Background(), PathOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Paths != 6 || analysis.MaxPaths != DefaultChokePaths || !analysis.Complete {
+		t.Errorf("paths = %d, max paths = %d, complete = %v, want 6, %d, true", analysis.Paths, analysis.MaxPaths, analysis.Complete, DefaultChokePaths)
+	}
+	// x 和 p 都覆盖所有路径，p 的修复代价更低
+	if cp := analysis.ChokePoints[0]; cp.NodeID != "p" || cp.Paths != 6 || cp.Coverage != 100 || cp.Weighted != 100 {
+		t.Errorf("first choke point = %+v, want p covering all paths", cp)
+	}
+	if r := analysis.Remediations[0]; r.Remediation != "restrict ingress" || r.Percentage != 100 || r.Cost != 3 || len(r.Nodes) != 3 {
+		t.Errorf("first remediation = %+v, want restrict ingress on 3 entries", r)
+	}
+
+	want := GraphCut{Nodes: []string{"p"}, Cost: 2}
+	if !reflect.DeepEqual(analysis.NodeCut, want) {
+		t.Errorf("node cut = %+v, want %+v", analysis.NodeCut, want)
+	}
+	want = GraphCut{Edges: []string{"x-p"}, Cost: 1}
+	if !reflect.DeepEqual(analysis.EdgeCut, want) {
+		t.Errorf("edge cut = %+v, want %+v", analysis.EdgeCut, want)
+	}
+}
+
+func TestAnalyzeChokePointsRemediationCostOverride(t *testing.T) {
+	tests := []struct {
+		roleCost string
+		want     GraphCut
+	}{
+		{"", GraphCut{Nodes: []string{"p"}, Cost: 2}},
+		{"1.5", GraphCut{Nodes: []string{"p"}, Cost: 1.5}},
+		// 角色难以收紧时改为关闭三个入口
+		{"10", GraphCut{Nodes: []string{"e1", "e2", "e3"}, Cost: 3}},
+		// 无效的覆盖值使用默认代价
+		{"-1", GraphCut{Nodes: []string{"p"}, Cost: 2}},
+	}
+	for _, tt := range tests {
+		analysis, err := chokeGraph(tt.roleCost).AnalyzeChokePoints(context.Background(), PathOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(analysis.NodeCut, tt.want) {
+			t.Errorf("remediation_cost %q: node cut = %+v, want %+v", tt.roleCost, analysis.NodeCut, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeChokePointsPathLimit(t *testing.T) {
+	analysis, err := chokeGraph("").AnalyzeChokePoints(context.Background(), PathOptions{MaxPaths: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Paths != 4 || analysis.MaxPaths != 4 || analysis.Complete {
+		t.Errorf("paths = %d, max paths = %d, complete = %v, want 4, 4, false", analysis.Paths, analysis.MaxPaths, analysis.Complete)
+	}
+	// 最小割基于整个攻击图，不受路径数限制
+	if want := (GraphCut{Nodes: []string{"p"}, Cost: 2}); !reflect.DeepEqual(analysis.NodeCut, want) {
+		t.Errorf("node cut = %+v, want %+v", analysis.NodeCut, want)
+	}
+}
+
+func TestAnalyzeChokePointsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chokeGraph("").AnalyzeChokePoints(ctx, PathOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
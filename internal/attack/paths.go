@@ -0,0 +1,477 @@
+package attack
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTopK 攻击链分析默认返回的路径数
+const DefaultTopK = 5
+
+// DefaultMaxPaths FindAllPaths 默认最多返回的路径数
+const DefaultMaxPaths = 1000
+
+// PathOptions 路径搜索限制
+type PathOptions struct {
+	MaxDepth int // 路径最多包含的节点数，0 表示不限制
+	MaxPaths int // 最多返回的路径数，0 表示使用各查询的默认值
+}
+
+// maxHops 索引图中路径最多经过的边数：真实路径的节点数加上虚拟起点和终点的两条边减一
+func (o PathOptions) maxHops() int {
+	if o.MaxDepth <= 0 {
+		return 0
+	}
+	return o.MaxDepth + 1
+}
+
+// minRiskCandidates 按风险排序前最少的候选路径数
+const minRiskCandidates = 20
+
+// maxImpact 节点影响的上限：CVSS 10 × critical 乘数 1.5
+const maxImpact = 15.0
+
+// AttackPath 从入口到目标的一条攻击路径
+type AttackPath struct {
+	Nodes       []string `json:"nodes"`
+	Probability float64  `json:"probability"`
+	RiskScore   float64  `json:"risk_score"`
+}
+
+// pathCost 路径搜索的代价函数
+type pathCost int
+
+const (
+	costLikelihood pathCost = iota // 边代价为 -log(概率)，代价最小的路径成功概率最高
+	costRisk                       // 另加节点代价 -log(影响/15)，偏向经过高危节点的路径
+)
+
+// searchGraph 路径搜索使用的索引图：0 为连接所有入口的虚拟起点，1 为所有目标连接的虚拟终点，
+// 其余节点按ID排序编号，邻接表按编号排序，保证结果与map遍历顺序无关
+type searchGraph struct {
+	ids  []string
+	adj  [][]searchEdge
+	cost map[[2]int]float64
+}
+
+type searchEdge struct {
+	to   int
+	cost float64
+}
+
+const (
+	superSource = 0
+	superSink   = 1
+)
+
+// newSearchGraph 构建索引图，概率不大于0的边视为不可达
+func (ag *AttackGraph) newSearchGraph(sources, targets []string, mode pathCost) *searchGraph {
+	ids := sortedNodeIDs(ag.nodes)
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i + 2
+	}
+
+	g := &searchGraph{
+		ids:  append([]string{"", ""}, ids...),
+		adj:  make([][]searchEdge, len(ids)+2),
+		cost: make(map[[2]int]float64),
+	}
+	nodeCost := func(id string) float64 {
+		if mode != costRisk {
+			return 0
+		}
+		node := ag.nodes[id]
+		impact := node.CVSS * ag.getSeverityMultiplier(node.Severity)
+		return -math.Log(math.Max(0.1, math.Min(maxImpact, impact)) / maxImpact)
+	}
+	add := func(from, to int, cost float64) {
+		key := [2]int{from, to}
+		if existing, ok := g.cost[key]; ok && existing <= cost {
+			return
+		}
+		g.cost[key] = cost
+	}
+
+	for _, id := range sources {
+		if i, ok := index[id]; ok {
+			add(superSource, i, nodeCost(id))
+		}
+	}
+	for _, id := range targets {
+		if i, ok := index[id]; ok {
+			add(i, superSink, 0)
+		}
+	}
+	for from, edges := range ag.edges {
+		fi, ok := index[from]
+		if !ok {
+			continue
+		}
+		for _, edge := range edges {
+			ti, ok := index[edge.To]
+			if !ok || edge.Probability <= 0 {
+				continue
+			}
+			add(fi, ti, -math.Log(math.Min(1, edge.Probability))+nodeCost(edge.To))
+		}
+	}
+
+	for key, cost := range g.cost {
+		g.adj[key[0]] = append(g.adj[key[0]], searchEdge{to: key[1], cost: cost})
+	}
+	for _, edges := range g.adj {
+		sort.Slice(edges, func(i, j int) bool { return edges[i].to < edges[j].to })
+	}
+	return g
+}
+
+// shortest 返回从 from 到虚拟终点代价最小的路径，跳过已移除的节点和边。maxHops 大于0时路径最多经过
+// maxHops 条边，使用按边数分层的松弛，复杂度 O(maxHops·E)；否则使用Dijkstra。
+// 代价相同时选择编号较小的节点，结果确定
+func (g *searchGraph) shortest(ctx context.Context, from, maxHops int, removedNodes map[int]bool, removedEdges map[[2]int]bool) ([]int, bool, error) {
+	if maxHops > 0 {
+		return g.shortestWithin(ctx, from, maxHops, removedNodes, removedEdges)
+	}
+
+	dist := make([]float64, len(g.adj))
+	prev := make([]int, len(g.adj))
+	done := make([]bool, len(g.adj))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+		prev[i] = -1
+	}
+	dist[from] = 0
+
+	queue := &distQueue{{node: from}}
+	for pops := 0; queue.Len() > 0; pops++ {
+		if pops&1023 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, false, err
+			}
+		}
+		item := heap.Pop(queue).(distItem)
+		if done[item.node] {
+			continue
+		}
+		done[item.node] = true
+		if item.node == superSink {
+			break
+		}
+		for _, edge := range g.adj[item.node] {
+			if removedNodes[edge.to] || removedEdges[[2]int{item.node, edge.to}] || done[edge.to] {
+				continue
+			}
+			if d := item.dist + edge.cost; d < dist[edge.to] {
+				dist[edge.to] = d
+				prev[edge.to] = item.node
+				heap.Push(queue, distItem{node: edge.to, dist: d})
+			}
+		}
+	}
+	if !done[superSink] {
+		return nil, false, nil
+	}
+
+	var path []int
+	for n := superSink; n != -1; n = prev[n] {
+		path = append(path, n)
+	}
+	reverse(path)
+	return path, true, nil
+}
+
+// shortestWithin 限制边数的最短路径。第 h 层只从上一层更新过的节点松弛，且只接受比此前所有层
+// 更小的代价，因为边代价非负，这样得到的路径不会重复经过节点
+func (g *searchGraph) shortestWithin(ctx context.Context, from, maxHops int, removedNodes map[int]bool, removedEdges map[[2]int]bool) ([]int, bool, error) {
+	best := make([]float64, len(g.adj))
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	best[from] = 0
+
+	frontier := map[int]float64{from: 0}
+	parents := []map[int]int{nil}
+	sinkLayer := -1
+	for h := 1; h <= maxHops && len(frontier) > 0; h++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		nodes := make([]int, 0, len(frontier))
+		for n := range frontier {
+			nodes = append(nodes, n)
+		}
+		sort.Ints(nodes)
+
+		next := make(map[int]float64)
+		parent := make(map[int]int)
+		for _, u := range nodes {
+			for _, edge := range g.adj[u] {
+				if removedNodes[edge.to] || removedEdges[[2]int{u, edge.to}] {
+					continue
+				}
+				if d := frontier[u] + edge.cost; d < best[edge.to] {
+					best[edge.to] = d
+					next[edge.to] = d
+					parent[edge.to] = u
+				}
+			}
+		}
+		parents = append(parents, parent)
+		if _, ok := next[superSink]; ok {
+			sinkLayer = h
+			delete(next, superSink)
+		}
+		frontier = next
+	}
+	if sinkLayer < 0 {
+		return nil, false, nil
+	}
+
+	path := []int{superSink}
+	for h, n := sinkLayer, superSink; h > 0; h-- {
+		n = parents[h][n]
+		path = append(path, n)
+	}
+	reverse(path)
+	return path, true, nil
+}
+
+func reverse(path []int) {
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+}
+
+// pathCostOf 计算索引路径的总代价
+func (g *searchGraph) pathCostOf(path []int) float64 {
+	total := 0.0
+	for i := 0; i+1 < len(path); i++ {
+		total += g.cost[[2]int{path[i], path[i+1]}]
+	}
+	return total
+}
+
+// yen 使用Yen算法按代价从小到大返回前 k 条无环路径（包含虚拟起点和终点），maxHops 大于0时限制路径的边数。
+// 每条路径最多进行路径长度次最短路径查询，总复杂度为 O(k·L·(E + V·log V))
+func (g *searchGraph) yen(ctx context.Context, k, maxHops int) ([][]int, error) {
+	first, ok, err := g.shortest(ctx, superSource, maxHops, nil, nil)
+	if err != nil || !ok || k <= 0 {
+		return nil, err
+	}
+	accepted := [][]int{first}
+	seen := map[string]bool{pathKey(first): true}
+	var candidates []candidatePath
+
+	for len(accepted) < k {
+		last := accepted[len(accepted)-1]
+		for i := 0; i < len(last)-1; i++ {
+			spur := last[i]
+			root := last[:i+1]
+			budget := 0
+			if maxHops > 0 {
+				if budget = maxHops - i; budget <= 0 {
+					break
+				}
+			}
+
+			removedEdges := make(map[[2]int]bool)
+			for _, p := range accepted {
+				if len(p) > i+1 && equalPrefix(p, root) {
+					removedEdges[[2]int{p[i], p[i+1]}] = true
+				}
+			}
+			removedNodes := make(map[int]bool, i)
+			for _, n := range root[:i] {
+				removedNodes[n] = true
+			}
+
+			spurPath, ok, err := g.shortest(ctx, spur, budget, removedNodes, removedEdges)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			total := append(append([]int{}, root[:i]...), spurPath...)
+			key := pathKey(total)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			candidates = append(candidates, candidatePath{nodes: total, cost: g.pathCostOf(total), key: g.labelKey(total)})
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		best := 0
+		for i := 1; i < len(candidates); i++ {
+			if candidates[i].less(candidates[best]) {
+				best = i
+			}
+		}
+		accepted = append(accepted, candidates[best].nodes)
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return accepted, nil
+}
+
+// labelKey 以节点ID拼接的路径键，用于代价相同时的确定排序
+func (g *searchGraph) labelKey(path []int) string {
+	ids := make([]string, 0, len(path))
+	for _, n := range path {
+		ids = append(ids, g.ids[n])
+	}
+	return strings.Join(ids, "\x00")
+}
+
+// candidatePath Yen算法的候选路径
+type candidatePath struct {
+	nodes []int
+	cost  float64
+	key   string
+}
+
+// less 按代价、长度和节点ID排序
+func (c candidatePath) less(o candidatePath) bool {
+	if c.cost != o.cost {
+		return c.cost < o.cost
+	}
+	if len(c.nodes) != len(o.nodes) {
+		return len(c.nodes) < len(o.nodes)
+	}
+	return c.key < o.key
+}
+
+func pathKey(path []int) string {
+	var b strings.Builder
+	for _, n := range path {
+		b.WriteString(strconv.Itoa(n))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func equalPrefix(path, prefix []int) bool {
+	for i, n := range prefix {
+		if path[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// distItem Dijkstra优先队列项
+type distItem struct {
+	node int
+	dist float64
+}
+
+type distQueue []distItem
+
+func (q distQueue) Len() int { return len(q) }
+func (q distQueue) Less(i, j int) bool {
+	if q[i].dist != q[j].dist {
+		return q[i].dist < q[j].dist
+	}
+	return q[i].node < q[j].node
+}
+func (q distQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *distQueue) Push(x interface{}) { *q = append(*q, x.(distItem)) }
+func (q *distQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// paths 去掉虚拟起点和终点，转换为攻击路径
+func (ag *AttackGraph) paths(g *searchGraph, found [][]int) []AttackPath {
+	result := make([]AttackPath, 0, len(found))
+	for _, p := range found {
+		ids := make([]string, 0, len(p)-2)
+		for _, n := range p[1 : len(p)-1] {
+			ids = append(ids, g.ids[n])
+		}
+		result = append(result, AttackPath{
+			Nodes:       ids,
+			Probability: ag.CalculatePathProbability(ids),
+			RiskScore:   ag.CalculatePathRisk(ids),
+		})
+	}
+	return result
+}
+
+// TopLikelyPaths 返回从任一入口到任一目标成功概率最高的 opts.MaxPaths 条路径（默认 DefaultTopK），
+// 在 -log(概率) 上使用Yen算法，按概率从高到低、长度从短到长、节点ID排序
+func (ag *AttackGraph) TopLikelyPaths(ctx context.Context, sources, targets []string, opts PathOptions) ([]AttackPath, error) {
+	k := opts.MaxPaths
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	g := ag.newSearchGraph(sources, targets, costLikelihood)
+	found, err := g.yen(ctx, k, opts.maxHops())
+	if err != nil {
+		return nil, err
+	}
+	paths := ag.paths(g, found)
+	sortPaths(paths, func(a, b AttackPath) int { return compareFloat(b.Probability, a.Probability) })
+	return paths, nil
+}
+
+// TopRiskPaths 返回从任一入口到任一目标风险评分最高的 opts.MaxPaths 条路径（默认 DefaultTopK）。
+// 风险评分是节点影响的平均值乘以路径概率，不能按边累加，因此先在 -log(概率) 加节点影响代价上
+// 用Yen算法取 4k 条（至少 minRiskCandidates 条）候选路径，再按风险评分从高到低排序取前 k 条。
+// 结果是近似的：风险评分最高的路径可能不在候选路径中
+func (ag *AttackGraph) TopRiskPaths(ctx context.Context, sources, targets []string, opts PathOptions) ([]AttackPath, error) {
+	k := opts.MaxPaths
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	g := ag.newSearchGraph(sources, targets, costRisk)
+	found, err := g.yen(ctx, max(4*k, minRiskCandidates), opts.maxHops())
+	if err != nil {
+		return nil, err
+	}
+	paths := ag.paths(g, found)
+	sortPaths(paths, func(a, b AttackPath) int {
+		if c := compareFloat(b.RiskScore, a.RiskScore); c != 0 {
+			return c
+		}
+		return compareFloat(b.Probability, a.Probability)
+	})
+	if len(paths) > k {
+		paths = paths[:k]
+	}
+	return paths, nil
+}
+
+// sortPaths 按 cmp 排序，相同时按长度和节点ID排序
+func sortPaths(paths []AttackPath, cmp func(a, b AttackPath) int) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		if c := cmp(paths[i], paths[j]); c != 0 {
+			return c < 0
+		}
+		if len(paths[i].Nodes) != len(paths[j].Nodes) {
+			return len(paths[i].Nodes) < len(paths[j].Nodes)
+		}
+		return strings.Join(paths[i].Nodes, "\x00") < strings.Join(paths[j].Nodes, "\x00")
+	})
+}
+
+// compareFloat 比较浮点数，忽略计算误差
+func compareFloat(a, b float64) int {
+	const epsilon = 1e-9
+	switch {
+	case a < b-epsilon:
+		return -1
+	case a > b+epsilon:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,253 @@
+package attack
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testEdge 测试图中的边
+type testEdge struct {
+	from, to string
+	p        float64
+}
+
+// newTestGraph 构建所有节点影响相同的攻击图，边按 seed 打乱后加入
+func newTestGraph(edges []testEdge, seed int64) *AttackGraph {
+	g := NewAttackGraph(quietLogger())
+	shuffled := append([]testEdge{}, edges...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	for i, e := range shuffled {
+		for _, id := range []string{e.from, e.to} {
+			if g.nodes[id] == nil {
+				g.AddNode(&AttackNode{ID: id, Label: id, Type: "exploit", Severity: "high", CVSS: 5})
+			}
+		}
+		g.AddEdge(&AttackEdge{ID: e.from + "-" + e.to + "-" + string(rune('a'+i)), From: e.from, To: e.to, Probability: e.p})
+	}
+	return g
+}
+
+func pathNodes(paths []AttackPath) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		result = append(result, strings.Join(p.Nodes, ","))
+	}
+	return result
+}
+
+// tiedEdges 五条路径的成功概率都是0.4，另有一条概率0.1的路径
+var tiedEdges = []testEdge{
+	{"s1", "a", 0.5}, {"s1", "b", 0.5}, {"s2", "a", 0.5},
+	{"a", "t", 0.8}, {"b", "t", 0.8},
+	{"s2", "t", 0.4},
+	{"s1", "c", 0.8}, {"c", "d", 0.5}, {"d", "t", 1},
+	{"s1", "t", 0.1},
+}
+
+func TestTopPathsTieOrder(t *testing.T) {
+	// 概率相同时按长度，再按节点ID排序
+	want := []string{"s2,t", "s1,a,t", "s1,b,t", "s2,a,t", "s1,c,d,t"}
+	sources, targets := []string{"s2", "s1"}, []string{"t"}
+	opts := PathOptions{MaxPaths: len(want)}
+
+	for seed := int64(0); seed < 20; seed++ {
+		g := newTestGraph(tiedEdges, seed)
+		likely, err := g.TopLikelyPaths(context.Background(), sources, targets, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pathNodes(likely); !reflect.DeepEqual(got, want) {
+			t.Fatalf("seed %d: TopLikelyPaths = %v, want %v", seed, got, want)
+		}
+		risk, err := g.TopRiskPaths(context.Background(), sources, targets, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pathNodes(risk); !reflect.DeepEqual(got, want) {
+			t.Fatalf("seed %d: TopRiskPaths = %v, want %v", seed, got, want)
+		}
+	}
+}
+
+// yenEdges 按概率排序的路径：s,a,t (0.81)、s,c,d,t (0.729)、s,b,t (0.45)、s,t (0.3)
+var yenEdges = []testEdge{
+	{"s", "a", 0.9}, {"a", "t", 0.9},
+	{"s", "c", 0.9}, {"c", "d", 0.9}, {"d", "t", 0.9},
+	{"s", "b", 0.5}, {"b", "t", 0.9},
+	{"s", "t", 0.3},
+}
+
+// labels 去掉虚拟起点和终点，返回以逗号连接的节点ID
+func labels(g *searchGraph, found [][]int) []string {
+	result := make([]string, 0, len(found))
+	for _, p := range found {
+		ids := make([]string, 0, len(p)-2)
+		for _, n := range p[1 : len(p)-1] {
+			ids = append(ids, g.ids[n])
+		}
+		result = append(result, strings.Join(ids, ","))
+	}
+	return result
+}
+
+func TestYen(t *testing.T) {
+	tests := []struct {
+		name     string
+		k        int
+		maxDepth int
+		want     []string
+	}{
+		{"all paths", 10, 0, []string{"s,a,t", "s,c,d,t", "s,b,t", "s,t"}},
+		{"top k", 2, 0, []string{"s,a,t", "s,c,d,t"}},
+		{"max depth 3", 10, 3, []string{"s,a,t", "s,b,t", "s,t"}},
+		{"max depth 2", 10, 2, []string{"s,t"}},
+		{"max depth 1", 10, 1, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ag := newTestGraph(yenEdges, 1)
+			g := ag.newSearchGraph([]string{"s"}, []string{"t"}, costLikelihood)
+			found, err := g.yen(context.Background(), tt.k, PathOptions{MaxDepth: tt.maxDepth}.maxHops())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := labels(g, found); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("yen = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortestWithin(t *testing.T) {
+	// 最可能的路径 s,a,b,x,t 有5个节点，限制为3个节点时只能经过概率较低的 s→x
+	ag := newTestGraph([]testEdge{
+		{"s", "a", 0.9}, {"a", "b", 0.9}, {"b", "x", 0.9}, {"x", "t", 0.9},
+		{"s", "x", 0.1},
+	}, 1)
+	g := ag.newSearchGraph([]string{"s"}, []string{"t"}, costLikelihood)
+
+	tests := []struct {
+		maxDepth int
+		want     []string
+	}{
+		{0, []string{"s,a,b,x,t"}},
+		{5, []string{"s,a,b,x,t"}},
+		{4, []string{"s,x,t"}},
+		{3, []string{"s,x,t"}},
+		{2, []string{}},
+	}
+	for _, tt := range tests {
+		path, ok, err := g.shortest(context.Background(), superSource, PathOptions{MaxDepth: tt.maxDepth}.maxHops(), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found [][]int
+		if ok {
+			found = append(found, path)
+		}
+		if got := labels(g, found); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("max depth %d: path = %v, want %v", tt.maxDepth, got, tt.want)
+		}
+	}
+}
+
+func TestPathSearchCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ag := newTestGraph(yenEdges, 1)
+	g := ag.newSearchGraph([]string{"s"}, []string{"t"}, costLikelihood)
+
+	for _, maxDepth := range []int{0, 3} {
+		if _, err := g.yen(ctx, 5, PathOptions{MaxDepth: maxDepth}.maxHops()); !errors.Is(err, context.Canceled) {
+			t.Errorf("yen with max depth %d: err = %v, want %v", maxDepth, err, context.Canceled)
+		}
+	}
+	if _, _, err := g.shortestWithin(ctx, superSource, 4, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("shortestWithin: err = %v, want %v", err, context.Canceled)
+	}
+	if _, err := ag.TopLikelyPaths(ctx, []string{"s"}, []string{"t"}, PathOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("TopLikelyPaths: err = %v, want %v", err, context.Canceled)
+	}
+	if _, err := ag.TopRiskPaths(ctx, []string{"s"}, []string{"t"}, PathOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("TopRiskPaths: err = %v, want %v", err, context.Canceled)
+	}
+	if _, err := ag.FindAllPaths(ctx, "s", "t", PathOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindAllPaths: err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFindAllPathsLimits(t *testing.T) {
+	ag := newTestGraph(yenEdges, 1)
+	paths, err := ag.FindAllPaths(context.Background(), "s", "t", PathOptions{MaxDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Errorf("paths with max depth 3 = %v, want 3 paths", paths)
+	}
+	paths, err = ag.FindAllPaths(context.Background(), "s", "t", PathOptions{MaxPaths: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("paths with max paths 2 = %v, want 2 paths", paths)
+	}
+}
+
+// benchGraph 10000个节点的合成攻击图，所有基准测试共用
+var benchGraph struct {
+	once             sync.Once
+	graph            *AttackGraph
+	entries, targets []string
+}
+
+func syntheticBenchGraph(b *testing.B) (*AttackGraph, []string, []string) {
+	benchGraph.once.Do(func() {
+		g := GenerateSyntheticGraph(10000, 4, 1, quietLogger())
+		for _, node := range g.Nodes() {
+			switch node.Type {
+			case "entry":
+				benchGraph.entries = append(benchGraph.entries, node.ID)
+			case "exfiltration":
+				benchGraph.targets = append(benchGraph.targets, node.ID)
+			}
+		}
+		benchGraph.graph = g
+	})
+	b.ResetTimer()
+	return benchGraph.graph, benchGraph.entries, benchGraph.targets
+}
+
+func BenchmarkTopLikelyPaths(b *testing.B) {
+	g, entries, targets := syntheticBenchGraph(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := g.TopLikelyPaths(context.Background(), entries, targets, PathOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTopRiskPaths(b *testing.B) {
+	g, entries, targets := syntheticBenchGraph(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := g.TopRiskPaths(context.Background(), entries, targets, PathOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindAllPaths(b *testing.B) {
+	g, entries, targets := syntheticBenchGraph(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := g.FindAllPaths(context.Background(), entries[0], targets[0], PathOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
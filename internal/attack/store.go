@@ -0,0 +1,77 @@
+package attack
+
+import (
+	"sort"
+	"sync"
+)
+
+// ChainStore 内存中的攻击链分析结果存储，超过容量时淘汰最早的结果
+type ChainStore struct {
+	mu       sync.RWMutex
+	capacity int
+	chains   map[string]*AttackChain
+	order    []string
+}
+
+// NewChainStore 创建攻击链存储
+func NewChainStore(capacity int) *ChainStore {
+	if capacity <= 0 {
+		capacity = 200
+	}
+	return &ChainStore{
+		capacity: capacity,
+		chains:   make(map[string]*AttackChain),
+	}
+}
+
+// Save 保存攻击链
+func (s *ChainStore) Save(chain *AttackChain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.chains[chain.ID]; !exists {
+		s.order = append(s.order, chain.ID)
+	}
+	s.chains[chain.ID] = chain
+
+	for len(s.order) > s.capacity {
+		delete(s.chains, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get 根据ID获取攻击链
+func (s *ChainStore) Get(id string) (*AttackChain, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chain, ok := s.chains[id]
+	return chain, ok
+}
+
+// List 按时间倒序列出攻击链
+func (s *ChainStore) List(limit, offset int) ([]*AttackChain, int) {
+	s.mu.RLock()
+	all := make([]*AttackChain, 0, len(s.chains))
+	for _, chain := range s.chains {
+		all = append(all, chain)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.After(all[j].CreatedAt)
+		}
+		return all[i].ID > all[j].ID
+	})
+
+	total := len(all)
+	if offset < 0 || offset >= total {
+		return []*AttackChain{}, total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return all[offset:end], total
+}
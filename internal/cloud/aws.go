@@ -128,11 +128,13 @@ func (c *AWSClient) getEC2Instances() []Resource {
 				"Owner":       "dev-team",
 			},
 			Metadata: map[string]interface{}{
-				"instance_type": "t3.medium",
-				"ami_id":        "ami-0abcdef1234567890",
-				"key_name":      "my-key-pair",
-				"public_ip":     "54.123.45.67",
-				"private_ip":    "10.0.1.100",
+				"instance_type":   "t3.medium",
+				"ami_id":          "ami-0abcdef1234567890",
+				"key_name":        "my-key-pair",
+				"public_ip":       "54.123.45.67",
+				"private_ip":      "10.0.1.100",
+				"security_groups": []string{"sg-1234567890abcdef0"},
+				"iam_role":        "arn:aws:iam::123456789012:role/AdminRole",
 			},
 			CreatedAt:    time.Now().Add(-24 * time.Hour),
 			LastModified: time.Now().Add(-1 * time.Hour),
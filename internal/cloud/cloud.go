@@ -58,6 +58,7 @@ type Vulnerability struct {
 	CVSS        float64   `json:"cvss"`
 	Remediation string    `json:"remediation"`
 	DetectedAt  time.Time `json:"detected_at"`
+	Compliance  []string  `json:"compliance,omitempty"` // 映射的合规控制项，格式为 框架:编号
 }
 
 // Context 上下文信息
@@ -0,0 +1,270 @@
+package compliance
+
+import (
+	"sort"
+	"strings"
+)
+
+// Framework 合规框架
+type Framework string
+
+const (
+	CISAWS        Framework = "CIS-AWS"        // CIS Amazon Web Services Foundations Benchmark v1.5.0
+	CISAzure      Framework = "CIS-Azure"      // CIS Microsoft Azure Foundations Benchmark v2.0.0
+	CISKubernetes Framework = "CIS-Kubernetes" // CIS Kubernetes Benchmark v1.8.0
+	NIST80053     Framework = "NIST-800-53"    // NIST SP 800-53 Rev. 5
+	PCIDSS        Framework = "PCI-DSS"        // PCI DSS v4.0
+)
+
+// 检查项来源
+const (
+	SourceIaC   = "iac"
+	SourceCloud = "cloud"
+)
+
+// Control 合规控制项
+type Control struct {
+	Framework Framework `json:"framework"`
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+}
+
+// Ref 返回控制项引用，格式为 框架:编号
+func (c Control) Ref() string {
+	return string(c.Framework) + ":" + c.ID
+}
+
+// Check 映射到控制项的检查：IaC规则ID或云资源漏洞ID。
+// ID 以 * 结尾时按前缀匹配，例如 CVE-* 匹配所有CVE编号的漏洞
+type Check struct {
+	ID       string   `json:"id"`
+	Source   string   `json:"source"`   // iac 或 cloud
+	Platform string   `json:"platform"` // aws, azure, kubernetes，为空表示不限平台
+	Controls []string `json:"controls"` // 控制项引用
+}
+
+// Catalog 合规目录，维护控制项及检查到控制项的映射
+type Catalog struct {
+	controls map[string]Control
+	checks   map[string]Check
+}
+
+// NewCatalog 创建空的合规目录
+func NewCatalog() *Catalog {
+	return &Catalog{
+		controls: make(map[string]Control),
+		checks:   make(map[string]Check),
+	}
+}
+
+// AddControl 添加控制项
+func (c *Catalog) AddControl(control Control) {
+	c.controls[control.Ref()] = control
+}
+
+// AddCheck 添加检查映射
+func (c *Catalog) AddCheck(check Check) {
+	c.checks[check.ID] = check
+}
+
+// Frameworks 返回目录中的所有框架
+func (c *Catalog) Frameworks() []Framework {
+	seen := make(map[Framework]bool)
+	var frameworks []Framework
+	for _, control := range c.controls {
+		if !seen[control.Framework] {
+			seen[control.Framework] = true
+			frameworks = append(frameworks, control.Framework)
+		}
+	}
+	sort.Slice(frameworks, func(i, j int) bool { return frameworks[i] < frameworks[j] })
+	return frameworks
+}
+
+// Controls 返回指定框架的控制项，按编号排序
+func (c *Catalog) Controls(framework Framework) []Control {
+	var controls []Control
+	for _, control := range c.controls {
+		if control.Framework == framework {
+			controls = append(controls, control)
+		}
+	}
+	sort.Slice(controls, func(i, j int) bool {
+		return compareControlIDs(controls[i].ID, controls[j].ID)
+	})
+	return controls
+}
+
+// lookup 查找检查项，精确匹配优先，其次使用最长的前缀模式
+func (c *Catalog) lookup(checkID string) (Check, bool) {
+	if check, ok := c.checks[checkID]; ok {
+		return check, true
+	}
+	var match Check
+	found := false
+	for id, check := range c.checks {
+		prefix := strings.TrimSuffix(id, "*")
+		if prefix != id && strings.HasPrefix(checkID, prefix) && (!found || len(id) > len(match.ID)) {
+			match, found = check, true
+		}
+	}
+	return match, found
+}
+
+// ControlRefs 返回检查项映射的控制项引用
+func (c *Catalog) ControlRefs(checkID string) []string {
+	check, ok := c.lookup(checkID)
+	if !ok {
+		return nil
+	}
+	refs := make([]string, len(check.Controls))
+	copy(refs, check.Controls)
+	return refs
+}
+
+// ChecksFor 返回映射到指定控制项的检查
+func (c *Catalog) ChecksFor(ref string) []Check {
+	var checks []Check
+	for _, check := range c.checks {
+		for _, r := range check.Controls {
+			if r == ref {
+				checks = append(checks, check)
+				break
+			}
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].ID < checks[j].ID })
+	return checks
+}
+
+// ParseFramework 不区分大小写地解析框架名称
+func ParseFramework(name string) (Framework, bool) {
+	for _, f := range []Framework{CISAWS, CISAzure, CISKubernetes, NIST80053, PCIDSS} {
+		if strings.EqualFold(string(f), name) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// compareControlIDs 按数字段比较控制项编号，例如 2.1.5 < 2.1.10，AC-3 < AC-6 < SC-28
+func compareControlIDs(a, b string) bool {
+	pa := strings.FieldsFunc(a, func(r rune) bool { return r == '.' || r == '-' })
+	pb := strings.FieldsFunc(b, func(r rune) bool { return r == '.' || r == '-' })
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		na, okA := atoi(pa[i])
+		nb, okB := atoi(pb[i])
+		if okA && okB {
+			return na < nb
+		}
+		return pa[i] < pb[i]
+	}
+	return len(pa) < len(pb)
+}
+
+// atoi 解析纯数字字符串
+func atoi(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n, true
+}
+
+// DefaultCatalog 返回内置规则和云资源检查的合规映射
+func DefaultCatalog() *Catalog {
+	c := NewCatalog()
+
+	controls := []Control{
+		// CIS AWS Foundations Benchmark v1.5.0
+		{CISAWS, "1.16", "Ensure IAM policies that allow full \"*:*\" administrative privileges are not attached"},
+		{CISAWS, "2.1.1", "Ensure all S3 buckets employ encryption-at-rest"},
+		{CISAWS, "2.1.5", "Ensure that S3 Buckets are configured with 'Block public access'"},
+		{CISAWS, "2.3.1", "Ensure that encryption is enabled for RDS Instances"},
+		{CISAWS, "5.2", "Ensure no security groups allow ingress from 0.0.0.0/0 to remote server administration ports"},
+
+		// CIS Microsoft Azure Foundations Benchmark v2.0.0
+		{CISAzure, "3.1", "Ensure that 'Secure transfer required' is set to 'Enabled'"},
+		{CISAzure, "3.2", "Ensure that 'Enable Infrastructure Encryption' for each Storage Account is set to 'enabled'"},
+		{CISAzure, "3.7", "Ensure that 'Public access level' is disabled for storage accounts with blob containers"},
+		{CISAzure, "8.5", "Ensure the Key Vault is Recoverable"},
+		{CISAzure, "8.7", "Ensure that Private Endpoints are Used for Azure Key Vault"},
+
+		// CIS Kubernetes Benchmark v1.8.0
+		{CISKubernetes, "5.2.2", "Minimize the admission of privileged containers"},
+		{CISKubernetes, "5.2.4", "Minimize the admission of containers wishing to share the host network namespace"},
+		{CISKubernetes, "5.2.7", "Minimize the admission of root containers"},
+		{CISKubernetes, "5.2.9", "Minimize the admission of containers with added capabilities"},
+
+		// NIST SP 800-53 Rev. 5
+		{NIST80053, "AC-3", "Access Enforcement"},
+		{NIST80053, "AC-6", "Least Privilege"},
+		{NIST80053, "CM-6", "Configuration Settings"},
+		{NIST80053, "CM-8", "System Component Inventory"},
+		{NIST80053, "CP-9", "System Backup"},
+		{NIST80053, "SC-6", "Resource Availability"},
+		{NIST80053, "SC-7", "Boundary Protection"},
+		{NIST80053, "SC-8", "Transmission Confidentiality and Integrity"},
+		{NIST80053, "SC-28", "Protection of Information at Rest"},
+		{NIST80053, "SI-2", "Flaw Remediation"},
+
+		// PCI DSS v4.0
+		{PCIDSS, "1.3.1", "Inbound traffic to the CDE is restricted"},
+		{PCIDSS, "1.4.1", "NSCs are implemented between trusted and untrusted networks"},
+		{PCIDSS, "2.2.1", "Configuration standards are developed, implemented, and maintained"},
+		{PCIDSS, "2.2.6", "System security parameters are configured to prevent misuse"},
+		{PCIDSS, "3.5.1", "PAN is rendered unreadable anywhere it is stored"},
+		{PCIDSS, "4.2.1", "Strong cryptography is used to safeguard PAN during transmission"},
+		{PCIDSS, "6.3.3", "All system components are protected from known vulnerabilities by installing applicable security patches"},
+		{PCIDSS, "7.2.1", "An access control model is defined and includes granting access based on least privileges"},
+		{PCIDSS, "12.5.1", "An inventory of system components that are in scope for PCI DSS is maintained"},
+	}
+	for _, control := range controls {
+		c.AddControl(control)
+	}
+
+	checks := []Check{
+		// IaC规则
+		{"TF001", SourceIaC, "aws", []string{"CIS-AWS:1.16", "NIST-800-53:AC-6", "PCI-DSS:7.2.1"}},
+		{"TF002", SourceIaC, "aws", []string{"CIS-AWS:2.1.5", "NIST-800-53:AC-3", "PCI-DSS:7.2.1"}},
+		{"TF003", SourceIaC, "aws", []string{"CIS-AWS:5.2", "NIST-800-53:SC-7", "PCI-DSS:1.3.1"}},
+		{"TF004", SourceIaC, "aws", []string{"CIS-AWS:2.3.1", "NIST-800-53:SC-28", "PCI-DSS:3.5.1"}},
+		{"K8S001", SourceIaC, "kubernetes", []string{"CIS-Kubernetes:5.2.7", "NIST-800-53:AC-6", "PCI-DSS:7.2.1"}},
+		{"K8S002", SourceIaC, "kubernetes", []string{"CIS-Kubernetes:5.2.2", "NIST-800-53:AC-6", "NIST-800-53:CM-6", "PCI-DSS:2.2.1"}},
+		{"K8S003", SourceIaC, "kubernetes", []string{"NIST-800-53:SC-6", "NIST-800-53:CM-6", "PCI-DSS:2.2.1"}},
+		{"K8S004", SourceIaC, "kubernetes", []string{"CIS-Kubernetes:5.2.4", "NIST-800-53:SC-7", "PCI-DSS:1.4.1"}},
+		{"K8S005", SourceIaC, "kubernetes", []string{"CIS-Kubernetes:5.2.9", "NIST-800-53:AC-6", "PCI-DSS:2.2.6"}},
+
+		// 云资源上的已知漏洞（CVE），不限平台
+		{"CVE-*", SourceCloud, "", []string{"NIST-800-53:SI-2", "PCI-DSS:6.3.3"}},
+
+		// AWS资源检查
+		{"S3-PUBLIC-001", SourceCloud, "aws", []string{"CIS-AWS:2.1.5", "NIST-800-53:AC-3", "PCI-DSS:7.2.1"}},
+		{"S3-ENCRYPT-001", SourceCloud, "aws", []string{"CIS-AWS:2.1.1", "NIST-800-53:SC-28", "PCI-DSS:3.5.1"}},
+		{"IAM-ADMIN-001", SourceCloud, "aws", []string{"CIS-AWS:1.16", "NIST-800-53:AC-6", "PCI-DSS:7.2.1"}},
+		{"SG-SSH-001", SourceCloud, "aws", []string{"CIS-AWS:5.2", "NIST-800-53:SC-7", "PCI-DSS:1.3.1"}},
+
+		// Azure资源检查
+		{"AZURE-VM-001", SourceCloud, "azure", []string{"NIST-800-53:SC-7", "PCI-DSS:1.3.1"}},
+		{"AZURE-STORAGE-001", SourceCloud, "azure", []string{"CIS-Azure:3.7", "NIST-800-53:AC-3", "PCI-DSS:7.2.1"}},
+		{"AZURE-STORAGE-002", SourceCloud, "azure", []string{"CIS-Azure:3.1", "NIST-800-53:SC-8", "PCI-DSS:4.2.1"}},
+		{"AZURE-STORAGE-003", SourceCloud, "azure", []string{"CIS-Azure:3.2", "NIST-800-53:SC-28", "PCI-DSS:3.5.1"}},
+		{"AZURE-RG-001", SourceCloud, "azure", []string{"NIST-800-53:CM-8", "PCI-DSS:12.5.1"}},
+		{"AZURE-KV-001", SourceCloud, "azure", []string{"CIS-Azure:8.7", "NIST-800-53:SC-7", "NIST-800-53:AC-3"}},
+		{"AZURE-KV-002", SourceCloud, "azure", []string{"CIS-Azure:8.5", "NIST-800-53:CP-9"}},
+	}
+	for _, check := range checks {
+		c.AddCheck(check)
+	}
+
+	return c
+}
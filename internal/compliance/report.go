@@ -0,0 +1,204 @@
+package compliance
+
+import (
+	"time"
+
+	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/iac"
+)
+
+// 控制项状态
+const (
+	StatusPass         = "pass"
+	StatusFail         = "fail"
+	StatusNotEvaluated = "not_evaluated"
+)
+
+// Evidence 控制项失败的证据
+type Evidence struct {
+	Source     string `json:"source"` // iac 或 cloud
+	CheckID    string `json:"check_id"`
+	Title      string `json:"title"`
+	Severity   string `json:"severity"`
+	ScanID     string `json:"scan_id,omitempty"`
+	FilePath   string `json:"file_path,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	ResourceID string `json:"resource_id,omitempty"`
+}
+
+// ControlResult 单个控制项的评估结果
+type ControlResult struct {
+	Control
+	Status   string     `json:"status"`
+	Checks   []string   `json:"checks"`
+	Evidence []Evidence `json:"evidence"`
+}
+
+// Report 合规评估报告
+type Report struct {
+	Framework   Framework       `json:"framework"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Scans       int             `json:"scans"`
+	Resources   int             `json:"resources"`
+	Controls    []ControlResult `json:"controls"`
+	Summary     ReportSummary   `json:"summary"`
+}
+
+// ReportSummary 合规评估摘要
+type ReportSummary struct {
+	Total        int     `json:"total"`
+	Passed       int     `json:"passed"`
+	Failed       int     `json:"failed"`
+	NotEvaluated int     `json:"not_evaluated"`
+	Score        float64 `json:"score"` // 已评估控制项中通过的百分比
+}
+
+// AnnotateScan 为扫描结果中的问题标注合规控制项
+func (c *Catalog) AnnotateScan(result *iac.ScanResult) {
+	for i := range result.Findings {
+		result.Findings[i].Compliance = c.ControlRefs(result.Findings[i].Rule)
+	}
+}
+
+// AnnotateResources 为云资源漏洞标注合规控制项
+func (c *Catalog) AnnotateResources(resources []cloud.Resource) {
+	for i := range resources {
+		for j := range resources[i].Vulnerabilities {
+			vuln := &resources[i].Vulnerabilities[j]
+			vuln.Compliance = c.ControlRefs(vuln.ID)
+		}
+	}
+}
+
+// LatestScans 每个扫描目标（文件、上传或仓库路径）只保留最新的扫描结果，按输入顺序返回
+func LatestScans(scans []*iac.ScanResult) []*iac.ScanResult {
+	latest := make(map[string]*iac.ScanResult)
+	for _, scan := range scans {
+		if prev, ok := latest[scan.FilePath]; !ok || scan.Timestamp.After(prev.Timestamp) {
+			latest[scan.FilePath] = scan
+		}
+	}
+	result := make([]*iac.ScanResult, 0, len(latest))
+	for _, scan := range scans {
+		if latest[scan.FilePath] == scan {
+			result = append(result, scan)
+		}
+	}
+	return result
+}
+
+// scanPlatforms 返回扫描覆盖的平台。未记录平台的历史结果只能从发现的问题推断
+func (c *Catalog) scanPlatforms(scan *iac.ScanResult) []string {
+	if len(scan.Platforms) > 0 {
+		return scan.Platforms
+	}
+	var platforms []string
+	for _, f := range scan.Findings {
+		if check, ok := c.lookup(f.Rule); ok {
+			platforms = append(platforms, check.Platform)
+		}
+	}
+	return platforms
+}
+
+// Evaluate 基于扫描结果和云资源清单评估框架中每个控制项的通过情况。
+// 每个扫描目标只使用最新的扫描结果。控制项的任一映射检查被触发即为失败；
+// 映射的检查所需的数据源（覆盖对应平台的IaC扫描或对应云平台的资源）
+// 均不存在时为未评估，否则为通过
+func (c *Catalog) Evaluate(framework Framework, scans []*iac.ScanResult, resources []cloud.Resource) *Report {
+	scans = LatestScans(scans)
+	report := &Report{
+		Framework:   framework,
+		GeneratedAt: time.Now(),
+		Scans:       len(scans),
+		Resources:   len(resources),
+		Controls:    []ControlResult{},
+	}
+
+	// 收集失败证据，按控制项引用归类
+	evidence := make(map[string][]Evidence)
+	iacPlatforms := make(map[string]bool)
+	for _, scan := range scans {
+		for _, platform := range c.scanPlatforms(scan) {
+			iacPlatforms[platform] = true
+		}
+		for _, f := range scan.Findings {
+			for _, ref := range c.ControlRefs(f.Rule) {
+				evidence[ref] = append(evidence[ref], Evidence{
+					Source:   SourceIaC,
+					CheckID:  f.Rule,
+					Title:    f.Title,
+					Severity: f.Severity,
+					ScanID:   scan.ID,
+					FilePath: f.FilePath,
+					Resource: f.Resource,
+				})
+			}
+		}
+	}
+
+	platforms := make(map[string]bool)
+	for _, resource := range resources {
+		platforms[string(resource.Provider)] = true
+		for _, vuln := range resource.Vulnerabilities {
+			for _, ref := range c.ControlRefs(vuln.ID) {
+				evidence[ref] = append(evidence[ref], Evidence{
+					Source:     SourceCloud,
+					CheckID:    vuln.ID,
+					Title:      vuln.Title,
+					Severity:   vuln.Severity,
+					Resource:   resource.Name,
+					ResourceID: resource.ID,
+				})
+			}
+		}
+	}
+
+	for _, control := range c.Controls(framework) {
+		ref := control.Ref()
+		result := ControlResult{
+			Control:  control,
+			Checks:   []string{},
+			Evidence: evidence[ref],
+		}
+		if result.Evidence == nil {
+			result.Evidence = []Evidence{}
+		}
+
+		evaluated := false
+		for _, check := range c.ChecksFor(ref) {
+			result.Checks = append(result.Checks, check.ID)
+			switch {
+			case check.Source == SourceIaC && check.Platform == "":
+				evaluated = evaluated || len(iacPlatforms) > 0
+			case check.Source == SourceIaC:
+				evaluated = evaluated || iacPlatforms[check.Platform]
+			case check.Platform == "":
+				evaluated = evaluated || len(platforms) > 0
+			default:
+				evaluated = evaluated || platforms[check.Platform]
+			}
+		}
+
+		switch {
+		case len(result.Evidence) > 0:
+			result.Status = StatusFail
+			report.Summary.Failed++
+		case evaluated:
+			result.Status = StatusPass
+			report.Summary.Passed++
+		default:
+			result.Status = StatusNotEvaluated
+			report.Summary.NotEvaluated++
+		}
+
+		report.Controls = append(report.Controls, result)
+	}
+
+	report.Summary.Total = len(report.Controls)
+	if evaluatedCount := report.Summary.Passed + report.Summary.Failed; evaluatedCount > 0 {
+		report.Summary.Score = float64(report.Summary.Passed) * 100 / float64(evaluatedCount)
+	}
+
+	return report
+}
@@ -0,0 +1,170 @@
+package compliance
+
+import (
+	"testing"
+	"time"
+
+	"cloudsecops/internal/cloud"
+	"cloudsecops/internal/iac"
+)
+
+// statuses 返回控制项编号到状态的映射
+func statuses(report *Report) map[string]string {
+	result := make(map[string]string)
+	for _, control := range report.Controls {
+		result[control.ID] = control.Status
+	}
+	return result
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	k8sScan := &iac.ScanResult{ID: "k8s", FilePath: "deploy", Timestamp: now, Platforms: []string{"kubernetes"}}
+	awsScan := &iac.ScanResult{
+		ID:        "aws",
+		FilePath:  "infra",
+		Timestamp: now,
+		Platforms: []string{"aws"},
+		Findings:  []iac.Finding{{Rule: "TF002", Title: "S3 Bucket Public Read", Severity: "critical"}},
+	}
+
+	tests := []struct {
+		name          string
+		framework     Framework
+		scans         []*iac.ScanResult
+		resources     []cloud.Resource
+		want          map[string]string
+		wantEvaluated int
+	}{
+		{
+			name:      "kubernetes scan does not evaluate CIS AWS",
+			framework: CISAWS,
+			scans:     []*iac.ScanResult{k8sScan},
+			want: map[string]string{
+				"1.16": StatusNotEvaluated, "2.1.1": StatusNotEvaluated, "2.1.5": StatusNotEvaluated,
+				"2.3.1": StatusNotEvaluated, "5.2": StatusNotEvaluated,
+			},
+		},
+		{
+			name:      "kubernetes scan evaluates CIS Kubernetes",
+			framework: CISKubernetes,
+			scans:     []*iac.ScanResult{k8sScan},
+			want: map[string]string{
+				"5.2.2": StatusPass, "5.2.4": StatusPass, "5.2.7": StatusPass, "5.2.9": StatusPass,
+			},
+			wantEvaluated: 4,
+		},
+		{
+			name:      "terraform scan covers only IaC checks",
+			framework: CISAWS,
+			scans:     []*iac.ScanResult{awsScan},
+			want: map[string]string{
+				"1.16": StatusPass, "2.1.1": StatusNotEvaluated, "2.1.5": StatusFail,
+				"2.3.1": StatusPass, "5.2": StatusPass,
+			},
+			wantEvaluated: 4,
+		},
+		{
+			name:      "cloud resources evaluate cloud-only controls",
+			framework: CISAWS,
+			scans:     []*iac.ScanResult{k8sScan},
+			resources: []cloud.Resource{{ID: "b-1", Name: "data", Provider: cloud.AWS}},
+			want: map[string]string{
+				"1.16": StatusPass, "2.1.1": StatusPass, "2.1.5": StatusPass,
+				"2.3.1": StatusNotEvaluated, "5.2": StatusPass,
+			},
+			wantEvaluated: 4,
+		},
+		{
+			name:      "legacy scan without platforms is inferred from findings",
+			framework: CISKubernetes,
+			scans: []*iac.ScanResult{{
+				ID:       "legacy",
+				FilePath: "pod.yaml",
+				Findings: []iac.Finding{{Rule: "K8S002", Severity: "critical"}},
+			}},
+			want: map[string]string{
+				"5.2.2": StatusFail, "5.2.4": StatusPass, "5.2.7": StatusPass, "5.2.9": StatusPass,
+			},
+			wantEvaluated: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := DefaultCatalog().Evaluate(tt.framework, tt.scans, tt.resources)
+			got := statuses(report)
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("%s = %s, want %s", id, got[id], want)
+				}
+			}
+			if n := report.Summary.Passed + report.Summary.Failed; n != tt.wantEvaluated {
+				t.Errorf("evaluated controls = %d, want %d", n, tt.wantEvaluated)
+			}
+			if tt.wantEvaluated == 0 && report.Summary.Score != 0 {
+				t.Errorf("score = %.1f for a report without evaluated controls", report.Summary.Score)
+			}
+		})
+	}
+}
+
+func TestEvaluateUsesLatestScanPerTarget(t *testing.T) {
+	now := time.Now()
+	old := &iac.ScanResult{
+		ID:        "old",
+		FilePath:  "infra",
+		Timestamp: now.Add(-time.Hour),
+		Platforms: []string{"aws"},
+		Findings:  []iac.Finding{{Rule: "TF002", Severity: "critical"}},
+	}
+	fixed := &iac.ScanResult{ID: "new", FilePath: "infra", Timestamp: now, Platforms: []string{"aws"}}
+	other := &iac.ScanResult{
+		ID:        "other",
+		FilePath:  "network",
+		Timestamp: now.Add(-2 * time.Hour),
+		Platforms: []string{"aws"},
+		Findings:  []iac.Finding{{Rule: "TF003", Severity: "high"}},
+	}
+
+	report := DefaultCatalog().Evaluate(CISAWS, []*iac.ScanResult{fixed, old, other}, nil)
+	if report.Scans != 2 {
+		t.Errorf("scans = %d, want 2", report.Scans)
+	}
+	got := statuses(report)
+	if got["2.1.5"] != StatusPass {
+		t.Errorf("2.1.5 = %s, want pass after the newer scan of infra fixed it", got["2.1.5"])
+	}
+	if got["5.2"] != StatusFail {
+		t.Errorf("5.2 = %s, want fail from the latest scan of network", got["5.2"])
+	}
+}
+
+func TestCloudVulnerabilitiesMapByCVEPattern(t *testing.T) {
+	catalog := DefaultCatalog()
+	for id, want := range map[string]int{
+		"CVE-2021-44228":      2,
+		"CVE-2023-38545":      2,
+		"AZURE-STORAGE-001":   3,
+		"CVE":                 0,
+		"GHSA-jfh8-c2jp-5v3q": 0,
+	} {
+		if got := catalog.ControlRefs(id); len(got) != want {
+			t.Errorf("ControlRefs(%q) = %v, want %d refs", id, got, want)
+		}
+	}
+
+	resources := []cloud.Resource{{
+		ID:              "vm-1",
+		Name:            "web",
+		Provider:        cloud.Azure,
+		Vulnerabilities: []cloud.Vulnerability{{ID: "CVE-2021-44228", Title: "Log4j", Severity: "critical"}},
+	}}
+	got := statuses(catalog.Evaluate(NIST80053, nil, resources))
+	if got["SI-2"] != StatusFail {
+		t.Errorf("SI-2 = %s, want fail for a CVE on an Azure resource", got["SI-2"])
+	}
+	got = statuses(catalog.Evaluate(NIST80053, nil, []cloud.Resource{{ID: "vm-2", Provider: cloud.Azure}}))
+	if got["SI-2"] != StatusPass {
+		t.Errorf("SI-2 = %s, want pass for cloud resources without CVEs", got["SI-2"])
+	}
+}
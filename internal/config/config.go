@@ -3,24 +3,33 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Environment string         `json:"environment"`
-	Server      ServerConfig   `json:"server"`
-	Database    DatabaseConfig `json:"database"`
-	Redis       RedisConfig    `json:"redis"`
-	JWT         JWTConfig      `json:"jwt"`
-	AWS         AWSConfig      `json:"aws"`
-	Azure       AzureConfig    `json:"azure"`
-	GitHub      GitHubConfig   `json:"github"`
+	Environment string           `json:"environment"`
+	Server      ServerConfig     `json:"server"`
+	Database    DatabaseConfig   `json:"database"`
+	Redis       RedisConfig      `json:"redis"`
+	JWT         JWTConfig        `json:"jwt"`
+	AWS         AWSConfig        `json:"aws"`
+	Azure       AzureConfig      `json:"azure"`
+	GitHub      GitHubConfig     `json:"github"`
+	IaC         IaCConfig        `json:"iac"`
+	EBPF        EBPFConfig       `json:"ebpf"`
+	Workload    WorkloadConfig   `json:"workload"`
+	Detection   DetectionConfig  `json:"detection"`
+	EventStore  EventStoreConfig `json:"event_store"`
+	Response    ResponseConfig   `json:"response"`
+	Attack      AttackConfig     `json:"attack"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int    `json:"port"`
-	Host string `json:"host"`
+	Port           int      `json:"port"`
+	Host           string   `json:"host"`
+	AllowedOrigins []string `json:"allowed_origins"` // 允许建立WebSocket连接的来源，"*" 表示不限制
 }
 
 // DatabaseConfig 数据库配置
@@ -71,13 +80,170 @@ type GitHubConfig struct {
 	Repo  string `json:"repo"`
 }
 
+// IaCConfig IaC扫描配置
+type IaCConfig struct {
+	WorkspaceDir    string    `json:"workspace_dir"`     // 克隆/解压工作区根目录
+	WorkspaceTTL    int       `json:"workspace_ttl"`     // 工作区保留时间，分钟
+	MaxUploadMB     int       `json:"max_upload_mb"`     // 上传文件大小上限
+	MaxExtractedMB  int       `json:"max_extracted_mb"`  // 归档解压后总大小上限
+	MaxFileMB       int       `json:"max_file_mb"`       // 归档内单个文件大小上限
+	MaxArchiveFiles int       `json:"max_archive_files"` // 归档内文件数量上限
+	Git             GitConfig `json:"git"`
+}
+
+// GitConfig Git仓库扫描配置
+type GitConfig struct {
+	CredentialsFile string   `json:"-"` // 挂载的密钥文件，内容为 token 或 username:token
+	Username        string   `json:"username"`
+	Token           string   `json:"-"`
+	SSHKeyPath      string   `json:"-"`
+	CloneTimeout    int      `json:"clone_timeout"` // 秒
+	AllowLocal      bool     `json:"allow_local"`      // 允许本地路径和file://仓库（测试用）
+	CredentialHosts []string `json:"credential_hosts"` // 只向这些主机（host 或 host:port）发送令牌
+	CAFile          string   `json:"ca_file"`          // 自建Git服务的CA证书
+	KnownHostsFile  string   `json:"known_hosts_file"` // ssh仓库主机公钥，ssh克隆只信任其中的主机
+	AllowedHosts    []string `json:"allowed_hosts"`    // 允许克隆的主机，* 表示任意主机，*.example.com 匹配子域名
+}
+
+// EBPFConfig eBPF监控配置
+type EBPFConfig struct {
+	ObjectPath     string `json:"object_path"`      // bpf2go生成的CO-RE对象文件
+	BTFPath        string `json:"btf_path"`         // 内核未提供BTF时使用的外部BTF文件
+	Transport      string `json:"transport"`        // auto、ringbuf 或 perf
+	RingBufferSize int    `json:"ring_buffer_size"` // ring buffer 大小，字节
+	PerfBufferSize int    `json:"perf_buffer_size"` // 内核不支持 ring buffer 时每个CPU的perf缓冲区大小，字节
+
+	Source      string  `json:"source"`       // auto、kernel、simulator 或 replay
+	Scenario    string  `json:"scenario"`     // 模拟器场景：内置场景名或场景文件路径
+	ReplayPath  string  `json:"replay_path"`  // 回放的JSONL事件文件
+	ReplaySpeed float64 `json:"replay_speed"` // 回放倍速，0 表示不等待
+	ReplayLoop  bool    `json:"replay_loop"`  // 回放结束后是否从头开始
+
+	RecordingDir string `json:"recording_dir"` // 事件录制文件目录
+
+	SubscriberBuffer   int `json:"subscriber_buffer"`    // 每个订阅者的事件缓冲区大小
+	SubscriberMaxDrops int `json:"subscriber_max_drops"` // 订阅者连续丢弃多少事件后被驱逐，0 表示不驱逐
+	MaxSubscribers     int `json:"max_subscribers"`      // 同时在线的订阅者上限
+
+	ProcRoot         string `json:"proc_root"`          // 宿主机 /proc 挂载位置，用于初始化进程表
+	ProcessTableSize int    `json:"process_table_size"` // 进程表容量
+	HashMaxSize      int    `json:"hash_max_size"`      // 计算SHA-256的可执行文件大小上限，字节，0 表示不计算
+
+	FlowTableSize      int      `json:"flow_table_size"`      // 网络流表容量
+	FlowIdleTimeout    int      `json:"flow_idle_timeout"`    // 流空闲多久后移出流表，秒
+	FlowLearningPeriod int      `json:"flow_learning_period"` // 容器首次出现后的学习期，期间出现的新对端不视为异常，秒
+	ScanWindow         int      `json:"scan_window"`          // 扫描检测的滑动窗口，秒
+	ScanThreshold      int      `json:"scan_threshold"`       // 窗口内连接的不同对端地址和端口数达到该值视为扫描
+	InternalNetworks   []string `json:"internal_networks"`    // 内部网络CIDR，用于区分横向连接和出站连接
+
+	Filter    KernelFilterConfig `json:"filter"`    // 内核侧过滤和限流，运行时可通过API更新
+	Integrity IntegrityConfig    `json:"integrity"` // 敏感文件完整性监视
+	Profile   ProfileConfig      `json:"profile"`   // 工作负载行为画像
+
+	QueueSize     int    `json:"queue_size"`      // 事件源与处理协程之间的队列长度，满时按严重程度取舍
+	SpillDir      string `json:"spill_dir"`       // 队列满时溢出事件的目录，为空时直接丢弃
+	SpillMaxBytes int    `json:"spill_max_bytes"` // 各级别溢出文件合计的大小上限，字节，0 表示不限制
+}
+
+// KernelFilterConfig 内核侧事件过滤和限流配置，只作用于文件打开和网络记录。
+// 拒绝项总是生效；某一维度配置了允许列表时，该维度未命中允许项的记录被丢弃
+type KernelFilterConfig struct {
+	AllowPaths   []string `json:"allow_paths,omitempty"` // 路径前缀，最长前缀匹配的项生效
+	DenyPaths    []string `json:"deny_paths,omitempty"`
+	AllowComms   []string `json:"allow_comms,omitempty"` // 进程名，最长15字节
+	DenyComms    []string `json:"deny_comms,omitempty"`
+	AllowUIDs    []uint32 `json:"allow_uids,omitempty"`
+	DenyUIDs     []uint32 `json:"deny_uids,omitempty"`
+	AllowCgroups []uint64 `json:"allow_cgroups,omitempty"` // cgroup v2 ID，即cgroup目录的inode号
+	DenyCgroups  []uint64 `json:"deny_cgroups,omitempty"`
+	RateLimit    int      `json:"rate_limit"` // 每个cgroup每秒上报的记录数，0 表示不限流
+	RateBurst    int      `json:"rate_burst"` // 令牌桶容量，0 表示与 RateLimit 相同
+}
+
+// IntegrityConfig 文件完整性监视配置。监视路径以 / 结尾时匹配目录下的所有文件，
+// * 匹配单个路径分量；这些路径的打开、写入、重命名和删除不受内核过滤影响
+type IntegrityConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Paths          []string `json:"paths"`
+	HashBaselines  bool     `json:"hash_baselines"`  // 是否记录内容哈希基线并检测内容漂移
+	MaxFiles       int      `json:"max_files"`       // 基线文件数上限
+	SettleDelay    int      `json:"settle_delay"`    // 文件被修改后等待多久再计算哈希，秒
+	VerifyInterval int      `json:"verify_interval"` // 定期校验宿主机基线的间隔，秒，0 表示不定期校验
+}
+
+// ProfileConfig 工作负载行为画像配置。学习期内记录容器执行的程序、打开的文件、
+// 网络对端和系统调用，锁定后出现的新项作为异常事件上报
+type ProfileConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Dir            string `json:"dir"`             // 画像保存目录，为空时只保存在内存中
+	LearningWindow int    `json:"learning_window"` // 工作负载首次出现后的学习期，秒
+	AutoLock       bool   `json:"auto_lock"`       // 学习期结束后自动锁定，否则需通过API锁定
+	MaxItems       int    `json:"max_items"`       // 每个类别的项数上限，学习期内超过上限的类别不报告异常
+	MaxProfiles    int    `json:"max_profiles"`    // 画像数上限
+}
+
+// WorkloadConfig 工作负载元数据配置，用于将监控事件关联到容器和Pod
+type WorkloadConfig struct {
+	ProcRoot       string `json:"proc_root"`       // 宿主机 /proc 挂载位置
+	CgroupRoot     string `json:"cgroup_root"`     // 宿主机cgroup v2挂载位置
+	NodeName       string `json:"node_name"`       // 当前节点名，通过Downward API注入
+	Kubernetes     bool   `json:"kubernetes"`      // 是否从Kubernetes API watch Pod元数据
+	KubeAPIServer  string `json:"kube_api_server"` // 为空时使用集群内配置
+	KubeTokenPath  string `json:"-"`
+	KubeCAPath     string `json:"-"`
+	RuntimeSocket  string `json:"runtime_socket"`  // Docker Engine API 兼容的容器运行时socket
+	ResyncInterval int    `json:"resync_interval"` // 容器运行时同步间隔，秒
+}
+
+// DetectionConfig 运行时检测规则配置
+type DetectionConfig struct {
+	RulesPath    string `json:"rules_path"`    // 自定义规则文件或目录，在内置规则之后加载
+	DefaultRules bool   `json:"default_rules"` // 是否加载内置规则
+}
+
+// EventStoreConfig 监控事件持久化配置
+type EventStoreConfig struct {
+	Enabled       bool `json:"enabled"`
+	BatchSize     int  `json:"batch_size"`     // 单次批量写入的事件数
+	FlushInterval int  `json:"flush_interval"` // 批次未满时的最长等待时间，毫秒
+	QueueSize     int  `json:"queue_size"`     // 待写入队列长度，队列已满时先丢弃低级别事件
+	// 数据库写入变慢、队列已满时溢出事件的目录和大小上限，为空时直接丢弃
+	SpillDir      string `json:"spill_dir"`
+	SpillMaxBytes int    `json:"spill_max_bytes"`
+
+	RetentionDays         int    `json:"retention_days"`          // 原始事件保留天数，按天分区整体删除
+	DownsampleAfterHours  int    `json:"downsample_after_hours"`  // 超过该时长的低级别事件聚合为每小时计数，0 表示不降采样
+	DownsampleMaxSeverity string `json:"downsample_max_severity"` // 参与降采样的最高严重程度，命中检测规则的事件始终保留
+	RollupRetentionDays   int    `json:"rollup_retention_days"`   // 聚合计数保留天数
+}
+
+// ResponseConfig 检测规则命中后的响应动作配置
+type ResponseConfig struct {
+	Enabled         bool   `json:"enabled"`
+	DryRun          bool   `json:"dry_run"`          // 只记录将要执行的动作，不实际执行
+	PolicyPath      string `json:"policy_path"`      // 规则与响应动作的绑定，YAML文件
+	AuditPath       string `json:"audit_path"`       // 审计日志，每行一条JSON记录，为空时只保留在内存中
+	AuditHistory    int    `json:"audit_history"`    // 内存中保留的审计记录数
+	DefaultCooldown int    `json:"default_cooldown"` // 同一绑定对同一目标重复执行同一动作的最短间隔，秒
+	QueueSize       int    `json:"queue_size"`       // 待处理的命中事件队列长度，队列已满时丢弃
+	Timeout         int    `json:"timeout"`          // 单个动作的超时，秒
+}
+
+// AttackConfig 攻击链分析配置
+type AttackConfig struct {
+	Timeout  int `json:"timeout"`   // 单次分析的超时，秒
+	MaxDepth int `json:"max_depth"` // 路径最多包含的节点数，0 表示不限制
+	MaxTopK  int `json:"max_top_k"` // 请求中 top_k 的上限
+}
+
 // Load 加载配置
 func Load() (*Config, error) {
 	config := &Config{
 		Environment: getEnv("ENVIRONMENT", "development"),
 		Server: ServerConfig{
-			Port: getEnvAsInt("SERVER_PORT", 8080),
-			Host: getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnvAsInt("SERVER_PORT", 8080),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", nil),
 		},
 		Database: DatabaseConfig{
 			Type:     getEnv("DB_TYPE", "sqlite"),
@@ -115,6 +281,139 @@ func Load() (*Config, error) {
 			Owner: getEnv("GITHUB_OWNER", ""),
 			Repo:  getEnv("GITHUB_REPO", ""),
 		},
+		IaC: IaCConfig{
+			WorkspaceDir:    getEnv("IAC_WORKSPACE_DIR", "/tmp/cloudsecops-workspaces"),
+			WorkspaceTTL:    getEnvAsInt("IAC_WORKSPACE_TTL", 60),
+			MaxUploadMB:     getEnvAsInt("IAC_MAX_UPLOAD_MB", 50),
+			MaxExtractedMB:  getEnvAsInt("IAC_MAX_EXTRACTED_MB", 200),
+			MaxFileMB:       getEnvAsInt("IAC_MAX_FILE_MB", 10),
+			MaxArchiveFiles: getEnvAsInt("IAC_MAX_ARCHIVE_FILES", 10000),
+			Git: GitConfig{
+				CredentialsFile: getEnv("GIT_CREDENTIALS_FILE", ""),
+				Username:        getEnv("GIT_USERNAME", "x-access-token"),
+				Token:           getEnv("GIT_TOKEN", getEnv("GITHUB_TOKEN", "")),
+				SSHKeyPath:      getEnv("GIT_SSH_KEY_PATH", ""),
+				CloneTimeout:    getEnvAsInt("GIT_CLONE_TIMEOUT", 120),
+				AllowLocal:      getEnvAsBool("GIT_ALLOW_LOCAL", false),
+				CredentialHosts: getEnvAsSlice("GIT_CREDENTIAL_HOSTS", []string{"github.com"}),
+				CAFile:          getEnv("GIT_SSL_CA_INFO", ""),
+				KnownHostsFile:  getEnv("GIT_KNOWN_HOSTS_FILE", ""),
+				AllowedHosts:    getEnvAsSlice("GIT_ALLOWED_HOSTS", []string{"github.com", "gitlab.com", "bitbucket.org"}),
+			},
+		},
+		EBPF: EBPFConfig{
+			ObjectPath:     getEnv("EBPF_OBJECT_PATH", "./internal/ebpf/programs/monitor_bpfel.o"),
+			BTFPath:        getEnv("EBPF_BTF_PATH", ""),
+			Transport:      getEnv("EBPF_TRANSPORT", "auto"),
+			RingBufferSize: getEnvAsInt("EBPF_RINGBUF_SIZE", 4*1024*1024),
+			PerfBufferSize: getEnvAsInt("EBPF_PERF_BUFFER_SIZE", 256*1024),
+			Source:         getEnv("EBPF_SOURCE", "auto"),
+			Scenario:       getEnv("EBPF_SCENARIO", "default"),
+			ReplayPath:     getEnv("EBPF_REPLAY_FILE", ""),
+			ReplaySpeed:    getEnvAsFloat("EBPF_REPLAY_SPEED", 1.0),
+			ReplayLoop:     getEnvAsBool("EBPF_REPLAY_LOOP", false),
+			RecordingDir:   getEnv("EBPF_RECORDING_DIR", "/var/lib/cloudsecops/recordings"),
+
+			SubscriberBuffer:   getEnvAsInt("EBPF_SUBSCRIBER_BUFFER", 256),
+			SubscriberMaxDrops: getEnvAsInt("EBPF_SUBSCRIBER_MAX_DROPS", 512),
+			MaxSubscribers:     getEnvAsInt("EBPF_MAX_SUBSCRIBERS", 100),
+
+			ProcRoot:         getEnv("EBPF_PROC_ROOT", getEnv("WORKLOAD_PROC_ROOT", "/proc")),
+			ProcessTableSize: getEnvAsInt("EBPF_PROCESS_TABLE_SIZE", 65536),
+			HashMaxSize:      getEnvAsInt("EBPF_HASH_MAX_SIZE", 64*1024*1024),
+
+			FlowTableSize:      getEnvAsInt("EBPF_FLOW_TABLE_SIZE", 16384),
+			FlowIdleTimeout:    getEnvAsInt("EBPF_FLOW_IDLE_TIMEOUT", 3600),
+			FlowLearningPeriod: getEnvAsInt("EBPF_FLOW_LEARNING_PERIOD", 600),
+			ScanWindow:         getEnvAsInt("EBPF_SCAN_WINDOW", 60),
+			ScanThreshold:      getEnvAsInt("EBPF_SCAN_THRESHOLD", 20),
+			InternalNetworks: getEnvAsSlice("EBPF_INTERNAL_NETWORKS", []string{
+				"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7",
+			}),
+			Filter: KernelFilterConfig{
+				AllowPaths:   getEnvAsSlice("EBPF_FILTER_ALLOW_PATHS", nil),
+				DenyPaths:    getEnvAsSlice("EBPF_FILTER_DENY_PATHS", nil),
+				AllowComms:   getEnvAsSlice("EBPF_FILTER_ALLOW_COMMS", nil),
+				DenyComms:    getEnvAsSlice("EBPF_FILTER_DENY_COMMS", nil),
+				AllowUIDs:    getEnvAsUint32Slice("EBPF_FILTER_ALLOW_UIDS"),
+				DenyUIDs:     getEnvAsUint32Slice("EBPF_FILTER_DENY_UIDS"),
+				AllowCgroups: getEnvAsUint64Slice("EBPF_FILTER_ALLOW_CGROUPS"),
+				DenyCgroups:  getEnvAsUint64Slice("EBPF_FILTER_DENY_CGROUPS"),
+				RateLimit:    getEnvAsInt("EBPF_RATE_LIMIT", 0),
+				RateBurst:    getEnvAsInt("EBPF_RATE_BURST", 0),
+			},
+			Integrity: IntegrityConfig{
+				Enabled: getEnvAsBool("EBPF_FIM_ENABLED", true),
+				Paths: getEnvAsSlice("EBPF_FIM_PATHS", []string{
+					"/etc/shadow", "/etc/gshadow", "/etc/passwd", "/etc/sudoers", "/etc/sudoers.d/",
+					"/root/.ssh/", "/home/*/.ssh/",
+					"/root/.kube/config", "/home/*/.kube/config", "/etc/kubernetes/admin.conf",
+					"/etc/kubernetes/kubelet.conf", "/var/lib/kubelet/kubeconfig",
+					"/var/run/secrets/kubernetes.io/serviceaccount/", "/run/secrets/kubernetes.io/serviceaccount/",
+					"/root/.aws/credentials", "/home/*/.aws/credentials",
+					"/root/.config/gcloud/", "/home/*/.config/gcloud/",
+					"/root/.azure/", "/home/*/.azure/",
+				}),
+				HashBaselines:  getEnvAsBool("EBPF_FIM_HASH_BASELINES", false),
+				MaxFiles:       getEnvAsInt("EBPF_FIM_MAX_FILES", 4096),
+				SettleDelay:    getEnvAsInt("EBPF_FIM_SETTLE_DELAY", 2),
+				VerifyInterval: getEnvAsInt("EBPF_FIM_VERIFY_INTERVAL", 0),
+			},
+			Profile: ProfileConfig{
+				Enabled:        getEnvAsBool("EBPF_PROFILE_ENABLED", true),
+				Dir:            getEnv("EBPF_PROFILE_DIR", "/var/lib/cloudsecops/profiles"),
+				LearningWindow: getEnvAsInt("EBPF_PROFILE_LEARNING_WINDOW", 3600),
+				AutoLock:       getEnvAsBool("EBPF_PROFILE_AUTO_LOCK", true),
+				MaxItems:       getEnvAsInt("EBPF_PROFILE_MAX_ITEMS", 512),
+				MaxProfiles:    getEnvAsInt("EBPF_PROFILE_MAX", 1024),
+			},
+			QueueSize:     getEnvAsInt("EBPF_QUEUE_SIZE", 8192),
+			SpillDir:      getEnv("EBPF_SPILL_DIR", ""),
+			SpillMaxBytes: getEnvAsInt("EBPF_SPILL_MAX_BYTES", 256*1024*1024),
+		},
+		Workload: WorkloadConfig{
+			ProcRoot:       getEnv("WORKLOAD_PROC_ROOT", "/proc"),
+			CgroupRoot:     getEnv("WORKLOAD_CGROUP_ROOT", "/sys/fs/cgroup"),
+			NodeName:       getEnv("NODE_NAME", ""),
+			Kubernetes:     getEnvAsBool("WORKLOAD_KUBERNETES", os.Getenv("KUBERNETES_SERVICE_HOST") != ""),
+			KubeAPIServer:  getEnv("KUBE_API_SERVER", ""),
+			KubeTokenPath:  getEnv("KUBE_TOKEN_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/token"),
+			KubeCAPath:     getEnv("KUBE_CA_PATH", "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"),
+			RuntimeSocket:  getEnv("CONTAINER_RUNTIME_SOCKET", ""),
+			ResyncInterval: getEnvAsInt("WORKLOAD_RESYNC_INTERVAL", 30),
+		},
+		Detection: DetectionConfig{
+			RulesPath:    getEnv("DETECTION_RULES_PATH", ""),
+			DefaultRules: getEnvAsBool("DETECTION_DEFAULT_RULES", true),
+		},
+		EventStore: EventStoreConfig{
+			Enabled:       getEnvAsBool("EVENT_STORE_ENABLED", true),
+			BatchSize:     getEnvAsInt("EVENT_STORE_BATCH_SIZE", 500),
+			FlushInterval: getEnvAsInt("EVENT_STORE_FLUSH_INTERVAL", 1000),
+			QueueSize:     getEnvAsInt("EVENT_STORE_QUEUE_SIZE", 10000),
+			SpillDir:      getEnv("EVENT_STORE_SPILL_DIR", ""),
+			SpillMaxBytes: getEnvAsInt("EVENT_STORE_SPILL_MAX_BYTES", 256*1024*1024),
+
+			RetentionDays:         getEnvAsInt("EVENT_RETENTION_DAYS", 14),
+			DownsampleAfterHours:  getEnvAsInt("EVENT_DOWNSAMPLE_AFTER_HOURS", 24),
+			DownsampleMaxSeverity: getEnv("EVENT_DOWNSAMPLE_MAX_SEVERITY", "low"),
+			RollupRetentionDays:   getEnvAsInt("EVENT_ROLLUP_RETENTION_DAYS", 90),
+		},
+		Response: ResponseConfig{
+			Enabled:         getEnvAsBool("RESPONSE_ENABLED", false),
+			DryRun:          getEnvAsBool("RESPONSE_DRY_RUN", true),
+			PolicyPath:      getEnv("RESPONSE_POLICY_PATH", ""),
+			AuditPath:       getEnv("RESPONSE_AUDIT_PATH", "/var/lib/cloudsecops/response-audit.jsonl"),
+			AuditHistory:    getEnvAsInt("RESPONSE_AUDIT_HISTORY", 1000),
+			DefaultCooldown: getEnvAsInt("RESPONSE_DEFAULT_COOLDOWN", 300),
+			QueueSize:       getEnvAsInt("RESPONSE_QUEUE_SIZE", 1024),
+			Timeout:         getEnvAsInt("RESPONSE_TIMEOUT", 10),
+		},
+		Attack: AttackConfig{
+			Timeout:  getEnvAsInt("ATTACK_ANALYSIS_TIMEOUT", 30),
+			MaxDepth: getEnvAsInt("ATTACK_MAX_DEPTH", 0),
+			MaxTopK:  getEnvAsInt("ATTACK_MAX_TOP_K", 50),
+		},
 	}
 
 	return config, nil
@@ -136,4 +435,61 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvAsFloat 获取环境变量并转换为浮点数
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice 获取以逗号分隔的环境变量
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsUint64Slice 获取以逗号分隔的无符号整数列表，无法解析的项被忽略
+func getEnvAsUint64Slice(key string) []uint64 {
+	var values []uint64
+	for _, item := range getEnvAsSlice(key, nil) {
+		if value, err := strconv.ParseUint(item, 10, 64); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsUint32Slice 获取以逗号分隔的32位无符号整数列表，无法解析的项被忽略
+func getEnvAsUint32Slice(key string) []uint32 {
+	var values []uint32
+	for _, item := range getEnvAsSlice(key, nil) {
+		if value, err := strconv.ParseUint(item, 10, 32); err == nil {
+			values = append(values, uint32(value))
+		}
+	}
+	return values
+}
+
+// getEnvAsBool 获取环境变量并转换为布尔值
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
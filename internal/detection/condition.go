@@ -0,0 +1,475 @@
+package detection
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"cloudsecops/internal/ebpf"
+)
+
+// node 条件表达式节点
+type node interface {
+	eval(e *ebpf.Event) bool
+}
+
+type andNode []node
+
+func (n andNode) eval(e *ebpf.Event) bool {
+	for _, child := range n {
+		if !child.eval(e) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []node
+
+func (n orNode) eval(e *ebpf.Event) bool {
+	for _, child := range n {
+		if child.eval(e) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) eval(e *ebpf.Event) bool {
+	return !n.child.eval(e)
+}
+
+// constNode 恒定结果，用于空的例外列表等
+type constNode bool
+
+func (n constNode) eval(*ebpf.Event) bool {
+	return bool(n)
+}
+
+// 比较运算符
+const (
+	opEq         = "="
+	opNe         = "!="
+	opLt         = "<"
+	opLe         = "<="
+	opGt         = ">"
+	opGe         = ">="
+	opContains   = "contains"
+	opIContains  = "icontains"
+	opStartsWith = "startswith"
+	opEndsWith   = "endswith"
+	opGlob       = "glob"
+	opPMatch     = "pmatch" // 路径前缀匹配：等于某个目录或位于其下
+	opIn         = "in"
+	opExists     = "exists"
+)
+
+// operators 以单词形式出现的运算符
+var operators = map[string]bool{
+	opContains: true, opIContains: true, opStartsWith: true, opEndsWith: true,
+	opGlob: true, opPMatch: true, opIn: true, opExists: true,
+}
+
+// compareNode 字段比较。字段无值时任何比较都不成立，多值字段任一值满足即成立，
+// != 要求所有值都不相等
+type compareNode struct {
+	field   string
+	extract fieldExtractor
+	op      string
+	values  []string
+	set     map[string]struct{}
+	number  float64
+}
+
+func (n *compareNode) eval(e *ebpf.Event) bool {
+	values := n.extract(e)
+	if n.op == opExists {
+		return len(values) > 0
+	}
+	if len(values) == 0 {
+		return false
+	}
+	if n.op == opNe {
+		for _, v := range values {
+			if v == n.values[0] {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if n.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *compareNode) match(v string) bool {
+	switch n.op {
+	case opEq:
+		return v == n.values[0]
+	case opLt, opLe, opGt, opGe:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		switch n.op {
+		case opLt:
+			return f < n.number
+		case opLe:
+			return f <= n.number
+		case opGt:
+			return f > n.number
+		default:
+			return f >= n.number
+		}
+	case opContains:
+		return strings.Contains(v, n.values[0])
+	case opIContains:
+		return strings.Contains(strings.ToLower(v), n.values[0])
+	case opStartsWith:
+		return strings.HasPrefix(v, n.values[0])
+	case opEndsWith:
+		return strings.HasSuffix(v, n.values[0])
+	case opGlob:
+		ok, _ := path.Match(n.values[0], v)
+		return ok
+	case opIn:
+		_, ok := n.set[v]
+		return ok
+	case opPMatch:
+		for _, p := range n.values {
+			if v == p || strings.HasPrefix(v, strings.TrimSuffix(p, "/")+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 词法单元类型
+const (
+	tokWord = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokEOF
+)
+
+type token struct {
+	kind  int
+	text  string
+	start int
+}
+
+// tokenize 将条件拆分为词法单元。未加引号的值可以包含路径和通配符
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{tokString, src[i+1 : i+1+end], i})
+			i += end + 2
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' {
+				op += "="
+			}
+			switch op {
+			case "==":
+				op = opEq
+			case "!":
+				return nil, fmt.Errorf("unexpected '!' at offset %d", i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+			if op == opEq && i < len(src) && src[i] == '=' {
+				i++
+			}
+		default:
+			start := i
+			for i < len(src) && !unicode.IsSpace(rune(src[i])) && !strings.ContainsRune("(),=!<>\"'", rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, src[start:i], start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+// compileEnv 编译条件所需的列表和宏
+type compileEnv struct {
+	lists     map[string][]string
+	macroSrc  map[string]string
+	macros    map[string]node
+	compiling map[string]bool
+}
+
+func newCompileEnv() *compileEnv {
+	return &compileEnv{
+		lists:     make(map[string][]string),
+		macroSrc:  make(map[string]string),
+		macros:    make(map[string]node),
+		compiling: make(map[string]bool),
+	}
+}
+
+// macro 返回编译后的宏，首次引用时编译并检查循环引用
+func (env *compileEnv) macro(name string) (node, bool, error) {
+	if n, ok := env.macros[name]; ok {
+		return n, true, nil
+	}
+	src, ok := env.macroSrc[name]
+	if !ok {
+		return nil, false, nil
+	}
+	if env.compiling[name] {
+		return nil, true, fmt.Errorf("macro %s references itself", name)
+	}
+
+	env.compiling[name] = true
+	n, err := env.compile(src)
+	delete(env.compiling, name)
+	if err != nil {
+		return nil, true, fmt.Errorf("macro %s: %w", name, err)
+	}
+	env.macros[name] = n
+	return n, true, nil
+}
+
+// compile 编译条件表达式
+func (env *compileEnv) compile(src string) (node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, env: env}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.start)
+	}
+	return n, nil
+}
+
+// parser 递归下降解析器：
+//
+//	or      := and ("or" and)*
+//	and     := not ("and" not)*
+//	not     := "not" not | primary
+//	primary := "(" or ")" | field op value | field "in" "(" value, ... ")" | field "exists" | macro
+type parser struct {
+	tokens []token
+	pos    int
+	env    *compileEnv
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokWord && tok.text == word
+}
+
+func (p *parser) parseOr() (node, error) {
+	var nodes orNode
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if !p.isKeyword("or") {
+			break
+		}
+		p.next()
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var nodes andNode
+	for {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if !p.isKeyword("and") {
+			break
+		}
+		p.next()
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("not") {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at offset %d", closing.start)
+		}
+		return n, nil
+	case tokWord:
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of condition")
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.start)
+	}
+
+	following := p.peek()
+	isComparison := following.kind == tokOp || (following.kind == tokWord && operators[following.text])
+	if !isComparison {
+		n, ok, err := p.env.macro(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown macro %q at offset %d", tok.text, tok.start)
+		}
+		return n, nil
+	}
+
+	extract, ok := lookupField(tok.text)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at offset %d", tok.text, tok.start)
+	}
+	op := p.next().text
+	n := &compareNode{field: tok.text, extract: extract, op: op}
+
+	switch op {
+	case opExists:
+		return n, nil
+	case opIn, opPMatch:
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", tok.text, op, err)
+		}
+		n.values = values
+		n.set = make(map[string]struct{}, len(values))
+		for _, v := range values {
+			n.set[v] = struct{}{}
+		}
+		return n, nil
+	}
+
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, fmt.Errorf("%s %s: expected value at offset %d", tok.text, op, value.start)
+	}
+	n.values = []string{value.text}
+	switch op {
+	case opLt, opLe, opGt, opGe:
+		number, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %q is not a number", tok.text, op, value.text)
+		}
+		n.number = number
+	case opIContains:
+		n.values[0] = strings.ToLower(value.text)
+	}
+	return n, nil
+}
+
+// parseValueList 解析 (a, b, c) 形式的值列表，也可以直接引用列表名。
+// 值为列表名时展开为列表项
+func (p *parser) parseValueList() ([]string, error) {
+	tok := p.next()
+	if tok.kind == tokWord {
+		items, ok := p.env.lists[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown list %q", tok.text)
+		}
+		return items, nil
+	}
+	if tok.kind != tokLParen {
+		return nil, fmt.Errorf("expected '(' at offset %d", tok.start)
+	}
+
+	var values []string
+	for {
+		tok := p.next()
+		switch tok.kind {
+		case tokRParen:
+			return values, nil
+		case tokWord:
+			if items, ok := p.env.lists[tok.text]; ok {
+				values = append(values, items...)
+			} else {
+				values = append(values, tok.text)
+			}
+		case tokString:
+			values = append(values, tok.text)
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.start)
+		}
+
+		switch sep := p.next(); sep.kind {
+		case tokComma:
+		case tokRParen:
+			return values, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or ')' at offset %d", sep.start)
+		}
+	}
+}
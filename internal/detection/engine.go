@@ -0,0 +1,510 @@
+package detection
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed rules/*.yaml
+var defaultRules embed.FS
+
+// severityRank 严重程度排序，用于多条规则命中时取最高级别
+var severityRank = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// ruleItem 规则文件中的一项，list、macro、rule 三者取其一
+type ruleItem struct {
+	List  string   `yaml:"list"`
+	Items []string `yaml:"items"`
+
+	Macro     string `yaml:"macro"`
+	Condition string `yaml:"condition"`
+
+	Rule       string                `yaml:"rule"`
+	Desc       string                `yaml:"desc"`
+	Output     string                `yaml:"output"`
+	Severity   string                `yaml:"severity"`
+	MITRE      []ebpf.MitreTechnique `yaml:"mitre"`
+	Tags       []string              `yaml:"tags"`
+	Enabled    *bool                 `yaml:"enabled"`
+	Exceptions []exceptionDef        `yaml:"exceptions"`
+
+	// Append 为 true 时追加到同名列表的条目或同名规则的例外，而不是替换
+	Append bool `yaml:"append"`
+}
+
+// exceptionDef 规则例外。可以写成条件，也可以写成字段与值的组合：
+// 任意一组 values 与 fields 逐一匹配时例外成立
+type exceptionDef struct {
+	Name      string     `yaml:"name"`
+	Condition string     `yaml:"condition"`
+	Fields    []string   `yaml:"fields"`
+	Comps     []string   `yaml:"comps"` // 与 fields 对应的运算符，默认 =
+	Values    [][]string `yaml:"values"`
+}
+
+// RuleInfo 规则信息
+type RuleInfo struct {
+	Name       string                `json:"name"`
+	Desc       string                `json:"desc"`
+	Condition  string                `json:"condition"`
+	Output     string                `json:"output"`
+	Severity   string                `json:"severity"`
+	MITRE      []ebpf.MitreTechnique `json:"mitre,omitempty"`
+	Tags       []string              `json:"tags,omitempty"`
+	Enabled    bool                  `json:"enabled"`
+	Exceptions []string              `json:"exceptions,omitempty"`
+	Source     string                `json:"source"`
+	Hits       uint64                `json:"hits"`
+}
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	info      RuleInfo
+	condition node
+	output    *outputTemplate
+	hits      atomic.Uint64
+}
+
+// ruleSet 一次加载得到的完整规则集
+type ruleSet struct {
+	rules    []*compiledRule
+	sources  []string
+	versions []ebpf.RuleVersion
+}
+
+// Engine 运行时检测规则引擎。规则按声明式条件匹配事件字段、进程祖先和容器元数据，
+// 命中后设置严重程度、MITRE 技术和输出文本
+type Engine struct {
+	cfg config.DetectionConfig
+	log *logrus.Logger
+
+	mu  sync.RWMutex
+	set *ruleSet
+}
+
+// NewEngine 创建检测引擎并加载规则
+func NewEngine(cfg config.DetectionConfig, log *logrus.Logger) (*Engine, error) {
+	e := &Engine{cfg: cfg, log: log}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 重新加载规则。加载失败时保留原有规则
+func (e *Engine) Reload() error {
+	set, err := e.load()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.set = set
+	e.mu.Unlock()
+
+	enabled := 0
+	for _, rule := range set.rules {
+		if rule.info.Enabled {
+			enabled++
+		}
+	}
+	e.log.Infof("Loaded %d detection rules (%d enabled) from %s", len(set.rules), enabled, strings.Join(set.sources, ", "))
+	return nil
+}
+
+// load 依次读取内置规则和配置的规则文件，后加载的同名定义覆盖先前的定义
+func (e *Engine) load() (*ruleSet, error) {
+	type document struct {
+		source string
+		data   []byte
+	}
+	var docs []document
+
+	if e.cfg.DefaultRules {
+		entries, err := defaultRules.ReadDir("rules")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			data, err := defaultRules.ReadFile("rules/" + entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, document{"builtin:" + entry.Name(), data})
+		}
+	}
+
+	if e.cfg.RulesPath != "" {
+		files, err := ruleFiles(e.cfg.RulesPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read rules file: %w", err)
+			}
+			docs = append(docs, document{file, data})
+		}
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no detection rules configured")
+	}
+
+	b := newBuilder()
+	set := &ruleSet{}
+	for _, doc := range docs {
+		var items []ruleItem
+		if err := yaml.Unmarshal(doc.data, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", doc.source, err)
+		}
+		if err := b.add(doc.source, items); err != nil {
+			return nil, fmt.Errorf("%s: %w", doc.source, err)
+		}
+		set.sources = append(set.sources, doc.source)
+		sum := sha256.Sum256(doc.data)
+		set.versions = append(set.versions, ebpf.RuleVersion{Source: doc.source, SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	rules, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	set.rules = rules
+	return set, nil
+}
+
+// ruleFiles 返回路径下的规则文件，目录按文件名排序
+func ruleFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("rules path unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Evaluate 对事件执行所有启用的规则，命中的规则按严重程度从高到低写入 Detections，
+// 事件的严重程度和描述取最高级别的命中。未命中任何规则的事件保留解码阶段的默认分级
+func (e *Engine) Evaluate(event *ebpf.Event) {
+	e.mu.RLock()
+	set := e.set
+	e.mu.RUnlock()
+
+	for _, rule := range set.rules {
+		if !rule.info.Enabled || !rule.condition.eval(event) {
+			continue
+		}
+		rule.hits.Add(1)
+		event.Detections = append(event.Detections, ebpf.Detection{
+			Rule:     rule.info.Name,
+			Severity: rule.info.Severity,
+			Output:   rule.output.render(event),
+			MITRE:    rule.info.MITRE,
+			Tags:     rule.info.Tags,
+		})
+	}
+	if len(event.Detections) == 0 {
+		return
+	}
+
+	sort.SliceStable(event.Detections, func(i, j int) bool {
+		return severityRank[event.Detections[i].Severity] > severityRank[event.Detections[j].Severity]
+	})
+	top := event.Detections[0]
+	event.Severity = top.Severity
+	event.Description = top.Output
+}
+
+// Rules 返回已加载的规则及命中次数
+func (e *Engine) Rules() []RuleInfo {
+	e.mu.RLock()
+	set := e.set
+	e.mu.RUnlock()
+
+	rules := make([]RuleInfo, 0, len(set.rules))
+	for _, rule := range set.rules {
+		info := rule.info
+		info.Hits = rule.hits.Load()
+		rules = append(rules, info)
+	}
+	return rules
+}
+
+// RuleVersions 返回已加载规则文件的来源和内容摘要，按加载顺序排列
+func (e *Engine) RuleVersions() []ebpf.RuleVersion {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]ebpf.RuleVersion(nil), e.set.versions...)
+}
+
+// builder 汇总多个规则文件中的定义
+type builder struct {
+	env       *compileEnv
+	rules     map[string]*ruleItem
+	sources   map[string]string
+	ruleOrder []string
+}
+
+func newBuilder() *builder {
+	return &builder{
+		env:     newCompileEnv(),
+		rules:   make(map[string]*ruleItem),
+		sources: make(map[string]string),
+	}
+}
+
+// add 加入一个文件的定义。列表在定义时展开其中引用的其他列表
+func (b *builder) add(source string, items []ruleItem) error {
+	for i := range items {
+		item := items[i]
+		switch {
+		case item.List != "":
+			var expanded []string
+			for _, v := range item.Items {
+				if nested, ok := b.env.lists[v]; ok && v != item.List {
+					expanded = append(expanded, nested...)
+				} else {
+					expanded = append(expanded, v)
+				}
+			}
+			if item.Append {
+				expanded = append(b.env.lists[item.List], expanded...)
+			}
+			b.env.lists[item.List] = expanded
+
+		case item.Macro != "":
+			if item.Condition == "" {
+				return fmt.Errorf("macro %s has no condition", item.Macro)
+			}
+			if item.Append {
+				if prev, ok := b.env.macroSrc[item.Macro]; ok {
+					item.Condition = "(" + prev + ") " + item.Condition
+				}
+			}
+			b.env.macroSrc[item.Macro] = item.Condition
+
+		case item.Rule != "":
+			prev, exists := b.rules[item.Rule]
+			if item.Append {
+				if !exists {
+					return fmt.Errorf("rule %s: append to undefined rule", item.Rule)
+				}
+				prev.Exceptions = append(prev.Exceptions, item.Exceptions...)
+				if item.Enabled != nil {
+					prev.Enabled = item.Enabled
+				}
+				continue
+			}
+			// 只设置 enabled 时视为启用/停用已有规则
+			if exists && item.Condition == "" && item.Enabled != nil {
+				prev.Enabled = item.Enabled
+				continue
+			}
+			if !exists {
+				b.ruleOrder = append(b.ruleOrder, item.Rule)
+			}
+			b.rules[item.Rule] = &item
+			b.sources[item.Rule] = source
+
+		default:
+			return fmt.Errorf("item %d is not a list, macro or rule", i)
+		}
+	}
+	return nil
+}
+
+// build 编译所有规则。宏在全部文件加载后才编译，因此可以引用后面文件中定义的列表
+func (b *builder) build() ([]*compiledRule, error) {
+	rules := make([]*compiledRule, 0, len(b.ruleOrder))
+	for _, name := range b.ruleOrder {
+		item := b.rules[name]
+		rule, err := b.compileRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		rule.info.Source = b.sources[name]
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (b *builder) compileRule(item *ruleItem) (*compiledRule, error) {
+	if item.Condition == "" {
+		return nil, fmt.Errorf("condition is required")
+	}
+	if item.Output == "" {
+		return nil, fmt.Errorf("output is required")
+	}
+	severity := strings.ToLower(item.Severity)
+	if _, ok := severityRank[severity]; !ok {
+		return nil, fmt.Errorf("invalid severity %q", item.Severity)
+	}
+
+	condition, err := b.env.compile(item.Condition)
+	if err != nil {
+		return nil, fmt.Errorf("condition: %w", err)
+	}
+
+	var exceptions orNode
+	var names []string
+	for _, exc := range item.Exceptions {
+		n, err := b.compileException(exc)
+		if err != nil {
+			return nil, fmt.Errorf("exception %s: %w", exc.Name, err)
+		}
+		exceptions = append(exceptions, n)
+		names = append(names, exc.Name)
+	}
+	if len(exceptions) > 0 {
+		condition = andNode{condition, notNode{exceptions}}
+	}
+
+	output, err := parseOutput(item.Output)
+	if err != nil {
+		return nil, fmt.Errorf("output: %w", err)
+	}
+
+	return &compiledRule{
+		info: RuleInfo{
+			Name:       item.Rule,
+			Desc:       item.Desc,
+			Condition:  item.Condition,
+			Output:     item.Output,
+			Severity:   severity,
+			MITRE:      item.MITRE,
+			Tags:       item.Tags,
+			Enabled:    item.Enabled == nil || *item.Enabled,
+			Exceptions: names,
+		},
+		condition: condition,
+		output:    output,
+	}, nil
+}
+
+// compileException 编译例外
+func (b *builder) compileException(exc exceptionDef) (node, error) {
+	if exc.Condition != "" {
+		return b.env.compile(exc.Condition)
+	}
+	if len(exc.Fields) == 0 {
+		return nil, fmt.Errorf("condition or fields is required")
+	}
+	if len(exc.Comps) != 0 && len(exc.Comps) != len(exc.Fields) {
+		return nil, fmt.Errorf("comps must match fields")
+	}
+
+	var alternatives orNode
+	for _, values := range exc.Values {
+		if len(values) != len(exc.Fields) {
+			return nil, fmt.Errorf("values %v do not match fields %v", values, exc.Fields)
+		}
+		var all andNode
+		for i, field := range exc.Fields {
+			extract, ok := lookupField(field)
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", field)
+			}
+			op := opEq
+			if len(exc.Comps) > 0 {
+				op = exc.Comps[i]
+			}
+			n := &compareNode{field: field, extract: extract, op: op, values: []string{values[i]}}
+			switch op {
+			case opEq, opNe, opContains, opStartsWith, opEndsWith, opGlob:
+			case opIContains:
+				n.values[0] = strings.ToLower(values[i])
+			case opPMatch, opIn:
+				n.values = b.expandValue(values[i])
+				n.set = make(map[string]struct{}, len(n.values))
+				for _, v := range n.values {
+					n.set[v] = struct{}{}
+				}
+			default:
+				return nil, fmt.Errorf("unsupported comparison %q", op)
+			}
+			all = append(all, n)
+		}
+		alternatives = append(alternatives, all)
+	}
+	if len(alternatives) == 0 {
+		return constNode(false), nil
+	}
+	return alternatives, nil
+}
+
+// expandValue 将列表名展开为列表项
+func (b *builder) expandValue(v string) []string {
+	if items, ok := b.env.lists[v]; ok {
+		return items
+	}
+	return []string{v}
+}
+
+// outputPattern 输出模板中的字段引用，如 %proc.name
+var outputPattern = regexp.MustCompile(`%[A-Za-z0-9_.]*[A-Za-z0-9_]`)
+
+// outputTemplate 编译后的输出模板
+type outputTemplate struct {
+	text   string
+	fields map[string]fieldExtractor
+}
+
+// parseOutput 解析输出模板并检查其中的字段
+func parseOutput(text string) (*outputTemplate, error) {
+	t := &outputTemplate{text: text, fields: make(map[string]fieldExtractor)}
+	for _, ref := range outputPattern.FindAllString(text, -1) {
+		name := ref[1:]
+		extract, ok := lookupField(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		t.fields[name] = extract
+	}
+	return t, nil
+}
+
+// render 用事件字段值替换模板中的引用，无值的字段显示为 <NA>
+func (t *outputTemplate) render(e *ebpf.Event) string {
+	return outputPattern.ReplaceAllStringFunc(t.text, func(ref string) string {
+		values := t.fields[ref[1:]](e)
+		if len(values) == 0 {
+			return "<NA>"
+		}
+		return strings.Join(values, ",")
+	})
+}
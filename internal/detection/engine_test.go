@@ -0,0 +1,189 @@
+package detection
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// firedRules 收集回放事件命中的规则
+type firedRules struct {
+	mu    sync.Mutex
+	rules map[string]bool
+}
+
+func (f *firedRules) Write(event ebpf.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range event.Detections {
+		f.rules[d.Rule] = true
+	}
+}
+
+// expectedRules 读取事件文件中 "# expect: <规则名>" 声明的预期命中规则
+func expectedRules(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var expected []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if rule, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "# expect:"); ok {
+			expected = append(expected, strings.TrimSpace(rule))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return expected
+}
+
+// fixtureMonitor 创建回放事件文件的监控器。profileDir 为空时行为画像只保存在内存中
+func fixtureMonitor(t *testing.T, path, profileDir string) *ebpf.Monitor {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ebpfCfg := cfg.EBPF
+	ebpfCfg.Source = ebpf.SourceReplay
+	ebpfCfg.ReplayPath = path
+	ebpfCfg.ReplaySpeed = 0
+	ebpfCfg.ReplayLoop = false
+	ebpfCfg.Profile.Dir = profileDir
+
+	monitor, err := ebpf.NewMonitor(ebpfCfg)
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	return monitor
+}
+
+// runFixture 运行监控器直到回放结束
+func runFixture(t *testing.T, monitor *ebpf.Monitor) {
+	t.Helper()
+	if err := monitor.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	status := monitor.SourceStatus()
+	for status.State == ebpf.SourceStateRunning && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		status = monitor.SourceStatus()
+	}
+	monitor.Stop()
+
+	if status.State != ebpf.SourceStateCompleted {
+		t.Fatalf("replay state = %s: %s", status.State, status.Error)
+	}
+	if stats := monitor.Stats(); stats.DecodeErrors > 0 {
+		t.Fatalf("%d events could not be decoded: %s", stats.DecodeErrors, stats.LastError)
+	}
+}
+
+// learnFixtureProfiles 回放基线文件建立行为画像并全部锁定，与 detect -profile-baseline 相同，返回保存画像的目录
+func learnFixtureProfiles(t *testing.T, baseline string) string {
+	t.Helper()
+	dir := t.TempDir()
+	monitor := fixtureMonitor(t, baseline, dir)
+	runFixture(t, monitor)
+	profiles := monitor.Profiles()
+	if len(profiles) == 0 {
+		t.Fatalf("baseline %s produced no profiles", baseline)
+	}
+	for _, p := range profiles {
+		if _, err := monitor.LockProfile(p.ID); err != nil {
+			t.Fatalf("LockProfile: %v", err)
+		}
+	}
+	return dir
+}
+
+// replayFixture 通过监控器回放事件文件，事件经过与线上相同的补全（完整性监视、工作负载、行为画像）后交给引擎
+func replayFixture(t *testing.T, engine *Engine, path, profileDir string) map[string]bool {
+	t.Helper()
+	monitor := fixtureMonitor(t, path, profileDir)
+	monitor.SetDetector(engine)
+	fired := &firedRules{rules: make(map[string]bool)}
+	monitor.AddSink(fired)
+	runFixture(t, monitor)
+	return fired.rules
+}
+
+func TestDefaultRulesMatchFixtures(t *testing.T) {
+	// baseline 为回放前学习并锁定画像的基线文件，相对于 test-configs
+	type fixture struct {
+		path     string
+		baseline string
+	}
+	var fixtures []fixture
+	for _, set := range []struct{ pattern, baseline string }{
+		{pattern: "escape/*.jsonl"},
+		{pattern: "integrity/*.jsonl"},
+		{pattern: "anomaly/*.jsonl", baseline: "anomaly/baseline/web.jsonl"},
+	} {
+		matches, err := filepath.Glob(filepath.Join("..", "..", "test-configs", set.pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) == 0 {
+			t.Fatalf("no fixtures found for test-configs/%s", set.pattern)
+		}
+		for _, path := range matches {
+			fixtures = append(fixtures, fixture{path: path, baseline: set.baseline})
+		}
+	}
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	engine, err := NewEngine(config.DetectionConfig{DefaultRules: true}, log)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	// 监控器使用全局日志器
+	logger.GetLogger().SetOutput(io.Discard)
+
+	for _, f := range fixtures {
+		path := f.path
+		name := filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			expected := expectedRules(t, path)
+			if len(expected) == 0 {
+				t.Fatal("fixture declares no expected rules")
+			}
+
+			profileDir := ""
+			if f.baseline != "" {
+				profileDir = learnFixtureProfiles(t, filepath.Join("..", "..", "test-configs", f.baseline))
+			}
+			fired := replayFixture(t, engine, path, profileDir)
+			for _, rule := range expected {
+				if !fired[rule] {
+					got := make([]string, 0, len(fired))
+					for r := range fired {
+						got = append(got, r)
+					}
+					sort.Strings(got)
+					t.Errorf("expected rule %q did not fire, fired: %v", rule, got)
+				}
+			}
+		})
+	}
+}
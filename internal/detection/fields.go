@@ -0,0 +1,431 @@
+package detection
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/workload"
+)
+
+// fieldExtractor 从事件中提取字段值。多值字段（如祖先进程名）返回多个值，
+// 比较时任一值满足即视为满足
+type fieldExtractor func(e *ebpf.Event) []string
+
+// hostContainerID 宿主机进程的 container.id
+const hostContainerID = "host"
+
+// labelPrefix Pod标签字段前缀，如 k8s.pod.label.app
+const labelPrefix = "k8s.pod.label."
+
+// fields 规则条件和输出模板中可用的字段
+var fields = map[string]fieldExtractor{
+	"evt.type":     str(func(e *ebpf.Event) string { return e.EventType }),
+	"evt.syscall":  str(func(e *ebpf.Event) string { return e.Syscall }),
+	"evt.time":     num(func(e *ebpf.Event) uint64 { return uint64(e.Timestamp) }),
+	"evt.filename": str(func(e *ebpf.Event) string { return e.Filename }),
+
+	"proc.pid":   num(func(e *ebpf.Event) uint64 { return uint64(e.PID) }),
+	"proc.tid":   num(func(e *ebpf.Event) uint64 { return uint64(e.TID) }),
+	"proc.ppid":  num(func(e *ebpf.Event) uint64 { return uint64(e.PPID) }),
+	"proc.name":  str(procName),
+	"proc.exe":   str(procExe),
+	"proc.pname": str(parentName),
+	"proc.aname": ancestorNames,
+	"proc.cmdline": str(func(e *ebpf.Event) string {
+		if e.Process == nil {
+			return ""
+		}
+		return e.Process.Cmdline()
+	}),
+	"proc.args": str(func(e *ebpf.Event) string {
+		if e.Process == nil || len(e.Process.Args) < 2 {
+			return ""
+		}
+		return strings.Join(e.Process.Args[1:], " ")
+	}),
+	"proc.hash": str(func(e *ebpf.Event) string {
+		if e.Process == nil {
+			return ""
+		}
+		return e.Process.ExeHash
+	}),
+	"proc.aexe":     lineageField(func(p *ebpf.ProcessInfo) string { return p.Exe }),
+	"proc.acmdline": lineageField(func(p *ebpf.ProcessInfo) string { return p.Cmdline() }),
+
+	"user.uid": num(func(e *ebpf.Event) uint64 { return uint64(e.UID) }),
+	"user.gid": num(func(e *ebpf.Event) uint64 { return uint64(e.GID) }),
+
+	"fd.name": str(func(e *ebpf.Event) string {
+		if fileEvent(e) {
+			return e.Filename
+		}
+		return ""
+	}),
+	"fd.directory": str(func(e *ebpf.Event) string {
+		if fileEvent(e) {
+			return path.Dir(e.Filename)
+		}
+		return ""
+	}),
+	"fd.basename": str(func(e *ebpf.Event) string {
+		if e.Filename != "" && fileEvent(e) {
+			return path.Base(e.Filename)
+		}
+		return ""
+	}),
+	"fd.newname": str(func(e *ebpf.Event) string {
+		if e.File == nil {
+			return ""
+		}
+		return e.File.NewPath
+	}),
+	"fd.write": str(func(e *ebpf.Event) string {
+		if e.File == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.File.Write)
+	}),
+
+	"fim.path": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return e.Integrity.Path
+	}),
+	"fim.watch": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return e.Integrity.Watch
+	}),
+	"fim.op": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return e.Integrity.Operation
+	}),
+	"fim.drift": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Integrity.Drift)
+	}),
+	"fim.hash": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return e.Integrity.Hash
+	}),
+	"fim.baseline": str(func(e *ebpf.Event) string {
+		if e.Integrity == nil {
+			return ""
+		}
+		return e.Integrity.BaselineHash
+	}),
+
+	"anomaly.category": str(func(e *ebpf.Event) string {
+		if e.Anomaly == nil {
+			return ""
+		}
+		return e.Anomaly.Category
+	}),
+	"anomaly.item": str(func(e *ebpf.Event) string {
+		if e.Anomaly == nil {
+			return ""
+		}
+		return e.Anomaly.Item
+	}),
+	"anomaly.profile": str(func(e *ebpf.Event) string {
+		if e.Anomaly == nil {
+			return ""
+		}
+		return e.Anomaly.Profile
+	}),
+	"anomaly.version": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Anomaly == nil {
+			return 0, false
+		}
+		return uint64(e.Anomaly.ProfileVersion), true
+	}),
+
+	"net.family": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return e.Network.Family
+	}),
+	"net.proto": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return e.Network.Protocol
+	}),
+	"net.direction": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return e.Network.Direction
+	}),
+	"net.saddr": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return e.Network.SourceAddr
+	}),
+	"net.sport": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Network == nil || e.Network.SourcePort == 0 {
+			return 0, false
+		}
+		return uint64(e.Network.SourcePort), true
+	}),
+	"net.daddr": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return e.Network.DestAddr
+	}),
+	"net.dport": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Network == nil {
+			return 0, false
+		}
+		return uint64(e.Network.DestPort), true
+	}),
+	"net.blocked": str(func(e *ebpf.Event) string {
+		if e.Network == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Network.Blocked)
+	}),
+	"net.internal": str(func(e *ebpf.Event) string {
+		if e.Flow == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Flow.Internal)
+	}),
+
+	"flow.new": str(func(e *ebpf.Event) string {
+		if e.Flow == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Flow.NewPeer)
+	}),
+	"flow.fanout": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Flow == nil {
+			return 0, false
+		}
+		return uint64(e.Flow.Fanout), true
+	}),
+	"flow.scan": str(func(e *ebpf.Event) string {
+		if e.Flow == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Flow.Scan)
+	}),
+
+	"ns.host": func(e *ebpf.Event) []string {
+		if e.Namespaces == nil {
+			return nil
+		}
+		return e.Namespaces.Host
+	},
+
+	"module.path": str(func(e *ebpf.Event) string {
+		if e.Module == nil {
+			return ""
+		}
+		return e.Module.Path
+	}),
+
+	"cap.name": str(func(e *ebpf.Event) string {
+		if e.Capability == nil {
+			return ""
+		}
+		return e.Capability.Name
+	}),
+	"cap.granted": str(func(e *ebpf.Event) string {
+		if e.Capability == nil {
+			return ""
+		}
+		return strconv.FormatBool(e.Capability.Granted)
+	}),
+
+	"mount.source": str(func(e *ebpf.Event) string {
+		if e.Mount == nil {
+			return ""
+		}
+		return e.Mount.Source
+	}),
+	"mount.target": str(func(e *ebpf.Event) string {
+		if e.Mount == nil {
+			return ""
+		}
+		return e.Mount.Target
+	}),
+	"mount.fstype": str(func(e *ebpf.Event) string {
+		if e.Mount == nil {
+			return ""
+		}
+		return e.Mount.FSType
+	}),
+
+	"ptrace.request": str(func(e *ebpf.Event) string {
+		if e.Ptrace == nil {
+			return ""
+		}
+		return e.Ptrace.RequestName
+	}),
+	"ptrace.target_pid": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Ptrace == nil {
+			return 0, false
+		}
+		return uint64(e.Ptrace.TargetPID), true
+	}),
+
+	"creds.old_uid": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Credentials == nil {
+			return 0, false
+		}
+		return uint64(e.Credentials.OldUID), true
+	}),
+	"creds.new_uid": optNum(func(e *ebpf.Event) (uint64, bool) {
+		if e.Credentials == nil {
+			return 0, false
+		}
+		return uint64(e.Credentials.NewUID), true
+	}),
+
+	"container.id": str(func(e *ebpf.Event) string {
+		switch {
+		case e.Workload != nil:
+			return e.Workload.ContainerID
+		case e.ContainerID != "":
+			return e.ContainerID
+		default:
+			return hostContainerID
+		}
+	}),
+	"container.name":    workloadField(func(w *workload.Workload) string { return w.ContainerName }),
+	"container.image":   workloadField(func(w *workload.Workload) string { return w.Image }),
+	"container.runtime": workloadField(func(w *workload.Workload) string { return w.Runtime }),
+	"k8s.pod.name":      workloadField(func(w *workload.Workload) string { return w.PodName }),
+	"k8s.ns.name":       workloadField(func(w *workload.Workload) string { return w.Namespace }),
+	"k8s.node.name":     workloadField(func(w *workload.Workload) string { return w.Node }),
+	"workload.name":     workloadField(func(w *workload.Workload) string { return w.Name() }),
+}
+
+// lookupField 查找字段，支持 k8s.pod.label.<key> 形式的标签字段
+func lookupField(name string) (fieldExtractor, bool) {
+	if f, ok := fields[name]; ok {
+		return f, true
+	}
+	if key := strings.TrimPrefix(name, labelPrefix); key != name && key != "" {
+		return func(e *ebpf.Event) []string {
+			if e.Workload == nil {
+				return nil
+			}
+			if v, ok := e.Workload.Labels[key]; ok {
+				return []string{v}
+			}
+			return nil
+		}, true
+	}
+	return nil, false
+}
+
+// fileEvent 判断事件是否为文件操作，模拟和回放事件没有系统调用名时按事件类型判断
+func fileEvent(e *ebpf.Event) bool {
+	switch e.Syscall {
+	case "openat", "write", "rename", "unlink":
+		return true
+	case "":
+		return e.EventType == "file_access"
+	}
+	return false
+}
+
+// procName 返回进程名。execve 事件在系统调用入口采集，comm 仍是调用者的名称，
+// 因此以新程序文件名作为进程名，调用者视为父进程
+func procName(e *ebpf.Event) string {
+	if e.Syscall == "execve" && e.Filename != "" {
+		return path.Base(e.Filename)
+	}
+	return e.Comm
+}
+
+// procExe 返回进程可执行文件路径，来自进程表或 execve 事件
+func procExe(e *ebpf.Event) string {
+	if e.Process != nil && e.Process.Exe != "" {
+		return e.Process.Exe
+	}
+	if e.Syscall == "execve" {
+		return e.Filename
+	}
+	return ""
+}
+
+// parentName 返回父进程名
+func parentName(e *ebpf.Event) string {
+	if e.Syscall == "execve" {
+		return e.Comm
+	}
+	if len(e.Ancestors) > 0 {
+		return e.Ancestors[0]
+	}
+	return ""
+}
+
+// ancestorNames 返回所有祖先进程名
+func ancestorNames(e *ebpf.Event) []string {
+	if e.Syscall == "execve" {
+		return append([]string{e.Comm}, e.Ancestors...)
+	}
+	return e.Ancestors
+}
+
+func str(f func(e *ebpf.Event) string) fieldExtractor {
+	return func(e *ebpf.Event) []string {
+		if v := f(e); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+}
+
+func num(f func(e *ebpf.Event) uint64) fieldExtractor {
+	return func(e *ebpf.Event) []string {
+		return []string{strconv.FormatUint(f(e), 10)}
+	}
+}
+
+func optNum(f func(e *ebpf.Event) (uint64, bool)) fieldExtractor {
+	return func(e *ebpf.Event) []string {
+		if v, ok := f(e); ok {
+			return []string{strconv.FormatUint(v, 10)}
+		}
+		return nil
+	}
+}
+
+// lineageField 提取所有祖先进程的字段，空值被忽略
+func lineageField(f func(p *ebpf.ProcessInfo) string) fieldExtractor {
+	return func(e *ebpf.Event) []string {
+		var values []string
+		for i := range e.Lineage {
+			if v := f(&e.Lineage[i]); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+}
+
+func workloadField(f func(w *workload.Workload) string) fieldExtractor {
+	return str(func(e *ebpf.Event) string {
+		if e.Workload == nil {
+			return ""
+		}
+		return f(e.Workload)
+	})
+}
@@ -0,0 +1,196 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	"golang.org/x/sys/unix"
+)
+
+// lsmListPath 当前启用的LSM列表
+const lsmListPath = "/sys/kernel/security/lsm"
+
+var (
+	// ErrBlockingUnavailable 连接阻断需要内核事件源和启用的BPF LSM
+	ErrBlockingUnavailable = errors.New("connection blocking requires the kernel event source with BPF LSM enabled")
+	// ErrBlockNotFound 阻断项不存在
+	ErrBlockNotFound = errors.New("connection block not found")
+)
+
+// ConnectionBlock 连接阻断项：cgroup 中的进程连接对端地址时被拒绝，Port 为0时阻断该地址的所有端口
+type ConnectionBlock struct {
+	CgroupID uint64 `json:"cgroup_id"`
+	Addr     string `json:"addr"`
+	Port     uint16 `json:"port,omitempty"`
+}
+
+// String 返回便于阅读的描述，如 cgroup 1234 -> 203.0.113.50:4444
+func (b ConnectionBlock) String() string {
+	target := b.Addr + " (all ports)"
+	if b.Port != 0 {
+		target = net.JoinHostPort(b.Addr, strconv.Itoa(int(b.Port)))
+	}
+	return fmt.Sprintf("cgroup %d -> %s", b.CgroupID, target)
+}
+
+// blockKey conn_block map 的键，与 programs/events.h 中的 block_key 一致
+type blockKey struct {
+	CgroupID uint64
+	Family   uint16
+	Port     uint16
+	Pad      uint32
+	Addr     [16]byte
+}
+
+// key 转换为map键，IPv4映射的IPv6地址按IPv4处理
+func (b ConnectionBlock) key() (blockKey, error) {
+	if b.CgroupID == 0 {
+		return blockKey{}, fmt.Errorf("cgroup_id is required")
+	}
+	ip := net.ParseIP(b.Addr)
+	if ip == nil {
+		return blockKey{}, fmt.Errorf("invalid address %q", b.Addr)
+	}
+	key := blockKey{CgroupID: b.CgroupID, Port: b.Port}
+	if v4 := ip.To4(); v4 != nil {
+		key.Family = unix.AF_INET
+		copy(key.Addr[:], v4)
+	} else {
+		key.Family = unix.AF_INET6
+		copy(key.Addr[:], ip.To16())
+	}
+	return key, nil
+}
+
+// block 转换回阻断项
+func (k blockKey) block() ConnectionBlock {
+	addr := net.IP(k.Addr[:])
+	if k.Family == unix.AF_INET {
+		addr = addr[:4]
+	}
+	return ConnectionBlock{CgroupID: k.CgroupID, Addr: addr.String(), Port: k.Port}
+}
+
+// bpfLSMAvailable 检查BPF LSM是否可用：内核需要 CONFIG_BPF_LSM，且启动参数 lsm= 中包含 bpf，
+// 否则LSM程序能够加载和挂载，但钩子不会被调用
+func bpfLSMAvailable() error {
+	if err := features.HaveProgramType(ebpf.LSM); err != nil {
+		return fmt.Errorf("kernel does not support BPF LSM programs: %w", err)
+	}
+	data, err := os.ReadFile(lsmListPath)
+	if err != nil {
+		return fmt.Errorf("failed to read active LSMs: %w", err)
+	}
+	for _, name := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		if name == "bpf" {
+			return nil
+		}
+	}
+	return fmt.Errorf("bpf is not in the active LSM list %q, add it to the lsm= boot parameter", strings.TrimSpace(string(data)))
+}
+
+// blockConnection 写入阻断项，已存在时不报错
+func (k *kernelSource) blockConnection(b ConnectionBlock) error {
+	if !k.blocking {
+		return ErrBlockingUnavailable
+	}
+	key, err := b.key()
+	if err != nil {
+		return err
+	}
+	if err := k.coll.Maps["conn_block"].Update(key, uint8(1), ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("failed to update conn_block: %w", err)
+	}
+	return nil
+}
+
+// unblockConnection 删除阻断项
+func (k *kernelSource) unblockConnection(b ConnectionBlock) error {
+	if !k.blocking {
+		return ErrBlockingUnavailable
+	}
+	key, err := b.key()
+	if err != nil {
+		return err
+	}
+	if err := k.coll.Maps["conn_block"].Delete(key); err != nil {
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return ErrBlockNotFound
+		}
+		return fmt.Errorf("failed to delete from conn_block: %w", err)
+	}
+	return nil
+}
+
+// blockedConnections 列出阻断项
+func (k *kernelSource) blockedConnections() ([]ConnectionBlock, error) {
+	if !k.blocking {
+		return nil, ErrBlockingUnavailable
+	}
+	var (
+		key   blockKey
+		value uint8
+	)
+	blocks := []ConnectionBlock{}
+	iter := k.coll.Maps["conn_block"].Iterate()
+	for iter.Next(&key, &value) {
+		blocks = append(blocks, key.block())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conn_block: %w", err)
+	}
+	return blocks, nil
+}
+
+// kernelBlocker 返回运行中的内核事件源，其他事件源返回 ErrBlockingUnavailable
+func (m *Monitor) kernelBlocker() (*kernelSource, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kernel, ok := m.source.(*kernelSource)
+	if !ok || !m.running {
+		return nil, ErrBlockingUnavailable
+	}
+	return kernel, nil
+}
+
+// BlockConnection 阻断 cgroup 中的进程向对端地址发起的连接，立即在内核中生效。
+// 阻断项保存在内核map中，监控器重启后失效
+func (m *Monitor) BlockConnection(b ConnectionBlock) error {
+	kernel, err := m.kernelBlocker()
+	if err != nil {
+		return err
+	}
+	if err := kernel.blockConnection(b); err != nil {
+		return err
+	}
+	m.log.Infof("Connection blocked: %s", b)
+	return nil
+}
+
+// UnblockConnection 删除连接阻断项
+func (m *Monitor) UnblockConnection(b ConnectionBlock) error {
+	kernel, err := m.kernelBlocker()
+	if err != nil {
+		return err
+	}
+	if err := kernel.unblockConnection(b); err != nil {
+		return err
+	}
+	m.log.Infof("Connection unblocked: %s", b)
+	return nil
+}
+
+// BlockedConnections 列出当前的连接阻断项
+func (m *Monitor) BlockedConnections() ([]ConnectionBlock, error) {
+	kernel, err := m.kernelBlocker()
+	if err != nil {
+		return nil, err
+	}
+	return kernel.blockedConnections()
+}
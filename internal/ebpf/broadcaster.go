@@ -0,0 +1,276 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTooManySubscribers 订阅者数量已达上限
+var ErrTooManySubscribers = errors.New("too many event subscribers")
+
+// severityLevels 严重程度排序，用于按最低级别过滤
+var severityLevels = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// ValidSeverity 检查严重程度名称是否合法
+func ValidSeverity(severity string) bool {
+	_, ok := severityLevels[severity]
+	return ok
+}
+
+// SeverityLevel 返回严重程度的排序值，info 为 0，critical 为 4，未知名称视为 info
+func SeverityLevel(severity string) int {
+	return severityLevels[severity]
+}
+
+// EventFilter 订阅过滤条件，各条件之间为"与"关系，空条件不过滤
+type EventFilter struct {
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Severities  []string `json:"severities,omitempty"`
+	Types       []string `json:"types,omitempty"`
+	// Containers 匹配容器ID前缀、容器名或Pod名
+	Containers []string `json:"containers,omitempty"`
+}
+
+// Validate 检查过滤条件
+func (f EventFilter) Validate() error {
+	if f.MinSeverity != "" && !ValidSeverity(f.MinSeverity) {
+		return fmt.Errorf("invalid min_severity: %s", f.MinSeverity)
+	}
+	for _, s := range f.Severities {
+		if !ValidSeverity(s) {
+			return fmt.Errorf("invalid severity: %s", s)
+		}
+	}
+	return nil
+}
+
+// Match 判断事件是否满足过滤条件
+func (f EventFilter) Match(e *Event) bool {
+	if f.MinSeverity != "" && severityLevels[e.Severity] < severityLevels[f.MinSeverity] {
+		return false
+	}
+	if len(f.Severities) > 0 && !contains(f.Severities, e.Severity) {
+		return false
+	}
+	if len(f.Types) > 0 && !contains(f.Types, e.EventType) {
+		return false
+	}
+	if len(f.Containers) > 0 && !f.matchContainer(e) {
+		return false
+	}
+	return true
+}
+
+func (f EventFilter) matchContainer(e *Event) bool {
+	for _, c := range f.Containers {
+		if c == "" {
+			continue
+		}
+		if strings.HasPrefix(e.ContainerID, c) {
+			return true
+		}
+		if w := e.Workload; w != nil && (w.ContainerName == c || w.PodName == c || w.Name() == c) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription 事件订阅。订阅者消费过慢、连续丢弃的事件超过上限时会被驱逐，
+// 此时 Done 被关闭，Err 返回原因
+type Subscription struct {
+	id      uint64
+	events  chan Event
+	done    chan struct{}
+	filter  atomic.Pointer[EventFilter]
+	dropped atomic.Uint64
+	streak  atomic.Uint64 // 连续丢弃数，成功投递后清零
+
+	mu  sync.Mutex
+	err error
+}
+
+// ID 返回订阅编号
+func (s *Subscription) ID() uint64 {
+	return s.id
+}
+
+// Events 返回事件通道
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done 订阅结束（取消或被驱逐）时关闭
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回订阅被驱逐的原因，正常取消时为nil
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Filter 返回当前过滤条件
+func (s *Subscription) Filter() EventFilter {
+	return *s.filter.Load()
+}
+
+// SetFilter 更新过滤条件
+func (s *Subscription) SetFilter(filter EventFilter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	s.filter.Store(&filter)
+	return nil
+}
+
+// Dropped 返回因缓冲区已满而丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// BroadcasterStats 广播统计
+type BroadcasterStats struct {
+	Subscribers int    `json:"subscribers"`
+	Dropped     uint64 `json:"dropped"` // 订阅者缓冲区已满而丢弃的事件数
+	Evicted     uint64 `json:"evicted"` // 因消费过慢被驱逐的订阅者数
+}
+
+// Broadcaster 将事件分发给所有订阅者。每个订阅者有独立的缓冲区，
+// 发送不阻塞，单个慢订阅者不会影响其他订阅者和事件采集
+type Broadcaster struct {
+	bufferSize     int
+	maxDrops       uint64
+	maxSubscribers int
+
+	mu      sync.RWMutex
+	subs    map[uint64]*Subscription
+	nextID  uint64
+	dropped atomic.Uint64
+	evicted atomic.Uint64
+}
+
+// NewBroadcaster 创建广播器。maxDrops 为驱逐前允许连续丢弃的事件数，0 表示从不驱逐
+func NewBroadcaster(bufferSize, maxDrops, maxSubscribers int) *Broadcaster {
+	if bufferSize <= 0 {
+		bufferSize = 256
+	}
+	return &Broadcaster{
+		bufferSize:     bufferSize,
+		maxDrops:       uint64(maxDrops),
+		maxSubscribers: maxSubscribers,
+		subs:           make(map[uint64]*Subscription),
+	}
+}
+
+// Subscribe 新增订阅
+func (b *Broadcaster) Subscribe(filter EventFilter) (*Subscription, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.maxSubscribers > 0 && len(b.subs) >= b.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	b.nextID++
+	sub := &Subscription{
+		id:     b.nextID,
+		events: make(chan Event, b.bufferSize),
+		done:   make(chan struct{}),
+	}
+	sub.filter.Store(&filter)
+	b.subs[sub.id] = sub
+	return sub, nil
+}
+
+// Unsubscribe 取消订阅
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(sub, nil)
+}
+
+// Publish 将事件投递给过滤条件匹配的订阅者，缓冲区已满时丢弃，
+// 连续丢弃超过上限的订阅者被驱逐
+func (b *Broadcaster) Publish(event Event) {
+	var slow []*Subscription
+
+	b.mu.RLock()
+	for _, sub := range b.subs {
+		filter := sub.filter.Load()
+		if !filter.Match(&event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+			sub.streak.Store(0)
+		default:
+			sub.dropped.Add(1)
+			b.dropped.Add(1)
+			if streak := sub.streak.Add(1); b.maxDrops > 0 && streak >= b.maxDrops {
+				slow = append(slow, sub)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(slow) == 0 {
+		return
+	}
+	b.mu.Lock()
+	for _, sub := range slow {
+		if b.removeLocked(sub, fmt.Errorf("subscriber too slow, %d events dropped", sub.dropped.Load())) {
+			b.evicted.Add(1)
+		}
+	}
+	b.mu.Unlock()
+}
+
+// removeLocked 移除订阅并关闭 Done，调用方需持有写锁。
+// 事件通道不关闭，读取方应同时等待 Done
+func (b *Broadcaster) removeLocked(sub *Subscription, reason error) bool {
+	if _, ok := b.subs[sub.id]; !ok {
+		return false
+	}
+	delete(b.subs, sub.id)
+
+	sub.mu.Lock()
+	sub.err = reason
+	sub.mu.Unlock()
+	close(sub.done)
+	return true
+}
+
+// Stats 返回广播统计
+func (b *Broadcaster) Stats() BroadcasterStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return BroadcasterStats{
+		Subscribers: len(b.subs),
+		Dropped:     b.dropped.Load(),
+		Evicted:     b.evicted.Load(),
+	}
+}
@@ -0,0 +1,324 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloudsecops/internal/config"
+
+	"github.com/cilium/ebpf"
+)
+
+// 内核侧过滤协议，与 programs/events.h 同步
+const (
+	maxFilterPathLen = 128
+	maxFilterEntries = 1024
+
+	filterAllow uint8 = 1
+	filterDeny  uint8 = 2
+
+	filterAllowlistPath   uint32 = 1 << 0
+	filterAllowlistComm   uint32 = 1 << 1
+	filterAllowlistUID    uint32 = 1 << 2
+	filterAllowlistCgroup uint32 = 1 << 3
+	filterPaths           uint32 = 1 << 4
+
+	filterStatPath      uint32 = 0
+	filterStatComm      uint32 = 1
+	filterStatUID       uint32 = 2
+	filterStatCgroup    uint32 = 3
+	filterStatThrottled uint32 = 4
+
+	// 令牌桶参数上限，保证内核中的乘法不会溢出
+	maxRateLimit = 1000000
+)
+
+// filterConfigValue filter_config map 的值
+type filterConfigValue struct {
+	Flags uint32
+	Pad   uint32
+	Rate  uint64
+	Burst uint64
+}
+
+// pathFilterKey path_filter 的LPM键
+type pathFilterKey struct {
+	Prefixlen uint32
+	Path      [maxFilterPathLen]byte
+}
+
+// KernelFilterStats 内核侧过滤统计，从程序加载起累计
+type KernelFilterStats struct {
+	Filtered       uint64 `json:"filtered"` // 命中过滤规则被丢弃的记录总数
+	FilteredPath   uint64 `json:"filtered_path"`
+	FilteredComm   uint64 `json:"filtered_comm"`
+	FilteredUID    uint64 `json:"filtered_uid"`
+	FilteredCgroup uint64 `json:"filtered_cgroup"`
+	Throttled      uint64 `json:"throttled"` // 超过cgroup速率限制被丢弃的记录数
+}
+
+// NormalizeKernelFilter 检查内核过滤配置并补全默认值：去除空白和重复项，
+// RateBurst 为0时取 RateLimit
+func NormalizeKernelFilter(f config.KernelFilterConfig) (config.KernelFilterConfig, error) {
+	var err error
+	if f.AllowPaths, f.DenyPaths, err = normalizeFilterStrings("path", f.AllowPaths, f.DenyPaths, validFilterPath); err != nil {
+		return f, err
+	}
+	if f.AllowComms, f.DenyComms, err = normalizeFilterStrings("comm", f.AllowComms, f.DenyComms, validFilterComm); err != nil {
+		return f, err
+	}
+	if err := checkFilterIDs("uid", f.AllowUIDs, f.DenyUIDs); err != nil {
+		return f, err
+	}
+	if err := checkFilterIDs("cgroup", f.AllowCgroups, f.DenyCgroups); err != nil {
+		return f, err
+	}
+
+	if f.RateLimit < 0 || f.RateLimit > maxRateLimit {
+		return f, fmt.Errorf("rate_limit must be between 0 and %d", maxRateLimit)
+	}
+	if f.RateBurst < 0 || f.RateBurst > maxRateLimit {
+		return f, fmt.Errorf("rate_burst must be between 0 and %d", maxRateLimit)
+	}
+	if f.RateBurst == 0 {
+		f.RateBurst = f.RateLimit
+	}
+	return f, nil
+}
+
+// normalizeFilterStrings 规范化一组允许和拒绝项，同一项不能同时出现在两个列表中
+func normalizeFilterStrings(kind string, allow, deny []string, valid func(string) error) ([]string, []string, error) {
+	seen := make(map[string]bool)
+	clean := func(items []string, action bool) ([]string, error) {
+		var out []string
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if err := valid(item); err != nil {
+				return nil, err
+			}
+			if previous, ok := seen[item]; ok {
+				if previous != action {
+					return nil, fmt.Errorf("%s %q is both allowed and denied", kind, item)
+				}
+				continue
+			}
+			seen[item] = action
+			out = append(out, item)
+		}
+		return out, nil
+	}
+
+	allow, err := clean(allow, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	deny, err = clean(deny, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(seen) > maxFilterEntries {
+		return nil, nil, fmt.Errorf("too many %s filters: %d, the limit is %d", kind, len(seen), maxFilterEntries)
+	}
+	return allow, deny, nil
+}
+
+// checkFilterIDs 检查UID或cgroup ID列表
+func checkFilterIDs[T comparable](kind string, allow, deny []T) error {
+	allowed := make(map[T]bool, len(allow))
+	for _, id := range allow {
+		allowed[id] = true
+	}
+	total := len(allowed)
+	denied := make(map[T]bool, len(deny))
+	for _, id := range deny {
+		if allowed[id] {
+			return fmt.Errorf("%s %v is both allowed and denied", kind, id)
+		}
+		if !denied[id] {
+			denied[id] = true
+			total++
+		}
+	}
+	if total > maxFilterEntries {
+		return fmt.Errorf("too many %s filters: %d, the limit is %d", kind, total, maxFilterEntries)
+	}
+	return nil
+}
+
+// validFilterPath 路径前缀必须是绝对路径，且短于内核读取的长度
+func validFilterPath(p string) error {
+	if !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("path filter %q must be absolute", p)
+	}
+	if len(p) >= maxFilterPathLen {
+		return fmt.Errorf("path filter %q is longer than %d bytes", p, maxFilterPathLen-1)
+	}
+	return nil
+}
+
+// validFilterComm 进程名不能超过内核 comm 的长度
+func validFilterComm(comm string) error {
+	if len(comm) > maxCommLen {
+		return fmt.Errorf("comm filter %q is longer than %d bytes", comm, maxCommLen)
+	}
+	return nil
+}
+
+// applyFilter 将过滤配置写入内核map。先写入新项和配置，再删除多余的旧项，
+// 更新过程中新旧规则短暂共存，但不会出现所有过滤都失效的窗口
+func (k *kernelSource) applyFilter(f config.KernelFilterConfig) error {
+	if k.coll == nil {
+		return fmt.Errorf("kernel source is not open")
+	}
+
+	paths := make(map[pathFilterKey]uint8)
+	for _, p := range f.AllowPaths {
+		paths[newPathFilterKey(p)] = filterAllow
+	}
+	for _, p := range f.DenyPaths {
+		paths[newPathFilterKey(p)] = filterDeny
+	}
+	comms := make(map[[maxCommLen + 1]byte]uint8)
+	for _, c := range f.AllowComms {
+		comms[commKey(c)] = filterAllow
+	}
+	for _, c := range f.DenyComms {
+		comms[commKey(c)] = filterDeny
+	}
+
+	value := filterConfigValue{Rate: uint64(f.RateLimit), Burst: uint64(f.RateBurst)}
+	if len(f.AllowPaths) > 0 {
+		value.Flags |= filterAllowlistPath
+	}
+	if len(paths) > 0 {
+		value.Flags |= filterPaths
+	}
+	if len(f.AllowComms) > 0 {
+		value.Flags |= filterAllowlistComm
+	}
+	if len(f.AllowUIDs) > 0 {
+		value.Flags |= filterAllowlistUID
+	}
+	if len(f.AllowCgroups) > 0 {
+		value.Flags |= filterAllowlistCgroup
+	}
+
+	var stale []func() error
+	var err error
+	if stale, err = putFilterEntries(k.coll.Maps["path_filter"], paths, stale); err != nil {
+		return fmt.Errorf("failed to update path filter: %w", err)
+	}
+	if stale, err = putFilterEntries(k.coll.Maps["comm_filter"], comms, stale); err != nil {
+		return fmt.Errorf("failed to update comm filter: %w", err)
+	}
+	if stale, err = putFilterEntries(k.coll.Maps["uid_filter"], filterActions(f.AllowUIDs, f.DenyUIDs), stale); err != nil {
+		return fmt.Errorf("failed to update uid filter: %w", err)
+	}
+	if stale, err = putFilterEntries(k.coll.Maps["cgroup_filter"], filterActions(f.AllowCgroups, f.DenyCgroups), stale); err != nil {
+		return fmt.Errorf("failed to update cgroup filter: %w", err)
+	}
+
+	configMap := k.coll.Maps["filter_config"]
+	if configMap == nil {
+		return fmt.Errorf("eBPF object has no filter_config map")
+	}
+	if err := configMap.Put(uint32(0), value); err != nil {
+		return fmt.Errorf("failed to update filter config: %w", err)
+	}
+
+	for _, remove := range stale {
+		if err := remove(); err != nil {
+			return fmt.Errorf("failed to remove stale filter: %w", err)
+		}
+	}
+	k.cfg.Filter = f
+	return nil
+}
+
+// putFilterEntries 写入过滤表，并将表中多余项的删除操作追加到 stale
+func putFilterEntries[K comparable](m *ebpf.Map, entries map[K]uint8, stale []func() error) ([]func() error, error) {
+	if m == nil {
+		return stale, fmt.Errorf("map not found in eBPF object")
+	}
+
+	var key K
+	var action uint8
+	iter := m.Iterate()
+	for iter.Next(&key, &action) {
+		if _, ok := entries[key]; !ok {
+			staleKey := key
+			stale = append(stale, func() error {
+				if err := m.Delete(staleKey); err != nil && !isNotExist(err) {
+					return err
+				}
+				return nil
+			})
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return stale, err
+	}
+
+	for key, action := range entries {
+		if err := m.Put(key, action); err != nil {
+			return stale, err
+		}
+	}
+	return stale, nil
+}
+
+// filterActions 将允许和拒绝列表合并为过滤表项
+func filterActions[T comparable](allow, deny []T) map[T]uint8 {
+	entries := make(map[T]uint8, len(allow)+len(deny))
+	for _, id := range allow {
+		entries[id] = filterAllow
+	}
+	for _, id := range deny {
+		entries[id] = filterDeny
+	}
+	return entries
+}
+
+// newPathFilterKey 构造路径前缀键，前缀长度不含结尾的NUL
+func newPathFilterKey(prefix string) pathFilterKey {
+	key := pathFilterKey{Prefixlen: uint32(len(prefix)) * 8}
+	copy(key.Path[:], prefix)
+	return key
+}
+
+// commKey 构造与 bpf_get_current_comm 结果相同的进程名键
+func commKey(comm string) [maxCommLen + 1]byte {
+	var key [maxCommLen + 1]byte
+	copy(key[:maxCommLen], comm)
+	return key
+}
+
+// isNotExist 判断map操作是否因键不存在而失败
+func isNotExist(err error) bool {
+	return errors.Is(err, ebpf.ErrKeyNotExist)
+}
+
+// filterStats 读取内核侧过滤计数
+func (k *kernelSource) filterStats() *KernelFilterStats {
+	if k.coll == nil {
+		return nil
+	}
+	statsMap := k.coll.Maps["filter_stats"]
+	if statsMap == nil {
+		return nil
+	}
+
+	stats := &KernelFilterStats{
+		FilteredPath:   perCPUTotal(statsMap, filterStatPath),
+		FilteredComm:   perCPUTotal(statsMap, filterStatComm),
+		FilteredUID:    perCPUTotal(statsMap, filterStatUID),
+		FilteredCgroup: perCPUTotal(statsMap, filterStatCgroup),
+		Throttled:      perCPUTotal(statsMap, filterStatThrottled),
+	}
+	stats.Filtered = stats.FilteredPath + stats.FilteredComm + stats.FilteredUID + stats.FilteredCgroup
+	return stats
+}
@@ -0,0 +1,375 @@
+package ebpf
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloudsecops/internal/config"
+)
+
+// 流表维护参数
+const (
+	flowSweepInterval = 60   // 秒
+	maxFlowProcesses  = 8    // 每条流记录的进程名数量上限
+	maxFanoutTracked  = 4096 // 每个容器扫描窗口内记录的对端数量上限
+	defaultFlowLimit  = 100
+	maxFlowQueryLimit = 1000
+)
+
+// hostFlowContainer 查询宿主机进程的流时使用的容器名
+const hostFlowContainer = "host"
+
+// Flow 网络流，按容器、协议、方向、对端地址和服务端口聚合。
+// 服务端口对出站连接是对端端口，对入站连接是本端端口
+type Flow struct {
+	ContainerID string   `json:"container_id"`
+	Workload    string   `json:"workload,omitempty"`
+	Protocol    string   `json:"protocol"`
+	Direction   string   `json:"direction"`
+	LocalAddr   string   `json:"local_addr,omitempty"`
+	PeerAddr    string   `json:"peer_addr"`
+	Port        uint16   `json:"port"`
+	Internal    bool     `json:"internal"`
+	Processes   []string `json:"processes,omitempty"`
+	Count       uint64   `json:"count"`
+	Bytes       uint64   `json:"bytes,omitempty"`
+	FirstSeen   int64    `json:"first_seen"`
+	LastSeen    int64    `json:"last_seen"`
+}
+
+// FlowContext 网络事件在所属容器近期连接中的上下文，由流追踪器填写，供检测规则使用
+type FlowContext struct {
+	// Internal 对端地址属于内部网络或回环地址
+	Internal bool `json:"internal"`
+	// NewPeer 学习期结束后首次出现的出站对端地址和端口
+	NewPeer bool `json:"new_peer,omitempty"`
+	// Fanout 扫描窗口内容器连接过的不同对端地址和端口数，仅出站事件计算
+	Fanout int `json:"fanout,omitempty"`
+	// Scan 扇出达到扫描阈值，同一容器每个窗口只标记一次
+	Scan bool `json:"scan,omitempty"`
+}
+
+// FlowQuery 流查询条件，零值不过滤
+type FlowQuery struct {
+	// Container 匹配容器ID前缀或工作负载名，host 表示宿主机进程
+	Container string
+	Protocol  string
+	Direction string
+	Internal  *bool
+	Limit     int
+}
+
+// Validate 检查查询条件
+func (q FlowQuery) Validate() error {
+	switch q.Protocol {
+	case "", "tcp", "udp":
+	default:
+		return fmt.Errorf("invalid protocol %q, expected tcp or udp", q.Protocol)
+	}
+	switch q.Direction {
+	case "", DirectionOutbound, DirectionInbound:
+	default:
+		return fmt.Errorf("invalid direction %q, expected outbound or inbound", q.Direction)
+	}
+	if q.Limit < 0 || q.Limit > maxFlowQueryLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxFlowQueryLimit)
+	}
+	return nil
+}
+
+type flowKey struct {
+	container string
+	protocol  string
+	direction string
+	peer      string
+	port      uint16
+}
+
+// containerFlows 单个容器的流统计状态
+type containerFlows struct {
+	firstSeen int64
+	lastSeen  int64
+	flows     int
+	// 扫描窗口内出站对端的最近连接时间
+	peers    map[string]int64
+	prunedAt int64
+	lastScan int64
+}
+
+// flowTracker 将网络事件聚合为流，并计算新对端和扇出等上下文。
+// 时间以事件时间戳为准，回放历史事件时结果与实时采集一致
+type flowTracker struct {
+	internal      []*net.IPNet
+	maxFlows      int
+	idleTimeout   int64
+	learning      int64
+	scanWindow    int64
+	scanThreshold int
+
+	mu         sync.RWMutex
+	flows      map[flowKey]*Flow
+	containers map[string]*containerFlows
+	lastSweep  int64
+	dropped    uint64
+}
+
+// newFlowTracker 创建流追踪器
+func newFlowTracker(cfg config.EBPFConfig) (*flowTracker, error) {
+	t := &flowTracker{
+		maxFlows:      cfg.FlowTableSize,
+		idleTimeout:   int64(cfg.FlowIdleTimeout),
+		learning:      int64(cfg.FlowLearningPeriod),
+		scanWindow:    int64(cfg.ScanWindow),
+		scanThreshold: cfg.ScanThreshold,
+		flows:         make(map[flowKey]*Flow),
+		containers:    make(map[string]*containerFlows),
+	}
+	for _, cidr := range cfg.InternalNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid internal network %q: %w", cidr, err)
+		}
+		t.internal = append(t.internal, network)
+	}
+	if t.maxFlows <= 0 {
+		t.maxFlows = 16384
+	}
+	if t.scanWindow <= 0 {
+		t.scanWindow = 60
+	}
+	return t, nil
+}
+
+// isInternal 判断地址是否属于内部网络
+func (t *flowTracker) isInternal(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range t.internal {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe 将网络事件计入流表并写入 event.Flow
+func (t *flowTracker) observe(event *Event) {
+	n := event.Network
+	if n == nil || n.Family == "unix" {
+		return
+	}
+	key := flowKey{
+		container: event.ContainerID,
+		protocol:  n.Protocol,
+		direction: n.Direction,
+		peer:      n.PeerAddr(),
+		port:      n.DestPort,
+	}
+	if key.peer == "" {
+		return
+	}
+	if key.protocol == "" {
+		key.protocol = "tcp"
+	}
+	if key.direction == "" {
+		key.direction = DirectionOutbound
+	}
+	peerIP := net.ParseIP(key.peer)
+	flowCtx := &FlowContext{Internal: t.isInternal(peerIP)}
+	now := event.Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now-t.lastSweep >= flowSweepInterval || now < t.lastSweep {
+		t.sweepLocked(now)
+	}
+
+	c := t.containers[key.container]
+	if c == nil {
+		c = &containerFlows{firstSeen: now, peers: make(map[string]int64)}
+		t.containers[key.container] = c
+	}
+	c.lastSeen = now
+
+	flow := t.flows[key]
+	if flow == nil {
+		if len(t.flows) >= t.maxFlows {
+			t.sweepLocked(now)
+		}
+		if len(t.flows) >= t.maxFlows {
+			t.dropped++
+		} else {
+			flow = &Flow{
+				ContainerID: key.container,
+				Protocol:    key.protocol,
+				Direction:   key.direction,
+				PeerAddr:    key.peer,
+				Port:        key.port,
+				Internal:    flowCtx.Internal,
+				FirstSeen:   now,
+			}
+			t.flows[key] = flow
+			c.flows++
+			flowCtx.NewPeer = key.direction == DirectionOutbound &&
+				now-c.firstSeen >= t.learning && !peerIP.IsLoopback()
+		}
+	}
+	if flow != nil {
+		flow.LastSeen = now
+		flow.Count++
+		flow.Bytes += uint64(n.Bytes)
+		if local := n.LocalAddr(); local != "" {
+			flow.LocalAddr = local
+		}
+		if event.Workload != nil {
+			flow.Workload = event.Workload.Name()
+		}
+		flow.addProcess(event.Comm)
+	}
+
+	if key.direction == DirectionOutbound {
+		flowCtx.Fanout, flowCtx.Scan = t.fanout(c, net.JoinHostPort(key.peer, strconv.Itoa(int(key.port))), now)
+	}
+	event.Flow = flowCtx
+}
+
+// fanout 记录一次出站连接，返回窗口内的不同对端数以及是否达到扫描阈值
+func (t *flowTracker) fanout(c *containerFlows, peer string, now int64) (int, bool) {
+	if c.prunedAt != now {
+		for p, seen := range c.peers {
+			if now-seen >= t.scanWindow || seen > now {
+				delete(c.peers, p)
+			}
+		}
+		c.prunedAt = now
+	}
+	if _, ok := c.peers[peer]; ok || len(c.peers) < maxFanoutTracked {
+		c.peers[peer] = now
+	}
+
+	count := len(c.peers)
+	if t.scanThreshold <= 0 || count < t.scanThreshold {
+		return count, false
+	}
+	if c.lastScan != 0 && now-c.lastScan < t.scanWindow && now >= c.lastScan {
+		return count, false
+	}
+	c.lastScan = now
+	return count, true
+}
+
+// sweepLocked 移除空闲超时的流和容器状态
+func (t *flowTracker) sweepLocked(now int64) {
+	t.lastSweep = now
+	if t.idleTimeout <= 0 {
+		return
+	}
+	for key, flow := range t.flows {
+		if now-flow.LastSeen > t.idleTimeout {
+			delete(t.flows, key)
+			if c := t.containers[key.container]; c != nil {
+				c.flows--
+			}
+		}
+	}
+	for id, c := range t.containers {
+		if c.flows <= 0 && now-c.lastSeen > t.idleTimeout {
+			delete(t.containers, id)
+		}
+	}
+}
+
+// addProcess 记录使用该流的进程名
+func (f *Flow) addProcess(comm string) {
+	if comm == "" || len(f.Processes) >= maxFlowProcesses {
+		return
+	}
+	for _, p := range f.Processes {
+		if p == comm {
+			return
+		}
+	}
+	f.Processes = append(f.Processes, comm)
+}
+
+// query 按条件返回流，按最近活动时间倒序
+func (t *flowTracker) query(q FlowQuery) ([]Flow, int) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultFlowLimit
+	}
+
+	t.mu.RLock()
+	flows := make([]Flow, 0, len(t.flows))
+	for _, flow := range t.flows {
+		if q.matches(flow) {
+			f := *flow
+			f.Processes = append([]string(nil), flow.Processes...)
+			flows = append(flows, f)
+		}
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(flows, func(i, j int) bool {
+		a, b := flows[i], flows[j]
+		if a.LastSeen != b.LastSeen {
+			return a.LastSeen > b.LastSeen
+		}
+		if a.ContainerID != b.ContainerID {
+			return a.ContainerID < b.ContainerID
+		}
+		if a.PeerAddr != b.PeerAddr {
+			return a.PeerAddr < b.PeerAddr
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Protocol+a.Direction < b.Protocol+b.Direction
+	})
+
+	total := len(flows)
+	if len(flows) > limit {
+		flows = flows[:limit]
+	}
+	return flows, total
+}
+
+// matches 判断流是否满足查询条件
+func (q FlowQuery) matches(f *Flow) bool {
+	switch {
+	case q.Container == hostFlowContainer:
+		if f.ContainerID != "" {
+			return false
+		}
+	case q.Container != "":
+		if f.ContainerID == "" || (!strings.HasPrefix(f.ContainerID, q.Container) && f.Workload != q.Container) {
+			return false
+		}
+	}
+	if q.Protocol != "" && f.Protocol != q.Protocol {
+		return false
+	}
+	if q.Direction != "" && f.Direction != q.Direction {
+		return false
+	}
+	if q.Internal != nil && f.Internal != *q.Internal {
+		return false
+	}
+	return true
+}
+
+// stats 返回流表大小和因流表已满未能记录的新流数
+func (t *flowTracker) stats() (int, uint64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.flows), t.dropped
+}
@@ -0,0 +1,675 @@
+package ebpf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudsecops/internal/config"
+
+	"github.com/cilium/ebpf"
+	"github.com/sirupsen/logrus"
+)
+
+// 文件完整性监视的操作类型
+const (
+	IntegrityRead      = "read"
+	IntegrityOpenWrite = "open_write"
+	IntegrityWrite     = "write"
+	IntegrityRename    = "rename"
+	IntegrityDelete    = "delete"
+	IntegrityDrift     = "drift"
+)
+
+// EventTypeIntegrity 内容漂移事件的类型
+const EventTypeIntegrity = "file_integrity"
+
+const (
+	// integrityQueueSize 等待计算哈希的文件数，队列满时放弃本次计算
+	integrityQueueSize = 256
+	// integrityWalkDepth 初始化基线时目录监视的最大遍历深度
+	integrityWalkDepth = 4
+)
+
+// IntegrityDetails 监视文件的访问详情。Path 为进程视角的路径，容器内的文件与宿主机文件分别建立基线
+type IntegrityDetails struct {
+	Path      string `json:"path"`
+	Watch     string `json:"watch"`
+	Operation string `json:"operation"`
+	// BaselineHash 和 Hash 为基线和当前内容的SHA-256，仅在启用哈希基线时填写
+	BaselineHash string `json:"baseline_hash,omitempty"`
+	Hash         string `json:"hash,omitempty"`
+	Drift        bool   `json:"drift,omitempty"`
+}
+
+// FileBaseline 监视文件的内容基线
+type FileBaseline struct {
+	ContainerID string    `json:"container_id,omitempty"`
+	Path        string    `json:"path"`
+	Watch       string    `json:"watch"`
+	Hash        string    `json:"hash"`
+	Size        int64     `json:"size"`
+	RecordedAt  time.Time `json:"recorded_at"`
+	// Current 最近一次计算的哈希，与 Hash 不同时文件已漂移
+	Current   string    `json:"current,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Drifted   bool      `json:"drifted"`
+	// ModifiedBy 最近一次修改该文件的进程
+	ModifiedBy string `json:"modified_by,omitempty"`
+}
+
+// IntegrityStatus 文件完整性监视状态
+type IntegrityStatus struct {
+	Enabled   bool           `json:"enabled"`
+	Hashing   bool           `json:"hashing"`
+	Watches   []string       `json:"watches"`
+	Baselines int            `json:"baselines"`
+	Skipped   uint64         `json:"skipped,omitempty"` // 队列满或基线数达到上限而未计算哈希的次数
+	Drifted   []FileBaseline `json:"drifted"`
+}
+
+// watchPattern 监视路径。以 / 结尾的模式匹配目录下任意深度的文件，* 等通配符只匹配单个路径分量
+type watchPattern struct {
+	raw   string
+	glob  string
+	dir   bool
+	depth int
+}
+
+// newWatchPattern 解析监视路径
+func newWatchPattern(raw string) (watchPattern, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return watchPattern{}, fmt.Errorf("integrity path %q must be absolute", raw)
+	}
+	glob := path.Clean(raw)
+	if _, err := path.Match(glob, ""); err != nil {
+		return watchPattern{}, fmt.Errorf("integrity path %q: %w", raw, err)
+	}
+	w := watchPattern{raw: raw, glob: glob, dir: strings.HasSuffix(raw, "/") && glob != "/"}
+	w.depth = strings.Count(glob, "/")
+	if len(w.prefix()) >= maxFilterPathLen {
+		return watchPattern{}, fmt.Errorf("integrity path %q is longer than %d bytes before the first wildcard", raw, maxFilterPathLen-1)
+	}
+	return w, nil
+}
+
+// match 判断路径是否命中监视模式
+func (w watchPattern) match(p string) bool {
+	p = path.Clean(p)
+	if !w.dir {
+		ok, _ := path.Match(w.glob, p)
+		return ok
+	}
+	// 取与模式相同数量的路径分量，剩余部分必须非空
+	i, n := 0, 0
+	for i = 1; i < len(p); i++ {
+		if p[i] == '/' {
+			if n++; n == w.depth {
+				break
+			}
+		}
+	}
+	if n < w.depth || i >= len(p)-1 {
+		return false
+	}
+	ok, _ := path.Match(w.glob, p[:i])
+	return ok
+}
+
+// prefix 返回第一个通配符之前的部分，写入内核的前缀表
+func (w watchPattern) prefix() string {
+	literal := w.glob
+	if i := strings.IndexAny(literal, "*?[\\"); i >= 0 {
+		return literal[:strings.LastIndexByte(literal[:i], '/')+1]
+	}
+	if w.dir {
+		literal += "/"
+	}
+	return literal
+}
+
+// parseWatchPatterns 解析并去重监视路径
+func parseWatchPatterns(paths []string) ([]watchPattern, error) {
+	seen := make(map[string]bool)
+	var patterns []watchPattern
+	for _, raw := range paths {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		w, err := newWatchPattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, w)
+	}
+	if len(patterns) > maxFilterEntries {
+		return nil, fmt.Errorf("too many integrity paths: %d, the limit is %d", len(patterns), maxFilterEntries)
+	}
+	return patterns, nil
+}
+
+// integrityPrefixes 返回写入内核 fim_watch 表的路径前缀
+func integrityPrefixes(cfg config.IntegrityConfig) ([]string, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	patterns, err := parseWatchPatterns(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var prefixes []string
+	for _, w := range patterns {
+		if p := w.prefix(); !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes, nil
+}
+
+// applyWatch 将完整性监视路径写入内核map，命中的路径不受过滤和限流影响
+func (k *kernelSource) applyWatch(cfg config.IntegrityConfig) error {
+	prefixes, err := integrityPrefixes(cfg)
+	if err != nil {
+		return err
+	}
+	watch := k.coll.Maps["fim_watch"]
+	if watch == nil {
+		return fmt.Errorf("eBPF object has no fim_watch map")
+	}
+	for _, p := range prefixes {
+		if err := watch.Update(newPathFilterKey(p), uint8(1), ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to add integrity path %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// hashJob 等待计算哈希的文件。root 为进程根目录的句柄，在事件处理时打开，
+// 进程在计算前退出也能访问其挂载命名空间中的文件
+type hashJob struct {
+	key     string
+	path    string
+	watch   string
+	root    *os.File
+	due     time.Time
+	trigger *Event // 修改文件的事件，基线建立时为nil
+}
+
+// integrityMonitor 按监视路径标注文件事件，并可选地维护内容哈希基线。
+// 文件被修改后等待 settle 再计算哈希，与基线不同时产生漂移事件
+type integrityMonitor struct {
+	patterns    []watchPattern
+	enabled     bool
+	hashBase    bool
+	maxFiles    int
+	maxSize     int64
+	settle      time.Duration
+	verifyEvery time.Duration
+	procRoot    string
+	log         *logrus.Logger
+
+	mu        sync.Mutex
+	hashing   bool
+	baselines map[string]*FileBaseline
+	skipped   uint64
+	jobs      chan hashJob
+	emit      func(Event)
+	done      chan struct{}
+}
+
+// newIntegrityMonitor 创建完整性监视器，监视路径无效时返回错误
+func newIntegrityMonitor(cfg config.EBPFConfig, log *logrus.Logger) (*integrityMonitor, error) {
+	patterns, err := parseWatchPatterns(cfg.Integrity.Paths)
+	if err != nil {
+		return nil, err
+	}
+	maxFiles := cfg.Integrity.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = 4096
+	}
+	return &integrityMonitor{
+		patterns:    patterns,
+		enabled:     cfg.Integrity.Enabled && len(patterns) > 0,
+		hashBase:    cfg.Integrity.HashBaselines && cfg.HashMaxSize > 0,
+		maxFiles:    maxFiles,
+		maxSize:     int64(cfg.HashMaxSize),
+		settle:      time.Duration(cfg.Integrity.SettleDelay) * time.Second,
+		verifyEvery: time.Duration(cfg.Integrity.VerifyInterval) * time.Second,
+		procRoot:    cfg.ProcRoot,
+		log:         log,
+		baselines:   make(map[string]*FileBaseline),
+	}, nil
+}
+
+// start 启动哈希计算协程。只有内核事件源的文件路径对应本机文件，其他事件源只标注事件
+func (im *integrityMonitor) start(ctx context.Context, kernel bool, emit func(Event)) {
+	if !im.enabled || !im.hashBase || !kernel {
+		return
+	}
+	im.mu.Lock()
+	im.hashing = true
+	im.jobs = make(chan hashJob, integrityQueueSize)
+	im.emit = emit
+	im.done = make(chan struct{})
+	jobs, done := im.jobs, im.done
+	im.mu.Unlock()
+
+	go im.run(ctx, jobs, done)
+}
+
+// stop 等待哈希计算协程退出并放弃未处理的任务，调用前需取消 start 的上下文
+func (im *integrityMonitor) stop() {
+	im.mu.Lock()
+	jobs, done := im.jobs, im.done
+	im.hashing = false
+	im.jobs, im.done = nil, nil
+	im.mu.Unlock()
+	if done == nil {
+		return
+	}
+	<-done
+	for {
+		select {
+		case job := <-jobs:
+			job.close()
+		default:
+			return
+		}
+	}
+}
+
+// run 初始化宿主机文件的基线，然后按顺序处理哈希任务。所有任务的等待时间相同，
+// 按入队顺序处理即按到期顺序处理
+func (im *integrityMonitor) run(ctx context.Context, jobs chan hashJob, done chan struct{}) {
+	defer close(done)
+
+	count := im.seed()
+	im.log.WithField("files", count).Info("File integrity baselines recorded")
+
+	var verify <-chan time.Time
+	if im.verifyEvery > 0 {
+		ticker := time.NewTicker(im.verifyEvery)
+		defer ticker.Stop()
+		verify = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-verify:
+			im.verify()
+		case job := <-jobs:
+			if wait := time.Until(job.due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					job.close()
+					return
+				case <-timer.C:
+				}
+			}
+			if drift := im.check(job); drift != nil && im.emit != nil {
+				im.emit(*drift)
+			}
+			job.close()
+		}
+	}
+}
+
+// observe 标注命中监视路径的文件事件，修改操作提升到高严重程度并安排计算哈希
+func (im *integrityMonitor) observe(event *Event) {
+	if !im.enabled || event.Integrity != nil {
+		return
+	}
+
+	var op, name string
+	switch {
+	case event.Syscall == "openat" || (event.Syscall == "" && event.EventType == "file_access"):
+		op = IntegrityRead
+		if event.File != nil && event.File.Write {
+			op = IntegrityOpenWrite
+		}
+	case event.Syscall == "write":
+		op = IntegrityWrite
+	case event.Syscall == "rename":
+		op = IntegrityRename
+	case event.Syscall == "unlink":
+		op = IntegrityDelete
+	default:
+		return
+	}
+
+	name = event.Filename
+	watch, ok := im.match(name)
+	if !ok && op == IntegrityRename && event.File != nil {
+		// 重命名到监视路径，如用临时文件替换 /etc/shadow
+		name = event.File.NewPath
+		watch, ok = im.match(name)
+	}
+	if !ok {
+		return
+	}
+
+	event.Integrity = &IntegrityDetails{Path: path.Clean(name), Watch: watch.raw, Operation: op}
+	if op != IntegrityRead && SeverityLevel(event.Severity) < SeverityLevel("high") {
+		event.Severity = "high"
+		event.Description = "Watched file modified"
+	}
+
+	if op == IntegrityDelete {
+		return
+	}
+	key := baselineKey(event.ContainerID, event.Integrity.Path)
+	im.mu.Lock()
+	hashing := im.hashing
+	baseline := im.baselines[key]
+	if baseline != nil {
+		event.Integrity.BaselineHash = baseline.Hash
+	}
+	im.mu.Unlock()
+	// 读取只用于为尚无基线的文件建立基线
+	if !hashing || (op == IntegrityRead && baseline != nil) {
+		return
+	}
+
+	job := hashJob{key: key, path: event.Integrity.Path, watch: watch.raw, due: time.Now()}
+	if op != IntegrityRead {
+		job.due = job.due.Add(im.settle)
+		trigger := *event
+		job.trigger = &trigger
+	}
+	if job.root = im.openRoot(event); job.root == nil {
+		return
+	}
+	im.enqueue(job)
+}
+
+// match 返回命中的第一个监视模式
+func (im *integrityMonitor) match(name string) (watchPattern, bool) {
+	if !strings.HasPrefix(name, "/") {
+		return watchPattern{}, false
+	}
+	for _, w := range im.patterns {
+		if w.match(name) {
+			return w, true
+		}
+	}
+	return watchPattern{}, false
+}
+
+// openRoot 打开事件进程的根目录。进程已退出时依次尝试父进程，宿主机进程最后使用init进程
+func (im *integrityMonitor) openRoot(event *Event) *os.File {
+	pids := []uint32{event.PID, event.PPID}
+	if event.ContainerID == "" {
+		pids = append(pids, 1)
+	}
+	for _, pid := range pids {
+		if pid == 0 {
+			continue
+		}
+		root, err := os.Open(filepath.Join(im.procRoot, strconv.FormatUint(uint64(pid), 10), "root"))
+		if err == nil {
+			return root
+		}
+	}
+	return nil
+}
+
+// enqueue 非阻塞地加入哈希任务，队列满时放弃
+func (im *integrityMonitor) enqueue(job hashJob) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.jobs != nil {
+		select {
+		case im.jobs <- job:
+			return
+		default:
+		}
+	}
+	im.skipped++
+	job.close()
+}
+
+// check 计算文件哈希并与基线比较。没有基线时以当前内容为基线；
+// 与基线不同且与上次报告的内容不同时返回漂移事件
+func (im *integrityMonitor) check(job hashJob) *Event {
+	sum, size, err := hashFileAt(job.root, job.path, im.maxSize)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			im.log.Debugf("Failed to hash watched file %s: %v", job.path, err)
+		}
+		return nil
+	}
+	now := time.Now().UTC()
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	baseline := im.baselines[job.key]
+	if baseline == nil {
+		if len(im.baselines) >= im.maxFiles {
+			im.skipped++
+			return nil
+		}
+		baseline = &FileBaseline{Path: job.path, Watch: job.watch, Hash: sum, Size: size, RecordedAt: now}
+		if job.trigger != nil {
+			baseline.ContainerID = job.trigger.ContainerID
+		}
+		im.baselines[job.key] = baseline
+	}
+	previous := baseline.Current
+	baseline.Current, baseline.CheckedAt = sum, now
+	baseline.Drifted = sum != baseline.Hash
+	if job.trigger != nil {
+		baseline.ModifiedBy = job.trigger.Comm
+	}
+	if !baseline.Drifted || sum == previous {
+		return nil
+	}
+	return driftEvent(job, baseline, now)
+}
+
+// driftEvent 构造内容漂移事件，带有最近一次修改文件的进程和工作负载
+func driftEvent(job hashJob, baseline *FileBaseline, now time.Time) *Event {
+	event := Event{Timestamp: now.Unix(), ContainerID: baseline.ContainerID}
+	if job.trigger != nil {
+		event = *job.trigger
+		event.Timestamp = now.Unix()
+		event.Detections = nil
+	}
+	event.Syscall = ""
+	event.File = nil
+	event.Filename = baseline.Path
+	event.EventType = EventTypeIntegrity
+	event.Severity = "high"
+	event.Description = "File content drift"
+	event.Integrity = &IntegrityDetails{
+		Path:         baseline.Path,
+		Watch:        baseline.Watch,
+		Operation:    IntegrityDrift,
+		BaselineHash: baseline.Hash,
+		Hash:         baseline.Current,
+		Drift:        true,
+	}
+	return &event
+}
+
+// seed 为宿主机上已存在的监视文件建立基线
+func (im *integrityMonitor) seed() int {
+	root, err := os.Open(filepath.Join(im.procRoot, "1", "root"))
+	if err != nil {
+		im.log.Warnf("Failed to open host root for integrity baselines: %v", err)
+		return 0
+	}
+	defer root.Close()
+
+	for _, w := range im.patterns {
+		for _, name := range im.expand(root, w) {
+			im.check(hashJob{key: baselineKey("", name), path: name, watch: w.raw, root: root})
+		}
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return len(im.baselines)
+}
+
+// expand 列出宿主机上命中监视模式的文件
+func (im *integrityMonitor) expand(root *os.File, w watchPattern) []string {
+	base := rootPath(root, "/")
+	matches, err := filepath.Glob(filepath.Join(base, w.glob))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, match := range matches {
+		name := "/" + strings.TrimPrefix(strings.TrimPrefix(match, base), "/")
+		if !w.dir {
+			files = append(files, name)
+			continue
+		}
+		filepath.WalkDir(match, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if len(files) >= im.maxFiles {
+				return filepath.SkipAll
+			}
+			rel := strings.TrimPrefix(p, match)
+			if d.IsDir() && strings.Count(rel, "/") >= integrityWalkDepth {
+				return filepath.SkipDir
+			}
+			// 服务账号令牌目录中的 ..data 等链接指向实际文件，只计算普通文件
+			if d.Type().IsRegular() {
+				files = append(files, path.Join(name, filepath.ToSlash(rel)))
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// verify 重新计算宿主机文件的哈希，发现未经事件报告的修改
+func (im *integrityMonitor) verify() {
+	root, err := os.Open(filepath.Join(im.procRoot, "1", "root"))
+	if err != nil {
+		return
+	}
+	defer root.Close()
+
+	im.mu.Lock()
+	var jobs []hashJob
+	for key, b := range im.baselines {
+		if b.ContainerID == "" {
+			jobs = append(jobs, hashJob{key: key, path: b.Path, watch: b.Watch, root: root})
+		}
+	}
+	im.mu.Unlock()
+
+	for _, job := range jobs {
+		if drift := im.check(job); drift != nil && im.emit != nil {
+			drift.Description = "File content drift found by periodic verification"
+			im.emit(*drift)
+		}
+	}
+}
+
+// status 返回监视状态和已漂移的文件
+func (im *integrityMonitor) status() IntegrityStatus {
+	status := IntegrityStatus{Enabled: im.enabled, Drifted: []FileBaseline{}}
+	for _, w := range im.patterns {
+		status.Watches = append(status.Watches, w.raw)
+	}
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	status.Hashing = im.hashing
+	status.Baselines = len(im.baselines)
+	status.Skipped = im.skipped
+	for _, b := range im.baselines {
+		if b.Drifted {
+			status.Drifted = append(status.Drifted, *b)
+		}
+	}
+	sort.Slice(status.Drifted, func(i, j int) bool {
+		if status.Drifted[i].ContainerID != status.Drifted[j].ContainerID {
+			return status.Drifted[i].ContainerID < status.Drifted[j].ContainerID
+		}
+		return status.Drifted[i].Path < status.Drifted[j].Path
+	})
+	return status
+}
+
+// accept 将已漂移文件的当前内容接受为新基线。path 为空时接受全部，返回更新的文件数
+func (im *integrityMonitor) accept(containerID, name string) int {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	now := time.Now().UTC()
+	count := 0
+	for _, b := range im.baselines {
+		if !b.Drifted || (name != "" && (b.Path != name || b.ContainerID != containerID)) {
+			continue
+		}
+		b.Hash, b.RecordedAt, b.Drifted = b.Current, now, false
+		count++
+	}
+	return count
+}
+
+// close 关闭入队任务持有的根目录句柄。初始化和定期校验直接计算，根目录由调用方关闭
+func (job hashJob) close() {
+	if job.root != nil {
+		job.root.Close()
+	}
+}
+
+// baselineKey 基线按容器和路径区分，宿主机文件的容器ID为空
+func baselineKey(containerID, name string) string {
+	return containerID + ":" + name
+}
+
+// rootPath 返回通过根目录句柄访问路径的位置，句柄指向的挂载命名空间在进程退出后仍可访问
+func rootPath(root *os.File, name string) string {
+	return filepath.Join("/proc/self/fd", strconv.Itoa(int(root.Fd())), name)
+}
+
+// hashFileAt 计算根目录下普通文件的SHA-256，超过大小上限时返回错误
+func hashFileAt(root *os.File, name string, maxSize int64) (string, int64, error) {
+	file, err := os.Open(rootPath(root, name))
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("%s is not a regular file", name)
+	}
+	if info.Size() > maxSize {
+		return "", 0, fmt.Errorf("%s is larger than %d bytes", name, maxSize)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), info.Size(), nil
+}
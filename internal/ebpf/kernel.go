@@ -0,0 +1,370 @@
+package ebpf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/config"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// kernelSource 通过CO-RE eBPF程序采集内核事件
+type kernelSource struct {
+	cfg   config.EBPFConfig
+	log   *logrus.Logger
+	stats *monitorCounters
+
+	spec      *ebpf.CollectionSpec
+	coll      *ebpf.Collection
+	links     []link.Link
+	reader    eventReader
+	transport string
+	bootTime  time.Time
+	processes *processTable
+	// 宿主机init进程所在的命名空间，用于判断 setns 是否进入了宿主机命名空间
+	hostNamespaces map[string]uint32
+	// 连接阻断的LSM钩子已挂载
+	blocking bool
+}
+
+// newKernelSource 创建内核事件源
+func newKernelSource(cfg config.EBPFConfig, log *logrus.Logger, stats *monitorCounters) *kernelSource {
+	return &kernelSource{
+		cfg:       cfg,
+		log:       log,
+		stats:     stats,
+		processes: newProcessTable(cfg.ProcRoot, int64(cfg.HashMaxSize), cfg.ProcessTableSize),
+	}
+}
+
+// Name 返回事件源名称
+func (k *kernelSource) Name() string {
+	return SourceKernel
+}
+
+// Open 检查运行条件并加载eBPF程序
+func (k *kernelSource) Open() error {
+	// 注意：这需要root权限和内核支持
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("loading eBPF programs requires root privileges (or CAP_BPF and CAP_PERFMON)")
+	}
+
+	// 检查eBPF程序文件是否存在
+	if _, err := os.Stat(k.cfg.ObjectPath); err != nil {
+		return fmt.Errorf("eBPF object %s not found, compile it with: cd internal/ebpf/programs && go generate monitor.go", k.cfg.ObjectPath)
+	}
+
+	// 移除内存限制
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return fmt.Errorf("failed to remove memlock: %w", err)
+	}
+
+	k.log.Infof("Loading eBPF programs from %s", k.cfg.ObjectPath)
+	if err := k.loadCollection(); err != nil {
+		return err
+	}
+
+	k.log.Infof("Loaded %d eBPF programs", len(k.links))
+
+	// 探针挂载之后再读取 /proc，期间创建的进程会同时出现在两处，不会遗漏
+	count, err := k.processes.seed()
+	if err != nil {
+		k.log.Warnf("Failed to seed process table: %v", err)
+	} else {
+		k.log.Infof("Seeded process table with %d processes", count)
+	}
+
+	k.hostNamespaces = readNamespaces(k.processes.procRoot, 1)
+	if len(k.hostNamespaces) == 0 {
+		k.log.Warnf("Failed to read host namespaces from %s/1/ns, setns into host namespaces will not be flagged", k.processes.procRoot)
+	}
+	return nil
+}
+
+// Run 从内核缓冲区读取记录并解码，读取器关闭后返回。
+// 丢失、解码失败和读取失败都计入统计，而不是静默丢弃
+func (k *kernelSource) Run(ctx context.Context, emit func(Event)) error {
+	reader := k.reader
+	if reader == nil {
+		return fmt.Errorf("kernel source is not open")
+	}
+
+	for {
+		sample, lost, err := reader.Read()
+		if err != nil {
+			if isClosed(err) || ctx.Err() != nil {
+				return nil
+			}
+			k.stats.readErrors.Add(1)
+			k.stats.recordError(err, time.Now().Unix())
+			k.log.Warnf("Failed to read eBPF event: %v", err)
+			continue
+		}
+
+		if lost > 0 {
+			k.stats.lost.Add(lost)
+			k.log.Warnf("Lost %d eBPF events, perf buffer is full", lost)
+		}
+		if len(sample) == 0 {
+			continue
+		}
+
+		event, err := decodeRecord(sample, k.bootTime)
+		if err != nil {
+			k.stats.decodeErrors.Add(1)
+			k.stats.recordError(err, time.Now().Unix())
+			k.log.Debugf("Failed to decode eBPF event: %v", err)
+			continue
+		}
+
+		switch event.Syscall {
+		case syscallFork:
+			k.processes.fork(event.Process.PPID, event.Process.PID, time.Unix(event.Timestamp, 0))
+			continue
+		case syscallExit:
+			k.processes.exit(event.PID, time.Unix(event.Timestamp, 0))
+			continue
+		case "execve":
+			k.processes.exec(&event, event.Process.Args)
+		case "setns":
+			event.Namespaces.markHost(k.hostNamespaces)
+		case "finit_module":
+			// 模块文件在调用返回前保持打开
+			event.Module.Path = readFDPath(k.processes.procRoot, event.PID, event.Module.FD)
+			event.Filename = event.Module.Path
+		case "openat", "unlink":
+			event.Filename = resolveFilePath(k.processes.procRoot, event.PID, event.File.DirFD, event.Filename)
+		case "rename":
+			event.Filename = resolveFilePath(k.processes.procRoot, event.PID, event.File.DirFD, event.Filename)
+			event.File.NewPath = resolveFilePath(k.processes.procRoot, event.PID, event.File.NewDirFD, event.File.NewPath)
+		}
+		k.processes.annotate(&event)
+		emit(event)
+	}
+}
+
+// Close 卸载探针并关闭读取器
+func (k *kernelSource) Close() error {
+	// 关闭读取器
+	if k.reader != nil {
+		k.reader.Close()
+		k.reader = nil
+	}
+
+	// 关闭链接
+	for _, l := range k.links {
+		if err := l.Close(); err != nil {
+			k.log.Errorf("Failed to close link: %v", err)
+		}
+	}
+	k.links = nil
+
+	// 关闭集合
+	if k.coll != nil {
+		k.coll.Close()
+		k.coll = nil
+	}
+
+	return nil
+}
+
+// Details 返回用于状态展示的事件源信息
+func (k *kernelSource) Details() map[string]string {
+	return map[string]string{
+		"object":    k.cfg.ObjectPath,
+		"transport": k.transport,
+		"programs":  strconv.Itoa(len(k.links)),
+		"processes": strconv.Itoa(k.processes.size()),
+	}
+}
+
+// Transport 返回事件传输方式
+func (k *kernelSource) Transport() string {
+	return k.transport
+}
+
+// KernelLost 返回内核侧丢失的事件数
+func (k *kernelSource) KernelLost() uint64 {
+	if k.coll == nil {
+		return 0
+	}
+	return kernelLost(k.coll.Maps["lost"])
+}
+
+// loadCollection 加载CO-RE对象文件，挂载其中的所有探针并打开事件读取器
+func (k *kernelSource) loadCollection() error {
+	kernelTypes, err := loadKernelBTF(k.cfg.BTFPath)
+	if err != nil {
+		return err
+	}
+
+	spec, err := ebpf.LoadCollectionSpec(k.cfg.ObjectPath)
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF object %s: %w", k.cfg.ObjectPath, err)
+	}
+
+	transport, err := selectTransport(spec, k.cfg.Transport, k.cfg.RingBufferSize)
+	if err != nil {
+		return err
+	}
+
+	if err := bpfLSMAvailable(); err != nil {
+		for name, prog := range spec.Programs {
+			if prog.Type == ebpf.LSM {
+				delete(spec.Programs, name)
+			}
+		}
+		k.log.Infof("Connection blocking disabled: %v", err)
+	}
+
+	coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+		Programs: ebpf.ProgramOptions{KernelTypes: kernelTypes},
+	})
+	if err != nil {
+		var verifierErr *ebpf.VerifierError
+		if errors.As(err, &verifierErr) {
+			k.log.Debugf("eBPF verifier log: %+v", verifierErr)
+		}
+		return fmt.Errorf("failed to load eBPF collection: %w", err)
+	}
+	k.spec = spec
+	k.coll = coll
+
+	// 过滤配置和完整性监视路径在挂载探针之前写入，第一条记录就按配置过滤
+	if err := k.applyFilter(k.cfg.Filter); err != nil {
+		k.Close()
+		return err
+	}
+	if err := k.applyWatch(k.cfg.Integrity); err != nil {
+		k.Close()
+		return err
+	}
+
+	if err := k.attachPrograms(); err != nil {
+		k.Close()
+		return err
+	}
+
+	reader, err := newEventReader(transport, coll.Maps["events"], k.cfg.PerfBufferSize)
+	if err != nil {
+		k.Close()
+		return err
+	}
+	k.reader = reader
+	k.transport = transport
+	k.bootTime = bootTime()
+	k.log.Infof("eBPF events use %s transport", transport)
+
+	return nil
+}
+
+// loadKernelBTF 加载内核类型信息，CO-RE重定位依赖它。
+// 优先使用配置的外部BTF文件，否则读取 /sys/kernel/btf/vmlinux
+func loadKernelBTF(path string) (*btf.Spec, error) {
+	if path != "" {
+		spec, err := btf.LoadSpec(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load BTF from EBPF_BTF_PATH %s: %w", path, err)
+		}
+		return spec, nil
+	}
+
+	spec, err := btf.LoadKernelSpec()
+	if err != nil {
+		return nil, fmt.Errorf("kernel BTF is not available (%v): CO-RE eBPF programs need a kernel built with "+
+			"CONFIG_DEBUG_INFO_BTF=y that exposes /sys/kernel/btf/vmlinux; on older kernels set EBPF_BTF_PATH "+
+			"to a BTF file for this kernel (for example from BTFHub)", err)
+	}
+	return spec, nil
+}
+
+// optionalPrograms 不是所有架构都有的探针，例如 arm64 只有 renameat 和 unlinkat，挂载失败时跳过
+var optionalPrograms = map[string]bool{
+	"tracepoint/syscalls/sys_enter_rename": true,
+	"tracepoint/syscalls/sys_enter_unlink": true,
+}
+
+// attachPrograms 按程序的段名挂载tracepoint、raw tracepoint、kprobe和LSM钩子
+func (k *kernelSource) attachPrograms() error {
+	names := make([]string, 0, len(k.spec.Programs))
+	for name := range k.spec.Programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		progSpec := k.spec.Programs[name]
+		prog := k.coll.Programs[name]
+
+		var l link.Link
+		var err error
+		switch progSpec.Type {
+		case ebpf.TracePoint:
+			group, tp, ok := tracepointName(progSpec.SectionName)
+			if !ok {
+				return fmt.Errorf("program %s: invalid tracepoint section %q", name, progSpec.SectionName)
+			}
+			l, err = link.Tracepoint(group, tp, prog, nil)
+		case ebpf.RawTracepoint:
+			tp := progSpec.SectionName[strings.IndexByte(progSpec.SectionName, '/')+1:]
+			l, err = link.AttachRawTracepoint(link.RawTracepointOptions{Name: tp, Program: prog})
+		case ebpf.Kprobe:
+			if strings.HasPrefix(progSpec.SectionName, "kretprobe/") {
+				l, err = link.Kretprobe(progSpec.AttachTo, prog, nil)
+			} else {
+				l, err = link.Kprobe(progSpec.AttachTo, prog, nil)
+			}
+		case ebpf.LSM:
+			l, err = link.AttachLSM(link.LSMOptions{Program: prog})
+			k.blocking = err == nil
+		default:
+			return fmt.Errorf("program %s: unsupported program type %s", name, progSpec.Type)
+		}
+		if err != nil {
+			if optionalPrograms[progSpec.SectionName] && errors.Is(err, os.ErrNotExist) {
+				k.log.WithField("program", name).Infof("Skipping %s, not available on this kernel", progSpec.SectionName)
+				continue
+			}
+			return fmt.Errorf("failed to attach %s (%s): %w", name, progSpec.SectionName, err)
+		}
+
+		k.links = append(k.links, l)
+		k.log.WithField("program", name).WithField("section", progSpec.SectionName).Info("Attached eBPF program")
+	}
+
+	return nil
+}
+
+// tracepointName 从段名中解析tracepoint的分组和名称，例如 tracepoint/syscalls/sys_enter_execve
+func tracepointName(section string) (string, string, bool) {
+	for _, prefix := range []string{"tracepoint/", "tp/"} {
+		if strings.HasPrefix(section, prefix) {
+			parts := strings.SplitN(strings.TrimPrefix(section, prefix), "/", 2)
+			if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+				return parts[0], parts[1], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// bootTime 计算系统启动时间，用于将 bpf_ktime_get_ns 转换为墙上时间
+func bootTime() time.Time {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(ts.Nano()))
+}
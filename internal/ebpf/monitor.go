@@ -2,17 +2,16 @@ package ebpf
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"cloudsecops/internal/config"
 	"cloudsecops/internal/logger"
+	"cloudsecops/internal/workload"
 
-	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/link"
-	"github.com/cilium/ebpf/perf"
-	"github.com/cilium/ebpf/rlimit"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,6 +20,7 @@ type Event struct {
 	Timestamp   int64  `json:"timestamp"`
 	PID         uint32 `json:"pid"`
 	TID         uint32 `json:"tid"`
+	PPID        uint32 `json:"ppid,omitempty"`
 	UID         uint32 `json:"uid"`
 	GID         uint32 `json:"gid"`
 	Comm        string `json:"comm"`
@@ -29,34 +29,195 @@ type Event struct {
 	Severity    string `json:"severity"`
 	Description string `json:"description"`
 	ContainerID string `json:"container_id"`
+
+	// 系统调用相关字段，仅内核事件携带
+	Syscall     string             `json:"syscall,omitempty"`
+	CgroupID    uint64             `json:"cgroup_id,omitempty"`
+	File        *FileDetails       `json:"file,omitempty"`
+	Network     *NetworkDetails    `json:"network,omitempty"`
+	Flow        *FlowContext       `json:"flow,omitempty"`
+	Mount       *MountDetails      `json:"mount,omitempty"`
+	Credentials *CredentialDetails `json:"credentials,omitempty"`
+	Ptrace      *PtraceDetails     `json:"ptrace,omitempty"`
+	Namespaces  *NamespaceDetails  `json:"namespaces,omitempty"`
+	Module      *ModuleDetails     `json:"module,omitempty"`
+	Capability  *CapabilityDetails `json:"capability,omitempty"`
+	// 命中完整性监视路径的文件事件和内容漂移事件
+	Integrity *IntegrityDetails `json:"integrity,omitempty"`
+	// 偏离工作负载行为画像的异常项
+	Anomaly *AnomalyDetails `json:"anomaly,omitempty"`
+
+	// 进程信息和从父进程开始向上的祖先链，仅内核事件源携带
+	Process *ProcessInfo  `json:"process,omitempty"`
+	Lineage []ProcessInfo `json:"lineage,omitempty"`
+	// 祖先进程名，与 Lineage 对应
+	Ancestors []string `json:"ancestors,omitempty"`
+
+	// 所属工作负载，宿主机进程为空
+	Workload *workload.Workload `json:"workload,omitempty"`
+
+	// 命中的检测规则
+	Detections []Detection `json:"detections,omitempty"`
+
+	// 通过API回放录制时为录制ID，用于与实时事件区分
+	Replay string `json:"replay,omitempty"`
+	// 产生事件的事件源：kernel、simulator 或 replay，由监控器在入队时设置。
+	// 只有内核事件对应本机真实的进程和连接
+	Source string `json:"source,omitempty"`
+}
+
+// MitreTechnique MITRE ATT&CK 技术
+type MitreTechnique struct {
+	ID     string `json:"id" yaml:"id"`
+	Name   string `json:"name,omitempty" yaml:"name"`
+	Tactic string `json:"tactic,omitempty" yaml:"tactic"`
+}
+
+// Detection 事件命中的检测规则
+type Detection struct {
+	Rule     string           `json:"rule"`
+	Severity string           `json:"severity"`
+	Output   string           `json:"output"`
+	MITRE    []MitreTechnique `json:"mitre,omitempty"`
+	Tags     []string         `json:"tags,omitempty"`
+}
+
+// Detector 检测引擎，对事件求值并写入命中结果
+type Detector interface {
+	Evaluate(event *Event)
+}
+
+// EventSink 事件下游消费者，如持久化存储。Write 在事件处理路径上同步调用，不应阻塞
+type EventSink interface {
+	Write(event Event)
+}
+
+// 事件源运行状态
+const (
+	SourceStateRunning   = "running"
+	SourceStateCompleted = "completed"
+	SourceStateFailed    = "failed"
+	SourceStateStopped   = "stopped"
+)
+
+// SourceStatus 当前事件源的状态
+type SourceStatus struct {
+	Active         string            `json:"active"`
+	Requested      string            `json:"requested"`
+	FallbackReason string            `json:"fallback_reason,omitempty"`
+	State          string            `json:"state"`
+	Error          string            `json:"error,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
 }
 
 // Monitor eBPF监控器
 type Monitor struct {
-	mu       sync.RWMutex
-	running  bool
-	cancel   context.CancelFunc
-	spec     *ebpf.CollectionSpec
-	coll     *ebpf.Collection
-	links    []link.Link
-	reader   *perf.Reader
-	events   chan Event
-	log      *logrus.Logger
+	mu      sync.RWMutex
+	running bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	// 事件源与处理协程之间的优先级队列，processed 在处理协程退出后关闭
+	ingest    *PriorityQueue
+	processed chan struct{}
+	events    *Broadcaster
+	log       *logrus.Logger
+	cfg       config.EBPFConfig
+
+	source         EventSource
+	fallbackReason string
+	sourceState    string
+	sourceErr      error
+	stats          monitorCounters
+	workloads      *workload.Resolver
+	flows          *flowTracker
+	integrity      *integrityMonitor
+	profiles       *profileTracker
+	detector       Detector
+	sinks          []EventSink
+
+	// 正在进行的录制和通过API发起的录制回放
+	recorder atomic.Pointer[recorder]
+	replay   *captureReplay
+}
+
+var (
+	// ErrReplayActive 已有录制回放在进行
+	ErrReplayActive = errors.New("a capture replay is already in progress")
+	// ErrNoReplay 没有正在进行的录制回放
+	ErrNoReplay = errors.New("no capture replay in progress")
+)
+
+// captureReplay 通过API发起的录制回放，与当前事件源并行向同一队列送入事件
+type captureReplay struct {
+	id        string
+	source    *replaySource
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startedAt time.Time
+	state     string
+	err       error
+}
+
+// ReplayStatus 录制回放状态
+type ReplayStatus struct {
+	Capture   string    `json:"capture"`
+	Speed     float64   `json:"speed"`
+	State     string    `json:"state"`
+	Emitted   uint64    `json:"emitted"`
+	StartedAt time.Time `json:"started_at"`
+	Error     string    `json:"error,omitempty"`
 }
 
 // NewMonitor 创建新的eBPF监控器
-func NewMonitor() (*Monitor, error) {
-	// 移除内存限制
-	if err := rlimit.RemoveMemlock(); err != nil {
-		return nil, fmt.Errorf("failed to remove memlock: %w", err)
+func NewMonitor(cfg config.EBPFConfig) (*Monitor, error) {
+	if !validSource(cfg.Source) {
+		return nil, fmt.Errorf("unknown event source %q, expected auto, kernel, simulator or replay", cfg.Source)
+	}
+
+	flows, err := newFlowTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Filter, err = NormalizeKernelFilter(cfg.Filter); err != nil {
+		return nil, fmt.Errorf("invalid kernel filter: %w", err)
+	}
+	log := logger.GetLogger()
+	integrity, err := newIntegrityMonitor(cfg, log)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Monitor{
-		events: make(chan Event, 1000),
-		log:    logger.GetLogger(),
+		events:    NewBroadcaster(cfg.SubscriberBuffer, cfg.SubscriberMaxDrops, cfg.MaxSubscribers),
+		log:       log,
+		cfg:       cfg,
+		flows:     flows,
+		integrity: integrity,
+		profiles:  newProfileTracker(cfg.Profile, log),
 	}, nil
 }
 
+// SetWorkloadResolver 设置工作负载解析器，需在 Start 之前调用
+func (m *Monitor) SetWorkloadResolver(resolver *workload.Resolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workloads = resolver
+}
+
+// SetDetector 设置检测引擎，需在 Start 之前调用
+func (m *Monitor) SetDetector(detector Detector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detector = detector
+}
+
+// AddSink 添加事件下游消费者，需在 Start 之前调用
+func (m *Monitor) AddSink(sink EventSink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks = append(m.sinks, sink)
+}
+
 // Start 启动eBPF监控
 func (m *Monitor) Start() error {
 	m.mu.Lock()
@@ -66,32 +227,137 @@ func (m *Monitor) Start() error {
 		return fmt.Errorf("monitor is already running")
 	}
 
+	ingest, err := NewPriorityQueue(QueueOptions{
+		Stage:         StageIngest,
+		Capacity:      m.cfg.QueueSize,
+		SpillDir:      m.cfg.SpillDir,
+		SpillMaxBytes: int64(m.cfg.SpillMaxBytes),
+	})
+	if err != nil {
+		return err
+	}
+
+	source, fallbackReason, err := m.openSource()
+	if err != nil {
+		ingest.Close()
+		return fmt.Errorf("failed to open event source: %w", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	m.cancel = cancel
+	m.done = make(chan struct{})
+	m.processed = make(chan struct{})
+	m.ingest = ingest
+	m.source = source
+	m.fallbackReason = fallbackReason
+	m.sourceState = SourceStateRunning
+	m.sourceErr = nil
+
+	// 启动事件处理：事件源只负责入队，补全、检测和分发在处理协程中完成，
+	// 下游变慢时内核缓冲区仍能及时读空，积压按严重程度在队列中取舍
+	go m.process(ingest, m.processed)
+	go m.runSource(ctx, source, ingest, m.done)
+	// 内容漂移事件与其他事件一样经过检测和分发
+	m.integrity.start(ctx, source.Name() == SourceKernel, func(event Event) {
+		event.Source = SourceKernel
+		ingest.PushWait(ctx, event)
+	})
 
-	// 加载eBPF程序（这里使用模拟实现）
-	if err := m.loadPrograms(); err != nil {
-		return fmt.Errorf("failed to load eBPF programs: %w", err)
+	m.running = true
+	m.log.WithField("source", source.Name()).Info("eBPF monitor started")
+
+	return nil
+}
+
+// openSource 按配置打开事件源。auto 模式下优先使用内核事件源，
+// 不可用时回退到模拟器，并记录回退原因供状态接口展示
+func (m *Monitor) openSource() (EventSource, string, error) {
+	requested := m.cfg.Source
+	if requested != SourceAuto && requested != "" {
+		source, err := newEventSource(requested, m.cfg, m.log, &m.stats)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := source.Open(); err != nil {
+			return nil, "", fmt.Errorf("%s source: %w", requested, err)
+		}
+		return source, "", nil
 	}
 
-	// 启动事件处理
-	go m.processEvents(ctx)
+	kernel := newKernelSource(m.cfg, m.log, &m.stats)
+	err := kernel.Open()
+	if err == nil {
+		return kernel, "", nil
+	}
 
-	// 启动模拟事件生成器（用于演示）
-	go m.simulateEvents(ctx)
+	reason := err.Error()
+	m.log.Warnf("Kernel event source unavailable, falling back to simulator: %s", reason)
+	simulator, simErr := newSimulatorSource(m.cfg.Scenario, m.log)
+	if simErr != nil {
+		return nil, "", simErr
+	}
+	if err := simulator.Open(); err != nil {
+		return nil, "", fmt.Errorf("simulator source: %w", err)
+	}
+	return simulator, reason, nil
+}
 
-	m.running = true
-	m.log.Info("eBPF monitor started")
+// runSource 运行事件源直到其结束或被停止。内核事件不能等待，队列满时按优先级取舍；
+// 回放和模拟事件源等待队列空位，不丢弃事件
+func (m *Monitor) runSource(ctx context.Context, source EventSource, ingest *PriorityQueue, done chan struct{}) {
+	defer close(done)
 
-	return nil
+	name := source.Name()
+	emit := func(event Event) {
+		event.Source = name
+		ingest.Push(event)
+	}
+	if name != SourceKernel {
+		emit = func(event Event) {
+			event.Source = name
+			ingest.PushWait(ctx, event)
+		}
+	}
+	err := source.Run(ctx, emit)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		m.sourceState = SourceStateStopped
+	case err != nil:
+		m.sourceState = SourceStateFailed
+		m.sourceErr = err
+		m.stats.recordError(err, time.Now().Unix())
+		m.log.Errorf("Event source %s failed: %v", source.Name(), err)
+	default:
+		m.sourceState = SourceStateCompleted
+		m.log.Infof("Event source %s completed", source.Name())
+	}
+}
+
+// process 从队列中取出事件并处理，队列关闭且取空后退出
+func (m *Monitor) process(ingest *PriorityQueue, processed chan struct{}) {
+	defer close(processed)
+	for {
+		event, ok := ingest.Pop()
+		if !ok {
+			return
+		}
+		if rec := m.recorder.Load(); rec != nil && event.Replay == "" {
+			if reason := rec.write(event); reason != "" {
+				m.finishRecording(rec, reason)
+			}
+		}
+		m.publish(event)
+	}
 }
 
 // Stop 停止eBPF监控
 func (m *Monitor) Stop() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if !m.running {
+		m.mu.Unlock()
 		return nil
 	}
 
@@ -99,12 +365,30 @@ func (m *Monitor) Stop() error {
 		m.cancel()
 	}
 
-	// 清理资源
-	if err := m.cleanup(); err != nil {
-		m.log.Errorf("Failed to cleanup eBPF resources: %v", err)
+	// 清理资源，关闭事件源会中断阻塞中的读取
+	if err := m.source.Close(); err != nil {
+		m.log.Errorf("Failed to close event source: %v", err)
 	}
 
 	m.running = false
+	done, ingest, processed, replay := m.done, m.ingest, m.processed, m.replay
+	m.mu.Unlock()
+
+	// 事件源和回放退出后关闭队列，处理协程处理完内存中剩余的事件后退出
+	if replay != nil {
+		replay.cancel()
+		<-replay.done
+	}
+	m.integrity.stop()
+	<-done
+	if err := ingest.Close(); err != nil {
+		m.log.Errorf("Failed to close event queue: %v", err)
+	}
+	<-processed
+	m.profiles.flush()
+	if rec := m.recorder.Load(); rec != nil {
+		m.finishRecording(rec, StopReasonMonitor)
+	}
 	m.log.Info("eBPF monitor stopped")
 
 	return nil
@@ -115,9 +399,14 @@ func (m *Monitor) Close() error {
 	return m.Stop()
 }
 
-// GetEvents 获取事件通道
-func (m *Monitor) GetEvents() <-chan Event {
-	return m.events
+// Subscribe 订阅事件。每个订阅者有独立的缓冲区，使用完毕后需调用 Unsubscribe
+func (m *Monitor) Subscribe(filter EventFilter) (*Subscription, error) {
+	return m.events.Subscribe(filter)
+}
+
+// Unsubscribe 取消事件订阅
+func (m *Monitor) Unsubscribe(sub *Subscription) {
+	m.events.Unsubscribe(sub)
 }
 
 // IsRunning 检查监控器是否运行中
@@ -127,107 +416,420 @@ func (m *Monitor) IsRunning() bool {
 	return m.running
 }
 
-// loadPrograms 加载eBPF程序（模拟实现）
-func (m *Monitor) loadPrograms() error {
-	m.log.Info("Loading eBPF programs...")
-	
-	// 尝试加载eBPF程序
-	// 注意：这需要root权限和内核支持
-	if os.Geteuid() != 0 {
-		m.log.Warn("eBPF programs require root privileges, falling back to simulation mode")
-		return nil
+// SourceStatus 返回当前事件源的状态
+func (m *Monitor) SourceStatus() SourceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	requested := m.cfg.Source
+	if requested == "" {
+		requested = SourceAuto
 	}
-	
-	// 检查eBPF程序文件是否存在
-	programPath := "./internal/ebpf/programs/monitor.o"
-	if _, err := os.Stat(programPath); os.IsNotExist(err) {
-		m.log.Warn("eBPF program not compiled, falling back to simulation mode")
-		m.log.Info("To compile eBPF program: cd internal/ebpf/programs && clang -O2 -target bpf -c monitor.c -o monitor.o")
-		return nil
+	status := SourceStatus{
+		Requested:      requested,
+		FallbackReason: m.fallbackReason,
+		State:          m.sourceState,
+	}
+	if m.source == nil {
+		status.State = SourceStateStopped
+		return status
+	}
+
+	status.Active = m.source.Name()
+	status.Details = m.source.Details()
+	if m.sourceErr != nil {
+		status.Error = m.sourceErr.Error()
 	}
-	
-	m.log.Info("eBPF program found, attempting to load...")
-	// TODO: 实际加载编译好的eBPF字节码
-	// 这里可以使用 cilium/ebpf 库加载程序
+	return status
+}
+
+// KernelFilter 返回当前的内核侧过滤配置
+func (m *Monitor) KernelFilter() config.KernelFilterConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg.Filter
+}
+
+// SetKernelFilter 更新内核侧过滤配置。内核事件源运行中时立即写入内核map，
+// 不需要重新加载程序；其他事件源下只保存配置，在内核事件源打开时生效
+func (m *Monitor) SetKernelFilter(filter config.KernelFilterConfig) error {
+	filter, err := NormalizeKernelFilter(filter)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kernel, ok := m.source.(*kernelSource); ok && m.running {
+		if err := kernel.applyFilter(filter); err != nil {
+			// 恢复之前的配置，避免内核中残留部分更新
+			if restoreErr := kernel.applyFilter(m.cfg.Filter); restoreErr != nil {
+				m.log.Errorf("Failed to restore kernel filter: %v", restoreErr)
+			}
+			return err
+		}
+	}
+	m.cfg.Filter = filter
+	m.log.WithField("rate_limit", filter.RateLimit).Info("Kernel event filter updated")
 	return nil
 }
 
-// cleanup 清理资源
-func (m *Monitor) cleanup() error {
-	// 关闭链接
-	for _, l := range m.links {
-		if err := l.Close(); err != nil {
-			m.log.Errorf("Failed to close link: %v", err)
+// StartRecording 开始录制事件源产生的事件。事件在补全和检测之前写入，
+// 文件头记录主机、内核和当前的规则版本，同一时间只能有一个录制
+func (m *Monitor) StartRecording(opts RecordingOptions) (CaptureInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		return CaptureInfo{}, fmt.Errorf("monitor is not running")
+	}
+	if m.recorder.Load() != nil {
+		return CaptureInfo{}, ErrRecordingActive
+	}
+
+	now := time.Now().UTC()
+	header := CaptureHeader{
+		Format:    CaptureFormat,
+		Version:   CaptureVersion,
+		ID:        newCaptureID(opts.Name, now),
+		Name:      opts.Name,
+		StartedAt: now,
+		Source:    m.source.Name(),
+	}
+	header.Host, header.Kernel, header.Arch = captureEnvironment(m.cfg.ProcRoot)
+	if versioner, ok := m.detector.(RuleVersioner); ok {
+		header.Rules = versioner.RuleVersions()
+	}
+
+	rec, err := startRecorder(m.cfg.RecordingDir, header, opts)
+	if err != nil {
+		return CaptureInfo{}, err
+	}
+	if opts.Duration > 0 {
+		rec.mu.Lock()
+		rec.timer = time.AfterFunc(opts.Duration, func() {
+			m.finishRecording(rec, StopReasonDuration)
+		})
+		rec.mu.Unlock()
+	}
+	m.recorder.Store(rec)
+	m.log.WithField("capture", header.ID).Info("Recording started")
+	return rec.snapshot(), nil
+}
+
+// StopRecording 停止当前录制并返回录制结果
+func (m *Monitor) StopRecording() (CaptureInfo, error) {
+	rec := m.recorder.Load()
+	if rec == nil {
+		return CaptureInfo{}, ErrNotRecording
+	}
+	return m.finishRecording(rec, StopReasonRequested)
+}
+
+// finishRecording 结束录制，多处同时结束时只有第一个原因生效
+func (m *Monitor) finishRecording(rec *recorder, reason string) (CaptureInfo, error) {
+	m.recorder.CompareAndSwap(rec, nil)
+	info, err := rec.close(reason)
+	if err != nil {
+		m.log.Errorf("Failed to finish recording %s: %v", info.ID, err)
+		return info, err
+	}
+	if info.StopReason == reason {
+		m.log.WithFields(logrus.Fields{
+			"capture": info.ID,
+			"events":  info.Events,
+			"reason":  reason,
+		}).Info("Recording stopped")
+	}
+	return info, nil
+}
+
+// Recording 返回正在进行的录制，没有时返回nil
+func (m *Monitor) Recording() *CaptureInfo {
+	rec := m.recorder.Load()
+	if rec == nil {
+		return nil
+	}
+	info := rec.snapshot()
+	return &info
+}
+
+// Recordings 列出录制目录中的录制文件，按开始时间倒序
+func (m *Monitor) Recordings() ([]CaptureInfo, error) {
+	captures, err := listCaptures(m.cfg.RecordingDir)
+	if err != nil {
+		return nil, err
+	}
+	if active := m.Recording(); active != nil {
+		for i := range captures {
+			if captures[i].ID == active.ID {
+				captures[i] = *active
+			}
 		}
 	}
-	m.links = nil
+	return captures, nil
+}
+
+// CapturePath 返回已完成录制的文件路径，正在录制的文件尚不完整，返回 ErrRecordingActive
+func (m *Monitor) CapturePath(id string) (string, error) {
+	path, err := capturePath(m.cfg.RecordingDir, id)
+	if err != nil {
+		return "", err
+	}
+	if active := m.Recording(); active != nil && active.ID == id {
+		return "", fmt.Errorf("capture %s: %w", id, ErrRecordingActive)
+	}
+	return path, nil
+}
 
-	// 关闭集合
-	if m.coll != nil {
-		m.coll.Close()
-		m.coll = nil
+// ReplayCapture 将录制文件送入当前的处理流程，与事件源并行运行。speed 为回放倍速，
+// 1 为原始速度，0 表示尽快回放。回放的事件带有录制ID，不会被再次录制
+func (m *Monitor) ReplayCapture(id string, speed float64) (*ReplayStatus, error) {
+	path, err := m.CapturePath(id)
+	if err != nil {
+		return nil, err
+	}
+	source := newReplaySource(path, speed, false, m.log, &m.stats).(*replaySource)
+	if err := source.Open(); err != nil {
+		return nil, err
+	}
+	if _, err := readCaptureHeader(path); err != nil {
+		return nil, err
 	}
 
-	// 关闭读取器
-	if m.reader != nil {
-		m.reader.Close()
-		m.reader = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		return nil, fmt.Errorf("monitor is not running")
+	}
+	if m.replay != nil && m.replay.state == SourceStateRunning {
+		return nil, ErrReplayActive
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	replay := &captureReplay{
+		id:        id,
+		source:    source,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		startedAt: time.Now().UTC(),
+		state:     SourceStateRunning,
+	}
+	m.replay = replay
+	go m.runReplay(ctx, replay, m.ingest)
+
+	m.log.WithFields(logrus.Fields{"capture": id, "speed": speed}).Info("Capture replay started")
+	return m.replayStatusLocked(), nil
+}
+
+// runReplay 运行录制回放，等待队列空位，不丢弃事件
+func (m *Monitor) runReplay(ctx context.Context, replay *captureReplay, ingest *PriorityQueue) {
+	defer close(replay.done)
+	err := replay.source.Run(ctx, func(event Event) {
+		event.Replay = replay.id
+		event.Source = SourceReplay
+		ingest.PushWait(ctx, event)
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		replay.state = SourceStateStopped
+	case err != nil:
+		replay.state = SourceStateFailed
+		replay.err = err
+		m.log.Errorf("Capture replay %s failed: %v", replay.id, err)
+	default:
+		replay.state = SourceStateCompleted
+		m.log.WithField("capture", replay.id).Info("Capture replay completed")
+	}
+}
+
+// StopReplay 停止正在进行的录制回放
+func (m *Monitor) StopReplay() error {
+	m.mu.RLock()
+	replay := m.replay
+	active := replay != nil && replay.state == SourceStateRunning
+	m.mu.RUnlock()
+	if !active {
+		return ErrNoReplay
+	}
+	replay.cancel()
+	<-replay.done
 	return nil
 }
 
-// processEvents 处理eBPF事件
-func (m *Monitor) processEvents(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			// 在实际实现中，这里会从perf buffer读取事件
-			time.Sleep(100 * time.Millisecond)
-		}
+// Replay 返回最近一次录制回放的状态，没有时返回nil
+func (m *Monitor) Replay() *ReplayStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.replayStatusLocked()
+}
+
+func (m *Monitor) replayStatusLocked() *ReplayStatus {
+	if m.replay == nil {
+		return nil
+	}
+	status := &ReplayStatus{
+		Capture:   m.replay.id,
+		Speed:     m.replay.source.speed,
+		State:     m.replay.state,
+		Emitted:   m.replay.source.emitted.Load(),
+		StartedAt: m.replay.startedAt,
 	}
+	if m.replay.err != nil {
+		status.Error = m.replay.err.Error()
+	}
+	return status
 }
 
-// simulateEvents 模拟事件生成（用于演示）
-func (m *Monitor) simulateEvents(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// ProcessTree 返回容器内的进程树，containerID 可以是ID前缀。
+// 进程表只在内核事件源下维护，其他事件源返回false
+func (m *Monitor) ProcessTree(containerID string) ([]*ProcessNode, bool) {
+	m.mu.RLock()
+	kernel, ok := m.source.(*kernelSource)
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return kernel.processes.tree(containerID), true
+}
 
-	eventTypes := []string{"syscall", "file_access", "network", "process"}
-	severities := []string{"low", "medium", "high", "critical"}
+// Flows 按条件返回网络流，按最近活动时间倒序，同时返回满足条件的总数
+func (m *Monitor) Flows(q FlowQuery) ([]Flow, int) {
+	return m.flows.query(q)
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			// 生成模拟事件
-			event := Event{
-				Timestamp:   time.Now().Unix(),
-				PID:         1234,
-				TID:         1234,
-				UID:         0,
-				GID:         0,
-				Comm:        "suspicious_proc",
-				Filename:    "/etc/passwd",
-				EventType:   eventTypes[time.Now().Second()%len(eventTypes)],
-				Severity:    severities[time.Now().Second()%len(severities)],
-				Description: "Suspicious file access detected",
-				ContainerID: "container_123",
-			}
+// Integrity 返回文件完整性监视状态和内容已漂移的文件
+func (m *Monitor) Integrity() IntegrityStatus {
+	return m.integrity.status()
+}
+
+// AcceptIntegrityBaseline 将已漂移文件的当前内容接受为新基线，path 为空时接受全部，
+// 宿主机文件的 containerID 为空。返回更新的文件数
+func (m *Monitor) AcceptIntegrityBaseline(containerID, path string) int {
+	count := m.integrity.accept(containerID, path)
+	if count > 0 {
+		m.log.WithFields(logrus.Fields{"files": count, "path": path}).Info("File integrity baselines accepted")
+	}
+	return count
+}
+
+// Profiles 返回所有工作负载行为画像的概要
+func (m *Monitor) Profiles() []ProfileSummary {
+	return m.profiles.list()
+}
+
+// Profile 返回行为画像，不存在时返回 ErrProfileNotFound
+func (m *Monitor) Profile(id string) (*Profile, error) {
+	return m.profiles.get(id)
+}
+
+// UpdateProfile 替换行为画像的项，已锁定的画像版本号加1
+func (m *Monitor) UpdateProfile(id string, update ProfileUpdate) (*Profile, error) {
+	profile, err := m.profiles.update(id, update)
+	if err == nil {
+		m.log.WithFields(logrus.Fields{"profile": profile.Key, "version": profile.Version}).Info("Behavior profile updated")
+	}
+	return profile, err
+}
+
+// LockProfile 立即结束学习期并锁定行为画像
+func (m *Monitor) LockProfile(id string) (*Profile, error) {
+	profile, err := m.profiles.lock(id)
+	if err == nil {
+		m.log.WithFields(logrus.Fields{"profile": profile.Key, "version": profile.Version}).Info("Behavior profile locked")
+	}
+	return profile, err
+}
+
+// RelearnProfile 让行为画像重新进入学习期，window 为0时使用配置的学习期，reset 为true时清空已学习的项
+func (m *Monitor) RelearnProfile(id string, window time.Duration, reset bool) (*Profile, error) {
+	return m.profiles.learn(id, window, reset)
+}
 
-			select {
-			case m.events <- event:
-				m.log.WithFields(map[string]interface{}{
-					"event_type": event.EventType,
-					"severity":   event.Severity,
-					"pid":        event.PID,
-				}).Debug("Generated eBPF event")
-			default:
-				m.log.Warn("Event channel is full, dropping event")
+// DeleteProfile 删除行为画像，该工作负载之后的事件开始新的学习期
+func (m *Monitor) DeleteProfile(id string) error {
+	return m.profiles.delete(id)
+}
+
+// WorkloadStatus 返回工作负载解析器状态，未启用时返回nil
+func (m *Monitor) WorkloadStatus() *workload.Status {
+	if m.workloads == nil {
+		return nil
+	}
+	status := m.workloads.Status()
+	return &status
+}
+
+// publish 补全工作负载信息、网络流上下文和文件完整性信息，与行为画像比较后执行检测规则，
+// 交给下游消费者并广播给订阅者
+func (m *Monitor) publish(event Event) {
+	m.stats.received.Add(1)
+	if m.workloads != nil && event.Workload == nil {
+		event.Workload = m.workloads.Resolve(event.PID, event.CgroupID, event.ContainerID)
+		if event.Workload != nil {
+			event.ContainerID = event.Workload.ContainerID
+		}
+	}
+	// 被阻断的连接没有建立，不计入网络流
+	if event.Network != nil && !event.Network.Blocked {
+		m.flows.observe(&event)
+	}
+	m.integrity.observe(&event)
+	anomalies := m.profiles.observe(&event)
+	if m.detector != nil {
+		m.detector.Evaluate(&event)
+	}
+	for _, sink := range m.sinks {
+		sink.Write(event)
+	}
+	m.events.Publish(event)
+
+	// 异常事件紧随触发事件发布，不经过队列，也不会被录制
+	for _, anomaly := range anomalies {
+		m.publish(anomaly)
+	}
+}
+
+// Stats 返回事件采集统计
+func (m *Monitor) Stats() MonitorStats {
+	stats := MonitorStats{
+		Received:     m.stats.received.Load(),
+		Lost:         m.stats.lost.Load(),
+		DecodeErrors: m.stats.decodeErrors.Load(),
+		ReadErrors:   m.stats.readErrors.Load(),
+	}
+	broadcast := m.events.Stats()
+	stats.Dropped = broadcast.Dropped
+	stats.Evicted = broadcast.Evicted
+	stats.Subscribers = broadcast.Subscribers
+	stats.Flows, stats.FlowsDropped = m.flows.stats()
+
+	m.mu.RLock()
+	if m.ingest != nil {
+		stats.Pipeline = append(stats.Pipeline, m.ingest.Stats())
+	}
+	stats.Pipeline = append(stats.Pipeline, QueueStats{
+		Stage:    StageBroadcast,
+		Enqueued: stats.Received,
+		Dropped:  broadcast.Dropped,
+	})
+	if m.source != nil {
+		stats.Transport = m.source.Name()
+		if kernel, ok := m.source.(*kernelSource); ok {
+			if transport := kernel.Transport(); transport != "" {
+				stats.Transport = transport
 			}
+			stats.Lost += kernel.KernelLost()
+			stats.KernelFilter = kernel.filterStats()
 		}
 	}
-}
\ No newline at end of file
+	m.mu.RUnlock()
+
+	m.stats.mu.Lock()
+	stats.LastError, stats.LastErrorTime = m.stats.lastError, m.stats.lastErrorTime
+	m.stats.mu.Unlock()
+
+	return stats
+}
@@ -0,0 +1,65 @@
+package ebpf
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// namespaceTypes 参与比较的命名空间，与 setns 记录中的字段对应
+var namespaceTypes = []string{"mnt", "pid", "net", "uts", "ipc", "cgroup"}
+
+// readNamespaces 读取进程所在命名空间的inode号，无法读取的命名空间被忽略。
+// 以 pid 1 调用时得到宿主机命名空间，要求 procRoot 是宿主机的 /proc
+func readNamespaces(procRoot string, pid uint32) map[string]uint32 {
+	result := make(map[string]uint32, len(namespaceTypes))
+	dir := filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "ns")
+	for _, name := range namespaceTypes {
+		// 链接内容形如 mnt:[4026531840]
+		link, err := os.Readlink(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		start, end := strings.IndexByte(link, '['), strings.LastIndexByte(link, ']')
+		if start < 0 || end <= start {
+			continue
+		}
+		inum, err := strconv.ParseUint(link[start+1:end], 10, 32)
+		if err != nil {
+			continue
+		}
+		result[name] = uint32(inum)
+	}
+	return result
+}
+
+// markHost 记录与宿主机相同的命名空间
+func (n *NamespaceDetails) markHost(host map[string]uint32) {
+	n.Host = nil
+	for _, name := range namespaceTypes {
+		if inum, ok := host[name]; ok && inum != 0 && inum == n.inum(name) {
+			n.Host = append(n.Host, name)
+		}
+	}
+}
+
+// inum 返回指定类型的命名空间inode号
+func (n *NamespaceDetails) inum(name string) uint32 {
+	switch name {
+	case "mnt":
+		return n.Mnt
+	case "pid":
+		return n.PID
+	case "net":
+		return n.Net
+	case "uts":
+		return n.UTS
+	case "ipc":
+		return n.IPC
+	case "cgroup":
+		return n.Cgroup
+	default:
+		return 0
+	}
+}
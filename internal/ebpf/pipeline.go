@@ -0,0 +1,570 @@
+package ebpf
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// 事件处理流水线的阶段名称，用于队列和丢弃统计
+const (
+	StageIngest    = "ingest"    // 事件源与处理协程之间的队列
+	StageBroadcast = "broadcast" // 实时订阅者的缓冲区
+	StageStore     = "store"     // 持久化写入队列
+)
+
+// severityCount 严重程度级别数，info 到 critical
+const severityCount = 5
+
+// ErrQueueClosed 队列已关闭
+var ErrQueueClosed = errors.New("event queue is closed")
+
+// errSpillFull 溢出文件已达大小上限
+var errSpillFull = errors.New("spill file is full")
+
+// severityNames 各严重程度级别的名称，下标为 SeverityLevel 的返回值
+var severityNames = [severityCount]string{"info", "low", "medium", "high", "critical"}
+
+// QueueOptions 优先级队列参数
+type QueueOptions struct {
+	Stage    string
+	Capacity int
+	// SpillDir 内存队列满时溢出事件的目录，为空时直接丢弃
+	SpillDir string
+	// SpillMaxBytes 各级别溢出文件合计的大小上限，0 表示不限制
+	SpillMaxBytes int64
+}
+
+// QueueStats 流水线阶段的队列和丢弃统计
+type QueueStats struct {
+	Stage    string `json:"stage"`
+	Capacity int    `json:"capacity,omitempty"`
+	Queued   int    `json:"queued"`
+	Enqueued uint64 `json:"enqueued"`
+	// Spilled 写入溢出文件的事件数，SpillPending 为其中尚未取出的数量
+	Spilled      uint64 `json:"spilled,omitempty"`
+	SpillPending int    `json:"spill_pending,omitempty"`
+	SpillBytes   int64  `json:"spill_bytes,omitempty"`
+	Dropped      uint64 `json:"dropped"`
+	// DroppedBySeverity 按事件严重程度统计的丢弃数
+	DroppedBySeverity map[string]uint64 `json:"dropped_by_severity,omitempty"`
+	LastError         string            `json:"last_error,omitempty"`
+}
+
+// PriorityQueue 按严重程度分级的有界事件队列。出队时总是先取最高级别的事件，
+// 同级别内保持先进先出；队列已满时挤出最低级别中最早的事件，因此高级别事件
+// 不会先于低级别事件被丢弃。配置了溢出目录时，被挤出的事件按级别写入磁盘，
+// 出队时溢出文件中有高于内存最高级别的事件则先从磁盘读回
+type PriorityQueue struct {
+	stage    string
+	capacity int
+	spill    *spillSet // 有独立的锁，读写磁盘时不持有 mu
+
+	mu        sync.Mutex
+	lanes     [severityCount][]Event
+	size      int
+	closed    bool
+	enqueued  uint64
+	spilled   uint64
+	dropped   [severityCount]uint64
+	lastError string
+
+	ready chan struct{} // 有事件可取时发出信号
+	space chan struct{} // 有空位时发出信号
+	done  chan struct{} // Close 后关闭
+}
+
+// NewPriorityQueue 创建优先级队列。溢出目录中上次运行遗留的事件会被继续处理
+func NewPriorityQueue(opts QueueOptions) (*PriorityQueue, error) {
+	if opts.Capacity <= 0 {
+		opts.Capacity = 8192
+	}
+	q := &PriorityQueue{
+		stage:    opts.Stage,
+		capacity: opts.Capacity,
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if opts.SpillDir != "" {
+		spill, err := openSpillSet(opts.SpillDir, opts.Stage, opts.SpillMaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s spill file: %w", opts.Stage, err)
+		}
+		q.spill = spill
+		if pending, _ := spill.stats(); pending > 0 {
+			signal(q.ready)
+		}
+	}
+	return q, nil
+}
+
+// Push 非阻塞入队。队列已满时，若新事件高于队列中的最低级别，挤出该级别最早的事件，
+// 否则溢出或丢弃新事件。写入溢出文件时不持有队列锁，磁盘I/O不阻塞其他入队和出队
+func (q *PriorityQueue) Push(event Event) {
+	level := SeverityLevel(event.Severity)
+
+	q.mu.Lock()
+	if q.closed {
+		q.dropped[level]++
+		q.mu.Unlock()
+		return
+	}
+	q.enqueued++
+
+	// 在锁内选出需要溢出的事件，释放锁后再写入磁盘
+	var victim *Event
+	if q.size >= q.capacity {
+		lowest := q.lowestLocked()
+		if lowest >= level {
+			q.mu.Unlock()
+			q.overflow(event)
+			return
+		}
+		evicted := q.lanes[lowest][0]
+		q.lanes[lowest][0] = Event{}
+		q.lanes[lowest] = q.lanes[lowest][1:]
+		q.size--
+		victim = &evicted
+	}
+	q.lanes[level] = append(q.lanes[level], event)
+	q.size++
+	q.mu.Unlock()
+	signal(q.ready)
+
+	if victim != nil {
+		q.overflow(*victim)
+	}
+}
+
+// PushWait 阻塞入队，等待队列出现空位。用于回放和模拟等不需要实时性的事件源
+func (q *PriorityQueue) PushWait(ctx context.Context, event Event) error {
+	level := SeverityLevel(event.Severity)
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.dropped[level]++
+			q.mu.Unlock()
+			return ErrQueueClosed
+		}
+		if q.size < q.capacity {
+			q.lanes[level] = append(q.lanes[level], event)
+			q.size++
+			q.enqueued++
+			q.mu.Unlock()
+			signal(q.ready)
+			return nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.space:
+		case <-q.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryPop 非阻塞出队，取内存和溢出文件中最高级别的事件，同级别时先取内存中的事件。
+// 读取溢出文件时不持有队列锁，不阻塞入队
+func (q *PriorityQueue) TryPop() (Event, bool) {
+	for {
+		q.mu.Lock()
+		level := q.highestLocked()
+		if level >= 0 && (q.spill == nil || q.spill.highest() <= level) {
+			event := q.lanes[level][0]
+			q.lanes[level][0] = Event{}
+			q.lanes[level] = q.lanes[level][1:]
+			q.size--
+			q.mu.Unlock()
+			signal(q.space)
+			return event, true
+		}
+		q.mu.Unlock()
+
+		if q.spill == nil {
+			return Event{}, false
+		}
+		event, spillLevel, ok, err := q.spill.read()
+		if err != nil {
+			// 无法解析的记录计入所在级别的丢弃
+			q.mu.Lock()
+			q.dropped[spillLevel]++
+			q.lastError = err.Error()
+			q.mu.Unlock()
+			continue
+		}
+		if ok {
+			return event, true
+		}
+		if level < 0 {
+			return Event{}, false
+		}
+		// 溢出事件已被其他消费者取走，重新比较内存队列
+	}
+}
+
+// Pop 阻塞出队，队列关闭且内存中的事件取完后返回false
+func (q *PriorityQueue) Pop() (Event, bool) {
+	for {
+		if event, ok := q.TryPop(); ok {
+			return event, true
+		}
+		select {
+		case <-q.ready:
+		case <-q.done:
+			return q.TryPop()
+		}
+	}
+}
+
+// Ready 返回有事件可取时发出信号的通道，收到信号后应反复调用 TryPop 直到取空
+func (q *PriorityQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Close 关闭队列，之后入队的事件被丢弃。内存中的事件仍可取出，
+// 溢出文件中未处理的事件保留在磁盘上，下次启动时继续处理
+func (q *PriorityQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.done)
+	if q.spill != nil {
+		return q.spill.close()
+	}
+	return nil
+}
+
+// Len 返回内存中排队的事件数
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Stats 返回队列统计
+func (q *PriorityQueue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := QueueStats{
+		Stage:     q.stage,
+		Capacity:  q.capacity,
+		Queued:    q.size,
+		Enqueued:  q.enqueued,
+		Spilled:   q.spilled,
+		LastError: q.lastError,
+	}
+	if q.spill != nil {
+		stats.SpillPending, stats.SpillBytes = q.spill.stats()
+	}
+	for severity, level := range severityLevels {
+		if n := q.dropped[level]; n > 0 {
+			if stats.DroppedBySeverity == nil {
+				stats.DroppedBySeverity = make(map[string]uint64)
+			}
+			stats.DroppedBySeverity[severity] = n
+			stats.Dropped += n
+		}
+	}
+	return stats
+}
+
+// highestLocked 返回内存中非空的最高级别，内存队列为空时返回-1
+func (q *PriorityQueue) highestLocked() int {
+	for level := severityCount - 1; level >= 0; level-- {
+		if len(q.lanes[level]) > 0 {
+			return level
+		}
+	}
+	return -1
+}
+
+// lowestLocked 返回内存中非空的最低级别
+func (q *PriorityQueue) lowestLocked() int {
+	for level := 0; level < severityCount; level++ {
+		if len(q.lanes[level]) > 0 {
+			return level
+		}
+	}
+	return severityCount - 1
+}
+
+// overflow 处理无法留在内存中的事件：写入溢出文件，失败时丢弃。调用方不能持有队列锁。
+// 溢出空间不足时先清出更低级别的溢出事件，计入这些级别的丢弃
+func (q *PriorityQueue) overflow(event Event) {
+	var evicted [severityCount]int
+	err := errSpillFull
+	if q.spill != nil {
+		evicted, err = q.spill.write(event)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for level, n := range evicted {
+		q.dropped[level] += uint64(n)
+	}
+	if err == nil {
+		q.spilled++
+		signal(q.ready)
+		return
+	}
+	// 写入时队列已关闭的事件与关闭后入队的事件一样计入丢弃
+	if !errors.Is(err, errSpillFull) && !errors.Is(err, ErrQueueClosed) {
+		q.lastError = err.Error()
+	}
+	q.dropped[SeverityLevel(event.Severity)]++
+}
+
+// signal 非阻塞地发出信号
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// spillSet 按严重程度分开的溢出文件，合计大小受同一上限约束
+type spillSet struct {
+	maxBytes int64
+	// top 有未取出事件的最高级别，没有时为-1。出队时不获取 mu 即可与内存队列比较
+	top atomic.Int32
+
+	mu     sync.Mutex
+	files  [severityCount]*spillFile
+	closed bool
+}
+
+// openSpillSet 打开各级别的溢出文件，文件名为 <stage>.<severity>.spill.jsonl
+func openSpillSet(dir, stage string, maxBytes int64) (*spillSet, error) {
+	s := &spillSet{maxBytes: maxBytes}
+	for level, name := range severityNames {
+		file, err := openSpillFile(filepath.Join(dir, stage+"."+name+".spill.jsonl"))
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.files[level] = file
+	}
+	s.updateTopLocked()
+	return s, nil
+}
+
+// write 将事件写入所在级别的溢出文件。空间不足时从最低级别起清空低于该事件级别的
+// 溢出文件，返回各级别被清出的事件数；仍然放不下时返回 errSpillFull
+func (s *spillSet) write(event Event) ([severityCount]int, error) {
+	var evicted [severityCount]int
+	data, err := json.Marshal(event)
+	if err != nil {
+		return evicted, err
+	}
+	data = append(data, '\n')
+	level := SeverityLevel(event.Severity)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.updateTopLocked()
+	if s.closed {
+		return evicted, ErrQueueClosed
+	}
+	for lower := 0; s.maxBytes > 0 && s.sizeLocked()+int64(len(data)) > s.maxBytes; lower++ {
+		if lower >= level {
+			return evicted, errSpillFull
+		}
+		if n := s.files[lower].pending; n > 0 {
+			if err := s.files[lower].reset(); err != nil {
+				return evicted, err
+			}
+			evicted[lower] = n
+		}
+	}
+	return evicted, s.files[level].write(data)
+}
+
+// read 从最高级别的非空溢出文件读取一个事件，没有事件时 ok 为false。
+// 记录无法解析时返回错误和所在级别，调用方可继续读取
+func (s *spillSet) read() (event Event, level int, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Event{}, 0, false, nil
+	}
+	defer s.updateTopLocked()
+	for level = severityCount - 1; level >= 0; level-- {
+		if s.files[level].pending == 0 {
+			continue
+		}
+		event, err = s.files[level].read()
+		return event, level, err == nil, err
+	}
+	return Event{}, 0, false, nil
+}
+
+// highest 返回有未取出事件的最高级别，没有时返回-1
+func (s *spillSet) highest() int {
+	return int(s.top.Load())
+}
+
+// updateTopLocked 在未取出的事件数变化后更新 top
+func (s *spillSet) updateTopLocked() {
+	for level := severityCount - 1; level >= 0; level-- {
+		if s.files[level] != nil && s.files[level].pending > 0 {
+			s.top.Store(int32(level))
+			return
+		}
+	}
+	s.top.Store(-1)
+}
+
+// stats 返回尚未取出的事件数和文件合计大小
+func (s *spillSet) stats() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := 0
+	for _, file := range s.files {
+		if file != nil {
+			pending += file.pending
+		}
+	}
+	return pending, s.sizeLocked()
+}
+
+func (s *spillSet) sizeLocked() int64 {
+	var size int64
+	for _, file := range s.files {
+		if file != nil {
+			size += file.size
+		}
+	}
+	return size
+}
+
+func (s *spillSet) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.top.Store(-1)
+	var firstErr error
+	for _, file := range s.files {
+		if file == nil {
+			continue
+		}
+		if err := file.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// spillFile 溢出文件，每行一个JSON事件。读取位置追上写入位置后清空文件
+type spillFile struct {
+	path    string
+	writer  *os.File
+	file    *os.File
+	reader  *bufio.Reader
+	size    int64
+	pending int
+}
+
+// openSpillFile 打开溢出文件，统计上次运行遗留的完整记录，并截掉写了一半的最后一行
+func openSpillFile(path string) (*spillFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	s := &spillFile{path: path, writer: writer, file: file, reader: bufio.NewReader(file)}
+
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		s.size += int64(len(line))
+		s.pending++
+	}
+	if err := writer.Truncate(s.size); err != nil {
+		s.close()
+		return nil, err
+	}
+	if err := s.rewind(); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// write 追加一行已编码的事件
+func (s *spillFile) write(data []byte) error {
+	if _, err := s.writer.Write(data); err != nil {
+		return err
+	}
+	s.size += int64(len(data))
+	s.pending++
+	return nil
+}
+
+// read 读取下一个事件，全部读完后清空文件
+func (s *spillFile) read() (Event, error) {
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		// 文件与计数不一致，放弃剩余内容
+		s.pending = 0
+		s.reset()
+		return Event{}, fmt.Errorf("failed to read spill file %s: %w", s.path, err)
+	}
+	s.pending--
+	if s.pending == 0 {
+		if err := s.reset(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	var event Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return Event{}, fmt.Errorf("invalid event in spill file %s: %w", s.path, err)
+	}
+	return event, nil
+}
+
+// reset 清空文件并回到开头
+func (s *spillFile) reset() error {
+	s.pending = 0
+	if err := s.writer.Truncate(0); err != nil {
+		return err
+	}
+	s.size = 0
+	return s.rewind()
+}
+
+// rewind 将读取位置移到文件开头
+func (s *spillFile) rewind() error {
+	if _, err := s.file.Seek(0, 0); err != nil {
+		return err
+	}
+	s.reader.Reset(s.file)
+	return nil
+}
+
+func (s *spillFile) close() error {
+	s.file.Close()
+	return s.writer.Close()
+}
@@ -0,0 +1,238 @@
+package ebpf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func queueEvent(id uint32, severity string) Event {
+	return Event{PID: id, Severity: severity, EventType: "process"}
+}
+
+// eventSize 返回事件在溢出文件中占用的字节数
+func eventSize(t *testing.T, event Event) int64 {
+	t.Helper()
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data) + 1)
+}
+
+// popAll 取出队列中的全部事件，返回PID序列
+func popAll(q *PriorityQueue) []uint32 {
+	var pids []uint32
+	for {
+		event, ok := q.TryPop()
+		if !ok {
+			return pids
+		}
+		pids = append(pids, event.PID)
+	}
+}
+
+func equalPIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPriorityQueueEvictsLowestSeverity(t *testing.T) {
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(queueEvent(1, "low"))
+	q.Push(queueEvent(2, "critical"))
+	q.Push(queueEvent(3, "low"))
+	q.Push(queueEvent(4, "high"))     // 挤出最早的 low
+	q.Push(queueEvent(5, "info"))     // 不高于队列中的最低级别，直接丢弃
+	q.Push(queueEvent(6, "critical")) // 挤出剩下的 low
+
+	if got, want := popAll(q), []uint32{2, 6, 4}; !equalPIDs(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+	stats := q.Stats()
+	if stats.DroppedBySeverity["low"] != 2 || stats.DroppedBySeverity["info"] != 1 || stats.DroppedBySeverity["critical"] != 0 {
+		t.Errorf("dropped = %v", stats.DroppedBySeverity)
+	}
+}
+
+func TestSpillEvictsLowerSeverityBeforeDroppingCritical(t *testing.T) {
+	dir := t.TempDir()
+	size := eventSize(t, queueEvent(10, "low"))
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: dir, SpillMaxBytes: 2 * size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Push(queueEvent(1, "critical")) // 留在内存中
+	q.Push(queueEvent(10, "low"))     // 溢出
+	q.Push(queueEvent(11, "low"))     // 溢出，溢出空间已满
+	q.Push(queueEvent(2, "critical")) // 清出 low 的溢出文件后写入
+	q.Push(queueEvent(12, "low"))     // 低级别事件不能清出 critical，被丢弃
+
+	stats := q.Stats()
+	if stats.DroppedBySeverity["critical"] != 0 {
+		t.Fatalf("critical events dropped while low events were on disk: %v", stats.DroppedBySeverity)
+	}
+	if stats.DroppedBySeverity["low"] != 3 {
+		t.Errorf("dropped low = %d, want 3", stats.DroppedBySeverity["low"])
+	}
+	if got, want := popAll(q), []uint32{1, 2}; !equalPIDs(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestSpillReadsHigherSeverityFirst(t *testing.T) {
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Push(queueEvent(1, "critical"))
+	q.Push(queueEvent(2, "low"))
+	q.Push(queueEvent(3, "medium"))
+	q.Push(queueEvent(4, "low"))
+	q.Push(queueEvent(5, "high"))
+
+	if got, want := popAll(q), []uint32{1, 5, 3, 2, 4}; !equalPIDs(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+	if stats := q.Stats(); stats.Spilled != 4 || stats.SpillPending != 0 || stats.SpillBytes != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestSpillSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(queueEvent(1, "critical"))
+	q.Push(queueEvent(2, "high"))
+	q.Push(queueEvent(3, "info"))
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got, want := popAll(q), []uint32{2, 3}; !equalPIDs(got, want) {
+		t.Errorf("events after restart = %v, want %v", got, want)
+	}
+}
+
+func TestTryPopReadsSpillWithoutQueueLock(t *testing.T) {
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Push(queueEvent(1, "high"))
+	q.Push(queueEvent(2, "high"))
+	if event, ok := q.TryPop(); !ok || event.PID != 1 {
+		t.Fatalf("first pop = %v %v", event.PID, ok)
+	}
+
+	// 模拟缓慢的磁盘读取：持有溢出文件的锁时，TryPop 阻塞在读取上，入队不应受影响
+	q.spill.mu.Lock()
+	popped := make(chan uint32)
+	go func() {
+		event, _ := q.TryPop()
+		popped <- event.PID
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(queueEvent(3, "critical"))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("Push blocked while TryPop was reading the spill file")
+	}
+	q.spill.mu.Unlock()
+
+	if pid := <-popped; pid != 2 {
+		t.Errorf("spilled event = %d, want 2", pid)
+	}
+	if event, ok := q.TryPop(); !ok || event.PID != 3 {
+		t.Errorf("in-memory event = %v %v, want 3", event.PID, ok)
+	}
+}
+
+func TestSpilledCriticalBeforeInMemoryLowerSeverity(t *testing.T) {
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Push(queueEvent(1, "critical"))
+	q.Push(queueEvent(2, "critical")) // 内存已满，溢出到磁盘
+	if event, ok := q.TryPop(); !ok || event.PID != 1 {
+		t.Fatalf("first pop = %v %v", event.PID, ok)
+	}
+	q.Push(queueEvent(3, "low"))
+	q.Push(queueEvent(4, "info")) // 低于内存中的 low，溢出到磁盘
+
+	if got, want := popAll(q), []uint32{2, 3, 4}; !equalPIDs(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestPushDoesNotHoldQueueLockWhileSpilling(t *testing.T) {
+	q, err := NewPriorityQueue(QueueOptions{Stage: "test", Capacity: 1, SpillDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Push(queueEvent(1, "low"))
+
+	// 模拟缓慢的磁盘写入：持有溢出文件的锁时，挤出 low 的入队阻塞在写入上，队列的其他操作不应受影响
+	q.spill.mu.Lock()
+	spilled := make(chan struct{})
+	go func() {
+		q.Push(queueEvent(2, "high"))
+		close(spilled)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan uint32)
+	go func() {
+		if n := q.Len(); n != 1 {
+			t.Errorf("queued = %d, want 1", n)
+		}
+		event, _ := q.TryPop()
+		done <- event.PID
+	}()
+	select {
+	case pid := <-done:
+		if pid != 2 {
+			t.Errorf("in-memory event = %d, want 2", pid)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queue blocked while Push was writing the spill file")
+	}
+	q.spill.mu.Unlock()
+	<-spilled
+
+	if event, ok := q.TryPop(); !ok || event.PID != 1 {
+		t.Errorf("spilled event = %v %v, want 1", event.PID, ok)
+	}
+}
@@ -0,0 +1,505 @@
+package ebpf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"cloudsecops/internal/workload"
+
+	"golang.org/x/sys/unix"
+)
+
+// 进程表参数
+const (
+	maxLineage      = 8
+	exitedTTL       = 30 * time.Second // 进程退出后保留的时间，晚到的事件仍可关联祖先链
+	clockTicks      = 100              // /proc/<pid>/stat 中 starttime 的单位，USER_HZ
+	hashCacheMax    = 4096
+	maxCommLen      = 15   // TASK_COMM_LEN 去掉结尾的NUL
+	maxCmdlineLen   = 4096 // 从 /proc 读取的命令行长度上限
+	defaultProcRoot = "/proc"
+)
+
+// ProcessInfo 进程信息
+type ProcessInfo struct {
+	PID       uint32   `json:"pid"`
+	PPID      uint32   `json:"ppid"`
+	UID       uint32   `json:"uid"`
+	Comm      string   `json:"comm"`
+	Exe       string   `json:"exe,omitempty"`
+	Args      []string `json:"args,omitempty"`
+	ExeHash   string   `json:"exe_hash,omitempty"` // 可执行文件的SHA-256
+	StartTime int64    `json:"start_time,omitempty"`
+}
+
+// Cmdline 返回以空格连接的命令行
+func (p *ProcessInfo) Cmdline() string {
+	return strings.Join(p.Args, " ")
+}
+
+// ProcessNode 进程树节点
+type ProcessNode struct {
+	ProcessInfo
+	ContainerID string         `json:"container_id,omitempty"`
+	Children    []*ProcessNode `json:"children,omitempty"`
+}
+
+// processEntry 进程表条目
+type processEntry struct {
+	info        ProcessInfo
+	containerID string
+	hashPath    string // 计算哈希时打开的路径，在进程的挂载命名空间内解析
+	hashed      bool
+	exited      time.Time
+}
+
+// processTable 内存中的进程表。启动时从 /proc 初始化，之后由内核的 fork、exec、exit
+// 记录维护，表中没有的进程在首次出现时从 /proc 补全
+type processTable struct {
+	procRoot    string
+	bootTime    time.Time
+	hashMaxSize int64
+	maxSize     int
+
+	mu     sync.Mutex
+	procs  map[uint32]*processEntry
+	purged time.Time
+
+	hashMu sync.Mutex
+	hashes map[fileKey]string
+}
+
+// fileKey 标识可执行文件的版本，文件被替换后重新计算哈希
+type fileKey struct {
+	dev, ino uint64
+	size     int64
+	mtime    int64
+}
+
+func newProcessTable(procRoot string, hashMaxSize int64, maxSize int) *processTable {
+	if procRoot == "" {
+		procRoot = defaultProcRoot
+	}
+	if maxSize <= 0 {
+		maxSize = 65536
+	}
+	return &processTable{
+		procRoot:    procRoot,
+		bootTime:    bootTime(),
+		hashMaxSize: hashMaxSize,
+		maxSize:     maxSize,
+		procs:       make(map[uint32]*processEntry),
+		hashes:      make(map[fileKey]string),
+	}
+}
+
+// seed 从 /proc 读取现有进程
+func (t *processTable) seed() (int, error) {
+	entries, err := os.ReadDir(t.procRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	procs := make(map[uint32]*processEntry, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if p, ok := t.readProc(uint32(pid)); ok {
+			procs[uint32(pid)] = p
+		}
+	}
+
+	t.mu.Lock()
+	t.procs = procs
+	t.mu.Unlock()
+	return len(procs), nil
+}
+
+// ProcessStartTime 返回进程的启动时间，进程不存在时返回false。用于确认PID没有在事件之后被复用
+func ProcessStartTime(procRoot string, pid uint32) (time.Time, bool) {
+	_, _, start, ok := readProcStat(procRoot, pid)
+	if !ok {
+		return time.Time{}, false
+	}
+	return bootTime().Add(time.Duration(start) * time.Second / clockTicks), true
+}
+
+// readProc 从 /proc 读取单个进程
+func (t *processTable) readProc(pid uint32) (*processEntry, bool) {
+	dir := filepath.Join(t.procRoot, strconv.FormatUint(uint64(pid), 10))
+	comm, ppid, start, ok := readProcStat(t.procRoot, pid)
+	if !ok {
+		return nil, false
+	}
+
+	p := &processEntry{info: ProcessInfo{PID: pid, PPID: ppid, Comm: comm}}
+	if start > 0 {
+		p.info.StartTime = t.bootTime.Add(time.Duration(start) * time.Second / clockTicks).Unix()
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		if len(cmdline) > maxCmdlineLen {
+			cmdline = cmdline[:maxCmdlineLen]
+		}
+		p.info.Args = splitArgs(cmdline)
+	}
+	// 内核线程没有可执行文件
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		p.info.Exe = strings.TrimSuffix(exe, " (deleted)")
+		p.hashPath = filepath.Join(dir, "exe")
+	}
+	if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		p.info.UID = statusUID(status)
+	}
+	if cgroup, err := workload.ReadProcCgroup(t.procRoot, pid); err == nil {
+		if info, ok := workload.ParseCgroupPath(cgroup); ok {
+			p.containerID = info.ContainerID
+		}
+	}
+	return p, true
+}
+
+// fork 记录新进程，子进程继承父进程的程序和容器
+func (t *processTable) fork(parent, child uint32, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := &processEntry{info: ProcessInfo{PID: child, PPID: parent, StartTime: ts.Unix()}}
+	if pp, ok := t.procs[parent]; ok {
+		p.info.UID = pp.info.UID
+		p.info.Comm = pp.info.Comm
+		p.info.Exe = pp.info.Exe
+		p.info.Args = pp.info.Args
+		p.info.ExeHash = pp.info.ExeHash
+		p.hashPath = pp.hashPath
+		p.hashed = pp.hashed
+		p.containerID = pp.containerID
+	}
+	t.procs[child] = p
+	t.purgeLocked()
+}
+
+// exec 用新程序替换进程信息。execve 在系统调用入口采集，
+// 文件路径相对于进程自身的根目录和工作目录解析。
+// 容器的第一个进程由宿主机上的运行时创建后才移入容器cgroup，因此在exec时重新读取所属容器
+func (t *processTable) exec(event *Event, args []string) {
+	dir := filepath.Join(t.procRoot, strconv.FormatUint(uint64(event.PID), 10))
+	hashPath := event.Filename
+	if path.IsAbs(hashPath) {
+		hashPath = filepath.Join(dir, "root", hashPath)
+	} else {
+		hashPath = filepath.Join(dir, "cwd", hashPath)
+	}
+	containerID, cgroupKnown := "", false
+	if cgroup, err := workload.ReadProcCgroup(t.procRoot, event.PID); err == nil {
+		cgroupKnown = true
+		if info, ok := workload.ParseCgroupPath(cgroup); ok {
+			containerID = info.ContainerID
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.procs[event.PID]
+	if !ok {
+		p = &processEntry{info: ProcessInfo{PID: event.PID, StartTime: event.Timestamp}}
+		t.procs[event.PID] = p
+	}
+	comm := path.Base(event.Filename)
+	if len(comm) > maxCommLen {
+		comm = comm[:maxCommLen]
+	}
+	p.info.PPID = event.PPID
+	p.info.UID = event.UID
+	p.info.Comm = comm
+	p.info.Exe = event.Filename
+	p.info.Args = args
+	p.info.ExeHash = ""
+	p.hashPath = hashPath
+	p.hashed = false
+	p.exited = time.Time{}
+	if cgroupKnown {
+		p.containerID = containerID
+	}
+}
+
+// exit 标记进程退出，条目在 exitedTTL 之后清理
+func (t *processTable) exit(pid uint32, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.procs[pid]; ok {
+		p.exited = ts
+	}
+	t.purgeLocked()
+}
+
+// annotate 为事件补全进程信息和祖先链
+func (t *processTable) annotate(event *Event) {
+	self := t.lookup(event.PID, event.PPID, event.Comm, event.UID)
+	if self == nil {
+		return
+	}
+	event.Process = self
+
+	event.Lineage = nil
+	event.Ancestors = nil
+	seen := map[uint32]bool{self.PID: true}
+	for pid := self.PPID; pid != 0 && !seen[pid] && len(event.Lineage) < maxLineage; {
+		seen[pid] = true
+		ancestor := t.lookup(pid, 0, "", 0)
+		if ancestor == nil {
+			break
+		}
+		event.Lineage = append(event.Lineage, *ancestor)
+		event.Ancestors = append(event.Ancestors, ancestor.Comm)
+		pid = ancestor.PPID
+	}
+}
+
+// lookup 返回进程信息的副本，表中没有时从 /proc 读取，仍不存在时以事件头部信息为准
+func (t *processTable) lookup(pid, ppid uint32, comm string, uid uint32) *ProcessInfo {
+	t.mu.Lock()
+	p, ok := t.procs[pid]
+	t.mu.Unlock()
+
+	if !ok {
+		var found bool
+		if p, found = t.readProc(pid); !found {
+			if comm == "" {
+				return nil
+			}
+			p = &processEntry{info: ProcessInfo{PID: pid, PPID: ppid, Comm: comm, UID: uid}}
+		}
+		t.mu.Lock()
+		if existing, ok := t.procs[pid]; ok {
+			p = existing
+		} else {
+			t.procs[pid] = p
+		}
+		t.mu.Unlock()
+	}
+
+	t.mu.Lock()
+	// 父进程退出后进程会被重新挂到 init 或 subreaper 下
+	if ppid != 0 && p.info.PPID != ppid {
+		p.info.PPID = ppid
+	}
+	hashPath := ""
+	if !p.hashed {
+		p.hashed = true
+		hashPath = p.hashPath
+	}
+	info := p.info
+	t.mu.Unlock()
+
+	if hashPath != "" {
+		info.ExeHash = t.hash(hashPath)
+		t.mu.Lock()
+		if p.hashPath == hashPath {
+			p.info.ExeHash = info.ExeHash
+		}
+		t.mu.Unlock()
+	}
+	return &info
+}
+
+// hash 计算可执行文件的SHA-256，按设备、inode、大小和修改时间缓存
+func (t *processTable) hash(name string) string {
+	if t.hashMaxSize <= 0 {
+		return ""
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() > t.hashMaxSize {
+		return ""
+	}
+	key := fileKey{size: info.Size(), mtime: info.ModTime().UnixNano()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		key.dev, key.ino = uint64(st.Dev), st.Ino
+	}
+	t.hashMu.Lock()
+	sum, ok := t.hashes[key]
+	t.hashMu.Unlock()
+	if ok {
+		return sum
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return ""
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	t.hashMu.Lock()
+	if len(t.hashes) >= hashCacheMax {
+		t.hashes = make(map[fileKey]string)
+	}
+	t.hashes[key] = sum
+	t.hashMu.Unlock()
+	return sum
+}
+
+// purgeLocked 清理已退出的进程，调用方需持有锁。进程表超过上限时不再等待 exitedTTL，
+// 仍超过上限则移除 /proc 中已不存在的进程
+func (t *processTable) purgeLocked() {
+	now := time.Now()
+	over := len(t.procs) > t.maxSize
+	if !over && now.Sub(t.purged) < exitedTTL {
+		return
+	}
+	t.purged = now
+
+	for pid, p := range t.procs {
+		if !p.exited.IsZero() && (over || now.Sub(p.exited) >= exitedTTL) {
+			delete(t.procs, pid)
+		}
+	}
+	if len(t.procs) <= t.maxSize {
+		return
+	}
+	for pid := range t.procs {
+		if _, err := os.Stat(filepath.Join(t.procRoot, strconv.FormatUint(uint64(pid), 10))); os.IsNotExist(err) {
+			delete(t.procs, pid)
+		}
+	}
+}
+
+// size 返回进程表中的进程数
+func (t *processTable) size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.procs)
+}
+
+// tree 返回容器内存活进程组成的进程树，containerID 可以是ID前缀。
+// 父进程不在该容器内的进程作为根节点
+func (t *processTable) tree(containerID string) []*ProcessNode {
+	t.mu.Lock()
+	nodes := make(map[uint32]*ProcessNode)
+	for pid, p := range t.procs {
+		if !p.exited.IsZero() || p.containerID == "" || !strings.HasPrefix(p.containerID, containerID) {
+			continue
+		}
+		nodes[pid] = &ProcessNode{ProcessInfo: p.info, ContainerID: p.containerID}
+	}
+	t.mu.Unlock()
+
+	roots := []*ProcessNode{}
+	for _, node := range nodes {
+		if parent, ok := nodes[node.PPID]; ok && node.PPID != node.PID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	sortNodes(roots)
+	return roots
+}
+
+func sortNodes(nodes []*ProcessNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].PID < nodes[j].PID })
+	for _, node := range nodes {
+		sortNodes(node.Children)
+	}
+}
+
+// splitArgs 拆分以NUL分隔的参数列表
+func splitArgs(data []byte) []string {
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(string(data), "\x00")
+}
+
+// statusUID 从 /proc/<pid>/status 中解析真实UID
+func statusUID(status []byte) uint32 {
+	for _, line := range bytes.Split(status, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte("Uid:")) {
+			continue
+		}
+		fields := bytes.Fields(line[len("Uid:"):])
+		if len(fields) == 0 {
+			return 0
+		}
+		uid, _ := strconv.ParseUint(string(fields[0]), 10, 32)
+		return uint32(uid)
+	}
+	return 0
+}
+
+// readProcStat 读取 /proc/<pid>/stat 中的进程名、父进程PID和启动时间（自系统启动的时钟滴答数）。
+// 进程名可能包含空格和括号，以最后一个")"为界
+func readProcStat(procRoot string, pid uint32) (string, uint32, uint64, bool) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "stat"))
+	if err != nil {
+		return "", 0, 0, false
+	}
+	open, end := bytes.IndexByte(data, '('), bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return "", 0, 0, false
+	}
+	// ")" 之后依次为 state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt cmajflt
+	// utime stime cutime cstime priority nice num_threads itrealvalue starttime
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 2 {
+		return "", 0, 0, false
+	}
+	ppid, err := strconv.ParseUint(string(fields[1]), 10, 32)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	var start uint64
+	if len(fields) > 19 {
+		start, _ = strconv.ParseUint(string(fields[19]), 10, 64)
+	}
+	return string(data[open+1 : end]), uint32(ppid), start, true
+}
+
+// readFDPath 解析进程文件描述符指向的路径，进程已退出或fd已关闭时返回空串
+func readFDPath(procRoot string, pid uint32, fd int32) string {
+	if fd < 0 {
+		return ""
+	}
+	target, err := os.Readlink(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "fd", strconv.Itoa(int(fd))))
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// resolveFilePath 将相对于 dirfd 的路径转换为进程视角的绝对路径，dirfd 为 AT_FDCWD 时相对于工作目录。
+// 无法解析时原样返回
+func resolveFilePath(procRoot string, pid uint32, dirfd int32, name string) string {
+	if name == "" || strings.HasPrefix(name, "/") {
+		return name
+	}
+	var dir string
+	if dirfd == unix.AT_FDCWD {
+		dir, _ = os.Readlink(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "cwd"))
+	} else {
+		dir = readFDPath(procRoot, pid, dirfd)
+	}
+	if !strings.HasPrefix(dir, "/") {
+		return name
+	}
+	return path.Join(dir, name)
+}
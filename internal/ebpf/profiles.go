@@ -0,0 +1,720 @@
+package ebpf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/workload"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 行为画像状态
+const (
+	ProfileLearning = "learning"
+	ProfileLocked   = "locked"
+)
+
+// 行为画像的类别
+const (
+	ProfileBinary  = "binary"
+	ProfileFile    = "file"
+	ProfileNetwork = "network"
+	ProfileSyscall = "syscall"
+)
+
+// EventTypeAnomaly 偏离行为画像的异常事件类型
+const EventTypeAnomaly = "anomaly"
+
+const (
+	// profileSaveInterval 学习中的画像写入磁盘的最小间隔
+	profileSaveInterval = time.Minute
+	// maxReportedAnomalies 每个画像版本记录的已报告异常数，超过后不再去重
+	maxReportedAnomalies = 4096
+)
+
+// 类别在 profileCategories 和 profileEntry 数组中的下标
+const (
+	categoryBinary = iota
+	categoryFile
+	categoryNetwork
+	categorySyscall
+)
+
+// profileCategories 类别顺序，与 profileEntry 中的数组下标对应
+var profileCategories = [...]string{ProfileBinary, ProfileFile, ProfileNetwork, ProfileSyscall}
+
+// anomalySeverity 各类别异常的严重程度
+var anomalySeverity = [...]string{"high", "low", "medium", "medium"}
+
+var (
+	// ErrProfileNotFound 行为画像不存在
+	ErrProfileNotFound = errors.New("profile not found")
+
+	// 由Deployment、DaemonSet、Job 和 StatefulSet 生成的Pod名后缀
+	replicaSetPodName = regexp.MustCompile(`^(.+)-[a-z0-9]{6,10}-[a-z0-9]{5}$`)
+	generatedPodName  = regexp.MustCompile(`^(.+)-[a-z0-9]{5}$`)
+	statefulPodName   = regexp.MustCompile(`^(.+)-[0-9]+$`)
+)
+
+// AnomalyDetails 偏离行为画像的项
+type AnomalyDetails struct {
+	ProfileID      string `json:"profile_id"`
+	Profile        string `json:"profile"`
+	Category       string `json:"category"`
+	Item           string `json:"item"`
+	ProfileVersion int    `json:"profile_version"`
+}
+
+// Profile 工作负载的行为画像。同一工作负载的容器重建后共用画像；
+// 项可以使用 * 等通配符，* 不匹配 /
+type Profile struct {
+	ID         string   `json:"id"`
+	Key        string   `json:"key"`
+	Workload   string   `json:"workload,omitempty"`
+	Image      string   `json:"image,omitempty"`
+	State      string   `json:"state"`
+	Version    int      `json:"version"` // 每次锁定或编辑后加1，异常事件带有产生时的版本
+	CreatedAt  int64    `json:"created_at"`
+	LearnUntil int64    `json:"learn_until"`
+	LockedAt   int64    `json:"locked_at,omitempty"`
+	UpdatedAt  int64    `json:"updated_at"`
+	LastSeen   int64    `json:"last_seen"`
+	Anomalies  uint64   `json:"anomalies"`
+	Binaries   []string `json:"binaries"`
+	Files      []string `json:"files"`
+	Network    []string `json:"network"`
+	Syscalls   []string `json:"syscalls"`
+	// Saturated 学习期内达到项数上限的类别，这些类别锁定后不报告异常
+	Saturated []string `json:"saturated,omitempty"`
+}
+
+// ProfileSummary 行为画像概要，Items 为各类别的项数
+type ProfileSummary struct {
+	ID         string         `json:"id"`
+	Key        string         `json:"key"`
+	Workload   string         `json:"workload,omitempty"`
+	State      string         `json:"state"`
+	Version    int            `json:"version"`
+	LearnUntil int64          `json:"learn_until"`
+	LastSeen   int64          `json:"last_seen"`
+	Anomalies  uint64         `json:"anomalies"`
+	Items      map[string]int `json:"items"`
+}
+
+// ProfileUpdate 替换行为画像的项，为nil的类别保持不变
+type ProfileUpdate struct {
+	Binaries []string `json:"binaries"`
+	Files    []string `json:"files"`
+	Network  []string `json:"network"`
+	Syscalls []string `json:"syscalls"`
+}
+
+// profileEntry 画像及其查找结构
+type profileEntry struct {
+	Profile
+	items     [len(profileCategories)]map[string]bool
+	globs     [len(profileCategories)][]string
+	saturated [len(profileCategories)]bool
+	reported  map[string]bool
+	dirty     bool
+}
+
+// profileTracker 为每个容器工作负载建立行为画像。学习期内记录执行的程序、打开的文件、
+// 网络对端和系统调用，学习期结束后锁定，之后出现的新项作为异常事件上报。
+// 时间以事件时间戳为准，回放历史事件时结果与实时采集一致
+type profileTracker struct {
+	enabled     bool
+	dir         string
+	window      int64
+	autoLock    bool
+	maxItems    int
+	maxProfiles int
+	log         *logrus.Logger
+
+	mu       sync.Mutex
+	profiles map[string]*profileEntry
+	savedAt  time.Time
+}
+
+// newProfileTracker 创建画像追踪器并加载目录中保存的画像
+func newProfileTracker(cfg config.ProfileConfig, log *logrus.Logger) *profileTracker {
+	t := &profileTracker{
+		enabled:     cfg.Enabled,
+		dir:         cfg.Dir,
+		window:      int64(cfg.LearningWindow),
+		autoLock:    cfg.AutoLock,
+		maxItems:    cfg.MaxItems,
+		maxProfiles: cfg.MaxProfiles,
+		log:         log,
+		profiles:    make(map[string]*profileEntry),
+		savedAt:     time.Now(),
+	}
+	if t.maxItems <= 0 {
+		t.maxItems = 512
+	}
+	if t.maxProfiles <= 0 {
+		t.maxProfiles = 1024
+	}
+	if t.enabled && t.dir != "" {
+		count, err := t.load()
+		if err != nil {
+			log.Warnf("Failed to load behavior profiles from %s: %v", t.dir, err)
+		} else if count > 0 {
+			log.Infof("Loaded %d behavior profiles from %s", count, t.dir)
+		}
+	}
+	return t
+}
+
+// observe 将事件计入所属工作负载的画像，返回偏离已锁定画像的异常事件。
+// 宿主机进程和通过API回放的事件不参与画像
+func (t *profileTracker) observe(event *Event) []Event {
+	if !t.enabled || event.Replay != "" || event.EventType == EventTypeAnomaly {
+		return nil
+	}
+	key := profileKey(event)
+	if key == "" {
+		return nil
+	}
+	items := profileItems(event)
+	if len(items) == 0 {
+		return nil
+	}
+	now := event.Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := profileID(key)
+	entry := t.profiles[id]
+	if entry == nil {
+		if len(t.profiles) >= t.maxProfiles {
+			t.log.Debugf("Behavior profile limit %d reached, %s is not profiled", t.maxProfiles, key)
+			return nil
+		}
+		entry = newProfileEntry(Profile{
+			ID:         id,
+			Key:        key,
+			State:      ProfileLearning,
+			CreatedAt:  now,
+			LearnUntil: now + t.window,
+			UpdatedAt:  now,
+		})
+		t.profiles[id] = entry
+	}
+	entry.LastSeen = now
+	if event.Workload != nil {
+		entry.Workload, entry.Image = event.Workload.Name(), event.Workload.Image
+	}
+	if entry.State == ProfileLearning && t.autoLock && now >= entry.LearnUntil {
+		entry.lock(now)
+		t.log.WithFields(logrus.Fields{"profile": entry.Key, "version": entry.Version}).Info("Behavior profile locked")
+		t.saveLocked(entry)
+	}
+
+	var anomalies []Event
+	for _, item := range items {
+		if entry.State == ProfileLearning {
+			if entry.learn(item.category, item.value, t.maxItems) {
+				entry.UpdatedAt = now
+				entry.dirty = true
+			}
+			continue
+		}
+		if entry.saturated[item.category] || entry.matches(item.category, item.value) {
+			continue
+		}
+		reportKey := profileCategories[item.category] + "\x00" + item.value
+		if entry.reported[reportKey] {
+			continue
+		}
+		if len(entry.reported) < maxReportedAnomalies {
+			entry.reported[reportKey] = true
+		}
+		entry.Anomalies++
+		entry.dirty = true
+		anomalies = append(anomalies, anomalyEvent(event, entry, item))
+	}
+
+	if time.Since(t.savedAt) >= profileSaveInterval {
+		t.savedAt = time.Now()
+		for _, e := range t.profiles {
+			t.saveLocked(e)
+		}
+	}
+	return anomalies
+}
+
+// profileItem 事件中需要与画像比较的一项
+type profileItem struct {
+	category int
+	value    string
+}
+
+// profileItems 提取事件中的程序、文件、网络对端和系统调用
+func profileItems(event *Event) []profileItem {
+	var items []profileItem
+	switch {
+	case event.Syscall == "execve":
+		if event.Filename != "" {
+			items = append(items, profileItem{categoryBinary, event.Filename})
+		}
+	case event.Syscall == "openat" || (event.Syscall == "" && event.EventType == "file_access"):
+		if strings.HasPrefix(event.Filename, "/") {
+			items = append(items, profileItem{categoryFile, normalizeProfilePath(event.Filename)})
+		}
+	}
+	if event.Network != nil {
+		if item := networkProfileItem(event.Network); item != "" {
+			items = append(items, profileItem{categoryNetwork, item})
+		}
+	}
+	if event.Syscall != "" {
+		items = append(items, profileItem{categorySyscall, event.Syscall})
+	}
+	return items
+}
+
+// normalizeProfilePath 将纯数字的路径分量替换为 *，如 /proc/1234/status 记为 /proc/*/status
+func normalizeProfilePath(p string) string {
+	parts := strings.Split(path.Clean(p), "/")
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(part, 10, 64); err == nil {
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// networkProfileItem 出站连接记录对端地址和端口，入站连接只记录本端端口
+func networkProfileItem(n *NetworkDetails) string {
+	protocol := n.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if n.Family == "unix" {
+		return "outbound unix " + n.DestAddr
+	}
+	if n.Direction == DirectionInbound {
+		return "inbound " + protocol + " *:" + strconv.Itoa(int(n.DestPort))
+	}
+	if n.DestAddr == "" {
+		return ""
+	}
+	return "outbound " + protocol + " " + net.JoinHostPort(n.DestAddr, strconv.Itoa(int(n.DestPort)))
+}
+
+// profileKey 返回事件所属工作负载的画像键。Kubernetes工作负载按命名空间、
+// 去掉生成后缀的Pod名和容器名区分，其他容器按镜像区分
+func profileKey(event *Event) string {
+	w := event.Workload
+	switch {
+	case w != nil && w.PodName != "":
+		container := w.ContainerName
+		if container == "" {
+			container = imageRepository(w.Image)
+		}
+		return "k8s/" + w.Namespace + "/" + podOwner(w.PodName) + "/" + container
+	case w != nil && w.Image != "":
+		return "image/" + imageRepository(w.Image)
+	case event.ContainerID != "":
+		return "container/" + workload.ShortID(event.ContainerID)
+	}
+	return ""
+}
+
+// podOwner 去掉控制器为Pod名生成的后缀
+func podOwner(pod string) string {
+	for _, re := range []*regexp.Regexp{replicaSetPodName, statefulPodName, generatedPodName} {
+		if m := re.FindStringSubmatch(pod); m != nil {
+			return m[1]
+		}
+	}
+	return pod
+}
+
+// imageRepository 去掉镜像的标签和摘要
+func imageRepository(image string) string {
+	if i := strings.IndexByte(image, '@'); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndexByte(image, ':'); i > strings.LastIndexByte(image, '/') {
+		image = image[:i]
+	}
+	return image
+}
+
+// profileID 由画像键生成可用于URL和文件名的ID
+func profileID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// anomalyEvent 构造异常事件，保留触发事件的进程和工作负载信息，
+// 去掉系统调用详情，避免与触发事件重复命中相同的检测规则
+func anomalyEvent(trigger *Event, entry *profileEntry, item profileItem) Event {
+	category := profileCategories[item.category]
+	return Event{
+		Timestamp:   trigger.Timestamp,
+		PID:         trigger.PID,
+		TID:         trigger.TID,
+		PPID:        trigger.PPID,
+		UID:         trigger.UID,
+		GID:         trigger.GID,
+		Comm:        trigger.Comm,
+		Filename:    item.value,
+		EventType:   EventTypeAnomaly,
+		Severity:    anomalySeverity[item.category],
+		Description: "Behavior anomaly: unexpected " + category,
+		ContainerID: trigger.ContainerID,
+		CgroupID:    trigger.CgroupID,
+		Process:     trigger.Process,
+		Lineage:     trigger.Lineage,
+		Ancestors:   trigger.Ancestors,
+		Workload:    trigger.Workload,
+		Replay:      trigger.Replay,
+		Source:      trigger.Source,
+		Anomaly: &AnomalyDetails{
+			ProfileID:      entry.ID,
+			Profile:        entry.Key,
+			Category:       category,
+			Item:           item.value,
+			ProfileVersion: entry.Version,
+		},
+	}
+}
+
+// newProfileEntry 根据画像的项列表建立查找结构
+func newProfileEntry(p Profile) *profileEntry {
+	entry := &profileEntry{Profile: p, reported: make(map[string]bool)}
+	lists := [...][]string{p.Binaries, p.Files, p.Network, p.Syscalls}
+	for i := range profileCategories {
+		entry.items[i] = make(map[string]bool)
+		for _, item := range lists[i] {
+			entry.add(i, item)
+		}
+	}
+	for _, category := range p.Saturated {
+		for i, name := range profileCategories {
+			if name == category {
+				entry.saturated[i] = true
+			}
+		}
+	}
+	entry.Binaries, entry.Files, entry.Network, entry.Syscalls, entry.Saturated = nil, nil, nil, nil, nil
+	return entry
+}
+
+// add 加入一项，返回是否为新项
+func (e *profileEntry) add(category int, item string) bool {
+	if e.items[category][item] {
+		return false
+	}
+	e.items[category][item] = true
+	if strings.ContainsAny(item, "*?[") {
+		e.globs[category] = append(e.globs[category], item)
+	}
+	return true
+}
+
+// learn 学习期内加入一项，达到上限时标记该类别已饱和
+func (e *profileEntry) learn(category int, item string, maxItems int) bool {
+	if e.items[category][item] || e.saturated[category] {
+		return false
+	}
+	if len(e.items[category]) >= maxItems {
+		e.saturated[category] = true
+		return true
+	}
+	return e.add(category, item)
+}
+
+// matches 判断一项是否在画像中，支持通配符项
+func (e *profileEntry) matches(category int, item string) bool {
+	if e.items[category][item] {
+		return true
+	}
+	for _, glob := range e.globs[category] {
+		if ok, _ := path.Match(glob, item); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lock 锁定画像并增加版本号，之前报告过的异常在新版本中重新报告
+func (e *profileEntry) lock(now int64) {
+	e.State = ProfileLocked
+	e.LockedAt = now
+	e.UpdatedAt = now
+	e.Version++
+	e.reported = make(map[string]bool)
+	e.dirty = true
+}
+
+// snapshot 返回包含各类别项列表的画像副本，项按字母顺序排列
+func (e *profileEntry) snapshot() Profile {
+	p := e.Profile
+	lists := make([][]string, len(profileCategories))
+	for i := range profileCategories {
+		lists[i] = make([]string, 0, len(e.items[i]))
+		for item := range e.items[i] {
+			lists[i] = append(lists[i], item)
+		}
+		sort.Strings(lists[i])
+		if e.saturated[i] {
+			p.Saturated = append(p.Saturated, profileCategories[i])
+		}
+	}
+	p.Binaries, p.Files = lists[categoryBinary], lists[categoryFile]
+	p.Network, p.Syscalls = lists[categoryNetwork], lists[categorySyscall]
+	return p
+}
+
+// summary 返回画像概要
+func (e *profileEntry) summary() ProfileSummary {
+	s := ProfileSummary{
+		ID:         e.ID,
+		Key:        e.Key,
+		Workload:   e.Workload,
+		State:      e.State,
+		Version:    e.Version,
+		LearnUntil: e.LearnUntil,
+		LastSeen:   e.LastSeen,
+		Anomalies:  e.Anomalies,
+		Items:      make(map[string]int, len(profileCategories)),
+	}
+	for i, name := range profileCategories {
+		s.Items[name] = len(e.items[i])
+	}
+	return s
+}
+
+// list 返回所有画像的概要，按画像键排序
+func (t *profileTracker) list() []ProfileSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	summaries := make([]ProfileSummary, 0, len(t.profiles))
+	for _, e := range t.profiles {
+		summaries = append(summaries, e.summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key < summaries[j].Key })
+	return summaries
+}
+
+// get 返回画像
+func (t *profileTracker) get(id string) (*Profile, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.profiles[id]
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w", id, ErrProfileNotFound)
+	}
+	p := entry.snapshot()
+	return &p, nil
+}
+
+// update 替换画像的项。已锁定的画像版本号加1，之前报告过的异常在新版本中重新报告
+func (t *profileTracker) update(id string, u ProfileUpdate) (*Profile, error) {
+	lists := [...][]string{u.Binaries, u.Files, u.Network, u.Syscalls}
+	for i, list := range lists {
+		clean, err := t.cleanItems(profileCategories[i], list)
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = clean
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.profiles[id]
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w", id, ErrProfileNotFound)
+	}
+	for i, list := range lists {
+		if list == nil {
+			continue
+		}
+		entry.items[i] = make(map[string]bool)
+		entry.globs[i] = nil
+		entry.saturated[i] = false
+		for _, item := range list {
+			entry.add(i, item)
+		}
+	}
+	entry.UpdatedAt = time.Now().Unix()
+	if entry.State == ProfileLocked {
+		entry.Version++
+		entry.reported = make(map[string]bool)
+	}
+	entry.dirty = true
+	t.saveLocked(entry)
+	p := entry.snapshot()
+	return &p, nil
+}
+
+// cleanItems 去除空白和重复项并检查通配符语法，list 为nil时返回nil
+func (t *profileTracker) cleanItems(category string, list []string) ([]string, error) {
+	if list == nil {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	clean := make([]string, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		if _, err := path.Match(item, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", category, item, err)
+		}
+		seen[item] = true
+		clean = append(clean, item)
+	}
+	if len(clean) > t.maxItems {
+		return nil, fmt.Errorf("too many %s items: %d, the limit is %d", category, len(clean), t.maxItems)
+	}
+	return clean, nil
+}
+
+// lock 立即锁定画像
+func (t *profileTracker) lock(id string) (*Profile, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.profiles[id]
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w", id, ErrProfileNotFound)
+	}
+	if entry.State != ProfileLocked {
+		entry.lock(time.Now().Unix())
+		t.saveLocked(entry)
+	}
+	p := entry.snapshot()
+	return &p, nil
+}
+
+// learn 让画像重新进入学习期，window 为0时使用配置的学习期，reset 为true时清空已学习的项
+func (t *profileTracker) learn(id string, window time.Duration, reset bool) (*Profile, error) {
+	if window <= 0 {
+		window = time.Duration(t.window) * time.Second
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := t.profiles[id]
+	if entry == nil {
+		return nil, fmt.Errorf("%s: %w", id, ErrProfileNotFound)
+	}
+	now := time.Now().Unix()
+	entry.State = ProfileLearning
+	entry.LearnUntil = now + int64(window/time.Second)
+	entry.UpdatedAt = now
+	if reset {
+		for i := range profileCategories {
+			entry.items[i] = make(map[string]bool)
+			entry.globs[i] = nil
+			entry.saturated[i] = false
+		}
+	}
+	entry.dirty = true
+	t.saveLocked(entry)
+	p := entry.snapshot()
+	return &p, nil
+}
+
+// delete 删除画像，该工作负载的下一个事件开始新的学习期
+func (t *profileTracker) delete(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.profiles[id] == nil {
+		return fmt.Errorf("%s: %w", id, ErrProfileNotFound)
+	}
+	delete(t.profiles, id)
+	if t.dir != "" {
+		if err := os.Remove(filepath.Join(t.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove profile %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// flush 将有变化的画像写入磁盘
+func (t *profileTracker) flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.profiles {
+		t.saveLocked(e)
+	}
+}
+
+// saveLocked 将有变化的画像写入临时文件后替换，调用方需持有锁。未配置目录时只保存在内存中
+func (t *profileTracker) saveLocked(e *profileEntry) {
+	if t.dir == "" || !e.dirty {
+		return
+	}
+	if err := writeProfile(t.dir, e.snapshot()); err != nil {
+		t.log.Warnf("Failed to save behavior profile %s: %v", e.Key, err)
+		return
+	}
+	e.dirty = false
+}
+
+// writeProfile 写入画像文件
+func writeProfile(dir string, p Profile) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, p.ID+".json")
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// load 读取目录中的画像文件，无法解析的文件被跳过
+func (t *profileTracker) load() (int, error) {
+	files, err := filepath.Glob(filepath.Join(t.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.log.Warnf("Failed to read behavior profile %s: %v", file, err)
+			continue
+		}
+		var p Profile
+		if err := json.Unmarshal(data, &p); err != nil || p.Key == "" {
+			t.log.Warnf("Skipping invalid behavior profile %s", file)
+			continue
+		}
+		p.ID = profileID(p.Key)
+		if p.State != ProfileLocked {
+			p.State = ProfileLearning
+		}
+		t.profiles[p.ID] = newProfileEntry(p)
+	}
+	return len(t.profiles), nil
+}
@@ -0,0 +1,260 @@
+// 内核与用户态之间的事件协议。
+// 每条记录以 struct event_header 开头，后跟与 type 对应的负载；
+// Go 端的镜像定义在 internal/ebpf/protocol.go，两边的字段和布局必须同步修改，
+// 不兼容的改动需要递增 EVENT_PROTOCOL_VERSION
+#ifndef __CLOUDBREACH_EVENTS_H
+#define __CLOUDBREACH_EVENTS_H
+
+#define EVENT_PROTOCOL_VERSION 6
+
+#define TASK_COMM_LEN 16
+#define MAX_PATH_LEN 256
+#define MAX_MOUNT_SOURCE_LEN 128
+#define MAX_FSTYPE_LEN 32
+#define MAX_UNIX_PATH_LEN 108
+
+// execve 参数：最多采集 MAX_ARGS 个，每个最长 MAX_ARG_LEN，总长度不超过 MAX_ARGS_LEN
+#define MAX_ARGS 16
+#define MAX_ARG_LEN 128
+#define MAX_ARGS_LEN 512
+
+// 单条记录的最大长度，用于perf回退模式下的暂存区
+#define MAX_RECORD_SIZE 1024
+
+// 记录类型
+#define RECORD_EXEC 1
+#define RECORD_OPEN 2
+#define RECORD_CONNECT 3
+#define RECORD_MOUNT 4
+#define RECORD_SETUID 5
+#define RECORD_PTRACE 6
+#define RECORD_CREDS 7
+#define RECORD_FORK 8
+#define RECORD_EXIT 9
+#define RECORD_ACCEPT 10
+#define RECORD_UDP_SEND 11
+#define RECORD_SETNS 12
+#define RECORD_MODULE 13
+#define RECORD_UNIX_CONNECT 14
+#define RECORD_CAPABILITY 15
+#define RECORD_RENAME 16
+#define RECORD_UNLINK 17
+#define RECORD_WRITE 18
+#define RECORD_BLOCKED 19
+
+// 公共头部，56字节
+struct event_header {
+    __u16 type;
+    __u16 version;
+    __u32 pid;
+    __u32 tid;
+    __u32 ppid;
+    __u32 uid;
+    __u32 gid;
+    __u64 timestamp;  // bpf_ktime_get_ns，CLOCK_MONOTONIC
+    __u64 cgroup_id;
+    char comm[TASK_COMM_LEN];
+};
+
+struct exec_record {
+    struct event_header hdr;
+    char filename[MAX_PATH_LEN];
+    __u32 argc;
+    __u32 args_size;          // args 中有效字节数
+    char args[MAX_ARGS_LEN];  // 以NUL分隔的参数
+};
+
+// 相对路径由用户态根据 dirfd 解析，dirfd 为 AT_FDCWD 时相对于工作目录
+struct open_record {
+    struct event_header hdr;
+    __s32 flags;
+    __u32 mode;
+    __s32 dirfd;
+    __u32 _pad;
+    char filename[MAX_PATH_LEN];
+};
+
+// rename、renameat 和 renameat2，flags 为 RENAME_* 标志
+struct rename_record {
+    struct event_header hdr;
+    __s32 olddirfd;
+    __s32 newdirfd;
+    __u32 flags;
+    __u32 _pad;
+    char oldname[MAX_PATH_LEN];
+    char newname[MAX_PATH_LEN];
+};
+
+// unlink 和 unlinkat，flags 含 AT_REMOVEDIR 时删除的是目录
+struct unlink_record {
+    struct event_header hdr;
+    __s32 dirfd;
+    __u32 flags;
+    char filename[MAX_PATH_LEN];
+};
+
+// 对监视文件的首次写入，每次打开只上报一次。flags 和 filename 为打开时的参数
+struct write_record {
+    struct event_header hdr;
+    __s32 fd;
+    __s32 flags;
+    char filename[MAX_PATH_LEN];
+};
+
+// TCP连接建立、接受和UDP发送共用的五元组记录，
+// 地址和端口均从本端视角填写：local 为本端，remote 为对端
+struct net_record {
+    struct event_header hdr;
+    __u16 family;
+    __u16 lport;        // 主机字节序，UDP未绑定时为0
+    __u16 rport;        // 主机字节序
+    __u8 protocol;      // IPPROTO_TCP 或 IPPROTO_UDP
+    __u8 _pad0;
+    __u8 laddr[16];     // IPv4 占前4字节
+    __u8 raddr[16];
+    __u32 bytes;        // UDP：距上次上报以来发送的字节数
+    __u32 _pad;
+};
+
+struct mount_record {
+    struct event_header hdr;
+    __u64 flags;
+    char source[MAX_MOUNT_SOURCE_LEN];
+    char target[MAX_PATH_LEN];
+    char fstype[MAX_FSTYPE_LEN];
+};
+
+struct setuid_record {
+    struct event_header hdr;
+    __u32 uid;
+    __u32 _pad;
+};
+
+struct ptrace_record {
+    struct event_header hdr;
+    __s64 request;
+    __u32 target_pid;
+    __u32 _pad;
+};
+
+struct creds_record {
+    struct event_header hdr;
+    __u32 old_uid;
+    __u32 new_uid;
+};
+
+// 进程创建，头部为父进程。只上报新进程，不上报新线程
+struct fork_record {
+    struct event_header hdr;
+    __u32 child_pid;
+    __u32 _pad;
+};
+
+// 进程退出，头部为退出的进程。只上报线程组leader
+struct exit_record {
+    struct event_header hdr;
+    __s32 exit_code;
+    __u32 _pad;
+};
+
+// setns 成功后当前任务所在的命名空间inode号，由用户态与宿主机命名空间比较
+struct setns_record {
+    struct event_header hdr;
+    __u32 mnt_ns;
+    __u32 pid_ns;       // pid_ns_for_children，setns 只影响之后创建的子进程
+    __u32 net_ns;
+    __u32 uts_ns;
+    __u32 ipc_ns;
+    __u32 cgroup_ns;
+};
+
+// 加载内核模块。init_module 的 fd 为 -1，finit_module 的 len 为0
+struct module_record {
+    struct event_header hdr;
+    __s32 fd;
+    __u32 flags;
+    __u64 len;
+};
+
+// 连接unix socket。抽象socket的路径以NUL开头
+struct unix_connect_record {
+    struct event_header hdr;
+    __u32 path_len;
+    char path[MAX_UNIX_PATH_LEN];
+};
+
+// 针对初始用户命名空间的能力检查，ret 为0表示允许
+struct capability_record {
+    struct event_header hdr;
+    __s32 cap;
+    __s32 ret;
+};
+
+// 内核侧过滤和限流：配置和过滤表由用户态写入，更新时无需重新加载程序。
+// 只作用于高频的文件打开和网络记录，进程生命周期和提权、逃逸相关的记录总是上报
+#define MAX_FILTER_PATH_LEN 128
+#define MAX_FILTER_ENTRIES 1024
+
+// 过滤表的值
+#define FILTER_ALLOW 1
+#define FILTER_DENY 2
+
+// filter_config.flags：对应维度配置了允许列表，未命中允许项的记录被丢弃
+#define FILTER_ALLOWLIST_PATH (1 << 0)
+#define FILTER_ALLOWLIST_COMM (1 << 1)
+#define FILTER_ALLOWLIST_UID (1 << 2)
+#define FILTER_ALLOWLIST_CGROUP (1 << 3)
+// 路径过滤表非空，为0时跳过读取路径
+#define FILTER_PATHS (1 << 4)
+
+struct filter_config {
+    __u32 flags;
+    __u32 _pad;
+    __u64 rate;   // 每个cgroup每秒允许上报的记录数，0 表示不限流
+    __u64 burst;  // 令牌桶容量
+};
+
+// 路径前缀过滤表的键，prefixlen 以位为单位
+struct path_filter_key {
+    __u32 prefixlen;
+    char path[MAX_FILTER_PATH_LEN];
+};
+
+// filter_stats 的下标，每项为每CPU计数
+#define FILTER_STAT_PATH 0
+#define FILTER_STAT_COMM 1
+#define FILTER_STAT_UID 2
+#define FILTER_STAT_CGROUP 3
+#define FILTER_STAT_THROTTLED 4
+#define FILTER_STAT_MAX 5
+
+// 文件完整性监视：路径前缀表由用户态写入，键与 path_filter 相同。
+// 命中的路径不受过滤和限流影响；以写方式打开时跟踪返回的文件描述符，
+// 首次写入时上报 write_record，关闭时停止跟踪
+#define MAX_FIM_ENTRIES 1024
+#define MAX_FIM_FDS 8192
+
+struct fim_fd_key {
+    __u32 tgid;
+    __s32 fd;
+};
+
+struct fim_fd {
+    __s32 flags;
+    __u32 written;
+    char filename[MAX_PATH_LEN];
+};
+
+// 连接阻断：表由响应动作写入，BPF LSM 的 socket_connect 钩子拒绝命中的连接，
+// 并以 net_record（RECORD_BLOCKED）上报被拒绝的连接。port 为0的项阻断该地址的所有端口
+#define MAX_BLOCK_ENTRIES 4096
+
+struct block_key {
+    __u64 cgroup_id;
+    __u16 family;
+    __u16 port;     // 主机字节序
+    __u32 _pad;
+    __u8 addr[16];  // IPv4 占前4字节
+};
+
+#endif /* __CLOUDBREACH_EVENTS_H */
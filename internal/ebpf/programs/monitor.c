@@ -1,229 +1,1030 @@
-#include <linux/bpf.h>
-#include <linux/ptrace.h>
-#include <linux/sched.h>
-#include <linux/fs.h>
-#include <linux/uaccess.h>
+// CO-RE 监控程序，字段偏移在加载时根据内核BTF重定位，同一对象文件可在不同内核版本上运行。
+// vmlinux.h 由 bpftool 从内核BTF生成，见 monitor.go 中的 go:generate 指令。
+// 程序只采集事实，严重程度判断在用户态完成（internal/ebpf/protocol.go）
+#include "vmlinux.h"
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_tracing.h>
 #include <bpf/bpf_core_read.h>
+#include <bpf/bpf_endian.h>
 
-#define TASK_COMM_LEN 16
-#define MAX_FILENAME_LEN 256
-#define MAX_CONTAINER_ID_LEN 64
-
-// 事件类型定义
-#define EVENT_SYSCALL 1
-#define EVENT_FILE_ACCESS 2
-#define EVENT_NETWORK 3
-#define EVENT_PROCESS 4
-
-// 严重程度定义
-#define SEVERITY_LOW 1
-#define SEVERITY_MEDIUM 2
-#define SEVERITY_HIGH 3
-#define SEVERITY_CRITICAL 4
-
-// 事件结构体
-struct event {
-    __u64 timestamp;
-    __u32 pid;
-    __u32 tid;
-    __u32 uid;
-    __u32 gid;
-    char comm[TASK_COMM_LEN];
-    char filename[MAX_FILENAME_LEN];
-    __u32 event_type;
-    __u32 severity;
-    char description[128];
-    char container_id[MAX_CONTAINER_ID_LEN];
-};
+#include "events.h"
+
+#define AF_UNIX 1
+#define AF_INET 2
+#define AF_INET6 10
+
+#define EPERM 1
+
+#define AT_FDCWD -100
+#define O_ACCMODE 00000003
+#define O_RDONLY 00000000
+#define O_CREAT 00000100
+#define O_TRUNC 00001000
+
+// 由用户态在加载前改写：内核支持ring buffer时为1，否则 events 被替换为perf事件数组
+const volatile __u32 use_ringbuf = 1;
 
 // BPF Maps定义
 struct {
-    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
-    __uint(key_size, sizeof(__u32));
-    __uint(value_size, sizeof(__u32));
+    __uint(type, BPF_MAP_TYPE_RINGBUF);
+    __uint(max_entries, 4 * 1024 * 1024);
 } events SEC(".maps");
 
+// perf回退模式下的每CPU暂存区
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, MAX_RECORD_SIZE);
+} heap SEC(".maps");
+
+// 缓冲区已满导致未能提交的记录数
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, __u64);
+} lost SEC(".maps");
+
+// 辅助函数：累加丢失计数
+static __always_inline void count_lost(void) {
+    __u32 zero = 0;
+    __u64 *count = bpf_map_lookup_elem(&lost, &zero);
+    if (count)
+        __sync_fetch_and_add(count, 1);
+}
+
+// 辅助函数：申请记录空间
+static __always_inline void *reserve_record(__u32 size) {
+    __u32 zero = 0;
+    void *buf;
+
+    if (use_ringbuf)
+        buf = bpf_ringbuf_reserve(&events, size, 0);
+    else
+        buf = bpf_map_lookup_elem(&heap, &zero);
+
+    if (!buf)
+        count_lost();
+    return buf;
+}
+
+// 辅助函数：提交记录
+static __always_inline void submit_record(void *ctx, void *buf, __u32 size) {
+    if (use_ringbuf) {
+        bpf_ringbuf_submit(buf, 0);
+        return;
+    }
+    if (bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, buf, size) < 0)
+        count_lost();
+}
+
+// 辅助函数：填充公共头部。ring buffer 中的空间不会被清零，所有字段都需要显式赋值
+static __always_inline void fill_header(struct event_header *hdr, __u16 type) {
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    __u64 uid_gid = bpf_get_current_uid_gid();
+
+    hdr->type = type;
+    hdr->version = EVENT_PROTOCOL_VERSION;
+    hdr->pid = pid_tgid >> 32;
+    hdr->tid = (__u32)pid_tgid;
+    hdr->ppid = BPF_CORE_READ(task, real_parent, tgid);
+    hdr->uid = (__u32)uid_gid;
+    hdr->gid = uid_gid >> 32;
+    hdr->timestamp = bpf_ktime_get_ns();
+    hdr->cgroup_id = bpf_get_current_cgroup_id();
+    bpf_get_current_comm(hdr->comm, sizeof(hdr->comm));
+}
+
+// 过滤配置，只有一个元素
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct filter_config);
+} filter_config SEC(".maps");
+
+// 路径前缀过滤，最长前缀匹配的项生效
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_FILTER_ENTRIES);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct path_filter_key);
+    __type(value, __u8);
+} path_filter SEC(".maps");
+
+// 进程名过滤，键为 bpf_get_current_comm 的结果，不足部分以NUL填充
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_FILTER_ENTRIES);
+    __uint(key_size, TASK_COMM_LEN);
+    __uint(value_size, sizeof(__u8));
+} comm_filter SEC(".maps");
+
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
-    __uint(max_entries, 10240);
+    __uint(max_entries, MAX_FILTER_ENTRIES);
     __type(key, __u32);
-    __type(value, struct event);
-} event_cache SEC(".maps");
-
-// 辅助函数：获取容器ID
-static __always_inline int get_container_id(char *container_id) {
-    // 简化实现：从cgroup路径中提取容器ID
-    // 实际实现需要解析/proc/self/cgroup
-    __builtin_memcpy(container_id, "container_demo", 14);
-    return 0;
-}
-
-// 辅助函数：检查是否为可疑行为
-static __always_inline int is_suspicious_syscall(__u32 syscall_nr) {
-    // 监控一些敏感系统调用
-    switch (syscall_nr) {
-        case 2:   // sys_fork
-        case 56:  // sys_clone
-        case 57:  // sys_fork
-        case 59:  // sys_execve
-        case 322: // sys_execveat
-            return SEVERITY_MEDIUM;
-        case 165: // sys_mount
-        case 166: // sys_umount
-        case 155: // sys_pivot_root
-            return SEVERITY_HIGH;
-        case 139: // sys_setfsuid
-        case 140: // sys_setfsgid
-        case 105: // sys_setuid
-        case 106: // sys_setgid
-            return SEVERITY_CRITICAL;
-        default:
-            return 0;
+    __type(value, __u8);
+} uid_filter SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_FILTER_ENTRIES);
+    __type(key, __u64);
+    __type(value, __u8);
+} cgroup_filter SEC(".maps");
+
+// 被过滤和被限流丢弃的记录数
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, FILTER_STAT_MAX);
+    __type(key, __u32);
+    __type(value, __u64);
+} filter_stats SEC(".maps");
+
+// 每个cgroup的令牌桶，tokens 以 1/NSEC_PER_SEC 个令牌为单位，避免除法
+#define NSEC_PER_SEC (1000ULL * 1000 * 1000)
+// 单次补充令牌的最长间隔，防止乘法溢出
+#define MAX_REFILL_NS (60 * NSEC_PER_SEC)
+
+struct rate_bucket {
+    __u64 tokens;
+    __u64 last;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 16384);
+    __type(key, __u64);
+    __type(value, struct rate_bucket);
+} rate_buckets SEC(".maps");
+
+// 辅助函数：累加过滤计数
+static __always_inline void count_filtered(__u32 stat) {
+    __u64 *count = bpf_map_lookup_elem(&filter_stats, &stat);
+    if (count)
+        __sync_fetch_and_add(count, 1);
+}
+
+// 辅助函数：根据过滤表的查找结果判断是否丢弃。拒绝项总是丢弃，
+// 配置了允许列表时未命中允许项的记录也被丢弃
+static __always_inline bool filter_denies(__u8 *action, bool allowlist) {
+    if (action)
+        return *action == FILTER_DENY;
+    return allowlist;
+}
+
+// 辅助函数：按进程名、UID和cgroup过滤当前任务，返回true表示丢弃
+static __always_inline bool filter_task(struct filter_config *cfg) {
+    char comm[TASK_COMM_LEN];
+    bpf_get_current_comm(comm, sizeof(comm));
+    if (filter_denies(bpf_map_lookup_elem(&comm_filter, comm), cfg->flags & FILTER_ALLOWLIST_COMM)) {
+        count_filtered(FILTER_STAT_COMM);
+        return true;
+    }
+
+    __u32 uid = (__u32)bpf_get_current_uid_gid();
+    if (filter_denies(bpf_map_lookup_elem(&uid_filter, &uid), cfg->flags & FILTER_ALLOWLIST_UID)) {
+        count_filtered(FILTER_STAT_UID);
+        return true;
+    }
+
+    __u64 cgroup_id = bpf_get_current_cgroup_id();
+    if (filter_denies(bpf_map_lookup_elem(&cgroup_filter, &cgroup_id), cfg->flags & FILTER_ALLOWLIST_CGROUP)) {
+        count_filtered(FILTER_STAT_CGROUP);
+        return true;
+    }
+    return false;
+}
+
+// 辅助函数：按路径前缀过滤，path 为用户态地址，返回true表示丢弃
+static __always_inline bool filter_path(struct filter_config *cfg, const void *path) {
+    if (!(cfg->flags & FILTER_PATHS))
+        return false;
+
+    // 键清零后读取，NUL之后的部分不参与匹配
+    struct path_filter_key key = {};
+    if (bpf_probe_read_user_str(key.path, sizeof(key.path), path) <= 0)
+        return false;
+    key.prefixlen = MAX_FILTER_PATH_LEN * 8;
+
+    if (filter_denies(bpf_map_lookup_elem(&path_filter, &key), cfg->flags & FILTER_ALLOWLIST_PATH)) {
+        count_filtered(FILTER_STAT_PATH);
+        return true;
+    }
+    return false;
+}
+
+// 辅助函数：按cgroup的令牌桶限流，返回true表示丢弃。
+// 桶的更新没有加锁，多个CPU并发时允许的速率是近似值
+static __always_inline bool rate_limited(struct filter_config *cfg) {
+    if (!cfg->rate)
+        return false;
+
+    __u64 cgroup_id = bpf_get_current_cgroup_id();
+    __u64 now = bpf_ktime_get_ns();
+    __u64 capacity = cfg->burst * NSEC_PER_SEC;
+    struct rate_bucket *bucket = bpf_map_lookup_elem(&rate_buckets, &cgroup_id);
+    if (!bucket) {
+        struct rate_bucket init = {.tokens = capacity - NSEC_PER_SEC, .last = now};
+        bpf_map_update_elem(&rate_buckets, &cgroup_id, &init, BPF_NOEXIST);
+        return false;
+    }
+
+    __u64 elapsed = now > bucket->last ? now - bucket->last : 0;
+    if (elapsed > MAX_REFILL_NS)
+        elapsed = MAX_REFILL_NS;
+    __u64 tokens = bucket->tokens + elapsed * cfg->rate;
+    if (tokens > capacity)
+        tokens = capacity;
+    bucket->last = now;
+
+    if (tokens < NSEC_PER_SEC) {
+        bucket->tokens = tokens;
+        count_filtered(FILTER_STAT_THROTTLED);
+        return true;
     }
+    bucket->tokens = tokens - NSEC_PER_SEC;
+    return false;
 }
 
-// 系统调用入口点监控
-SEC("tp/syscalls/sys_enter_openat")
+// 辅助函数：判断是否跳过当前记录。先过滤再限流，被过滤的记录不消耗令牌
+static __always_inline bool skip_record(const void *user_path) {
+    __u32 zero = 0;
+    struct filter_config *cfg = bpf_map_lookup_elem(&filter_config, &zero);
+    if (!cfg)
+        return false;
+
+    if (filter_task(cfg))
+        return true;
+    if (user_path && filter_path(cfg, user_path))
+        return true;
+    return rate_limited(cfg);
+}
+
+// 文件完整性监视的路径前缀
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __uint(max_entries, MAX_FIM_ENTRIES);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __type(key, struct path_filter_key);
+    __type(value, __u8);
+} fim_watch SEC(".maps");
+
+// 以写方式打开监视文件时，从进入到返回之间暂存打开参数，键为 pid_tgid
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 1024);
+    __type(key, __u64);
+    __type(value, struct fim_fd);
+} fim_pending SEC(".maps");
+
+// 正在跟踪的监视文件描述符
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, MAX_FIM_FDS);
+    __type(key, struct fim_fd_key);
+    __type(value, struct fim_fd);
+} fim_fds SEC(".maps");
+
+// 匹配路径和暂存打开参数用的每CPU空间，避免占用栈
+struct fim_scratch {
+    struct path_filter_key key;
+    struct fim_fd pending;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, __u32);
+    __type(value, struct fim_scratch);
+} fim_scratch SEC(".maps");
+
+// 辅助函数：路径是否命中监视前缀，path 为用户态地址。
+// 上次读取残留在NUL之后的字节不影响匹配：更长的前缀要求NUL所在位置是非NUL字符
+static __always_inline bool fim_watched(const void *path) {
+    __u32 zero = 0;
+    struct fim_scratch *s = bpf_map_lookup_elem(&fim_scratch, &zero);
+    if (!s)
+        return false;
+    if (bpf_probe_read_user_str(s->key.path, sizeof(s->key.path), path) <= 0)
+        return false;
+    s->key.prefixlen = MAX_FILTER_PATH_LEN * 8;
+    return bpf_map_lookup_elem(&fim_watch, &s->key) != NULL;
+}
+
+// 辅助函数：以写方式打开监视文件时暂存参数，返回时再关联文件描述符
+static __always_inline void fim_track_open(const void *path, __s32 flags) {
+    if ((flags & O_ACCMODE) == O_RDONLY && !(flags & (O_CREAT | O_TRUNC)))
+        return;
+
+    __u32 zero = 0;
+    struct fim_scratch *s = bpf_map_lookup_elem(&fim_scratch, &zero);
+    if (!s)
+        return;
+    s->pending.flags = flags;
+    s->pending.written = 0;
+    if (bpf_probe_read_user_str(s->pending.filename, sizeof(s->pending.filename), path) <= 0)
+        return;
+
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    bpf_map_update_elem(&fim_pending, &pid_tgid, &s->pending, BPF_ANY);
+}
+
+// 辅助函数：读取用户态字符串，失败时置为空串
+static __always_inline void read_user_str(char *dst, __u32 size, const void *src) {
+    if (bpf_probe_read_user_str(dst, size, src) < 0)
+        dst[0] = '\0';
+}
+
+// 辅助函数：读取 argv，参数以NUL分隔依次存放，超出缓冲区的部分被截断
+static __always_inline void read_args(struct exec_record *r, const char *const *argv) {
+    __u32 off = 0;
+
+    r->argc = 0;
+#pragma unroll
+    for (int i = 0; i < MAX_ARGS; i++) {
+        const char *arg = NULL;
+        if (bpf_probe_read_user(&arg, sizeof(arg), &argv[i]) < 0 || !arg)
+            break;
+        if (off > MAX_ARGS_LEN - MAX_ARG_LEN)
+            break;
+        long n = bpf_probe_read_user_str(&r->args[off], MAX_ARG_LEN, arg);
+        if (n <= 0)
+            break;
+        off += n;
+        r->argc++;
+    }
+    r->args_size = off;
+}
+
+// 进程执行监控
+SEC("tracepoint/syscalls/sys_enter_execve")
+int trace_execve_enter(struct trace_event_raw_sys_enter *ctx) {
+    struct exec_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_EXEC);
+    read_user_str(r->filename, sizeof(r->filename), (const void *)ctx->args[0]);
+    read_args(r, (const char *const *)ctx->args[1]);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 进程创建：用于维护用户态进程表，参数为父子进程的 task_struct
+SEC("raw_tracepoint/sched_process_fork")
+int trace_sched_fork(struct bpf_raw_tracepoint_args *ctx) {
+    struct task_struct *child = (struct task_struct *)ctx->args[1];
+
+    // 新线程与创建者属于同一线程组，不是新进程
+    __u32 child_pid = BPF_CORE_READ(child, pid);
+    __u32 child_tgid = BPF_CORE_READ(child, tgid);
+    if (child_pid != child_tgid)
+        return 0;
+
+    struct fork_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_FORK);
+    r->child_pid = child_tgid;
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 进程退出：用于维护用户态进程表
+SEC("tracepoint/sched/sched_process_exit")
+int trace_sched_exit(struct trace_event_raw_sched_process_template *ctx) {
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    if ((pid_tgid >> 32) != (__u32)pid_tgid)
+        return 0;
+
+    struct exit_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_EXIT);
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    r->exit_code = BPF_CORE_READ(task, exit_code);
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 文件访问监控。监视的文件总是上报，以写方式打开时开始跟踪文件描述符
+SEC("tracepoint/syscalls/sys_enter_openat")
 int trace_openat_enter(struct trace_event_raw_sys_enter *ctx) {
-    struct event event = {};
-    struct task_struct *task;
-    
-    // 获取当前任务信息
-    task = (struct task_struct *)bpf_get_current_task();
-    
-    event.timestamp = bpf_ktime_get_ns();
-    event.pid = bpf_get_current_pid_tgid() >> 32;
-    event.tid = bpf_get_current_pid_tgid() & 0xFFFFFFFF;
-    event.uid = bpf_get_current_uid_gid() >> 32;
-    event.gid = bpf_get_current_uid_gid() & 0xFFFFFFFF;
-    
-    bpf_get_current_comm(&event.comm, sizeof(event.comm));
-    
-    // 获取文件名
-    char *filename_ptr = (char *)ctx->args[1];
-    bpf_probe_read_user_str(event.filename, sizeof(event.filename), filename_ptr);
-    
-    event.event_type = EVENT_FILE_ACCESS;
-    event.severity = SEVERITY_LOW;
-    
-    // 检查是否访问敏感文件
-    if (bpf_strncmp(event.filename, "/etc/passwd", 11) == 0 ||
-        bpf_strncmp(event.filename, "/etc/shadow", 11) == 0 ||
-        bpf_strncmp(event.filename, "/etc/sudoers", 12) == 0) {
-        event.severity = SEVERITY_HIGH;
-        __builtin_memcpy(event.description, "Sensitive file access", 22);
-    } else if (bpf_strncmp(event.filename, "/proc/", 6) == 0) {
-        event.severity = SEVERITY_MEDIUM;
-        __builtin_memcpy(event.description, "Proc filesystem access", 23);
+    const void *path = (const void *)ctx->args[1];
+    __s32 flags = (__s32)ctx->args[2];
+
+    if (fim_watched(path))
+        fim_track_open(path, flags);
+    else if (skip_record(path))
+        return 0;
+
+    struct open_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_OPEN);
+    r->flags = flags;
+    r->mode = (__u32)ctx->args[3];
+    r->dirfd = (__s32)ctx->args[0];
+    r->_pad = 0;
+    read_user_str(r->filename, sizeof(r->filename), path);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 打开监视文件成功后记录返回的文件描述符
+SEC("tracepoint/syscalls/sys_exit_openat")
+int trace_openat_exit(struct trace_event_raw_sys_exit *ctx) {
+    __u64 pid_tgid = bpf_get_current_pid_tgid();
+    struct fim_fd *pending = bpf_map_lookup_elem(&fim_pending, &pid_tgid);
+    if (!pending)
+        return 0;
+
+    if (ctx->ret >= 0) {
+        struct fim_fd_key key = {.tgid = pid_tgid >> 32, .fd = (__s32)ctx->ret};
+        bpf_map_update_elem(&fim_fds, &key, pending, BPF_ANY);
+    }
+    bpf_map_delete_elem(&fim_pending, &pid_tgid);
+    return 0;
+}
+
+// 辅助函数：对跟踪中的文件描述符首次写入时上报
+static __always_inline int fim_write(void *ctx, __s32 fd) {
+    struct fim_fd_key key = {.tgid = bpf_get_current_pid_tgid() >> 32, .fd = fd};
+    struct fim_fd *tracked = bpf_map_lookup_elem(&fim_fds, &key);
+    if (!tracked || tracked->written)
+        return 0;
+    tracked->written = 1;
+
+    struct write_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_WRITE);
+    r->fd = fd;
+    r->flags = tracked->flags;
+    bpf_probe_read_kernel_str(r->filename, sizeof(r->filename), tracked->filename);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_write")
+int trace_write_enter(struct trace_event_raw_sys_enter *ctx) {
+    return fim_write(ctx, (__s32)ctx->args[0]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_pwrite64")
+int trace_pwrite64_enter(struct trace_event_raw_sys_enter *ctx) {
+    return fim_write(ctx, (__s32)ctx->args[0]);
+}
+
+SEC("tracepoint/syscalls/sys_enter_writev")
+int trace_writev_enter(struct trace_event_raw_sys_enter *ctx) {
+    return fim_write(ctx, (__s32)ctx->args[0]);
+}
+
+// 关闭文件描述符后停止跟踪，fd号可能被复用
+SEC("tracepoint/syscalls/sys_enter_close")
+int trace_close_enter(struct trace_event_raw_sys_enter *ctx) {
+    struct fim_fd_key key = {.tgid = bpf_get_current_pid_tgid() >> 32, .fd = (__s32)ctx->args[0]};
+    bpf_map_delete_elem(&fim_fds, &key);
+    return 0;
+}
+
+// 辅助函数：上报重命名。任一路径命中监视前缀时不受过滤和限流影响
+static __always_inline int submit_rename(void *ctx, __s32 olddirfd, const void *oldname,
+                                         __s32 newdirfd, const void *newname, __u32 flags) {
+    if (!fim_watched(oldname) && !fim_watched(newname) && skip_record(oldname))
+        return 0;
+
+    struct rename_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_RENAME);
+    r->olddirfd = olddirfd;
+    r->newdirfd = newdirfd;
+    r->flags = flags;
+    r->_pad = 0;
+    read_user_str(r->oldname, sizeof(r->oldname), oldname);
+    read_user_str(r->newname, sizeof(r->newname), newname);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 旧的 rename 和 unlink 系统调用不是所有架构都有，挂载失败时跳过
+SEC("tracepoint/syscalls/sys_enter_rename")
+int trace_rename_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_rename(ctx, AT_FDCWD, (const void *)ctx->args[0], AT_FDCWD, (const void *)ctx->args[1], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_renameat")
+int trace_renameat_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_rename(ctx, (__s32)ctx->args[0], (const void *)ctx->args[1],
+                         (__s32)ctx->args[2], (const void *)ctx->args[3], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_renameat2")
+int trace_renameat2_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_rename(ctx, (__s32)ctx->args[0], (const void *)ctx->args[1],
+                         (__s32)ctx->args[2], (const void *)ctx->args[3], (__u32)ctx->args[4]);
+}
+
+// 辅助函数：上报删除
+static __always_inline int submit_unlink(void *ctx, __s32 dirfd, const void *path, __u32 flags) {
+    if (!fim_watched(path) && skip_record(path))
+        return 0;
+
+    struct unlink_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_UNLINK);
+    r->dirfd = dirfd;
+    r->flags = flags;
+    read_user_str(r->filename, sizeof(r->filename), path);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_unlink")
+int trace_unlink_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_unlink(ctx, AT_FDCWD, (const void *)ctx->args[0], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_unlinkat")
+int trace_unlinkat_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_unlink(ctx, (__s32)ctx->args[0], (const void *)ctx->args[1], (__u32)ctx->args[2]);
+}
+
+// 辅助函数：从 sock 读取本端和对端地址，family 须为 AF_INET 或 AF_INET6
+static __always_inline void read_sock_addrs(struct sock *sk, __u16 family, __u8 *laddr, __u8 *raddr) {
+    __builtin_memset(laddr, 0, 16);
+    __builtin_memset(raddr, 0, 16);
+    if (family == AF_INET) {
+        __u32 *l4 = (__u32 *)laddr, *r4 = (__u32 *)raddr;
+        BPF_CORE_READ_INTO(l4, sk, __sk_common.skc_rcv_saddr);
+        BPF_CORE_READ_INTO(r4, sk, __sk_common.skc_daddr);
     } else {
-        __builtin_memcpy(event.description, "File access", 12);
+        struct in6_addr *l6 = (struct in6_addr *)laddr, *r6 = (struct in6_addr *)raddr;
+        BPF_CORE_READ_INTO(l6, sk, __sk_common.skc_v6_rcv_saddr);
+        BPF_CORE_READ_INTO(r6, sk, __sk_common.skc_v6_daddr);
     }
-    
-    get_container_id(event.container_id);
-    
-    // 发送事件
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &event, sizeof(event));
-    
+}
+
+// 辅助函数：上报已建立五元组的TCP连接
+static __always_inline int submit_tcp(void *ctx, struct sock *sk, __u16 type) {
+    __u16 family = BPF_CORE_READ(sk, __sk_common.skc_family);
+    // 只关注IP连接，忽略unix socket等
+    if (family != AF_INET && family != AF_INET6)
+        return 0;
+    if (skip_record(NULL))
+        return 0;
+
+    struct net_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, type);
+    r->family = family;
+    r->protocol = IPPROTO_TCP;
+    r->_pad0 = 0;
+    r->lport = BPF_CORE_READ(sk, __sk_common.skc_num);
+    r->rport = bpf_ntohs(BPF_CORE_READ(sk, __sk_common.skc_dport));
+    read_sock_addrs(sk, family, r->laddr, r->raddr);
+    r->bytes = 0;
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
     return 0;
 }
 
-// 进程创建监控
-SEC("tp/syscalls/sys_enter_execve")
-int trace_execve_enter(struct trace_event_raw_sys_enter *ctx) {
-    struct event event = {};
-    
-    event.timestamp = bpf_ktime_get_ns();
-    event.pid = bpf_get_current_pid_tgid() >> 32;
-    event.tid = bpf_get_current_pid_tgid() & 0xFFFFFFFF;
-    event.uid = bpf_get_current_uid_gid() >> 32;
-    event.gid = bpf_get_current_uid_gid() & 0xFFFFFFFF;
-    
-    bpf_get_current_comm(&event.comm, sizeof(event.comm));
-    
-    // 获取执行的程序名
-    char *filename_ptr = (char *)ctx->args[0];
-    bpf_probe_read_user_str(event.filename, sizeof(event.filename), filename_ptr);
-    
-    event.event_type = EVENT_PROCESS;
-    event.severity = SEVERITY_MEDIUM;
-    
-    // 检查是否为可疑程序
-    if (bpf_strncmp(event.filename, "/bin/sh", 7) == 0 ||
-        bpf_strncmp(event.filename, "/bin/bash", 9) == 0) {
-        if (event.uid == 0) {
-            event.severity = SEVERITY_HIGH;
-            __builtin_memcpy(event.description, "Root shell execution", 20);
-        } else {
-            __builtin_memcpy(event.description, "Shell execution", 15);
+// TCP主动连接：tcp_connect 调用时本端地址和端口已经分配，SYN尚未发出
+SEC("kprobe/tcp_connect")
+int BPF_KPROBE(trace_tcp_connect, struct sock *sk) {
+    return submit_tcp(ctx, sk, RECORD_CONNECT);
+}
+
+// TCP被动连接：inet_csk_accept 返回已完成握手的新连接
+SEC("kretprobe/inet_csk_accept")
+int BPF_KRETPROBE(trace_tcp_accept, struct sock *sk) {
+    if (!sk)
+        return 0;
+    return submit_tcp(ctx, sk, RECORD_ACCEPT);
+}
+
+// UDP发送按进程和目的地址限流，同一目的地址每个周期最多上报一次，期间的字节数累加到下一次上报
+#define UDP_REPORT_INTERVAL_NS (1000ULL * 1000 * 1000)
+
+struct udp_flow_key {
+    __u32 pid;
+    __u16 family;
+    __u16 rport;
+    __u8 raddr[16];
+};
+
+struct udp_flow_state {
+    __u64 last_report;
+    __u64 bytes;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 16384);
+    __type(key, struct udp_flow_key);
+    __type(value, struct udp_flow_state);
+} udp_flows SEC(".maps");
+
+// 辅助函数：UDP发送。未连接的socket从 msg_name 取目的地址，已连接的从 sock 读取
+static __always_inline int submit_udp(void *ctx, struct sock *sk, struct msghdr *msg, __u64 len) {
+    struct udp_flow_key key = {};
+    void *name = BPF_CORE_READ(msg, msg_name);
+
+    key.pid = bpf_get_current_pid_tgid() >> 32;
+    if (name) {
+        // sendmsg 已将目的地址复制到内核
+        bpf_probe_read_kernel(&key.family, sizeof(key.family), name);
+        if (key.family == AF_INET) {
+            struct sockaddr_in sin = {};
+            bpf_probe_read_kernel(&sin, sizeof(sin), name);
+            key.rport = bpf_ntohs(sin.sin_port);
+            __builtin_memcpy(key.raddr, &sin.sin_addr.s_addr, 4);
+        } else if (key.family == AF_INET6) {
+            struct sockaddr_in6 sin6 = {};
+            bpf_probe_read_kernel(&sin6, sizeof(sin6), name);
+            key.rport = bpf_ntohs(sin6.sin6_port);
+            __builtin_memcpy(key.raddr, &sin6.sin6_addr, 16);
+        }
+    } else {
+        __u8 laddr[16];
+        key.family = BPF_CORE_READ(sk, __sk_common.skc_family);
+        key.rport = bpf_ntohs(BPF_CORE_READ(sk, __sk_common.skc_dport));
+        if (key.family == AF_INET || key.family == AF_INET6)
+            read_sock_addrs(sk, key.family, laddr, key.raddr);
+    }
+    if ((key.family != AF_INET && key.family != AF_INET6) || key.rport == 0)
+        return 0;
+
+    __u64 now = bpf_ktime_get_ns();
+    __u64 bytes = len;
+    struct udp_flow_state *state = bpf_map_lookup_elem(&udp_flows, &key);
+    if (state) {
+        if (now - state->last_report < UDP_REPORT_INTERVAL_NS) {
+            __sync_fetch_and_add(&state->bytes, len);
+            return 0;
         }
-    } else if (bpf_strncmp(event.filename, "/usr/bin/nc", 11) == 0 ||
-               bpf_strncmp(event.filename, "/bin/nc", 7) == 0) {
-        event.severity = SEVERITY_CRITICAL;
-        __builtin_memcpy(event.description, "Netcat execution detected", 25);
+        bytes += state->bytes;
+        state->bytes = 0;
+        state->last_report = now;
     } else {
-        __builtin_memcpy(event.description, "Process execution", 17);
+        struct udp_flow_state init = {.last_report = now};
+        bpf_map_update_elem(&udp_flows, &key, &init, BPF_ANY);
     }
-    
-    get_container_id(event.container_id);
-    
-    // 发送事件
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &event, sizeof(event));
-    
+    if (skip_record(NULL))
+        return 0;
+
+    struct net_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_UDP_SEND);
+    r->family = key.family;
+    r->protocol = IPPROTO_UDP;
+    r->_pad0 = 0;
+    r->lport = BPF_CORE_READ(sk, __sk_common.skc_num);
+    r->rport = key.rport;
+    __builtin_memset(r->laddr, 0, sizeof(r->laddr));
+    if (key.family == AF_INET) {
+        __u32 *l4 = (__u32 *)r->laddr;
+        BPF_CORE_READ_INTO(l4, sk, __sk_common.skc_rcv_saddr);
+    } else {
+        struct in6_addr *l6 = (struct in6_addr *)r->laddr;
+        BPF_CORE_READ_INTO(l6, sk, __sk_common.skc_v6_rcv_saddr);
+    }
+    __builtin_memcpy(r->raddr, key.raddr, sizeof(r->raddr));
+    r->bytes = bytes > 0xffffffff ? 0xffffffff : (__u32)bytes;
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
     return 0;
 }
 
-// 网络连接监控
-SEC("tp/syscalls/sys_enter_connect")
+// UDP发送监控
+SEC("kprobe/udp_sendmsg")
+int BPF_KPROBE(trace_udp_sendmsg, struct sock *sk, struct msghdr *msg, size_t len) {
+    return submit_udp(ctx, sk, msg, len);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int BPF_KPROBE(trace_udpv6_sendmsg, struct sock *sk, struct msghdr *msg, size_t len) {
+    return submit_udp(ctx, sk, msg, len);
+}
+
+// unix socket 连接监控，用于发现容器内访问容器运行时socket
+SEC("tracepoint/syscalls/sys_enter_connect")
 int trace_connect_enter(struct trace_event_raw_sys_enter *ctx) {
-    struct event event = {};
-    
-    event.timestamp = bpf_ktime_get_ns();
-    event.pid = bpf_get_current_pid_tgid() >> 32;
-    event.tid = bpf_get_current_pid_tgid() & 0xFFFFFFFF;
-    event.uid = bpf_get_current_uid_gid() >> 32;
-    event.gid = bpf_get_current_uid_gid() & 0xFFFFFFFF;
-    
-    bpf_get_current_comm(&event.comm, sizeof(event.comm));
-    
-    event.event_type = EVENT_NETWORK;
-    event.severity = SEVERITY_MEDIUM;
-    __builtin_memcpy(event.description, "Network connection", 18);
-    __builtin_memcpy(event.filename, "network_socket", 14);
-    
-    get_container_id(event.container_id);
-    
-    // 发送事件
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &event, sizeof(event));
-    
+    const struct sockaddr *addr = (const struct sockaddr *)ctx->args[1];
+    __u16 family = 0;
+    bpf_probe_read_user(&family, sizeof(family), &addr->sa_family);
+
+    // IP连接由 tcp_connect 和 udp_sendmsg 探针采集
+    if (family != AF_UNIX)
+        return 0;
+
+    struct unix_connect_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_UNIX_CONNECT);
+    // sun_path 紧跟在 sun_family 之后，长度由 addrlen 决定
+    __u32 len = (__u32)ctx->args[2];
+    len = len > sizeof(family) ? len - sizeof(family) : 0;
+    if (len > MAX_UNIX_PATH_LEN)
+        len = MAX_UNIX_PATH_LEN;
+    __builtin_memset(r->path, 0, sizeof(r->path));
+    if (len > 0 && bpf_probe_read_user(r->path, len, (const char *)addr + sizeof(family)) < 0)
+        len = 0;
+    r->path_len = len;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 连接阻断表，由响应动作在运行时写入
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, MAX_BLOCK_ENTRIES);
+    __type(key, struct block_key);
+    __type(value, __u8);
+} conn_block SEC(".maps");
+
+// 连接阻断：TCP连接和已连接的UDP socket 都经过 socket_connect，
+// 先按端口查找，再查找阻断整个地址的项。被拒绝的连接不会到达 tcp_connect，在这里单独上报
+SEC("lsm/socket_connect")
+int BPF_PROG(block_connect, struct socket *sock, struct sockaddr *address, int addrlen, int ret) {
+    struct block_key key = {};
+    __u16 port;
+
+    if (ret)
+        return ret;
+
+    key.family = BPF_CORE_READ(address, sa_family);
+    if (key.family == AF_INET) {
+        struct sockaddr_in *in = (struct sockaddr_in *)address;
+        key.port = bpf_ntohs(BPF_CORE_READ(in, sin_port));
+        bpf_probe_read_kernel(key.addr, 4, &in->sin_addr);
+    } else if (key.family == AF_INET6) {
+        struct sockaddr_in6 *in6 = (struct sockaddr_in6 *)address;
+        key.port = bpf_ntohs(BPF_CORE_READ(in6, sin6_port));
+        bpf_probe_read_kernel(key.addr, 16, &in6->sin6_addr);
+    } else {
+        return 0;
+    }
+    key.cgroup_id = bpf_get_current_cgroup_id();
+
+    port = key.port;
+    if (!bpf_map_lookup_elem(&conn_block, &key)) {
+        key.port = 0;
+        if (!bpf_map_lookup_elem(&conn_block, &key))
+            return 0;
+    }
+
+    struct net_record *r = reserve_record(sizeof(*r));
+    if (r) {
+        fill_header(&r->hdr, RECORD_BLOCKED);
+        r->family = key.family;
+        r->lport = 0;
+        r->rport = port;
+        r->protocol = BPF_CORE_READ(sock, type) == SOCK_STREAM ? IPPROTO_TCP : IPPROTO_UDP;
+        r->_pad0 = 0;
+        __builtin_memset(r->laddr, 0, sizeof(r->laddr));
+        __builtin_memcpy(r->raddr, key.addr, sizeof(r->raddr));
+        r->bytes = 0;
+        r->_pad = 0;
+        submit_record(ctx, r, sizeof(*r));
+    }
+    return -EPERM;
+}
+
+// 文件系统挂载监控
+SEC("tracepoint/syscalls/sys_enter_mount")
+int trace_mount_enter(struct trace_event_raw_sys_enter *ctx) {
+    struct mount_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_MOUNT);
+    r->flags = ctx->args[3];
+    read_user_str(r->source, sizeof(r->source), (const void *)ctx->args[0]);
+    read_user_str(r->target, sizeof(r->target), (const void *)ctx->args[1]);
+    read_user_str(r->fstype, sizeof(r->fstype), (const void *)ctx->args[2]);
+
+    submit_record(ctx, r, sizeof(*r));
     return 0;
 }
 
 // 权限提升监控
-SEC("tp/syscalls/sys_enter_setuid")
+SEC("tracepoint/syscalls/sys_enter_setuid")
 int trace_setuid_enter(struct trace_event_raw_sys_enter *ctx) {
-    struct event event = {};
-    
-    event.timestamp = bpf_ktime_get_ns();
-    event.pid = bpf_get_current_pid_tgid() >> 32;
-    event.tid = bpf_get_current_pid_tgid() & 0xFFFFFFFF;
-    event.uid = bpf_get_current_uid_gid() >> 32;
-    event.gid = bpf_get_current_uid_gid() & 0xFFFFFFFF;
-    
-    bpf_get_current_comm(&event.comm, sizeof(event.comm));
-    
-    event.event_type = EVENT_SYSCALL;
-    event.severity = SEVERITY_CRITICAL;
-    __builtin_memcpy(event.description, "UID change attempt", 18);
-    __builtin_memcpy(event.filename, "setuid_syscall", 14);
-    
-    get_container_id(event.container_id);
-    
-    // 发送事件
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &event, sizeof(event));
-    
-    return 0;
-}
-
-char _license[] SEC("license") = "GPL";
\ No newline at end of file
+    struct setuid_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_SETUID);
+    r->uid = (__u32)ctx->args[0];
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 进程调试/注入监控
+SEC("tracepoint/syscalls/sys_enter_ptrace")
+int trace_ptrace_enter(struct trace_event_raw_sys_enter *ctx) {
+    struct ptrace_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_PTRACE);
+    r->request = (__s64)ctx->args[0];
+    r->target_pid = (__u32)ctx->args[1];
+    r->_pad = 0;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 命名空间切换监控：nsenter 等工具通过 setns 进入其他进程的命名空间
+SEC("tracepoint/syscalls/sys_exit_setns")
+int trace_setns_exit(struct trace_event_raw_sys_exit *ctx) {
+    if (ctx->ret != 0)
+        return 0;
+
+    struct setns_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_SETNS);
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct nsproxy *nsp = BPF_CORE_READ(task, nsproxy);
+    r->mnt_ns = BPF_CORE_READ(nsp, mnt_ns, ns.inum);
+    r->pid_ns = BPF_CORE_READ(nsp, pid_ns_for_children, ns.inum);
+    r->net_ns = BPF_CORE_READ(nsp, net_ns, ns.inum);
+    r->uts_ns = BPF_CORE_READ(nsp, uts_ns, ns.inum);
+    r->ipc_ns = BPF_CORE_READ(nsp, ipc_ns, ns.inum);
+    r->cgroup_ns = BPF_CORE_READ(nsp, cgroup_ns, ns.inum);
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 辅助函数：上报内核模块加载
+static __always_inline int submit_module(void *ctx, __s32 fd, __u64 len, __u32 flags) {
+    struct module_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_MODULE);
+    r->fd = fd;
+    r->flags = flags;
+    r->len = len;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 内核模块加载监控
+SEC("tracepoint/syscalls/sys_enter_init_module")
+int trace_init_module_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_module(ctx, -1, ctx->args[1], 0);
+}
+
+SEC("tracepoint/syscalls/sys_enter_finit_module")
+int trace_finit_module_enter(struct trace_event_raw_sys_enter *ctx) {
+    return submit_module(ctx, (__s32)ctx->args[0], 0, (__u32)ctx->args[2]);
+}
+
+// 能力检查监控。cap_capable 调用非常频繁，只关注可用于逃逸的能力和针对初始用户命名空间的检查，
+// 同一进程的同一能力每个周期最多上报一次
+#define CAP_DAC_READ_SEARCH 2
+#define CAP_NET_ADMIN 12
+#define CAP_SYS_MODULE 16
+#define CAP_SYS_RAWIO 17
+#define CAP_SYS_PTRACE 19
+#define CAP_SYS_ADMIN 21
+#define CAP_BPF 39
+#define CAP_REPORT_INTERVAL_NS (60ULL * 1000 * 1000 * 1000)
+
+struct cap_key {
+    __u32 tgid;
+    __s32 cap;
+};
+
+// 进入 cap_capable 时记录待上报的能力，返回时取出
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 4096);
+    __type(key, __u64);
+    __type(value, __s32);
+} cap_pending SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 16384);
+    __type(key, struct cap_key);
+    __type(value, __u64);
+} cap_reported SEC(".maps");
+
+static __always_inline bool watched_cap(int cap) {
+    switch (cap) {
+    case CAP_DAC_READ_SEARCH:
+    case CAP_NET_ADMIN:
+    case CAP_SYS_MODULE:
+    case CAP_SYS_RAWIO:
+    case CAP_SYS_PTRACE:
+    case CAP_SYS_ADMIN:
+    case CAP_BPF:
+        return true;
+    default:
+        return false;
+    }
+}
+
+SEC("kprobe/cap_capable")
+int BPF_KPROBE(trace_cap_capable, const struct cred *cred, struct user_namespace *targ_ns, int cap) {
+    if (!watched_cap(cap))
+        return 0;
+    // 非初始用户命名空间内的能力不能作用于宿主机
+    if (BPF_CORE_READ(targ_ns, level) != 0)
+        return 0;
+
+    __u64 id = bpf_get_current_pid_tgid();
+    __s32 value = cap;
+    bpf_map_update_elem(&cap_pending, &id, &value, BPF_ANY);
+    return 0;
+}
+
+SEC("kretprobe/cap_capable")
+int BPF_KRETPROBE(trace_cap_capable_ret, int ret) {
+    __u64 id = bpf_get_current_pid_tgid();
+    __s32 *pending = bpf_map_lookup_elem(&cap_pending, &id);
+    if (!pending)
+        return 0;
+    struct cap_key key = {.tgid = id >> 32, .cap = *pending};
+    bpf_map_delete_elem(&cap_pending, &id);
+
+    __u64 now = bpf_ktime_get_ns();
+    __u64 *last = bpf_map_lookup_elem(&cap_reported, &key);
+    if (last && now - *last < CAP_REPORT_INTERVAL_NS)
+        return 0;
+    bpf_map_update_elem(&cap_reported, &key, &now, BPF_ANY);
+
+    struct capability_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_CAPABILITY);
+    r->cap = key.cap;
+    r->ret = ret;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+// 凭证变更监控：所有 set*uid 调用和 setuid 程序最终都会经过 commit_creds，
+// 只上报非root进程获得root权限的情况
+SEC("kprobe/commit_creds")
+int BPF_KPROBE(trace_commit_creds, struct cred *new) {
+    __u32 new_uid = BPF_CORE_READ(new, uid.val);
+    __u32 current_uid = (__u32)bpf_get_current_uid_gid();
+    if (new_uid != 0 || current_uid == 0)
+        return 0;
+
+    struct creds_record *r = reserve_record(sizeof(*r));
+    if (!r)
+        return 0;
+
+    fill_header(&r->hdr, RECORD_CREDS);
+    r->old_uid = current_uid;
+    r->new_uid = new_uid;
+
+    submit_record(ctx, r, sizeof(*r));
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -2,47 +2,10 @@
 
 package main
 
-import (
-	"fmt"
-	"os"
-	"path/filepath"
+// 生成CO-RE对象文件 monitor_bpfel.o，运行时由 internal/ebpf 按 EBPF_OBJECT_PATH 加载。
+// 需要 clang、libbpf 头文件和 bpftool，生成的Go绑定带有 ignore 构建标签，不参与编译：
+//
+//	cd internal/ebpf/programs && go generate monitor.go
 
-	"github.com/cilium/ebpf/rlimit"
-)
-
-//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -cflags "-O2 -g -Wall -Werror" monitor monitor.c -- -I/usr/include/bpf
-
-func main() {
-	// 移除内存限制
-	if err := rlimit.RemoveMemlock(); err != nil {
-		fmt.Printf("Failed to remove memlock: %v\n", err)
-		os.Exit(1)
-	}
-
-	// 这是一个示例程序，实际使用时需要先编译eBPF程序
-	fmt.Println("eBPF program loader - this is a template")
-	fmt.Println("To use this, you need to:")
-	fmt.Println("1. Install clang and kernel headers")
-	fmt.Println("2. Compile the eBPF C program")
-	fmt.Println("3. Generate Go bindings with bpf2go")
-	return
-
-
-}
-
-// 生成eBPF字节码文件
-func generateBytecode() error {
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-
-	cFile := filepath.Join(currentDir, "monitor.c")
-	oFile := filepath.Join(currentDir, "monitor.o")
-
-	// 使用clang编译eBPF程序
-	cmd := fmt.Sprintf("clang -O2 -target bpf -c %s -o %s -I/usr/include/bpf", cFile, oFile)
-	fmt.Printf("Compiling eBPF program: %s\n", cmd)
-
-	return nil
-}
\ No newline at end of file
+//go:generate sh -c "bpftool btf dump file /sys/kernel/btf/vmlinux format c > vmlinux.h"
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -cc clang -cflags "-O2 -g -Wall -Werror" -target bpfel -tags ignore monitor monitor.c -- -I. -I/usr/include/bpf
@@ -0,0 +1,714 @@
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 内核事件协议，与 programs/events.h 保持一致
+const (
+	protocolVersion = 6
+
+	recordExec    = 1
+	recordOpen    = 2
+	recordConnect = 3
+	recordMount   = 4
+	recordSetuid  = 5
+	recordPtrace  = 6
+	recordCreds   = 7
+	recordFork    = 8
+	recordExit    = 9
+	recordAccept  = 10
+	recordUDPSend = 11
+	recordSetns   = 12
+	recordModule  = 13
+	recordUnix    = 14
+	recordCap     = 15
+	recordRename  = 16
+	recordUnlink  = 17
+	recordWrite   = 18
+	recordBlocked = 19
+)
+
+// 进程生命周期记录只用于维护进程表，不作为事件上报
+const (
+	syscallFork = "fork"
+	syscallExit = "exit"
+)
+
+var (
+	errShortRecord   = errors.New("record too short")
+	errVersion       = errors.New("unsupported protocol version")
+	errUnknownRecord = errors.New("unknown record type")
+)
+
+// recordHeader 每条记录的公共头部
+type recordHeader struct {
+	Type      uint16
+	Version   uint16
+	PID       uint32
+	TID       uint32
+	PPID      uint32
+	UID       uint32
+	GID       uint32
+	Timestamp uint64
+	CgroupID  uint64
+	Comm      [16]byte
+}
+
+type execPayload struct {
+	Filename [256]byte
+	Argc     uint32
+	ArgsSize uint32
+	Args     [512]byte
+}
+
+type forkPayload struct {
+	ChildPID uint32
+	_        uint32
+}
+
+type exitPayload struct {
+	ExitCode int32
+	_        uint32
+}
+
+type openPayload struct {
+	Flags    int32
+	Mode     uint32
+	DirFD    int32
+	_        uint32
+	Filename [256]byte
+}
+
+type renamePayload struct {
+	OldDirFD int32
+	NewDirFD int32
+	Flags    uint32
+	_        uint32
+	OldName  [256]byte
+	NewName  [256]byte
+}
+
+type unlinkPayload struct {
+	DirFD    int32
+	Flags    uint32
+	Filename [256]byte
+}
+
+type writePayload struct {
+	FD       int32
+	Flags    int32
+	Filename [256]byte
+}
+
+type netPayload struct {
+	Family   uint16
+	LPort    uint16
+	RPort    uint16
+	Protocol uint8
+	_        uint8
+	LAddr    [16]byte
+	RAddr    [16]byte
+	Bytes    uint32
+	_        uint32
+}
+
+type unixConnectPayload struct {
+	PathLen uint32
+	Path    [108]byte
+}
+
+type setnsPayload struct {
+	Mnt    uint32
+	PID    uint32
+	Net    uint32
+	UTS    uint32
+	IPC    uint32
+	Cgroup uint32
+}
+
+type modulePayload struct {
+	FD    int32
+	Flags uint32
+	Len   uint64
+}
+
+type capabilityPayload struct {
+	Cap int32
+	Ret int32
+}
+
+type mountPayload struct {
+	Flags  uint64
+	Source [128]byte
+	Target [256]byte
+	FSType [32]byte
+}
+
+type setuidPayload struct {
+	UID uint32
+	_   uint32
+}
+
+type ptracePayload struct {
+	Request   int64
+	TargetPID uint32
+	_         uint32
+}
+
+type credsPayload struct {
+	OldUID uint32
+	NewUID uint32
+}
+
+var headerSize = binary.Size(recordHeader{})
+
+// FileDetails 文件访问详情
+type FileDetails struct {
+	Flags int32  `json:"flags"`
+	Mode  uint32 `json:"mode"`
+	Write bool   `json:"write"`
+	// NewPath 重命名的目标路径
+	NewPath string `json:"new_path,omitempty"`
+	// FD 写入事件的文件描述符
+	FD int32 `json:"fd,omitempty"`
+	// DirFD 和 NewDirFD 为相对路径所相对的目录，由内核事件源解析后不再需要
+	DirFD    int32 `json:"-"`
+	NewDirFD int32 `json:"-"`
+}
+
+// 网络方向
+const (
+	DirectionOutbound = "outbound"
+	DirectionInbound  = "inbound"
+)
+
+// NetworkDetails 网络连接详情。源地址为发起方，目的地址为服务端：
+// 出站连接的源地址是本端，入站连接的目的地址是本端
+type NetworkDetails struct {
+	Protocol   string `json:"protocol,omitempty"`  // tcp 或 udp
+	Direction  string `json:"direction,omitempty"` // outbound 或 inbound
+	Family     string `json:"family"`
+	SourceAddr string `json:"source_addr,omitempty"`
+	SourcePort uint16 `json:"source_port,omitempty"`
+	DestAddr   string `json:"dest_addr"`
+	DestPort   uint16 `json:"dest_port"`
+	Bytes      uint32 `json:"bytes,omitempty"` // UDP发送的字节数
+	// Blocked 连接被阻断表拒绝，未建立
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// PeerAddr 返回对端地址
+func (n *NetworkDetails) PeerAddr() string {
+	if n.Direction == DirectionInbound {
+		return n.SourceAddr
+	}
+	return n.DestAddr
+}
+
+// LocalAddr 返回本端地址
+func (n *NetworkDetails) LocalAddr() string {
+	if n.Direction == DirectionInbound {
+		return n.DestAddr
+	}
+	return n.SourceAddr
+}
+
+// MountDetails 挂载详情
+type MountDetails struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	FSType string `json:"fstype"`
+	Flags  uint64 `json:"flags"`
+}
+
+// CredentialDetails 凭证变更详情
+type CredentialDetails struct {
+	OldUID uint32 `json:"old_uid"`
+	NewUID uint32 `json:"new_uid"`
+}
+
+// NamespaceDetails setns 之后所在的命名空间inode号
+type NamespaceDetails struct {
+	Mnt    uint32 `json:"mnt"`
+	PID    uint32 `json:"pid"`
+	Net    uint32 `json:"net"`
+	UTS    uint32 `json:"uts"`
+	IPC    uint32 `json:"ipc"`
+	Cgroup uint32 `json:"cgroup"`
+	// Host 与宿主机init进程相同的命名空间，如 mnt、pid、net
+	Host []string `json:"host,omitempty"`
+}
+
+// ModuleDetails 内核模块加载详情
+type ModuleDetails struct {
+	FD    int32  `json:"fd"`
+	Flags uint32 `json:"flags,omitempty"`
+	Size  uint64 `json:"size,omitempty"`
+	// Path finit_module 加载的模块文件，由用户态根据fd解析
+	Path string `json:"path,omitempty"`
+}
+
+// CapabilityDetails 能力检查详情
+type CapabilityDetails struct {
+	Cap     int32  `json:"cap"`
+	Name    string `json:"name"`
+	Granted bool   `json:"granted"`
+}
+
+// PtraceDetails ptrace调用详情
+type PtraceDetails struct {
+	Request     int64  `json:"request"`
+	RequestName string `json:"request_name"`
+	TargetPID   uint32 `json:"target_pid"`
+}
+
+// decodeRecord 将内核记录解码为 Event，并根据系统调用参数判断严重程度
+func decodeRecord(sample []byte, boot time.Time) (Event, error) {
+	if len(sample) < headerSize {
+		return Event{}, fmt.Errorf("%w: %d bytes", errShortRecord, len(sample))
+	}
+
+	var hdr recordHeader
+	r := bytes.NewReader(sample)
+	if err := binary.Read(r, binary.NativeEndian, &hdr); err != nil {
+		return Event{}, err
+	}
+	if hdr.Version != protocolVersion {
+		return Event{}, fmt.Errorf("%w: %d", errVersion, hdr.Version)
+	}
+
+	event := Event{
+		Timestamp: boot.Add(time.Duration(hdr.Timestamp)).Unix(),
+		PID:       hdr.PID,
+		TID:       hdr.TID,
+		PPID:      hdr.PPID,
+		UID:       hdr.UID,
+		GID:       hdr.GID,
+		Comm:      cString(hdr.Comm[:]),
+		CgroupID:  hdr.CgroupID,
+	}
+
+	readPayload := func(v interface{}) error {
+		if err := binary.Read(r, binary.NativeEndian, v); err != nil {
+			return fmt.Errorf("%w: type %d: %v", errShortRecord, hdr.Type, err)
+		}
+		return nil
+	}
+
+	switch hdr.Type {
+	case recordExec:
+		var p execPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "execve"
+		event.Filename = cString(p.Filename[:])
+		size := p.ArgsSize
+		if size > uint32(len(p.Args)) {
+			size = uint32(len(p.Args))
+		}
+		event.Process = &ProcessInfo{
+			PID:  hdr.PID,
+			PPID: hdr.PPID,
+			UID:  hdr.UID,
+			Comm: event.Comm,
+			Exe:  event.Filename,
+			Args: splitArgs(p.Args[:size]),
+		}
+		classifyExec(&event)
+
+	case recordFork:
+		var p forkPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = syscallFork
+		event.Process = &ProcessInfo{PID: p.ChildPID, PPID: hdr.PID, UID: hdr.UID, Comm: event.Comm}
+
+	case recordExit:
+		var p exitPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = syscallExit
+
+	case recordOpen:
+		var p openPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "openat"
+		event.Filename = cString(p.Filename[:])
+		event.File = &FileDetails{Flags: p.Flags, Mode: p.Mode, Write: openForWrite(p.Flags), DirFD: p.DirFD}
+		classifyOpen(&event)
+
+	case recordWrite:
+		var p writePayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "write"
+		event.Filename = cString(p.Filename[:])
+		event.File = &FileDetails{Flags: p.Flags, Write: true, FD: p.FD, DirFD: unix.AT_FDCWD}
+		event.EventType = "file_access"
+		event.Severity = "medium"
+		event.Description = "File write"
+
+	case recordRename:
+		var p renamePayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "rename"
+		event.Filename = cString(p.OldName[:])
+		event.File = &FileDetails{
+			Flags:    int32(p.Flags),
+			Write:    true,
+			NewPath:  cString(p.NewName[:]),
+			DirFD:    p.OldDirFD,
+			NewDirFD: p.NewDirFD,
+		}
+		event.EventType = "file_access"
+		event.Severity = "medium"
+		event.Description = "File rename"
+
+	case recordUnlink:
+		var p unlinkPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "unlink"
+		event.Filename = cString(p.Filename[:])
+		event.File = &FileDetails{Flags: int32(p.Flags), Write: true, DirFD: p.DirFD}
+		event.EventType = "file_access"
+		event.Severity = "low"
+		event.Description = "File deletion"
+		if p.Flags&unix.AT_REMOVEDIR != 0 {
+			event.Description = "Directory deletion"
+		}
+
+	case recordConnect, recordAccept, recordUDPSend, recordBlocked:
+		var p netPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		decodeNetwork(&event, hdr.Type, p)
+
+	case recordUnix:
+		var p unixConnectPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		size := p.PathLen
+		if size > uint32(len(p.Path)) {
+			size = uint32(len(p.Path))
+		}
+		event.Syscall = "connect"
+		event.Network = &NetworkDetails{
+			Direction: DirectionOutbound,
+			Family:    "unix",
+			DestAddr:  unixPath(p.Path[:size]),
+		}
+		event.Filename = event.Network.DestAddr
+		event.EventType = "network"
+		event.Severity = "low"
+		event.Description = "Unix socket connection"
+
+	case recordSetns:
+		var p setnsPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "setns"
+		event.Namespaces = &NamespaceDetails{Mnt: p.Mnt, PID: p.PID, Net: p.Net, UTS: p.UTS, IPC: p.IPC, Cgroup: p.Cgroup}
+		event.Filename = "mnt:[" + strconv.FormatUint(uint64(p.Mnt), 10) + "]"
+		event.EventType = "syscall"
+		event.Severity = "medium"
+		event.Description = "Namespace change"
+
+	case recordModule:
+		var p modulePayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Module = &ModuleDetails{FD: p.FD, Flags: p.Flags, Size: p.Len}
+		if p.FD >= 0 {
+			event.Syscall = "finit_module"
+		} else {
+			event.Syscall = "init_module"
+		}
+		event.EventType = "syscall"
+		event.Severity = "high"
+		event.Description = "Kernel module load"
+
+	case recordCap:
+		var p capabilityPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "capable"
+		event.Capability = &CapabilityDetails{Cap: p.Cap, Name: capabilityName(p.Cap), Granted: p.Ret == 0}
+		event.Filename = event.Capability.Name
+		event.EventType = "syscall"
+		if event.Capability.Granted {
+			event.Severity = "medium"
+			event.Description = "Capability used"
+		} else {
+			event.Severity = "low"
+			event.Description = "Capability denied"
+		}
+
+	case recordMount:
+		var p mountPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "mount"
+		event.Mount = &MountDetails{
+			Source: cString(p.Source[:]),
+			Target: cString(p.Target[:]),
+			FSType: cString(p.FSType[:]),
+			Flags:  p.Flags,
+		}
+		event.Filename = event.Mount.Target
+		event.EventType = "syscall"
+		event.Severity = "high"
+		event.Description = "Filesystem mount"
+
+	case recordSetuid:
+		var p setuidPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "setuid"
+		event.Credentials = &CredentialDetails{OldUID: hdr.UID, NewUID: p.UID}
+		event.Filename = "uid=" + strconv.FormatUint(uint64(p.UID), 10)
+		event.EventType = "syscall"
+		if p.UID == 0 {
+			event.Severity = "critical"
+			event.Description = "setuid to root"
+		} else {
+			event.Severity = "high"
+			event.Description = "UID change attempt"
+		}
+
+	case recordPtrace:
+		var p ptracePayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "ptrace"
+		event.Ptrace = &PtraceDetails{
+			Request:     p.Request,
+			RequestName: ptraceRequestName(p.Request),
+			TargetPID:   p.TargetPID,
+		}
+		event.Filename = "pid=" + strconv.FormatUint(uint64(p.TargetPID), 10)
+		classifyPtrace(&event)
+
+	case recordCreds:
+		var p credsPayload
+		if err := readPayload(&p); err != nil {
+			return Event{}, err
+		}
+		event.Syscall = "commit_creds"
+		event.Credentials = &CredentialDetails{OldUID: p.OldUID, NewUID: p.NewUID}
+		event.Filename = "uid=" + strconv.FormatUint(uint64(p.NewUID), 10)
+		event.EventType = "syscall"
+		event.Severity = "critical"
+		event.Description = "Privilege escalation to root"
+
+	default:
+		return Event{}, fmt.Errorf("%w: %d", errUnknownRecord, hdr.Type)
+	}
+
+	return event, nil
+}
+
+// decodeNetwork 将本端视角的五元组转换为发起方到服务端的方向
+func decodeNetwork(event *Event, recordType uint16, p netPayload) {
+	local, remote := p.LAddr[:], p.RAddr[:]
+	n := &NetworkDetails{Protocol: "tcp", Direction: DirectionOutbound, Bytes: p.Bytes}
+	switch p.Family {
+	case unix.AF_INET:
+		n.Family = "ipv4"
+		local, remote = local[:4], remote[:4]
+	case unix.AF_INET6:
+		n.Family = "ipv6"
+	default:
+		n.Family = strconv.Itoa(int(p.Family))
+	}
+	if p.Protocol == unix.IPPROTO_UDP {
+		n.Protocol = "udp"
+	}
+
+	event.EventType = "network"
+	switch recordType {
+	case recordAccept:
+		n.Direction = DirectionInbound
+		n.SourceAddr, n.SourcePort = net.IP(remote).String(), p.RPort
+		n.DestAddr, n.DestPort = net.IP(local).String(), p.LPort
+		event.Syscall = "accept"
+		event.Severity = "low"
+		event.Description = "Inbound connection"
+	case recordUDPSend:
+		n.SourceAddr, n.SourcePort = net.IP(local).String(), p.LPort
+		n.DestAddr, n.DestPort = net.IP(remote).String(), p.RPort
+		event.Syscall = "sendmsg"
+		event.Severity = "low"
+		event.Description = "UDP datagram sent"
+	case recordBlocked:
+		n.DestAddr, n.DestPort = net.IP(remote).String(), p.RPort
+		n.Blocked = true
+		event.Syscall = "connect"
+		event.Severity = "high"
+		event.Description = "Connection blocked"
+	default:
+		n.SourceAddr, n.SourcePort = net.IP(local).String(), p.LPort
+		n.DestAddr, n.DestPort = net.IP(remote).String(), p.RPort
+		event.Syscall = "connect"
+		event.Severity = "medium"
+		event.Description = "Network connection"
+	}
+	event.Network = n
+	event.Filename = net.JoinHostPort(n.DestAddr, strconv.Itoa(int(n.DestPort)))
+}
+
+// classifyExec 判断进程执行事件的严重程度
+func classifyExec(event *Event) {
+	event.EventType = "process"
+	switch {
+	case event.Filename == "/bin/sh" || event.Filename == "/bin/bash":
+		if event.UID == 0 {
+			event.Severity = "high"
+			event.Description = "Root shell execution"
+		} else {
+			event.Severity = "medium"
+			event.Description = "Shell execution"
+		}
+	case event.Filename == "/usr/bin/nc" || event.Filename == "/bin/nc":
+		event.Severity = "critical"
+		event.Description = "Netcat execution detected"
+	default:
+		event.Severity = "medium"
+		event.Description = "Process execution"
+	}
+}
+
+// openForWrite 判断打开标志是否可能修改文件，与内核中 fim_track_open 的判断一致
+func openForWrite(flags int32) bool {
+	accessMode := flags & unix.O_ACCMODE
+	return accessMode == unix.O_WRONLY || accessMode == unix.O_RDWR || flags&(unix.O_CREAT|unix.O_TRUNC) != 0
+}
+
+// sensitiveFiles 敏感文件前缀
+var sensitiveFiles = []string{"/etc/passwd", "/etc/shadow", "/etc/sudoers"}
+
+// classifyOpen 判断文件访问事件的严重程度
+func classifyOpen(event *Event) {
+	event.EventType = "file_access"
+	event.Severity = "low"
+	event.Description = "File access"
+
+	for _, prefix := range sensitiveFiles {
+		if strings.HasPrefix(event.Filename, prefix) {
+			event.Severity = "high"
+			event.Description = "Sensitive file access"
+			return
+		}
+	}
+	if strings.HasPrefix(event.Filename, "/proc/") {
+		event.Severity = "medium"
+		event.Description = "Proc filesystem access"
+	}
+}
+
+// classifyPtrace 判断ptrace事件的严重程度
+func classifyPtrace(event *Event) {
+	event.EventType = "syscall"
+	switch event.Ptrace.Request {
+	case unix.PTRACE_ATTACH, unix.PTRACE_SEIZE:
+		event.Severity = "critical"
+		event.Description = "ptrace attach to process"
+	case unix.PTRACE_POKETEXT, unix.PTRACE_POKEDATA:
+		event.Severity = "critical"
+		event.Description = "ptrace memory write"
+	default:
+		event.Severity = "high"
+		event.Description = "ptrace call"
+	}
+}
+
+// ptraceRequestName 返回ptrace请求的名称
+func ptraceRequestName(request int64) string {
+	switch request {
+	case unix.PTRACE_TRACEME:
+		return "PTRACE_TRACEME"
+	case unix.PTRACE_PEEKTEXT:
+		return "PTRACE_PEEKTEXT"
+	case unix.PTRACE_PEEKDATA:
+		return "PTRACE_PEEKDATA"
+	case unix.PTRACE_POKETEXT:
+		return "PTRACE_POKETEXT"
+	case unix.PTRACE_POKEDATA:
+		return "PTRACE_POKEDATA"
+	case unix.PTRACE_CONT:
+		return "PTRACE_CONT"
+	case unix.PTRACE_ATTACH:
+		return "PTRACE_ATTACH"
+	case unix.PTRACE_DETACH:
+		return "PTRACE_DETACH"
+	case unix.PTRACE_SEIZE:
+		return "PTRACE_SEIZE"
+	default:
+		return strconv.FormatInt(request, 10)
+	}
+}
+
+// capabilityName 返回能力名称
+func capabilityName(c int32) string {
+	switch c {
+	case unix.CAP_DAC_READ_SEARCH:
+		return "CAP_DAC_READ_SEARCH"
+	case unix.CAP_NET_ADMIN:
+		return "CAP_NET_ADMIN"
+	case unix.CAP_SYS_MODULE:
+		return "CAP_SYS_MODULE"
+	case unix.CAP_SYS_RAWIO:
+		return "CAP_SYS_RAWIO"
+	case unix.CAP_SYS_PTRACE:
+		return "CAP_SYS_PTRACE"
+	case unix.CAP_SYS_ADMIN:
+		return "CAP_SYS_ADMIN"
+	case unix.CAP_BPF:
+		return "CAP_BPF"
+	default:
+		return "CAP_" + strconv.Itoa(int(c))
+	}
+}
+
+// unixPath 返回unix socket路径，抽象socket以@开头
+func unixPath(b []byte) string {
+	if len(b) > 0 && b[0] == 0 {
+		return "@" + strings.TrimRight(string(b[1:]), "\x00")
+	}
+	return cString(b)
+}
+
+// cString 截取以NUL结尾的C字符串
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
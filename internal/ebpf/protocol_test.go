@@ -0,0 +1,409 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// recordBuilder 按 programs/events.h 的布局逐字段构造内核记录，不依赖 protocol.go 中的Go结构体
+type recordBuilder []byte
+
+func (b *recordBuilder) u8(v uint8) *recordBuilder {
+	*b = append(*b, v)
+	return b
+}
+
+func (b *recordBuilder) u16(v uint16) *recordBuilder {
+	*b = binary.NativeEndian.AppendUint16(*b, v)
+	return b
+}
+
+func (b *recordBuilder) u32(v uint32) *recordBuilder {
+	*b = binary.NativeEndian.AppendUint32(*b, v)
+	return b
+}
+
+func (b *recordBuilder) i32(v int32) *recordBuilder { return b.u32(uint32(v)) }
+
+func (b *recordBuilder) u64(v uint64) *recordBuilder {
+	*b = binary.NativeEndian.AppendUint64(*b, v)
+	return b
+}
+
+// str 写入长度为 n 的定长字符数组，不足部分补0
+func (b *recordBuilder) str(s string, n int) *recordBuilder {
+	field := make([]byte, n)
+	copy(field, s)
+	*b = append(*b, field...)
+	return b
+}
+
+// 测试记录头部的公共字段
+const (
+	testPID      = 4242
+	testTID      = 4243
+	testPPID     = 1
+	testCgroupID = 0xc0ffee
+)
+
+var testBoot = time.Unix(1700000000, 0)
+
+// header 构造 struct event_header，时间戳为启动后5秒
+func header(recordType, version uint16, uid uint32) *recordBuilder {
+	b := &recordBuilder{}
+	b.u16(recordType).u16(version).u32(testPID).u32(testTID).u32(testPPID).u32(uid).u32(uid)
+	b.u64(uint64(5*time.Second)).u64(testCgroupID).str("payload", 16)
+	return b
+}
+
+func ipv4(a, b, c, d byte) string {
+	return string([]byte{a, b, c, d})
+}
+
+func netRecord(recordType uint16, family uint16, protocol uint8, laddr, raddr string, lport, rport uint16) []byte {
+	b := header(recordType, protocolVersion, 1000)
+	b.u16(family).u16(lport).u16(rport).u8(protocol).u8(0).str(laddr, 16).str(raddr, 16).u32(512).u32(0)
+	return *b
+}
+
+func TestHeaderAndPayloadLayout(t *testing.T) {
+	// 与 events.h 中各记录的大小一致（不含56字节的公共头部）
+	tests := []struct {
+		name    string
+		payload interface{}
+		size    int
+	}{
+		{"event_header", recordHeader{}, 56},
+		{"exec_record", execPayload{}, 256 + 4 + 4 + 512},
+		{"open_record", openPayload{}, 4 + 4 + 4 + 4 + 256},
+		{"rename_record", renamePayload{}, 4 + 4 + 4 + 4 + 256 + 256},
+		{"unlink_record", unlinkPayload{}, 4 + 4 + 256},
+		{"write_record", writePayload{}, 4 + 4 + 256},
+		{"net_record", netPayload{}, 2 + 2 + 2 + 1 + 1 + 16 + 16 + 4 + 4},
+		{"mount_record", mountPayload{}, 8 + 128 + 256 + 32},
+		{"setuid_record", setuidPayload{}, 8},
+		{"ptrace_record", ptracePayload{}, 16},
+		{"creds_record", credsPayload{}, 8},
+		{"fork_record", forkPayload{}, 8},
+		{"exit_record", exitPayload{}, 8},
+		{"setns_record", setnsPayload{}, 24},
+		{"module_record", modulePayload{}, 16},
+		{"unix_connect_record", unixConnectPayload{}, 4 + 108},
+		{"capability_record", capabilityPayload{}, 8},
+	}
+	for _, tt := range tests {
+		if got := binary.Size(tt.payload); got != tt.size {
+			t.Errorf("%s: size = %d, want %d", tt.name, got, tt.size)
+		}
+	}
+	if protocolVersion != 6 {
+		t.Errorf("protocolVersion = %d, want EVENT_PROTOCOL_VERSION 6", protocolVersion)
+	}
+}
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		record []byte
+		check  func(t *testing.T, e Event)
+	}{
+		{
+			name: "exec",
+			record: *header(recordExec, protocolVersion, 0).
+				str("/bin/bash", 256).u32(3).u32(13).str("bash\x00-c\x00id\x00", 512),
+			check: func(t *testing.T, e Event) {
+				want := &ProcessInfo{PID: testPID, PPID: testPPID, UID: 0, Comm: "payload", Exe: "/bin/bash", Args: []string{"bash", "-c", "id"}}
+				if e.Syscall != "execve" || e.Filename != "/bin/bash" || !reflect.DeepEqual(e.Process, want) {
+					t.Errorf("event = %+v, process = %+v", e, e.Process)
+				}
+				if e.Severity != "high" || e.Description != "Root shell execution" {
+					t.Errorf("severity = %s (%s), want a high root shell", e.Severity, e.Description)
+				}
+			},
+		},
+		{
+			// args_size 超出缓冲区时截断到缓冲区长度
+			name: "exec with oversized args_size",
+			record: *header(recordExec, protocolVersion, 1000).
+				str("/usr/bin/env", 256).u32(1).u32(4096).str("env", 512),
+			check: func(t *testing.T, e Event) {
+				if !reflect.DeepEqual(e.Process.Args, []string{"env"}) || e.Severity != "medium" {
+					t.Errorf("args = %q, severity = %s", e.Process.Args, e.Severity)
+				}
+			},
+		},
+		{
+			name:   "open",
+			record: *header(recordOpen, protocolVersion, 1000).i32(unix.O_RDONLY).u32(0).i32(unix.AT_FDCWD).u32(0).str("/etc/shadow", 256),
+			check: func(t *testing.T, e Event) {
+				want := &FileDetails{Flags: unix.O_RDONLY, DirFD: unix.AT_FDCWD}
+				if e.Syscall != "openat" || e.Filename != "/etc/shadow" || !reflect.DeepEqual(e.File, want) || e.Severity != "high" {
+					t.Errorf("event = %+v, file = %+v", e, e.File)
+				}
+			},
+		},
+		{
+			name:   "open for write",
+			record: *header(recordOpen, protocolVersion, 1000).i32(unix.O_WRONLY|unix.O_CREAT).u32(0644).i32(3).u32(0).str("app.log", 256),
+			check: func(t *testing.T, e Event) {
+				if !e.File.Write || e.File.Mode != 0644 || e.File.DirFD != 3 || e.Severity != "low" {
+					t.Errorf("file = %+v, severity = %s", e.File, e.Severity)
+				}
+			},
+		},
+		{
+			name:   "write",
+			record: *header(recordWrite, protocolVersion, 0).i32(7).i32(unix.O_WRONLY).str("/etc/passwd", 256),
+			check: func(t *testing.T, e Event) {
+				want := &FileDetails{Flags: unix.O_WRONLY, Write: true, FD: 7, DirFD: unix.AT_FDCWD}
+				if e.Syscall != "write" || e.Filename != "/etc/passwd" || !reflect.DeepEqual(e.File, want) {
+					t.Errorf("event = %+v, file = %+v", e, e.File)
+				}
+			},
+		},
+		{
+			name:   "rename",
+			record: *header(recordRename, protocolVersion, 0).i32(unix.AT_FDCWD).i32(5).u32(1).u32(0).str("/tmp/x", 256).str("bin/ls", 256),
+			check: func(t *testing.T, e Event) {
+				want := &FileDetails{Flags: 1, Write: true, NewPath: "bin/ls", DirFD: unix.AT_FDCWD, NewDirFD: 5}
+				if e.Syscall != "rename" || e.Filename != "/tmp/x" || !reflect.DeepEqual(e.File, want) {
+					t.Errorf("event = %+v, file = %+v", e, e.File)
+				}
+			},
+		},
+		{
+			name:   "unlink directory",
+			record: *header(recordUnlink, protocolVersion, 0).i32(unix.AT_FDCWD).u32(unix.AT_REMOVEDIR).str("/var/log/audit", 256),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != "unlink" || e.Filename != "/var/log/audit" || e.Description != "Directory deletion" {
+					t.Errorf("event = %+v", e)
+				}
+			},
+		},
+		{
+			name:   "tcp connect ipv4",
+			record: netRecord(recordConnect, unix.AF_INET, unix.IPPROTO_TCP, ipv4(10, 0, 0, 2), ipv4(10, 0, 0, 5), 40000, 443),
+			check: func(t *testing.T, e Event) {
+				want := &NetworkDetails{Protocol: "tcp", Direction: DirectionOutbound, Family: "ipv4", SourceAddr: "10.0.0.2", SourcePort: 40000, DestAddr: "10.0.0.5", DestPort: 443, Bytes: 512}
+				if e.Syscall != "connect" || e.Filename != "10.0.0.5:443" || !reflect.DeepEqual(e.Network, want) {
+					t.Errorf("event = %+v, network = %+v", e, e.Network)
+				}
+			},
+		},
+		{
+			// 入站连接的发起方是对端
+			name:   "accept ipv6",
+			record: netRecord(recordAccept, unix.AF_INET6, unix.IPPROTO_TCP, "\x20\x01\x0d\xb8"+string(make([]byte, 11))+"\x01", "\x20\x01\x0d\xb8"+string(make([]byte, 11))+"\x09", 8080, 51000),
+			check: func(t *testing.T, e Event) {
+				want := &NetworkDetails{Protocol: "tcp", Direction: DirectionInbound, Family: "ipv6", SourceAddr: "2001:db8::9", SourcePort: 51000, DestAddr: "2001:db8::1", DestPort: 8080, Bytes: 512}
+				if e.Syscall != "accept" || e.Filename != "[2001:db8::1]:8080" || !reflect.DeepEqual(e.Network, want) {
+					t.Errorf("event = %+v, network = %+v", e, e.Network)
+				}
+			},
+		},
+		{
+			name:   "udp send",
+			record: netRecord(recordUDPSend, unix.AF_INET, unix.IPPROTO_UDP, ipv4(10, 0, 0, 2), ipv4(8, 8, 8, 8), 0, 53),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != "sendmsg" || e.Network.Protocol != "udp" || e.Network.DestAddr != "8.8.8.8" || e.Network.Bytes != 512 {
+					t.Errorf("event = %+v, network = %+v", e, e.Network)
+				}
+			},
+		},
+		{
+			name:   "blocked connection",
+			record: netRecord(recordBlocked, unix.AF_INET, unix.IPPROTO_TCP, ipv4(0, 0, 0, 0), ipv4(203, 0, 113, 7), 0, 4444),
+			check: func(t *testing.T, e Event) {
+				if !e.Network.Blocked || e.Network.SourceAddr != "" || e.Filename != "203.0.113.7:4444" || e.Severity != "high" {
+					t.Errorf("event = %+v, network = %+v", e, e.Network)
+				}
+			},
+		},
+		{
+			name:   "abstract unix socket",
+			record: *header(recordUnix, protocolVersion, 0).u32(5).str("\x00sock", 108),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != "connect" || e.Filename != "@sock" || e.Network.Family != "unix" {
+					t.Errorf("event = %+v, network = %+v", e, e.Network)
+				}
+			},
+		},
+		{
+			// path_len 超出缓冲区时截断到缓冲区长度
+			name:   "unix socket with oversized path_len",
+			record: *header(recordUnix, protocolVersion, 0).u32(4096).str("/run/containerd/containerd.sock", 108),
+			check: func(t *testing.T, e Event) {
+				if e.Filename != "/run/containerd/containerd.sock" {
+					t.Errorf("filename = %q", e.Filename)
+				}
+			},
+		},
+		{
+			name:   "mount",
+			record: *header(recordMount, protocolVersion, 0).u64(unix.MS_BIND).str("/dev/sda1", 128).str("/mnt/host", 256).str("ext4", 32),
+			check: func(t *testing.T, e Event) {
+				want := &MountDetails{Source: "/dev/sda1", Target: "/mnt/host", FSType: "ext4", Flags: unix.MS_BIND}
+				if e.Syscall != "mount" || e.Filename != "/mnt/host" || !reflect.DeepEqual(e.Mount, want) {
+					t.Errorf("event = %+v, mount = %+v", e, e.Mount)
+				}
+			},
+		},
+		{
+			name:   "setuid root",
+			record: *header(recordSetuid, protocolVersion, 1000).u32(0).u32(0),
+			check: func(t *testing.T, e Event) {
+				want := &CredentialDetails{OldUID: 1000, NewUID: 0}
+				if e.Filename != "uid=0" || !reflect.DeepEqual(e.Credentials, want) || e.Severity != "critical" {
+					t.Errorf("event = %+v, credentials = %+v", e, e.Credentials)
+				}
+			},
+		},
+		{
+			name:   "ptrace attach",
+			record: *header(recordPtrace, protocolVersion, 0).u64(unix.PTRACE_ATTACH).u32(1).u32(0),
+			check: func(t *testing.T, e Event) {
+				want := &PtraceDetails{Request: unix.PTRACE_ATTACH, RequestName: "PTRACE_ATTACH", TargetPID: 1}
+				if e.Filename != "pid=1" || !reflect.DeepEqual(e.Ptrace, want) || e.Severity != "critical" {
+					t.Errorf("event = %+v, ptrace = %+v", e, e.Ptrace)
+				}
+			},
+		},
+		{
+			name:   "commit_creds",
+			record: *header(recordCreds, protocolVersion, 1000).u32(1000).u32(0),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != "commit_creds" || e.Credentials.OldUID != 1000 || e.Credentials.NewUID != 0 {
+					t.Errorf("event = %+v, credentials = %+v", e, e.Credentials)
+				}
+			},
+		},
+		{
+			name:   "fork",
+			record: *header(recordFork, protocolVersion, 1000).u32(5000).u32(0),
+			check: func(t *testing.T, e Event) {
+				want := &ProcessInfo{PID: 5000, PPID: testPID, UID: 1000, Comm: "payload"}
+				if e.Syscall != syscallFork || !reflect.DeepEqual(e.Process, want) {
+					t.Errorf("event = %+v, process = %+v", e, e.Process)
+				}
+			},
+		},
+		{
+			name:   "exit",
+			record: *header(recordExit, protocolVersion, 1000).i32(1).u32(0),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != syscallExit {
+					t.Errorf("syscall = %s", e.Syscall)
+				}
+			},
+		},
+		{
+			name:   "setns",
+			record: *header(recordSetns, protocolVersion, 0).u32(4026531840).u32(4026531836).u32(4026531992).u32(4026531838).u32(4026531839).u32(4026531835),
+			check: func(t *testing.T, e Event) {
+				want := &NamespaceDetails{Mnt: 4026531840, PID: 4026531836, Net: 4026531992, UTS: 4026531838, IPC: 4026531839, Cgroup: 4026531835}
+				if e.Filename != "mnt:[4026531840]" || !reflect.DeepEqual(e.Namespaces, want) {
+					t.Errorf("event = %+v, namespaces = %+v", e, e.Namespaces)
+				}
+			},
+		},
+		{
+			name:   "init_module",
+			record: *header(recordModule, protocolVersion, 0).i32(-1).u32(0).u64(65536),
+			check: func(t *testing.T, e Event) {
+				want := &ModuleDetails{FD: -1, Size: 65536}
+				if e.Syscall != "init_module" || !reflect.DeepEqual(e.Module, want) {
+					t.Errorf("event = %+v, module = %+v", e, e.Module)
+				}
+			},
+		},
+		{
+			name:   "finit_module",
+			record: *header(recordModule, protocolVersion, 0).i32(3).u32(2).u64(0),
+			check: func(t *testing.T, e Event) {
+				if e.Syscall != "finit_module" || e.Module.FD != 3 || e.Module.Flags != 2 {
+					t.Errorf("event = %+v, module = %+v", e, e.Module)
+				}
+			},
+		},
+		{
+			name:   "capability denied",
+			record: *header(recordCap, protocolVersion, 1000).i32(unix.CAP_SYS_ADMIN).i32(-int32(unix.EPERM)),
+			check: func(t *testing.T, e Event) {
+				want := &CapabilityDetails{Cap: unix.CAP_SYS_ADMIN, Name: "CAP_SYS_ADMIN"}
+				if e.Filename != "CAP_SYS_ADMIN" || !reflect.DeepEqual(e.Capability, want) || e.Description != "Capability denied" {
+					t.Errorf("event = %+v, capability = %+v", e, e.Capability)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := decodeRecord(tt.record, testBoot)
+			if err != nil {
+				t.Fatalf("decodeRecord: %v", err)
+			}
+			if e.PID != testPID || e.TID != testTID || e.PPID != testPPID || e.CgroupID != testCgroupID || e.Comm != "payload" {
+				t.Errorf("header = pid %d tid %d ppid %d cgroup %x comm %q", e.PID, e.TID, e.PPID, e.CgroupID, e.Comm)
+			}
+			if want := testBoot.Add(5 * time.Second).Unix(); e.Timestamp != want {
+				t.Errorf("timestamp = %d, want %d", e.Timestamp, want)
+			}
+			tt.check(t, e)
+		})
+	}
+}
+
+func TestDecodeRecordErrors(t *testing.T) {
+	full := map[string][]byte{
+		"exec":    *header(recordExec, protocolVersion, 0).str("/bin/sh", 256).u32(0).u32(0).str("", 512),
+		"open":    *header(recordOpen, protocolVersion, 0).i32(0).u32(0).i32(0).u32(0).str("/etc/hosts", 256),
+		"rename":  *header(recordRename, protocolVersion, 0).i32(0).i32(0).u32(0).u32(0).str("a", 256).str("b", 256),
+		"unlink":  *header(recordUnlink, protocolVersion, 0).i32(0).u32(0).str("a", 256),
+		"write":   *header(recordWrite, protocolVersion, 0).i32(0).i32(0).str("a", 256),
+		"connect": netRecord(recordConnect, unix.AF_INET, unix.IPPROTO_TCP, ipv4(127, 0, 0, 1), ipv4(127, 0, 0, 1), 1, 2),
+		"mount":   *header(recordMount, protocolVersion, 0).u64(0).str("", 128).str("", 256).str("", 32),
+		"setuid":  *header(recordSetuid, protocolVersion, 0).u32(0).u32(0),
+		"ptrace":  *header(recordPtrace, protocolVersion, 0).u64(0).u32(0).u32(0),
+		"creds":   *header(recordCreds, protocolVersion, 0).u32(0).u32(0),
+		"fork":    *header(recordFork, protocolVersion, 0).u32(0).u32(0),
+		"exit":    *header(recordExit, protocolVersion, 0).u32(0).u32(0),
+		"setns":   *header(recordSetns, protocolVersion, 0).u32(0).u32(0).u32(0).u32(0).u32(0).u32(0),
+		"module":  *header(recordModule, protocolVersion, 0).i32(0).u32(0).u64(0),
+		"unix":    *header(recordUnix, protocolVersion, 0).u32(0).str("", 108),
+		"cap":     *header(recordCap, protocolVersion, 0).i32(0).i32(0),
+	}
+	for name, record := range full {
+		if _, err := decodeRecord(record, testBoot); err != nil {
+			t.Errorf("%s: complete record: %v", name, err)
+		}
+		// 只有头部、缺少最后一个字节的负载都必须返回错误
+		for _, size := range []int{headerSize, len(record) - 1} {
+			if _, err := decodeRecord(record[:size], testBoot); !errors.Is(err, errShortRecord) {
+				t.Errorf("%s truncated to %d bytes: err = %v, want %v", name, size, err, errShortRecord)
+			}
+		}
+	}
+
+	for _, size := range []int{0, 1, 4, headerSize - 1} {
+		if _, err := decodeRecord((*header(recordExec, protocolVersion, 0))[:size], testBoot); !errors.Is(err, errShortRecord) {
+			t.Errorf("%d-byte header: err = %v, want %v", size, err, errShortRecord)
+		}
+	}
+	for _, version := range []uint16{0, protocolVersion - 1, protocolVersion + 1} {
+		record := *header(recordSetuid, version, 0).u32(0).u32(0)
+		if _, err := decodeRecord(record, testBoot); !errors.Is(err, errVersion) {
+			t.Errorf("version %d: err = %v, want %v", version, err, errVersion)
+		}
+	}
+	for _, recordType := range []uint16{0, recordBlocked + 1, 0xffff} {
+		record := *header(recordType, protocolVersion, 0).u64(0)
+		if _, err := decodeRecord(record, testBoot); !errors.Is(err, errUnknownRecord) {
+			t.Errorf("type %d: err = %v, want %v", recordType, err, errUnknownRecord)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package ebpf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 录制文件格式：gzip压缩的JSONL，首行为 {"capture": {...}} 形式的文件头，之后每行一个事件
+const (
+	CaptureFormat  = "cloudbreach-capture"
+	CaptureVersion = 1
+
+	captureExt     = ".jsonl.gz"
+	captureMetaExt = ".meta.json"
+
+	// captureFlushInterval 录制数据至少每隔这么久刷新到磁盘一次，进程异常退出时最多丢失这段时间的事件
+	captureFlushInterval = time.Second
+)
+
+// 录制结束原因
+const (
+	StopReasonRequested = "requested"
+	StopReasonDuration  = "duration"
+	StopReasonMaxEvents = "max_events"
+	StopReasonMonitor   = "monitor_stopped"
+	StopReasonError     = "error"
+)
+
+var (
+	// ErrRecordingActive 已有录制在进行
+	ErrRecordingActive = errors.New("a recording is already in progress")
+	// ErrNotRecording 没有正在进行的录制
+	ErrNotRecording = errors.New("no recording in progress")
+	// ErrCaptureNotFound 录制文件不存在
+	ErrCaptureNotFound = errors.New("capture not found")
+	// ErrInvalidCaptureID 录制ID含有不允许的字符
+	ErrInvalidCaptureID = errors.New("invalid capture id")
+)
+
+// captureIDPattern 录制ID同时用作文件名，只允许安全字符
+var captureIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}$`)
+
+// captureNameReplacer 录制名称中不能出现在文件名里的字符
+var captureNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// RuleVersion 检测规则文件及其内容的SHA-256，用于确认录制时生效的规则
+type RuleVersion struct {
+	Source string `json:"source"`
+	SHA256 string `json:"sha256"`
+}
+
+// RuleVersioner 能够报告规则版本的检测引擎，录制时写入文件头
+type RuleVersioner interface {
+	RuleVersions() []RuleVersion
+}
+
+// CaptureHeader 录制文件头，记录采集时的主机、内核和规则版本
+type CaptureHeader struct {
+	Format    string        `json:"format"`
+	Version   int           `json:"version"`
+	ID        string        `json:"id"`
+	Name      string        `json:"name,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Host      string        `json:"host"`
+	Kernel    string        `json:"kernel,omitempty"`
+	Arch      string        `json:"arch"`
+	Source    string        `json:"source"`
+	Rules     []RuleVersion `json:"rules,omitempty"`
+}
+
+// captureLine 录制文件首行，外层的 capture 键用于与事件行区分
+type captureLine struct {
+	Capture *CaptureHeader `json:"capture"`
+}
+
+// CaptureInfo 录制文件信息
+type CaptureInfo struct {
+	CaptureHeader
+	StoppedAt  *time.Time `json:"stopped_at,omitempty"`
+	StopReason string     `json:"stop_reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Events     uint64     `json:"events"`
+	Bytes      int64      `json:"bytes"`
+	// Recording 为 true 表示仍在录制；Incomplete 表示录制未正常结束，事件数未知
+	Recording  bool `json:"recording,omitempty"`
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// RecordingOptions 录制参数
+type RecordingOptions struct {
+	Name string
+	// Duration 录制时长，到期自动停止，0 表示不限制
+	Duration time.Duration
+	// MaxEvents 录制的事件数上限，0 表示不限制
+	MaxEvents uint64
+}
+
+// recorder 正在进行的录制。事件在补全和检测之前写入，回放时重新经过完整的处理流程
+type recorder struct {
+	mu        sync.Mutex
+	info      CaptureInfo
+	path      string
+	file      *os.File
+	buf       *bufio.Writer
+	gz        *gzip.Writer
+	maxEvents uint64
+	lastFlush time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+// newCaptureID 生成录制ID：UTC时间加可选的名称
+func newCaptureID(name string, now time.Time) string {
+	id := now.UTC().Format("20060102T150405Z")
+	if name = strings.Trim(captureNameReplacer.ReplaceAllString(name, "-"), "-"); name != "" {
+		if len(name) > 64 {
+			name = name[:64]
+		}
+		id += "-" + name
+	}
+	return id
+}
+
+// startRecorder 创建录制文件并写入文件头
+func startRecorder(dir string, header CaptureHeader, opts RecordingOptions) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	path := filepath.Join(dir, header.ID+captureExt)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("capture %s already exists", header.ID)
+		}
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	r := &recorder{
+		info:      CaptureInfo{CaptureHeader: header, Recording: true},
+		path:      path,
+		file:      file,
+		buf:       bufio.NewWriter(file),
+		maxEvents: opts.MaxEvents,
+		lastFlush: time.Now(),
+	}
+	r.gz = gzip.NewWriter(r.buf)
+	if err := r.writeLine(captureLine{Capture: &header}); err == nil {
+		err = r.flush()
+	}
+	if err != nil {
+		r.gz.Close()
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write capture header: %w", err)
+	}
+	return r, nil
+}
+
+// write 写入一个事件，返回非空的原因时录制应当停止
+func (r *recorder) write(event Event) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ""
+	}
+
+	if err := r.writeLine(event); err != nil {
+		r.info.Error = err.Error()
+		return StopReasonError
+	}
+	r.info.Events++
+	if time.Since(r.lastFlush) >= captureFlushInterval {
+		if err := r.flush(); err != nil {
+			r.info.Error = err.Error()
+			return StopReasonError
+		}
+	}
+	if r.maxEvents > 0 && r.info.Events >= r.maxEvents {
+		return StopReasonMaxEvents
+	}
+	return ""
+}
+
+func (r *recorder) writeLine(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = r.gz.Write(data)
+	return err
+}
+
+// flush 将已压缩的数据写入文件，之前的事件在进程异常退出后仍可读取
+func (r *recorder) flush() error {
+	r.lastFlush = time.Now()
+	if err := r.gz.Flush(); err != nil {
+		return err
+	}
+	return r.buf.Flush()
+}
+
+// close 结束录制并写入元数据文件，重复调用返回同样的结果
+func (r *recorder) close(reason string) (CaptureInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return r.info, nil
+	}
+	r.closed = true
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+
+	err := r.gz.Close()
+	if flushErr := r.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	now := time.Now().UTC()
+	r.info.StoppedAt = &now
+	r.info.StopReason = reason
+	r.info.Recording = false
+	if info, statErr := os.Stat(r.path); statErr == nil {
+		r.info.Bytes = info.Size()
+	}
+	if err != nil && r.info.Error == "" {
+		r.info.Error = err.Error()
+	}
+	if metaErr := writeCaptureMeta(r.path, r.info); err == nil {
+		err = metaErr
+	}
+	return r.info, err
+}
+
+// snapshot 返回录制进度
+func (r *recorder) snapshot() CaptureInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := r.info
+	if stat, err := r.file.Stat(); err == nil && !r.closed {
+		info.Bytes = stat.Size()
+	}
+	return info
+}
+
+// writeCaptureMeta 写入录制结束后的元数据，列出录制时不必解压整个文件
+func writeCaptureMeta(capturePath string, info CaptureInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSuffix(capturePath, captureExt) + captureMetaExt
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// listCaptures 列出目录中的录制文件，按开始时间倒序。没有元数据的文件从文件头读取信息
+func listCaptures(dir string) ([]CaptureInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+captureExt))
+	if err != nil {
+		return nil, err
+	}
+
+	captures := make([]CaptureInfo, 0, len(paths))
+	for _, path := range paths {
+		info, err := readCaptureInfo(path)
+		if err != nil {
+			continue
+		}
+		captures = append(captures, info)
+	}
+	sort.Slice(captures, func(i, j int) bool {
+		return captures[i].StartedAt.After(captures[j].StartedAt)
+	})
+	return captures, nil
+}
+
+// readCaptureInfo 读取单个录制文件的信息。ID 以文件名为准，文件被复制或改名后仍可下载和回放
+func readCaptureInfo(path string) (CaptureInfo, error) {
+	var info CaptureInfo
+	id := strings.TrimSuffix(filepath.Base(path), captureExt)
+	data, err := os.ReadFile(strings.TrimSuffix(path, captureExt) + captureMetaExt)
+	if err == nil {
+		if err := json.Unmarshal(data, &info); err != nil {
+			return info, fmt.Errorf("invalid capture metadata: %w", err)
+		}
+		info.ID = id
+		return info, nil
+	}
+
+	header, err := readCaptureHeader(path)
+	if err != nil {
+		return info, err
+	}
+	info.CaptureHeader = *header
+	info.ID = id
+	info.Incomplete = true
+	if stat, err := os.Stat(path); err == nil {
+		info.Bytes = stat.Size()
+	}
+	return info, nil
+}
+
+// readCaptureHeader 读取录制文件头，不是录制文件时返回错误
+func readCaptureHeader(path string) (*CaptureHeader, error) {
+	file, err := openEventFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+	header, ok, err := parseCaptureHeader(bytes.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not a capture file", path)
+	}
+	return header, nil
+}
+
+// parseCaptureHeader 解析录制文件头。不是文件头的行返回false，版本不受支持时返回错误
+func parseCaptureHeader(data []byte) (*CaptureHeader, bool, error) {
+	if !bytes.HasPrefix(data, []byte("{")) || !bytes.HasPrefix(bytes.TrimSpace(data[1:]), []byte(`"capture"`)) {
+		return nil, false, nil
+	}
+	var line captureLine
+	if err := json.Unmarshal(data, &line); err != nil || line.Capture == nil {
+		return nil, false, nil
+	}
+	header := line.Capture
+	if header.Format != CaptureFormat {
+		return nil, false, fmt.Errorf("unknown capture format %q", header.Format)
+	}
+	if header.Version < 1 || header.Version > CaptureVersion {
+		return nil, false, fmt.Errorf("unsupported capture version %d, this build reads up to version %d", header.Version, CaptureVersion)
+	}
+	return header, true, nil
+}
+
+// capturePath 返回录制ID对应的文件路径
+func capturePath(dir, id string) (string, error) {
+	if !captureIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCaptureID, id)
+	}
+	path := filepath.Join(dir, id+captureExt)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrCaptureNotFound
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// eventFile 事件文件读取器，gzip压缩的文件自动解压
+type eventFile struct {
+	io.Reader
+	gz   *gzip.Reader
+	file *os.File
+}
+
+// openEventFile 打开JSONL事件文件或录制文件
+func openEventFile(path string) (*eventFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid gzip file %s: %w", path, err)
+		}
+		return &eventFile{Reader: &completeLineReader{r: gz, chunk: make([]byte, 32*1024)}, gz: gz, file: file}, nil
+	}
+	return &eventFile{Reader: reader, file: file}, nil
+}
+
+func (f *eventFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	return f.file.Close()
+}
+
+// completeLineReader 只交出以换行结尾的数据。录制未正常结束时gzip流被截断，
+// 最后一行可能只写了一半，丢弃这部分内容后报告 io.ErrUnexpectedEOF
+type completeLineReader struct {
+	r     io.Reader
+	chunk []byte
+	buf   []byte
+	err   error
+}
+
+func (c *completeLineReader) Read(p []byte) (int, error) {
+	for {
+		if i := bytes.LastIndexByte(c.buf, '\n'); i >= 0 {
+			n := copy(p, c.buf[:i+1])
+			c.buf = c.buf[n:]
+			return n, nil
+		}
+		if c.err != nil {
+			if c.err == io.EOF && len(c.buf) > 0 {
+				n := copy(p, c.buf)
+				c.buf = c.buf[n:]
+				return n, nil
+			}
+			return 0, c.err
+		}
+		n, err := c.r.Read(c.chunk)
+		c.buf = append(c.buf, c.chunk[:n]...)
+		c.err = err
+	}
+}
+
+// captureEnvironment 采集环境：主机名、内核版本和CPU架构
+func captureEnvironment(procRoot string) (host, kernel, arch string) {
+	host, _ = os.Hostname()
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	if data, err := os.ReadFile(filepath.Join(procRoot, "sys", "kernel", "osrelease")); err == nil {
+		kernel = strings.TrimSpace(string(data))
+	}
+	return host, kernel, runtime.GOARCH
+}
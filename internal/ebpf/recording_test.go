@@ -0,0 +1,210 @@
+package ebpf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// captureEvents 录制测试使用的事件，包含嵌套的详情字段
+func captureEvents() []Event {
+	return []Event{
+		{Timestamp: 1700000000, PID: 10, Comm: "bash", EventType: "process", Severity: "info", Filename: "/bin/bash"},
+		{Timestamp: 1700000001, PID: 11, Comm: "cat", EventType: "file", Severity: "high", Syscall: "openat",
+			Filename: "/etc/shadow", File: &FileDetails{Mode: 0400}},
+		{Timestamp: 1700000002, PID: 12, Comm: "curl", EventType: "network", Severity: "medium", Syscall: "connect",
+			Network: &NetworkDetails{Protocol: "tcp", Direction: "outbound", Family: "ipv4", DestAddr: "203.0.113.7", DestPort: 443}},
+		{Timestamp: 1700000002, PID: 13, Comm: "insmod", EventType: "module", Severity: "critical", ContainerID: "abc123"},
+	}
+}
+
+func testHeader(id string) CaptureHeader {
+	return CaptureHeader{Format: CaptureFormat, Version: CaptureVersion, ID: id, StartedAt: time.Unix(1700000000, 0).UTC(),
+		Host: "node-1", Kernel: "6.1.0", Arch: "amd64", Source: SourceKernel}
+}
+
+// recordEvents 录制事件，close 为 false 时只刷新到磁盘而不结束录制，模拟进程异常退出
+func recordEvents(t *testing.T, dir, id string, events []Event, close bool) string {
+	t.Helper()
+	r, err := startRecorder(dir, testHeader(id), RecordingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if reason := r.write(event); reason != "" {
+			t.Fatalf("write stopped: %s", reason)
+		}
+	}
+	if close {
+		if _, err := r.close(StopReasonRequested); err != nil {
+			t.Fatal(err)
+		}
+	} else if err := r.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return r.path
+}
+
+// replayEvents 以最快速度回放文件，返回回放的事件和计数器。时间戳在回放时被改写，比较前清零
+func replayEvents(t *testing.T, path string) ([]Event, *replaySource, *monitorCounters, error) {
+	t.Helper()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	stats := &monitorCounters{}
+	source := newReplaySource(path, 0, false, log, stats).(*replaySource)
+	if err := source.Open(); err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	err := source.Run(context.Background(), func(event Event) {
+		event.Timestamp = 0
+		events = append(events, event)
+	})
+	return events, source, stats, err
+}
+
+func withoutTimestamps(events []Event) []Event {
+	out := make([]Event, len(events))
+	for i, event := range events {
+		event.Timestamp = 0
+		out[i] = event
+	}
+	return out
+}
+
+func TestRecordingReplayRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	events := captureEvents()
+	path := recordEvents(t, dir, "20231114T221320Z-roundtrip", events, true)
+
+	got, source, stats, err := replayEvents(t, path)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := withoutTimestamps(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed events differ\n got: %+v\nwant: %+v", got, want)
+	}
+	if n := stats.decodeErrors.Load(); n != 0 {
+		t.Errorf("decode errors = %d, want 0", n)
+	}
+	if details := source.Details(); details["capture"] != "20231114T221320Z-roundtrip" || details["capture_host"] != "node-1" || details["emitted"] != "4" {
+		t.Errorf("details = %v", details)
+	}
+
+	captures, err := listCaptures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 1 {
+		t.Fatalf("captures = %+v, want one", captures)
+	}
+	if c := captures[0]; c.Events != 4 || c.StopReason != StopReasonRequested || c.Incomplete || c.Recording || c.Bytes == 0 {
+		t.Errorf("capture info = %+v", c)
+	}
+}
+
+func TestReplayIncompleteCapture(t *testing.T) {
+	dir := t.TempDir()
+	events := captureEvents()
+	path := recordEvents(t, dir, "incomplete", events, false)
+
+	// 没有gzip结尾和元数据文件，已刷新的事件照常回放
+	info, err := readCaptureInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Incomplete || info.ID != "incomplete" {
+		t.Errorf("capture info = %+v, want incomplete", info)
+	}
+	got, _, _, err := replayEvents(t, path)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := withoutTimestamps(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed events differ\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestReplayTruncatedCapture(t *testing.T) {
+	dir := t.TempDir()
+	events := captureEvents()
+	path := recordEvents(t, dir, "truncated", events, true)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 从任意位置截断，回放的事件都是录制事件的前缀，不会出现半行解析出的事件
+	want := withoutTimestamps(events)
+	for size := len(data) - 1; size > 20; size -= 7 {
+		cut := filepath.Join(dir, "cut.jsonl.gz")
+		if err := os.WriteFile(cut, data[:size], 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, _, stats, err := replayEvents(t, cut)
+		if err != nil && !strings.Contains(err.Error(), "flate") && !strings.Contains(err.Error(), "gzip") {
+			t.Fatalf("size %d: unexpected error %v", size, err)
+		}
+		if len(got) > len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want[:len(got)])) {
+			t.Fatalf("size %d: replayed %+v, want a prefix of the recording", size, got)
+		}
+		if n := stats.decodeErrors.Load(); n != 0 {
+			t.Fatalf("size %d: decode errors = %d, want 0", size, n)
+		}
+	}
+}
+
+func TestReplayCorruptCapture(t *testing.T) {
+	gzipped := func(lines ...string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(strings.Join(lines, "\n") + "\n"))
+		gz.Close()
+		return buf.Bytes()
+	}
+	header := `{"capture":{"format":"cloudbreach-capture","version":1,"id":"corrupt","source":"kernel"}}`
+	event := `{"pid":1,"event_type":"process","severity":"info"}`
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantErr     string
+		wantEvents  int
+		wantDecodes uint64
+	}{
+		{name: "malformed event line", data: gzipped(header, event, `{"pid":`, event), wantEvents: 2, wantDecodes: 1},
+		{name: "unsupported version", data: gzipped(strings.Replace(header, `"version":1`, `"version":99`, 1), event), wantErr: "unsupported capture version"},
+		{name: "unknown format", data: gzipped(strings.Replace(header, CaptureFormat, "other", 1), event), wantErr: "unknown capture format"},
+		{name: "invalid gzip header", data: []byte{0x1f, 0x8b, 0x00, 0x00, 'x'}, wantErr: "invalid gzip file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "corrupt.jsonl.gz")
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, _, stats, err := replayEvents(t, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if len(got) != tt.wantEvents || stats.decodeErrors.Load() != tt.wantDecodes {
+				t.Errorf("events = %d, decode errors = %d, want %d, %d", len(got), stats.decodeErrors.Load(), tt.wantEvents, tt.wantDecodes)
+			}
+		})
+	}
+}
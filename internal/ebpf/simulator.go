@@ -0,0 +1,155 @@
+package ebpf
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cloudsecops/internal/workload"
+
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed scenarios/*.json
+var builtinScenarios embed.FS
+
+// Scenario 模拟器场景。按顺序回放步骤中的事件，结果完全确定，便于演示和联调
+type Scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Loop        bool           `json:"loop"`
+	Steps       []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep 场景中的一个步骤
+type ScenarioStep struct {
+	Delay  string `json:"delay"`  // 发出事件前的等待时间，如 "5s"
+	Repeat int    `json:"repeat"` // 重复次数，0 视为1次
+	Event  Event  `json:"event"`
+
+	delay time.Duration
+}
+
+// loadScenario 加载场景，name 可以是内置场景名或场景文件路径
+func loadScenario(name string) (*Scenario, error) {
+	if name == "" {
+		name = "default"
+	}
+
+	data, err := builtinScenarios.ReadFile("scenarios/" + name + ".json")
+	if err != nil {
+		data, err = os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q is neither built in nor a readable file: %w", name, err)
+		}
+	}
+
+	var scenario Scenario
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", name, err)
+	}
+	if len(scenario.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %s has no steps", name)
+	}
+	if scenario.Name == "" {
+		scenario.Name = name
+	}
+
+	// 同一容器只需在首次出现时写明工作负载信息，后续步骤沿用
+	workloads := make(map[string]*workload.Workload)
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if w := step.Event.Workload; w != nil {
+			if step.Event.ContainerID == "" {
+				step.Event.ContainerID = w.ContainerID
+			}
+			workloads[step.Event.ContainerID] = w
+		} else if w, ok := workloads[step.Event.ContainerID]; ok {
+			step.Event.Workload = w
+		}
+		if step.Delay != "" {
+			step.delay, err = time.ParseDuration(step.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("scenario %s step %d: invalid delay: %w", name, i, err)
+			}
+		}
+		if step.Repeat <= 0 {
+			step.Repeat = 1
+		}
+	}
+
+	return &scenario, nil
+}
+
+// BuiltinScenarios 返回内置场景名称
+func BuiltinScenarios() []string {
+	entries, err := builtinScenarios.ReadDir("scenarios")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names
+}
+
+// simulatorSource 场景模拟事件源
+type simulatorSource struct {
+	scenario *Scenario
+	log      *logrus.Logger
+	emitted  atomic.Uint64
+}
+
+// newSimulatorSource 创建场景模拟事件源
+func newSimulatorSource(scenario string, log *logrus.Logger) (EventSource, error) {
+	s, err := loadScenario(scenario)
+	if err != nil {
+		return nil, err
+	}
+	return &simulatorSource{scenario: s, log: log}, nil
+}
+
+func (s *simulatorSource) Name() string { return SourceSimulator }
+
+func (s *simulatorSource) Open() error { return nil }
+
+func (s *simulatorSource) Run(ctx context.Context, emit func(Event)) error {
+	s.log.WithField("scenario", s.scenario.Name).Info("Running simulated event scenario")
+
+	for {
+		for _, step := range s.scenario.Steps {
+			for i := 0; i < step.Repeat; i++ {
+				if !sleepContext(ctx, step.delay) {
+					return nil
+				}
+				event := step.Event
+				if event.Timestamp == 0 {
+					event.Timestamp = time.Now().Unix()
+				}
+				emit(event)
+				s.emitted.Add(1)
+			}
+		}
+		if !s.scenario.Loop {
+			return nil
+		}
+	}
+}
+
+func (s *simulatorSource) Close() error { return nil }
+
+func (s *simulatorSource) Details() map[string]string {
+	return map[string]string{
+		"scenario": s.scenario.Name,
+		"steps":    strconv.Itoa(len(s.scenario.Steps)),
+		"loop":     strconv.FormatBool(s.scenario.Loop),
+		"emitted":  strconv.FormatUint(s.emitted.Load(), 10),
+	}
+}
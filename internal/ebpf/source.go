@@ -0,0 +1,76 @@
+package ebpf
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloudsecops/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 事件源名称
+const (
+	SourceAuto      = "auto"
+	SourceKernel    = "kernel"
+	SourceSimulator = "simulator"
+	SourceReplay    = "replay"
+)
+
+// EventSource 事件源。内核探针、场景模拟器和录制回放都通过它向监控器提供事件，
+// 之后的处理流程完全相同
+type EventSource interface {
+	// Name 返回事件源名称
+	Name() string
+	// Open 准备事件源所需的资源，失败时返回明确的原因
+	Open() error
+	// Run 持续产生事件直到 ctx 取消、事件源被关闭或数据耗尽，正常结束时返回nil
+	Run(ctx context.Context, emit func(Event)) error
+	// Close 释放资源并中断阻塞中的 Run
+	Close() error
+	// Details 返回用于状态展示的事件源信息
+	Details() map[string]string
+}
+
+// validSource 检查事件源名称是否合法
+func validSource(name string) bool {
+	switch name {
+	case "", SourceAuto, SourceKernel, SourceSimulator, SourceReplay:
+		return true
+	default:
+		return false
+	}
+}
+
+// newEventSource 根据名称创建事件源
+func newEventSource(name string, cfg config.EBPFConfig, log *logrus.Logger, stats *monitorCounters) (EventSource, error) {
+	switch name {
+	case SourceKernel:
+		return newKernelSource(cfg, log, stats), nil
+	case SourceSimulator:
+		return newSimulatorSource(cfg.Scenario, log)
+	case SourceReplay:
+		if cfg.ReplayPath == "" {
+			return nil, fmt.Errorf("replay source requires EBPF_REPLAY_FILE")
+		}
+		return newReplaySource(cfg.ReplayPath, cfg.ReplaySpeed, cfg.ReplayLoop, log, stats), nil
+	default:
+		return nil, fmt.Errorf("unknown event source: %s", name)
+	}
+}
+
+// sleepContext 等待指定时间，ctx 取消时提前返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
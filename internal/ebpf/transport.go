@@ -0,0 +1,200 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// 事件传输方式
+const (
+	TransportRingBuf = "ringbuf"
+	TransportPerf    = "perf"
+)
+
+// eventReader 从内核读取原始记录
+type eventReader interface {
+	// Read 阻塞读取一条记录，同时返回此前因缓冲区已满而丢失的样本数；
+	// 读取器关闭后返回 os.ErrClosed
+	Read() ([]byte, uint64, error)
+	Close() error
+}
+
+// ringbufReader ring buffer 读取器
+type ringbufReader struct {
+	reader *ringbuf.Reader
+}
+
+func (r *ringbufReader) Read() ([]byte, uint64, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	return record.RawSample, 0, nil
+}
+
+func (r *ringbufReader) Close() error {
+	return r.reader.Close()
+}
+
+// perfReader perf缓冲区读取器
+type perfReader struct {
+	reader *perf.Reader
+}
+
+func (r *perfReader) Read() ([]byte, uint64, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	return record.RawSample, record.LostSamples, nil
+}
+
+func (r *perfReader) Close() error {
+	return r.reader.Close()
+}
+
+// selectTransport 根据配置和内核能力选择传输方式，并相应改写对象中的 events 映射。
+// 内核不支持 ring buffer（5.8 之前）时回退到perf事件数组
+func selectTransport(spec *ebpf.CollectionSpec, mode string, ringBufSize int) (string, error) {
+	eventsSpec, ok := spec.Maps["events"]
+	if !ok {
+		return "", fmt.Errorf("eBPF object has no events map")
+	}
+
+	transport := TransportRingBuf
+	switch mode {
+	case "", "auto":
+		if err := features.HaveMapType(ebpf.RingBuf); err != nil {
+			transport = TransportPerf
+		}
+	case TransportRingBuf:
+		if err := features.HaveMapType(ebpf.RingBuf); err != nil {
+			return "", fmt.Errorf("ring buffer is not supported by this kernel: %w", err)
+		}
+	case TransportPerf:
+		transport = TransportPerf
+	default:
+		return "", fmt.Errorf("unknown eBPF transport: %s", mode)
+	}
+
+	if transport == TransportPerf {
+		eventsSpec.Type = ebpf.PerfEventArray
+		eventsSpec.KeySize = 4
+		eventsSpec.ValueSize = 4
+		eventsSpec.MaxEntries = 0 // 加载时按CPU数量设置
+	} else if ringBufSize > 0 {
+		eventsSpec.MaxEntries = ringBufferSize(ringBufSize)
+	}
+
+	useRingBuf := uint32(0)
+	if transport == TransportRingBuf {
+		useRingBuf = 1
+	}
+	if err := spec.RewriteConstants(map[string]interface{}{"use_ringbuf": useRingBuf}); err != nil {
+		return "", fmt.Errorf("failed to configure transport: %w", err)
+	}
+
+	return transport, nil
+}
+
+// ringBufferSize 将大小调整为页大小整数倍的2的幂，ring buffer 要求如此
+func ringBufferSize(size int) uint32 {
+	page := os.Getpagesize()
+	n := page
+	for n < size {
+		n <<= 1
+	}
+	return uint32(n)
+}
+
+// newEventReader 为 events 映射创建对应的读取器
+func newEventReader(transport string, events *ebpf.Map, perfBufferSize int) (eventReader, error) {
+	if transport == TransportRingBuf {
+		reader, err := ringbuf.NewReader(events)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ring buffer reader: %w", err)
+		}
+		return &ringbufReader{reader: reader}, nil
+	}
+
+	reader, err := perf.NewReader(events, perfBufferSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open perf reader: %w", err)
+	}
+	return &perfReader{reader: reader}, nil
+}
+
+// isClosed 判断读取器是否已关闭
+func isClosed(err error) bool {
+	return errors.Is(err, os.ErrClosed) || errors.Is(err, perf.ErrClosed) || errors.Is(err, ringbuf.ErrClosed)
+}
+
+// MonitorStats 事件采集统计
+type MonitorStats struct {
+	Transport     string `json:"transport"`
+	Received      uint64 `json:"received"`      // 成功解码的事件数
+	Lost          uint64 `json:"lost"`          // 内核缓冲区已满而丢失的事件数
+	DecodeErrors  uint64 `json:"decode_errors"` // 无法解码的记录数
+	ReadErrors    uint64 `json:"read_errors"`   // 读取缓冲区失败的次数
+	Dropped       uint64 `json:"dropped"`       // 订阅者缓冲区已满而丢弃的事件数
+	Evicted       uint64 `json:"evicted"`       // 因消费过慢被驱逐的订阅者数
+	Subscribers   int    `json:"subscribers"`   // 当前订阅者数
+	Flows         int    `json:"flows"`         // 流表中的网络流数
+	FlowsDropped  uint64 `json:"flows_dropped"` // 流表已满而未记录的新流数
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorTime int64  `json:"last_error_time,omitempty"`
+
+	// 内核侧过滤和限流丢弃的记录数，仅内核事件源提供
+	KernelFilter *KernelFilterStats `json:"kernel_filter,omitempty"`
+	// 事件处理流水线各阶段的队列和丢弃统计
+	Pipeline []QueueStats `json:"pipeline"`
+}
+
+// monitorCounters 监控器内部计数器
+type monitorCounters struct {
+	received     atomic.Uint64
+	lost         atomic.Uint64
+	decodeErrors atomic.Uint64
+	readErrors   atomic.Uint64
+
+	mu            sync.Mutex
+	lastError     string
+	lastErrorTime int64
+}
+
+// recordError 记录最近一次错误
+func (c *monitorCounters) recordError(err error, now int64) {
+	c.mu.Lock()
+	c.lastError = err.Error()
+	c.lastErrorTime = now
+	c.mu.Unlock()
+}
+
+// kernelLost 汇总内核侧丢失计数（ring buffer 预留失败或perf输出失败）
+func kernelLost(lostMap *ebpf.Map) uint64 {
+	if lostMap == nil {
+		return 0
+	}
+	return perCPUTotal(lostMap, 0)
+}
+
+// perCPUTotal 汇总每CPU计数数组中某一项在所有CPU上的值
+func perCPUTotal(m *ebpf.Map, index uint32) uint64 {
+	var perCPU []uint64
+	if err := m.Lookup(index, &perCPU); err != nil {
+		return 0
+	}
+	var total uint64
+	for _, n := range perCPU {
+		total += n
+	}
+	return total
+}
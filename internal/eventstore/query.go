@@ -0,0 +1,243 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/ebpf"
+
+	"github.com/lib/pq"
+)
+
+// 分页大小
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ErrInvalidCursor 分页游标无法解析
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query 事件查询条件，各条件之间为"与"关系，零值不过滤
+type Query struct {
+	Since       time.Time
+	Until       time.Time
+	MinSeverity string
+	Severities  []string
+	Types       []string
+	// Containers 匹配容器ID前缀、容器名、Pod名或工作负载名
+	Containers []string
+	PIDs       []uint32
+	// Text 在进程名、文件名、描述、工作负载和命中规则中不区分大小写搜索
+	Text   string
+	Limit  int
+	Cursor string
+}
+
+// Validate 检查查询条件
+func (q Query) Validate() error {
+	filter := ebpf.EventFilter{MinSeverity: q.MinSeverity, Severities: q.Severities}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Before(q.Since) {
+		return fmt.Errorf("until must not be before since")
+	}
+	if q.Limit < 0 || q.Limit > MaxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+	if q.Cursor != "" {
+		if _, _, err := decodeCursor(q.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoredEvent 已存储的事件
+type StoredEvent struct {
+	ID int64 `json:"id"`
+	ebpf.Event
+}
+
+// Page 按时间倒序的一页事件，NextCursor 为空表示没有更多结果
+type Page struct {
+	Events     []StoredEvent `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Rollup 降采样后的每小时事件计数
+type Rollup struct {
+	Bucket      time.Time `json:"bucket"`
+	EventType   string    `json:"event_type"`
+	Severity    string    `json:"severity"`
+	ContainerID string    `json:"container_id"`
+	Comm        string    `json:"comm"`
+	Count       int64     `json:"count"`
+}
+
+// Query 按条件查询事件，结果按时间和ID倒序，使用游标分页
+func (s *Store) Query(ctx context.Context, q Query) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+
+	where, args := q.conditions()
+	// 多取一条用于判断是否还有下一页
+	args = append(args, limit+1)
+	query := fmt.Sprintf("SELECT id, data FROM monitor_events%s ORDER BY time DESC, id DESC LIMIT $%d", where, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	page := &Page{Events: []StoredEvent{}}
+	for rows.Next() {
+		var event StoredEvent
+		var data []byte
+		if err := rows.Scan(&event.ID, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if err := json.Unmarshal(data, &event.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode event %d: %w", event.ID, err)
+		}
+		page.Events = append(page.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+
+	if len(page.Events) > limit {
+		page.Events = page.Events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeCursor(last.Timestamp, last.ID)
+	}
+	return page, nil
+}
+
+// conditions 构造 WHERE 子句和参数
+func (q Query) conditions() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if !q.Since.IsZero() {
+		clauses = append(clauses, "time >= "+arg(q.Since))
+	}
+	if !q.Until.IsZero() {
+		clauses = append(clauses, "time <= "+arg(q.Until))
+	}
+	if q.MinSeverity != "" {
+		clauses = append(clauses, "severity_level >= "+arg(ebpf.SeverityLevel(q.MinSeverity)))
+	}
+	if len(q.Severities) > 0 {
+		clauses = append(clauses, "severity = ANY("+arg(pq.Array(q.Severities))+")")
+	}
+	if len(q.Types) > 0 {
+		clauses = append(clauses, "event_type = ANY("+arg(pq.Array(q.Types))+")")
+	}
+	if len(q.Containers) > 0 {
+		var matches []string
+		for _, c := range q.Containers {
+			prefix := arg(escapeLike(c) + "%")
+			name := arg(c)
+			matches = append(matches, fmt.Sprintf("container_id LIKE %s OR container_name = %s OR pod_name = %s OR workload = %s",
+				prefix, name, name, name))
+		}
+		clauses = append(clauses, "("+strings.Join(matches, " OR ")+")")
+	}
+	if len(q.PIDs) > 0 {
+		pids := make([]int64, len(q.PIDs))
+		for i, pid := range q.PIDs {
+			pids[i] = int64(pid)
+		}
+		clauses = append(clauses, "pid = ANY("+arg(pq.Array(pids))+")")
+	}
+	if q.Text != "" {
+		pattern := arg("%" + escapeLike(q.Text) + "%")
+		clauses = append(clauses, fmt.Sprintf(
+			"(comm ILIKE %[1]s OR filename ILIKE %[1]s OR description ILIKE %[1]s OR workload ILIKE %[1]s OR array_to_string(rules, ' ') ILIKE %[1]s)",
+			pattern))
+	}
+	if q.Cursor != "" {
+		ts, id, _ := decodeCursor(q.Cursor)
+		clauses = append(clauses, fmt.Sprintf("(time, id) < (%s, %s)", arg(time.Unix(ts, 0).UTC()), arg(id)))
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// Rollups 查询时间范围内的降采样计数
+func (s *Store) Rollups(ctx context.Context, since, until time.Time) ([]Rollup, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT bucket, event_type, severity, container_id, comm, count
+		FROM monitor_event_rollups
+		WHERE bucket >= $1 AND bucket <= $2
+		ORDER BY bucket DESC, count DESC
+		LIMIT $3`, since, until, MaxLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+	defer rows.Close()
+
+	rollups := []Rollup{}
+	for rows.Next() {
+		var r Rollup
+		if err := rows.Scan(&r.Bucket, &r.EventType, &r.Severity, &r.ContainerID, &r.Comm, &r.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %w", err)
+		}
+		rollups = append(rollups, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+	return rollups, nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// encodeCursor 游标为最后一条事件的时间戳和ID
+func encodeCursor(ts, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", ts, id)))
+}
+
+func decodeCursor(cursor string) (int64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	tsPart, idPart, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return 0, 0, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return ts, id, nil
+}
@@ -0,0 +1,258 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/ebpf"
+)
+
+// schemaLockKey 多个实例共享数据库时，用于串行化建表和分区维护的咨询锁
+const schemaLockKey = 0x6d6f6e6576 // "monev"
+
+// partitionPrefix 按天分区的表名前缀，后接 YYYYMMDD
+const partitionPrefix = "monitor_events_"
+
+// schema 事件表按时间范围分区，索引在分区父表上定义并自动应用到各分区
+const schema = `
+CREATE TABLE IF NOT EXISTS monitor_events (
+	id             BIGSERIAL,
+	time           TIMESTAMPTZ NOT NULL,
+	event_type     TEXT NOT NULL,
+	severity       TEXT NOT NULL,
+	severity_level SMALLINT NOT NULL,
+	pid            BIGINT NOT NULL,
+	ppid           BIGINT NOT NULL,
+	uid            BIGINT NOT NULL,
+	comm           TEXT NOT NULL,
+	filename       TEXT NOT NULL,
+	description    TEXT NOT NULL,
+	container_id   TEXT NOT NULL,
+	container_name TEXT NOT NULL,
+	pod_name       TEXT NOT NULL,
+	namespace      TEXT NOT NULL,
+	workload       TEXT NOT NULL,
+	rules          TEXT[] NOT NULL,
+	data           JSONB NOT NULL,
+	PRIMARY KEY (time, id)
+) PARTITION BY RANGE (time);
+
+CREATE INDEX IF NOT EXISTS monitor_events_severity_idx ON monitor_events (severity_level, time DESC);
+CREATE INDEX IF NOT EXISTS monitor_events_type_idx ON monitor_events (event_type, time DESC);
+CREATE INDEX IF NOT EXISTS monitor_events_container_idx ON monitor_events (container_id, time DESC);
+CREATE INDEX IF NOT EXISTS monitor_events_pid_idx ON monitor_events (pid, time DESC);
+
+CREATE TABLE IF NOT EXISTS monitor_event_rollups (
+	bucket       TIMESTAMPTZ NOT NULL,
+	event_type   TEXT NOT NULL,
+	severity     TEXT NOT NULL,
+	container_id TEXT NOT NULL,
+	comm         TEXT NOT NULL,
+	count        BIGINT NOT NULL,
+	PRIMARY KEY (bucket, event_type, severity, container_id, comm)
+);
+`
+
+// downsampleQuery 将早于截止时间、未命中检测规则的低级别事件聚合为每小时计数并删除原始事件，
+// 返回降采样的事件数
+const downsampleQuery = `
+WITH moved AS (
+	DELETE FROM monitor_events
+	WHERE time < $1 AND severity_level <= $2 AND cardinality(rules) = 0
+	RETURNING time, event_type, severity, container_id, comm
+), rolled AS (
+	INSERT INTO monitor_event_rollups (bucket, event_type, severity, container_id, comm, count)
+	SELECT date_trunc('hour', time), event_type, severity, container_id, comm, count(*)
+	FROM moved
+	GROUP BY 1, 2, 3, 4, 5
+	ON CONFLICT (bucket, event_type, severity, container_id, comm)
+	DO UPDATE SET count = monitor_event_rollups.count + EXCLUDED.count
+)
+SELECT count(*) FROM moved`
+
+// Migrate 创建事件表、聚合表以及当天和次日的分区
+func (s *Store) Migrate(ctx context.Context) error {
+	err := s.withLock(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, schema); err != nil {
+			return fmt.Errorf("failed to create event tables: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	today := dayOf(time.Now())
+	for _, day := range []time.Time{today, today.AddDate(0, 0, 1)} {
+		if err := s.ensurePartition(ctx, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withLock 在持有咨询锁的事务中执行
+func (s *Store) withLock(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", schemaLockKey); err != nil {
+		return fmt.Errorf("failed to acquire schema lock: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensurePartition 确保指定日期的分区存在
+func (s *Store) ensurePartition(ctx context.Context, day time.Time) error {
+	name := partitionName(day)
+	s.mu.Lock()
+	exists := s.partitions[name]
+	s.mu.Unlock()
+	if exists {
+		return nil
+	}
+
+	err := s.withLock(ctx, func(tx *sql.Tx) error {
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF monitor_events FOR VALUES FROM ('%s') TO ('%s')",
+			name, day.Format(time.RFC3339), day.AddDate(0, 0, 1).Format(time.RFC3339))
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.partitions[name] = true
+	s.mu.Unlock()
+	return nil
+}
+
+// maintain 执行保留策略：预建次日分区、降采样低级别事件、删除过期分区和聚合计数
+func (s *Store) maintain(ctx context.Context) {
+	now := time.Now()
+	if err := s.ensurePartition(ctx, dayOf(now).AddDate(0, 0, 1)); err != nil {
+		s.maintenanceFailed(err)
+		return
+	}
+	if err := s.downsample(ctx, now); err != nil {
+		s.maintenanceFailed(err)
+		return
+	}
+	if err := s.dropExpiredPartitions(ctx, now); err != nil {
+		s.maintenanceFailed(err)
+		return
+	}
+	rollupCutoff := now.AddDate(0, 0, -s.cfg.RollupRetentionDays)
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM monitor_event_rollups WHERE bucket < $1", rollupCutoff); err != nil {
+		s.maintenanceFailed(fmt.Errorf("failed to delete expired rollups: %w", err))
+		return
+	}
+
+	s.mu.Lock()
+	s.lastMaintenance = now.Unix()
+	s.mu.Unlock()
+}
+
+func (s *Store) maintenanceFailed(err error) {
+	s.mu.Lock()
+	s.recordErrorLocked(err)
+	s.mu.Unlock()
+	s.log.Warnf("Event store maintenance failed: %v", err)
+}
+
+// downsample 降采样早于 DownsampleAfterHours 的低级别事件
+func (s *Store) downsample(ctx context.Context, now time.Time) error {
+	if s.cfg.DownsampleAfterHours <= 0 || !ebpf.ValidSeverity(s.cfg.DownsampleMaxSeverity) {
+		return nil
+	}
+	cutoff := now.Add(-time.Duration(s.cfg.DownsampleAfterHours) * time.Hour)
+	var n uint64
+	err := s.db.QueryRowContext(ctx, downsampleQuery, cutoff, ebpf.SeverityLevel(s.cfg.DownsampleMaxSeverity)).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to downsample events: %w", err)
+	}
+	s.downsampled.Add(n)
+	return nil
+}
+
+// dropExpiredPartitions 删除整天都早于保留期限的分区
+func (s *Store) dropExpiredPartitions(ctx context.Context, now time.Time) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'monitor_events'`)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions: %w", err)
+	}
+	var partitions []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan partition: %w", err)
+		}
+		partitions = append(partitions, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	cutoff := retentionCutoff(now, s.cfg.RetentionDays)
+	for _, name := range partitions {
+		day, ok := partitionDay(name)
+		if !ok || day.AddDate(0, 0, 1).After(cutoff) {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		s.mu.Lock()
+		delete(s.partitions, name)
+		s.mu.Unlock()
+		s.log.Infof("Dropped expired event partition %s", name)
+	}
+	return nil
+}
+
+// retentionCutoff 返回保留期限的起点，按天对齐，早于该时间的事件不再保留
+func retentionCutoff(now time.Time, retentionDays int) time.Time {
+	return dayOf(now).AddDate(0, 0, -retentionDays+1)
+}
+
+// dayOf 返回UTC日期的零点
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(day time.Time) string {
+	return partitionPrefix + day.Format("20060102")
+}
+
+// partitionDay 从分区表名解析日期
+func partitionDay(name string) (time.Time, bool) {
+	suffix := strings.TrimPrefix(name, partitionPrefix)
+	if suffix == name {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("20060102", suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
@@ -0,0 +1,325 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// 维护任务间隔
+const maintenanceInterval = time.Hour
+
+// eventColumns monitor_events 表的写入列，顺序与 eventValues 一致
+var eventColumns = []string{
+	"time", "event_type", "severity", "severity_level", "pid", "ppid", "uid",
+	"comm", "filename", "description", "container_id", "container_name",
+	"pod_name", "namespace", "workload", "rules", "data",
+}
+
+// Stats 事件存储统计
+type Stats struct {
+	Enabled         bool   `json:"enabled"`
+	Queued          int    `json:"queued"`
+	Written         uint64 `json:"written"`
+	Dropped         uint64 `json:"dropped"`                 // 队列已满而丢弃的事件数，低级别事件先被丢弃
+	Spilled         uint64 `json:"spilled,omitempty"`       // 队列已满时写入溢出文件的事件数
+	SpillPending    int    `json:"spill_pending,omitempty"` // 溢出文件中尚未写入数据库的事件数
+	Expired         uint64 `json:"expired"`                 // 早于保留期限、未写入的事件数
+	Failed          uint64 `json:"failed"`                  // 写入失败的事件数
+	Downsampled     uint64 `json:"downsampled"`
+	LastFlush       int64  `json:"last_flush,omitempty"`
+	LastMaintenance int64  `json:"last_maintenance,omitempty"`
+	LastError       string `json:"last_error,omitempty"`
+	LastErrorTime   int64  `json:"last_error_time,omitempty"`
+}
+
+// Store 监控事件存储。事件先进入有界队列，由后台协程批量写入按天分区的
+// monitor_events 表，并按保留策略删除过期分区、将低级别事件降采样为每小时计数
+type Store struct {
+	db    *sql.DB
+	cfg   config.EventStoreConfig
+	log   *logrus.Logger
+	queue *ebpf.PriorityQueue
+
+	written     atomic.Uint64
+	expired     atomic.Uint64
+	failed      atomic.Uint64
+	downsampled atomic.Uint64
+
+	mu              sync.Mutex
+	partitions      map[string]bool // 已确认存在的分区
+	lastFlush       int64
+	lastMaintenance int64
+	lastError       string
+	lastErrorTime   int64
+}
+
+// NewStore 创建事件存储
+func NewStore(db *sql.DB, cfg config.EventStoreConfig, log *logrus.Logger) (*Store, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 1000
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = 14
+	}
+	if cfg.RollupRetentionDays <= 0 {
+		cfg.RollupRetentionDays = 90
+	}
+	queue, err := ebpf.NewPriorityQueue(ebpf.QueueOptions{
+		Stage:         ebpf.StageStore,
+		Capacity:      cfg.QueueSize,
+		SpillDir:      cfg.SpillDir,
+		SpillMaxBytes: int64(cfg.SpillMaxBytes),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		db:         db,
+		cfg:        cfg,
+		log:        log,
+		queue:      queue,
+		partitions: make(map[string]bool),
+	}, nil
+}
+
+// Write 将事件加入写入队列，不阻塞事件处理。队列已满时先丢弃或溢出低级别事件
+func (s *Store) Write(event ebpf.Event) {
+	s.queue.Push(event)
+}
+
+// Run 批量写入事件并定期执行保留策略，直到 ctx 取消。
+// 退出前写入队列中剩余的事件
+func (s *Store) Run(ctx context.Context) {
+	s.maintain(ctx)
+
+	flush := time.NewTicker(time.Duration(s.cfg.FlushInterval) * time.Millisecond)
+	defer flush.Stop()
+	maintenance := time.NewTicker(maintenanceInterval)
+	defer maintenance.Stop()
+
+	batch := make([]ebpf.Event, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case <-s.queue.Ready():
+			for {
+				event, ok := s.queue.TryPop()
+				if !ok {
+					break
+				}
+				batch = append(batch, event)
+				if len(batch) >= s.cfg.BatchSize {
+					s.flush(ctx, batch)
+					batch = batch[:0]
+				}
+			}
+		case <-flush.C:
+			if len(batch) > 0 {
+				s.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-maintenance.C:
+			s.maintain(ctx)
+		case <-ctx.Done():
+			s.drain(batch)
+			return
+		}
+	}
+}
+
+// drain 关闭时写入内存队列中剩余的事件，溢出文件中的事件留到下次启动
+func (s *Store) drain(batch []ebpf.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.queue.Close(); err != nil {
+		s.log.Warnf("Failed to close event store queue: %v", err)
+	}
+	for {
+		event, ok := s.queue.TryPop()
+		if !ok {
+			break
+		}
+		batch = append(batch, event)
+		if len(batch) >= s.cfg.BatchSize {
+			s.flush(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		s.flush(ctx, batch)
+	}
+}
+
+// flush 写入一批事件，失败时记录错误并丢弃该批次
+func (s *Store) flush(ctx context.Context, batch []ebpf.Event) {
+	err := s.insert(ctx, batch)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastFlush = time.Now().Unix()
+	if err != nil {
+		s.recordErrorLocked(err)
+		s.log.Warnf("Failed to store monitor events: %v", err)
+	}
+}
+
+// insert 批量写入事件，早于保留期限的事件直接丢弃
+func (s *Store) insert(ctx context.Context, batch []ebpf.Event) error {
+	cutoff := retentionCutoff(time.Now(), s.cfg.RetentionDays)
+	rows := make([][]interface{}, 0, len(batch))
+	days := make(map[time.Time]bool)
+	for i := range batch {
+		ts := eventTime(&batch[i])
+		if ts.Before(cutoff) {
+			s.expired.Add(1)
+			continue
+		}
+		values, err := eventValues(&batch[i], ts)
+		if err != nil {
+			s.failed.Add(1)
+			continue
+		}
+		rows = append(rows, values)
+		days[dayOf(ts)] = true
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	for day := range days {
+		if err := s.ensurePartition(ctx, day); err != nil {
+			s.failed.Add(uint64(len(rows)))
+			return err
+		}
+	}
+	if err := s.copyRows(ctx, rows); err != nil {
+		s.failed.Add(uint64(len(rows)))
+		return err
+	}
+	s.written.Add(uint64(len(rows)))
+	return nil
+}
+
+// copyRows 在一个事务中通过 COPY 写入所有行
+func (s *Store) copyRows(ctx context.Context, rows [][]interface{}) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("monitor_events", eventColumns...))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, values := range rows {
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to copy event: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("failed to close copy: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+	return nil
+}
+
+// eventValues 将事件转换为写入列的值
+func eventValues(event *ebpf.Event, ts time.Time) ([]interface{}, error) {
+	// 与 time 列保持一致，游标分页依赖事件中的时间戳
+	event.Timestamp = ts.Unix()
+	// PostgreSQL 的 text 和 jsonb 不接受 NUL 字符
+	event.Comm = stripNUL(event.Comm)
+	event.Filename = stripNUL(event.Filename)
+	event.Description = stripNUL(event.Description)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	rules := make([]string, 0, len(event.Detections))
+	for _, d := range event.Detections {
+		rules = append(rules, d.Rule)
+	}
+	var containerName, podName, namespace string
+	if w := event.Workload; w != nil {
+		containerName, podName, namespace = w.ContainerName, w.PodName, w.Namespace
+	}
+
+	return []interface{}{
+		ts, event.EventType, event.Severity, ebpf.SeverityLevel(event.Severity),
+		int64(event.PID), int64(event.PPID), int64(event.UID),
+		event.Comm, event.Filename, event.Description, event.ContainerID, containerName,
+		podName, namespace, event.Workload.Name(), pq.Array(rules), string(data),
+	}, nil
+}
+
+func stripNUL(s string) string {
+	return strings.ReplaceAll(s, "\x00", "")
+}
+
+// eventTime 返回事件时间，缺失时使用当前时间。事件时间戳精度为秒
+func eventTime(event *ebpf.Event) time.Time {
+	if event.Timestamp <= 0 {
+		return time.Now().Truncate(time.Second).UTC()
+	}
+	return time.Unix(event.Timestamp, 0).UTC()
+}
+
+// recordErrorLocked 记录最近一次错误，调用方需持有锁
+func (s *Store) recordErrorLocked(err error) {
+	s.lastError = err.Error()
+	s.lastErrorTime = time.Now().Unix()
+}
+
+// Stats 返回事件存储统计
+func (s *Store) Stats() Stats {
+	queue := s.queue.Stats()
+	stats := Stats{
+		Enabled:      true,
+		Queued:       queue.Queued,
+		Written:      s.written.Load(),
+		Dropped:      queue.Dropped,
+		Spilled:      queue.Spilled,
+		SpillPending: queue.SpillPending,
+		Expired:      s.expired.Load(),
+		Failed:       s.failed.Load(),
+		Downsampled:  s.downsampled.Load(),
+	}
+	s.mu.Lock()
+	stats.LastFlush = s.lastFlush
+	stats.LastMaintenance = s.lastMaintenance
+	stats.LastError, stats.LastErrorTime = s.lastError, s.lastErrorTime
+	s.mu.Unlock()
+	return stats
+}
+
+// QueueStats 返回写入队列的统计，用于流水线指标
+func (s *Store) QueueStats() ebpf.QueueStats {
+	return s.queue.Stats()
+}
@@ -0,0 +1,281 @@
+package iac
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloudsecops/internal/config"
+)
+
+// 支持的归档格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ErrArchiveLimit 解压超出限制
+var ErrArchiveLimit = errors.New("archive exceeds extraction limits")
+
+// ArchiveLimits 解压限制，用于防御压缩炸弹和磁盘配额耗尽
+type ArchiveLimits struct {
+	MaxFiles     int     // 最多解压的文件数
+	MaxFileSize  int64   // 单个文件解压后的最大字节数
+	MaxTotalSize int64   // 解压后的总字节数
+	MaxRatio     float64 // 解压后大小与归档大小之比的上限
+}
+
+// ExtractStats 解压统计
+type ExtractStats struct {
+	Files   int   `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Skipped int   `json:"skipped"` // 跳过的符号链接、硬链接和设备文件等
+}
+
+// DefaultArchiveLimits 默认解压限制
+func DefaultArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxFiles:     10000,
+		MaxFileSize:  10 << 20,
+		MaxTotalSize: 200 << 20,
+		MaxRatio:     100,
+	}
+}
+
+// ArchiveLimitsFromConfig 根据配置生成解压限制
+func ArchiveLimitsFromConfig(cfg config.IaCConfig) ArchiveLimits {
+	limits := DefaultArchiveLimits()
+	if cfg.MaxArchiveFiles > 0 {
+		limits.MaxFiles = cfg.MaxArchiveFiles
+	}
+	if cfg.MaxFileMB > 0 {
+		limits.MaxFileSize = int64(cfg.MaxFileMB) << 20
+	}
+	if cfg.MaxExtractedMB > 0 {
+		limits.MaxTotalSize = int64(cfg.MaxExtractedMB) << 20
+	}
+	return limits
+}
+
+// ArchiveFormat 根据文件名判断归档格式，非归档返回空字符串
+func ArchiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	default:
+		return ""
+	}
+}
+
+// ExtractArchive 将归档安全地解压到目标目录。
+// 只会创建普通文件和目录：绝对路径和包含..的条目被拒绝，符号链接和硬链接被跳过，
+// 文件大小按实际写入的字节数而不是归档中声明的大小进行限制
+func ExtractArchive(archivePath, format, destDir string, limits ArchiveLimits) (*ExtractStats, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &extractor{
+		dest:   destDir,
+		limits: limits,
+		stats:  &ExtractStats{},
+	}
+	if limits.MaxRatio > 0 {
+		// 小归档的压缩比波动较大，至少允许解压1MB
+		ratioLimit := int64(float64(info.Size()) * limits.MaxRatio)
+		if ratioLimit < 1<<20 {
+			ratioLimit = 1 << 20
+		}
+		if x.limits.MaxTotalSize <= 0 || ratioLimit < x.limits.MaxTotalSize {
+			x.limits.MaxTotalSize = ratioLimit
+		}
+	}
+
+	if err := os.MkdirAll(destDir, 0700); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case ArchiveZip:
+		err = x.extractZip(archivePath)
+	case ArchiveTarGz:
+		err = x.extractTarGz(archivePath)
+	default:
+		err = fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return x.stats, nil
+}
+
+// extractor 解压状态
+type extractor struct {
+	dest   string
+	limits ArchiveLimits
+	stats  *ExtractStats
+}
+
+// extractZip 解压zip归档
+func (x *extractor) extractZip(archivePath string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := x.mkdir(f.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if f.UncompressedSize64 > uint64(x.maxFileSize()) {
+				return fmt.Errorf("%w: %s is too large", ErrArchiveLimit, f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			err = x.writeFile(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			x.stats.Skipped++
+		}
+	}
+
+	return nil
+}
+
+// extractTarGz 解压tar.gz归档
+func (x *extractor) extractTarGz(archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := x.mkdir(hdr.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if hdr.Size > x.maxFileSize() {
+				return fmt.Errorf("%w: %s is too large", ErrArchiveLimit, hdr.Name)
+			}
+			if err := x.writeFile(hdr.Name, tr); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			x.stats.Skipped++
+		}
+	}
+}
+
+// entryPath 校验归档条目名称并返回目标路径
+func (x *extractor) entryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("illegal path in archive: %q", name)
+		}
+	}
+	return secureJoin(x.dest, filepath.FromSlash(path.Clean(name)))
+}
+
+// mkdir 创建目录条目
+func (x *extractor) mkdir(name string) error {
+	target, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0700)
+}
+
+// writeFile 写入普通文件条目，按实际字节数执行大小限制
+func (x *extractor) writeFile(name string, r io.Reader) error {
+	if x.limits.MaxFiles > 0 && x.stats.Files >= x.limits.MaxFiles {
+		return fmt.Errorf("%w: more than %d files", ErrArchiveLimit, x.limits.MaxFiles)
+	}
+
+	target, err := x.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	// O_EXCL 保证不会覆盖已存在的文件或通过已存在的链接写出
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer out.Close()
+
+	remaining := x.maxFileSize()
+	if x.limits.MaxTotalSize > 0 && x.limits.MaxTotalSize-x.stats.Bytes < remaining {
+		remaining = x.limits.MaxTotalSize - x.stats.Bytes
+	}
+
+	// 多读一个字节用于判断是否超限
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if n > remaining {
+		return fmt.Errorf("%w: extracted size limit reached at %s", ErrArchiveLimit, name)
+	}
+
+	x.stats.Files++
+	x.stats.Bytes += n
+	return nil
+}
+
+// maxFileSize 单个文件大小上限
+func (x *extractor) maxFileSize() int64 {
+	if x.limits.MaxFileSize > 0 {
+		return x.limits.MaxFileSize
+	}
+	return 1 << 62
+}
@@ -0,0 +1,276 @@
+package iac
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveEntry 测试归档中的条目
+type archiveEntry struct {
+	name string
+	body string
+	kind byte // tar.TypeReg、tar.TypeDir、tar.TypeSymlink 或 tar.TypeLink
+	link string
+}
+
+func regular(name, body string) archiveEntry {
+	return archiveEntry{name: name, body: body, kind: tar.TypeReg}
+}
+
+// writeTestArchive 在独立的临时目录中生成归档，返回归档路径
+func writeTestArchive(t *testing.T, format string, entries []archiveEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			body := e.body
+			switch e.kind {
+			case tar.TypeDir:
+				hdr.SetMode(os.ModeDir | 0755)
+			case tar.TypeSymlink:
+				hdr.SetMode(os.ModeSymlink | 0777)
+				body = e.link
+			default:
+				hdr.SetMode(0644)
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			hdr := &tar.Header{Name: e.name, Typeflag: e.kind, Linkname: e.link, Mode: 0644}
+			if e.kind == tar.TypeReg {
+				hdr.Size = int64(len(e.body))
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if e.kind == tar.TypeReg {
+				if _, err := tw.Write([]byte(e.body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "upload."+format)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// listFiles 返回目录下所有条目的相对路径
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtractArchive(t *testing.T) {
+	limits := ArchiveLimits{MaxFiles: 10, MaxFileSize: 1 << 20, MaxTotalSize: 4 << 20, MaxRatio: 100}
+	big := strings.Repeat("a", 600)
+
+	tests := []struct {
+		name        string
+		formats     []string
+		entries     []archiveEntry
+		limits      ArchiveLimits
+		wantErr     string // 错误信息包含的内容，为空表示成功
+		wantLimit   bool   // 错误是否为 ErrArchiveLimit
+		wantFiles   []string
+		wantSkipped int
+	}{
+		{
+			name:      "regular files and directories",
+			entries:   []archiveEntry{{name: "infra/", kind: tar.TypeDir}, regular("infra/main.tf", "resource {}"), regular("k8s/pod.yaml", "kind: Pod")},
+			wantFiles: []string{"infra", "infra/main.tf", "k8s", "k8s/pod.yaml"},
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{regular("/etc/cron.d/evil", "x")},
+			wantErr: "illegal path",
+		},
+		{
+			name:    "parent traversal",
+			entries: []archiveEntry{regular("../evil.tf", "x")},
+			wantErr: "illegal path",
+		},
+		{
+			name:    "nested parent traversal",
+			entries: []archiveEntry{regular("infra/../../evil.tf", "x")},
+			wantErr: "illegal path",
+		},
+		{
+			name:    "backslash traversal",
+			entries: []archiveEntry{regular(`..\evil.tf`, "x")},
+			wantErr: "illegal path",
+		},
+		{
+			name:    "windows drive path",
+			entries: []archiveEntry{regular(`C:\evil.tf`, "x")},
+			wantErr: "illegal path",
+		},
+		{
+			// 符号链接被跳过，之后同名路径下的文件写入普通目录而不是链接目标
+			name:        "symlink skipped",
+			entries:     []archiveEntry{{name: "link", kind: tar.TypeSymlink, link: "/etc"}, regular("link/evil.tf", "x")},
+			wantFiles:   []string{"link", "link/evil.tf"},
+			wantSkipped: 1,
+		},
+		{
+			name:        "hardlink skipped",
+			formats:     []string{ArchiveTarGz},
+			entries:     []archiveEntry{regular("main.tf", "x"), {name: "passwd", kind: tar.TypeLink, link: "/etc/passwd"}},
+			wantFiles:   []string{"main.tf"},
+			wantSkipped: 1,
+		},
+		{
+			name:    "duplicate entry",
+			entries: []archiveEntry{regular("main.tf", "first"), regular("main.tf", "second")},
+			wantErr: "failed to create main.tf",
+		},
+		{
+			name:      "compression ratio bomb",
+			entries:   []archiveEntry{regular("bomb.tf", strings.Repeat("\x00", 3<<20))},
+			wantLimit: true,
+		},
+		{
+			name:      "file larger than MaxFileSize",
+			entries:   []archiveEntry{regular("big.tf", big)},
+			limits:    ArchiveLimits{MaxFileSize: 500},
+			wantLimit: true,
+		},
+		{
+			name:      "total larger than MaxTotalSize",
+			entries:   []archiveEntry{regular("a.tf", big), regular("b.tf", big)},
+			limits:    ArchiveLimits{MaxTotalSize: 1000},
+			wantLimit: true,
+		},
+		{
+			name:      "more files than MaxFiles",
+			entries:   []archiveEntry{regular("a.tf", "a"), regular("b.tf", "b"), regular("c.tf", "c")},
+			limits:    ArchiveLimits{MaxFiles: 2},
+			wantLimit: true,
+		},
+		{
+			name:      "within all limits",
+			entries:   []archiveEntry{regular("a.tf", big), regular("b.tf", "b")},
+			limits:    ArchiveLimits{MaxFiles: 2, MaxFileSize: 600, MaxTotalSize: 601},
+			wantFiles: []string{"a.tf", "b.tf"},
+		},
+	}
+	for _, tt := range tests {
+		formats := tt.formats
+		if formats == nil {
+			formats = []string{ArchiveZip, ArchiveTarGz}
+		}
+		for _, format := range formats {
+			t.Run(tt.name+"/"+format, func(t *testing.T) {
+				archive := writeTestArchive(t, format, tt.entries)
+				root := t.TempDir()
+				dest := filepath.Join(root, "out")
+				l := limits
+				if tt.limits != (ArchiveLimits{}) {
+					l = tt.limits
+				}
+
+				stats, err := ExtractArchive(archive, format, dest, l)
+				switch {
+				case tt.wantLimit:
+					if !errors.Is(err, ErrArchiveLimit) {
+						t.Fatalf("err = %v, want %v", err, ErrArchiveLimit)
+					}
+				case tt.wantErr != "":
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("err = %v, want %q", err, tt.wantErr)
+					}
+				default:
+					if err != nil {
+						t.Fatalf("ExtractArchive: %v", err)
+					}
+					if got := listFiles(t, dest); strings.Join(got, ",") != strings.Join(tt.wantFiles, ",") {
+						t.Errorf("extracted %v, want %v", got, tt.wantFiles)
+					}
+					if stats.Skipped != tt.wantSkipped {
+						t.Errorf("skipped = %d, want %d", stats.Skipped, tt.wantSkipped)
+					}
+				}
+
+				// 无论成功与否，都不能在目标目录之外创建文件
+				for _, f := range listFiles(t, root) {
+					if !strings.HasPrefix(f, "out") {
+						t.Errorf("file outside destination: %s", f)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestExtractArchiveDuplicateKeepsFirst(t *testing.T) {
+	for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+		archive := writeTestArchive(t, format, []archiveEntry{regular("main.tf", "first"), regular("main.tf", "second")})
+		dest := t.TempDir()
+		if _, err := ExtractArchive(archive, format, dest, DefaultArchiveLimits()); err == nil {
+			t.Fatalf("%s: duplicate entry extracted without error", format)
+		}
+		data, err := os.ReadFile(filepath.Join(dest, "main.tf"))
+		if err != nil || string(data) != "first" {
+			t.Errorf("%s: main.tf = %q, %v, want the first entry", format, data, err)
+		}
+	}
+}
+
+func TestArchiveFormat(t *testing.T) {
+	tests := map[string]string{
+		"infra.zip":    ArchiveZip,
+		"INFRA.ZIP":    ArchiveZip,
+		"infra.tar.gz": ArchiveTarGz,
+		"infra.tgz":    ArchiveTarGz,
+		"infra.tar":    "",
+		"main.tf":      "",
+	}
+	for name, want := range tests {
+		if got := ArchiveFormat(name); got != want {
+			t.Errorf("ArchiveFormat(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
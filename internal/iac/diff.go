@@ -0,0 +1,183 @@
+package iac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 差异状态
+const (
+	DiffNew       = "new"
+	DiffFixed     = "fixed"
+	DiffUnchanged = "unchanged"
+)
+
+// DiffResult 两次扫描结果之间的差异
+type DiffResult struct {
+	Base       string      `json:"base"`
+	Head       string      `json:"head"`
+	BaseCommit string      `json:"base_commit,omitempty"`
+	HeadCommit string      `json:"head_commit,omitempty"`
+	New        []Finding   `json:"new"`
+	Fixed      []Finding   `json:"fixed"`
+	Unchanged  []Finding   `json:"unchanged"`
+	Summary    DiffSummary `json:"summary"`
+}
+
+// DiffSummary 差异摘要
+type DiffSummary struct {
+	New       int     `json:"new"`
+	Fixed     int     `json:"fixed"`
+	Unchanged int     `json:"unchanged"`
+	NewBySev  Summary `json:"new_by_severity"`
+}
+
+// severityRanks 严重程度排序，数值越大越严重
+var severityRanks = map[string]int{
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+// SeverityRank 返回严重程度的排序值，未知严重程度返回0
+func SeverityRank(severity string) int {
+	return severityRanks[strings.ToLower(severity)]
+}
+
+// ValidSeverity 检查严重程度是否合法
+func ValidSeverity(severity string) bool {
+	return SeverityRank(severity) > 0
+}
+
+// NormalizeLocation 规范化文件位置：统一分隔符并去除多余的./前缀
+func NormalizeLocation(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	return strings.TrimPrefix(path, "./")
+}
+
+// Fingerprint 计算发现问题的稳定指纹。
+// 指纹只依赖规则、资源地址和规范化后的文件位置，不包含行号，
+// 这样无关的改动使行号偏移时同一问题仍能被识别
+func Fingerprint(f Finding) string {
+	h := sha256.New()
+	h.Write([]byte(f.Rule))
+	h.Write([]byte{0})
+	h.Write([]byte(f.Resource))
+	h.Write([]byte{0})
+	// 资源地址区分同一文件中同类型的多个资源；没有地址时保持原有指纹不变
+	if f.Address != "" {
+		h.Write([]byte(f.Address))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(NormalizeLocation(f.FilePath)))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// DiffResults 比较两次扫描结果，将问题分为新增、已修复和未变化三类
+func DiffResults(base, head *ScanResult) *DiffResult {
+	diff := &DiffResult{
+		Base:       base.ID,
+		Head:       head.ID,
+		BaseCommit: base.CommitSHA,
+		HeadCommit: head.CommitSHA,
+		New:        []Finding{},
+		Fixed:      []Finding{},
+		Unchanged:  []Finding{},
+	}
+
+	// 同一指纹可能出现多次，按出现次数配对
+	baseByFP := make(map[string][]Finding)
+	for _, f := range base.Findings {
+		fp := findingFingerprint(f)
+		baseByFP[fp] = append(baseByFP[fp], f)
+	}
+
+	for _, f := range head.Findings {
+		fp := findingFingerprint(f)
+		if matches := baseByFP[fp]; len(matches) > 0 {
+			baseByFP[fp] = matches[1:]
+			diff.Unchanged = append(diff.Unchanged, f)
+			continue
+		}
+		diff.New = append(diff.New, f)
+	}
+
+	for _, f := range base.Findings {
+		fp := findingFingerprint(f)
+		if remaining := baseByFP[fp]; len(remaining) > 0 {
+			baseByFP[fp] = remaining[1:]
+			diff.Fixed = append(diff.Fixed, f)
+		}
+	}
+
+	sortFindings(diff.New)
+	sortFindings(diff.Fixed)
+	sortFindings(diff.Unchanged)
+
+	diff.Summary = DiffSummary{
+		New:       len(diff.New),
+		Fixed:     len(diff.Fixed),
+		Unchanged: len(diff.Unchanged),
+		NewBySev:  (&Scanner{}).generateSummary(diff.New),
+	}
+
+	return diff
+}
+
+// NewAtOrAbove 返回严重程度不低于阈值的新增问题
+func (d *DiffResult) NewAtOrAbove(severity string) []Finding {
+	threshold := SeverityRank(severity)
+	var findings []Finding
+	for _, f := range d.New {
+		if SeverityRank(f.Severity) >= threshold {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// DiffGitRefs 分别扫描同一仓库的两个引用并比较结果
+func (s *Scanner) DiffGitRefs(ctx context.Context, repoURL, baseRef, headRef, subdir string, opts GitOptions) (*DiffResult, *ScanResult, *ScanResult, error) {
+	base, err := s.ScanGitRepository(ctx, GitSource{URL: repoURL, Ref: baseRef, Subdir: subdir}, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	head, err := s.ScanGitRepository(ctx, GitSource{URL: repoURL, Ref: headRef, Subdir: subdir}, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return DiffResults(base, head), base, head, nil
+}
+
+// findingFingerprint 返回问题指纹，兼容未记录指纹的历史结果
+func findingFingerprint(f Finding) string {
+	if f.Fingerprint != "" {
+		return f.Fingerprint
+	}
+	return Fingerprint(f)
+}
+
+// sortFindings 按严重程度降序、位置和规则排序，保证输出稳定
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if ra, rb := SeverityRank(a.Severity), SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Line < b.Line
+	})
+}
@@ -0,0 +1,146 @@
+package iac
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// bucketFinding 构造指定资源地址的S3公开读取问题
+func bucketFinding(address string, line int) Finding {
+	f := Finding{
+		Severity: "critical",
+		Line:     line,
+		Resource: "aws_s3_bucket",
+		Address:  address,
+		Rule:     "TF002",
+		FilePath: "infra/main.tf",
+	}
+	f.Fingerprint = Fingerprint(f)
+	return f
+}
+
+func addresses(findings []Finding) []string {
+	result := make([]string, 0, len(findings))
+	for _, f := range findings {
+		result = append(result, f.Address)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestDiffResults(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, head    []Finding
+		wantNew       []string
+		wantFixed     []string
+		wantUnchanged []string
+	}{
+		{
+			name:          "line shift keeps finding unchanged",
+			base:          []Finding{bucketFinding("aws_s3_bucket.a", 1)},
+			head:          []Finding{bucketFinding("aws_s3_bucket.a", 12)},
+			wantNew:       []string{},
+			wantFixed:     []string{},
+			wantUnchanged: []string{"aws_s3_bucket.a"},
+		},
+		{
+			name:          "same rule fixed on one bucket and introduced on another",
+			base:          []Finding{bucketFinding("aws_s3_bucket.a", 1)},
+			head:          []Finding{bucketFinding("aws_s3_bucket.b", 6)},
+			wantNew:       []string{"aws_s3_bucket.b"},
+			wantFixed:     []string{"aws_s3_bucket.a"},
+			wantUnchanged: []string{},
+		},
+		{
+			name:          "second bucket breaks while first stays",
+			base:          []Finding{bucketFinding("aws_s3_bucket.a", 1)},
+			head:          []Finding{bucketFinding("aws_s3_bucket.a", 1), bucketFinding("aws_s3_bucket.b", 6)},
+			wantNew:       []string{"aws_s3_bucket.b"},
+			wantFixed:     []string{},
+			wantUnchanged: []string{"aws_s3_bucket.a"},
+		},
+		{
+			name:          "both buckets fixed",
+			base:          []Finding{bucketFinding("aws_s3_bucket.a", 1), bucketFinding("aws_s3_bucket.b", 6)},
+			head:          nil,
+			wantNew:       []string{},
+			wantFixed:     []string{"aws_s3_bucket.a", "aws_s3_bucket.b"},
+			wantUnchanged: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffResults(&ScanResult{ID: "base", Findings: tt.base}, &ScanResult{ID: "head", Findings: tt.head})
+			check := func(kind string, got []Finding, want []string) {
+				if g := addresses(got); !equalStrings(g, want) {
+					t.Errorf("%s = %v, want %v", kind, g, want)
+				}
+			}
+			check("new", diff.New, tt.wantNew)
+			check("fixed", diff.Fixed, tt.wantFixed)
+			check("unchanged", diff.Unchanged, tt.wantUnchanged)
+			if diff.Summary.New != len(tt.wantNew) || diff.Summary.Fixed != len(tt.wantFixed) {
+				t.Errorf("summary = %+v", diff.Summary)
+			}
+		})
+	}
+}
+
+func TestFingerprintIncludesAddress(t *testing.T) {
+	a, b := bucketFinding("aws_s3_bucket.a", 1), bucketFinding("aws_s3_bucket.b", 1)
+	if a.Fingerprint == b.Fingerprint {
+		t.Fatal("findings on different resources share a fingerprint")
+	}
+
+	// 没有资源地址的历史结果指纹保持不变
+	legacy := Finding{Rule: "TF002", Resource: "aws_s3_bucket", FilePath: "./infra/main.tf"}
+	sum := sha256.Sum256([]byte("TF002\x00aws_s3_bucket\x00infra/main.tf"))
+	if got, want := Fingerprint(legacy), hex.EncodeToString(sum[:])[:32]; got != want {
+		t.Errorf("legacy fingerprint = %s, want %s", got, want)
+	}
+}
+
+func TestScanFileReportsResourceAddress(t *testing.T) {
+	tf := `resource "aws_s3_bucket" "logs" {
+  bucket = "logs"
+  acl    = "private"
+}
+
+resource "aws_s3_bucket" "public" {
+  bucket = "public"
+  acl    = "public-read"
+}
+`
+	path := filepath.Join(t.TempDir(), "main.tf")
+	if err := os.WriteFile(path, []byte(tf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewScanner().ScanFile(path)
+	if err != nil {
+		t.Fatalf("ScanFile: %v", err)
+	}
+	if len(result.Findings) != 1 {
+		t.Fatalf("findings = %+v, want one", result.Findings)
+	}
+	f := result.Findings[0]
+	if f.Rule != "TF002" || f.Address != "aws_s3_bucket.public" || f.Line != 6 {
+		t.Errorf("finding = %s %s line %d, want TF002 aws_s3_bucket.public line 6", f.Rule, f.Address, f.Line)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,432 @@
+package iac
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/config"
+)
+
+// GitSource Git仓库扫描来源
+type GitSource struct {
+	URL    string `json:"url"`
+	Ref    string `json:"ref"`    // 分支、标签或提交SHA，为空时使用远端默认分支
+	Subdir string `json:"subdir"` // 仓库内需要扫描的子目录
+}
+
+// GitOptions Git克隆选项
+type GitOptions struct {
+	WorkspaceDir    string
+	Username        string
+	Token           string
+	CredentialsFile string
+	SSHKeyPath      string
+	Timeout         time.Duration
+	AllowLocal      bool
+	CredentialHosts []string // 令牌只发送给这些主机，为空时不发送
+	CAFile          string
+	KnownHostsFile  string   // ssh仓库的主机公钥，未配置时拒绝ssh仓库
+	AllowedHosts    []string // 允许克隆的主机，为空时不允许任何远程仓库
+}
+
+// Checkout 浅克隆后的仓库工作区
+type Checkout struct {
+	Dir    string `json:"dir"`
+	Commit string `json:"commit"`
+	root   string
+}
+
+var (
+	scpLikeURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/-].*$`)
+	commitSHA  = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+)
+
+// GitOptionsFromConfig 根据配置生成Git克隆选项
+func GitOptionsFromConfig(cfg config.IaCConfig) GitOptions {
+	return GitOptions{
+		WorkspaceDir:    cfg.WorkspaceDir,
+		Username:        cfg.Git.Username,
+		Token:           cfg.Git.Token,
+		CredentialsFile: cfg.Git.CredentialsFile,
+		SSHKeyPath:      cfg.Git.SSHKeyPath,
+		Timeout:         time.Duration(cfg.Git.CloneTimeout) * time.Second,
+		AllowLocal:      cfg.Git.AllowLocal,
+		CredentialHosts: cfg.Git.CredentialHosts,
+		CAFile:          cfg.Git.CAFile,
+		KnownHostsFile:  cfg.Git.KnownHostsFile,
+		AllowedHosts:    cfg.Git.AllowedHosts,
+	}
+}
+
+// ScanGitRepository 浅克隆Git仓库并扫描，扫描完成后清理工作区
+func (s *Scanner) ScanGitRepository(ctx context.Context, src GitSource, opts GitOptions) (*ScanResult, error) {
+	checkout, err := CloneGit(ctx, src, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer checkout.Close()
+
+	target := checkout.Dir
+	if src.Subdir != "" {
+		target, err = secureJoin(checkout.Dir, src.Subdir)
+		if err != nil {
+			return nil, err
+		}
+		if info, statErr := os.Stat(target); statErr != nil || !info.IsDir() {
+			return nil, fmt.Errorf("subdir not found in repository: %s", src.Subdir)
+		}
+	}
+
+	result, err := s.ScanDirectory(target)
+	if err != nil {
+		return nil, err
+	}
+
+	result.FilePath = redactURL(src.URL)
+	if src.Subdir != "" {
+		result.FilePath += "//" + filepath.ToSlash(filepath.Clean(src.Subdir))
+	}
+	result.FileType = "git"
+	result.Repository = redactURL(src.URL)
+	result.Ref = src.Ref
+	result.CommitSHA = checkout.Commit
+
+	return result, nil
+}
+
+// CloneGit 将仓库的指定引用浅克隆到隔离的工作区
+func CloneGit(ctx context.Context, src GitSource, opts GitOptions) (*Checkout, error) {
+	if err := validateGitURL(src.URL, opts); err != nil {
+		return nil, err
+	}
+	if err := validateGitRef(src.Ref); err != nil {
+		return nil, err
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	workspaceDir := opts.WorkspaceDir
+	if workspaceDir == "" {
+		workspaceDir = os.TempDir()
+	}
+	if err := os.MkdirAll(workspaceDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create workspace dir: %w", err)
+	}
+	root, err := os.MkdirTemp(workspaceDir, "git-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	checkout := &Checkout{
+		Dir:  filepath.Join(root, "repo"),
+		root: root,
+	}
+	home := filepath.Join(root, "home")
+	if err := os.Mkdir(home, 0700); err != nil {
+		checkout.Close()
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	env, err := gitEnv(src.URL, home, opts)
+	if err != nil {
+		checkout.Close()
+		return nil, err
+	}
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	steps := [][]string{
+		{"init", "--quiet", checkout.Dir},
+		{"-C", checkout.Dir, "remote", "add", "origin", "--", src.URL},
+		{"-C", checkout.Dir, "fetch", "--quiet", "--depth=1", "--no-tags", "--no-recurse-submodules", "origin", "--", ref},
+		{"-C", checkout.Dir, "checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		if _, err := runGit(ctx, env, args...); err != nil {
+			checkout.Close()
+			return nil, err
+		}
+	}
+
+	sha, err := runGit(ctx, env, "-C", checkout.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		checkout.Close()
+		return nil, err
+	}
+	checkout.Commit = strings.TrimSpace(sha)
+
+	if commitSHA.MatchString(strings.ToLower(src.Ref)) && !strings.EqualFold(checkout.Commit, src.Ref) {
+		checkout.Close()
+		return nil, fmt.Errorf("fetched commit %s does not match requested ref %s", checkout.Commit, src.Ref)
+	}
+
+	return checkout, nil
+}
+
+// Close 删除工作区
+func (c *Checkout) Close() error {
+	if c.root == "" {
+		return nil
+	}
+	return os.RemoveAll(c.root)
+}
+
+// runGit 执行git命令，错误信息中附带stderr
+func runGit(ctx context.Context, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("git %s: %w", gitSubcommand(args), ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", gitSubcommand(args), msg)
+	}
+
+	return stdout.String(), nil
+}
+
+// gitSubcommand 返回参数中的git子命令名称
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-C" {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+// gitEnv 构造隔离的git运行环境：不读取系统/用户配置，禁用hooks和交互提示，
+// 凭据通过环境变量注入而不出现在命令行参数中。令牌只配置在允许的主机的URL下，
+// 请求其他主机（包括重定向后的主机）时git不会发送
+func gitEnv(rawURL, home string, opts GitOptions) ([]string, error) {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=" + os.DevNull,
+		"GIT_ASKPASS=",
+		"SSH_ASKPASS=",
+	}
+
+	configs := [][2]string{
+		{"core.hooksPath", os.DevNull},
+		{"core.symlinks", "false"},
+		{"protocol.allow", "never"},
+		{"protocol.https.allow", "always"},
+		{"protocol.ssh.allow", "always"},
+		{"http.followRedirects", "false"},
+		{"advice.detachedHead", "false"},
+	}
+	if opts.AllowLocal {
+		configs = append(configs, [2]string{"protocol.file.allow", "always"})
+	}
+	if opts.CAFile != "" {
+		configs = append(configs, [2]string{"http.sslCAInfo", opts.CAFile})
+	}
+
+	if host, ok := credentialHost(rawURL, opts.CredentialHosts); ok {
+		username, token, err := gitCredentials(opts)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+			configs = append(configs, [2]string{"http.https://" + host + "/.extraHeader", "Authorization: Basic " + basic})
+		}
+	}
+
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(configs)))
+	for i, kv := range configs {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]),
+		)
+	}
+
+	// 工作区的HOME是新建的，只信任 known_hosts 文件中的主机公钥
+	sshCommand := "ssh -o BatchMode=yes -o StrictHostKeyChecking=yes"
+	if opts.KnownHostsFile != "" {
+		sshCommand += fmt.Sprintf(" -o UserKnownHostsFile='%s'", strings.ReplaceAll(opts.KnownHostsFile, "'", ""))
+	}
+	if opts.SSHKeyPath != "" {
+		sshCommand += fmt.Sprintf(" -o IdentitiesOnly=yes -i '%s'", strings.ReplaceAll(opts.SSHKeyPath, "'", ""))
+	}
+	env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+
+	return env, nil
+}
+
+// credentialHost 返回https仓库地址的主机（host 或 host:port），仅当其在允许列表中时ok为true
+func credentialHost(rawURL string, allowed []string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(u.Scheme, "https") || u.Host == "" {
+		return "", false
+	}
+	host := strings.ToLower(u.Host)
+	for _, h := range allowed {
+		if strings.ToLower(strings.TrimSpace(h)) == host {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+// gitCredentials 读取凭据，优先使用挂载的密钥文件（内容为 token 或 username:token）
+func gitCredentials(opts GitOptions) (string, string, error) {
+	username, token := opts.Username, opts.Token
+	if opts.CredentialsFile != "" {
+		data, err := os.ReadFile(opts.CredentialsFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read git credentials: %w", err)
+		}
+		secret := strings.TrimSpace(string(data))
+		if user, pass, ok := strings.Cut(secret, ":"); ok {
+			username, token = user, pass
+		} else {
+			token = secret
+		}
+	}
+	if username == "" {
+		username = "x-access-token"
+	}
+	return username, token, nil
+}
+
+// validateGitURL 校验仓库地址，仅允许 AllowedHosts 中主机的https/ssh仓库，ssh仓库需配置 known_hosts，
+// 本地仓库需显式开启
+func validateGitURL(rawURL string, opts GitOptions) error {
+	if rawURL == "" {
+		return fmt.Errorf("repository URL is required")
+	}
+	if strings.HasPrefix(rawURL, "-") || strings.ContainsAny(rawURL, "\x00\n\r") {
+		return fmt.Errorf("invalid repository URL")
+	}
+
+	if scpLikeURL.MatchString(rawURL) {
+		at := strings.Index(rawURL, "@")
+		host := rawURL[at+1 : at+1+strings.Index(rawURL[at+1:], ":")]
+		return checkRemoteHost(host, "", true, opts)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https", "ssh":
+		if u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				return fmt.Errorf("credentials must not be embedded in the repository URL")
+			}
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("invalid repository URL: missing host")
+		}
+		return checkRemoteHost(u.Hostname(), u.Port(), strings.EqualFold(u.Scheme, "ssh"), opts)
+	case "file", "":
+		if !opts.AllowLocal {
+			return fmt.Errorf("local repositories are not allowed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported repository URL scheme: %s", u.Scheme)
+	}
+}
+
+// checkRemoteHost 检查远程仓库主机是否允许克隆，ssh仓库还需要 known_hosts 才能校验主机公钥
+func checkRemoteHost(host, port string, ssh bool, opts GitOptions) error {
+	if !hostAllowed(host, port, opts.AllowedHosts) {
+		return fmt.Errorf("repository host is not allowed: %s", host)
+	}
+	if ssh && opts.KnownHostsFile == "" {
+		return fmt.Errorf("ssh repositories require a known_hosts file (GIT_KNOWN_HOSTS_FILE)")
+	}
+	return nil
+}
+
+// hostAllowed 判断主机是否在允许列表中：* 匹配任意主机，*.example.com 匹配其子域名，
+// 带端口的条目（host:port）只匹配该端口
+func hostAllowed(host, port string, allowed []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+		name, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			name, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		if name == host || (strings.HasPrefix(name, "*.") && strings.HasSuffix(host, name[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGitRef 校验分支、标签或提交引用
+func validateGitRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if strings.HasPrefix(ref, "-") || strings.Contains(ref, "..") ||
+		strings.ContainsAny(ref, " \t\n\r\x00~^:?*[\\") {
+		return fmt.Errorf("invalid git ref: %s", ref)
+	}
+	return nil
+}
+
+// redactURL 去除URL中的用户信息
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// secureJoin 拼接路径并确保结果不会逃逸出根目录
+func secureJoin(root, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("path must be relative: %s", name)
+	}
+	joined := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes workspace: %s", name)
+	}
+	return joined, nil
+}
@@ -0,0 +1,303 @@
+package iac
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// requireGit 没有git时跳过测试
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// gitFixture 在临时目录中执行git命令
+func gitFixture(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newBareRepo 创建包含一个Terraform文件的裸仓库，返回仓库路径和提交SHA
+func newBareRepo(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	bare := filepath.Join(root, "repo.git")
+	work := filepath.Join(root, "work")
+	gitFixture(t, root, "init", "--quiet", "--bare", bare)
+	gitFixture(t, root, "init", "--quiet", work)
+
+	tf := "resource \"aws_s3_bucket\" \"data\" {\n  bucket = \"data\"\n  acl    = \"public-read\"\n}\n"
+	if err := os.MkdirAll(filepath.Join(work, "infra"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "infra", "main.tf"), []byte(tf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitFixture(t, work, "add", ".")
+	gitFixture(t, work, "commit", "--quiet", "-m", "initial")
+	gitFixture(t, work, "push", "--quiet", bare, "HEAD:refs/heads/main")
+	return bare, gitFixture(t, work, "rev-parse", "HEAD")
+}
+
+func TestCloneGitLocalBareRepo(t *testing.T) {
+	requireGit(t)
+	bare, sha := newBareRepo(t)
+
+	tests := []struct {
+		name string
+		ref  string
+	}{
+		{"default branch", ""},
+		{"branch", "main"},
+		{"commit", sha},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := GitOptions{WorkspaceDir: t.TempDir(), AllowLocal: true, Timeout: time.Minute}
+			checkout, err := CloneGit(context.Background(), GitSource{URL: "file://" + bare, Ref: tt.ref}, opts)
+			if err != nil {
+				t.Fatalf("CloneGit: %v", err)
+			}
+			defer checkout.Close()
+
+			if checkout.Commit != sha {
+				t.Errorf("commit = %s, want %s", checkout.Commit, sha)
+			}
+			if _, err := os.Stat(filepath.Join(checkout.Dir, "infra", "main.tf")); err != nil {
+				t.Errorf("main.tf not checked out: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloneGitRejectsLocalRepoByDefault(t *testing.T) {
+	_, err := CloneGit(context.Background(), GitSource{URL: "file:///tmp/repo.git"}, GitOptions{WorkspaceDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "local repositories are not allowed") {
+		t.Fatalf("err = %v, want local repositories are not allowed", err)
+	}
+}
+
+func TestScanGitRepository(t *testing.T) {
+	requireGit(t)
+	bare, sha := newBareRepo(t)
+
+	opts := GitOptions{WorkspaceDir: t.TempDir(), AllowLocal: true, Timeout: time.Minute}
+	result, err := NewScanner().ScanGitRepository(context.Background(), GitSource{URL: "file://" + bare, Subdir: "infra"}, opts)
+	if err != nil {
+		t.Fatalf("ScanGitRepository: %v", err)
+	}
+	if result.CommitSHA != sha || result.FileType != "git" {
+		t.Errorf("commit = %s, type = %s", result.CommitSHA, result.FileType)
+	}
+	if len(result.Findings) == 0 {
+		t.Error("expected findings for the public bucket")
+	}
+}
+
+// authRecorder 记录收到的Authorization请求头，所有请求返回404使克隆失败
+type authRecorder struct {
+	mu       sync.Mutex
+	requests int
+	headers  []string
+}
+
+func (a *authRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.requests++
+	if h := r.Header.Get("Authorization"); h != "" {
+		a.headers = append(a.headers, h)
+	}
+	a.mu.Unlock()
+	http.NotFound(w, r)
+}
+
+func TestGitCredentialsOnlySentToAllowedHosts(t *testing.T) {
+	requireGit(t)
+	recorder := &authRecorder{}
+	server := httptest.NewTLSServer(recorder)
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		wantAuth bool
+	}{
+		{"host not in allowlist", []string{"github.com"}, false},
+		{"empty allowlist", nil, false},
+		{"host in allowlist", []string{"github.com", host}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.mu.Lock()
+			recorder.requests, recorder.headers = 0, nil
+			recorder.mu.Unlock()
+
+			opts := GitOptions{
+				WorkspaceDir:    t.TempDir(),
+				Token:           "s3cret",
+				CredentialHosts: tt.allowed,
+				AllowedHosts:    []string{host},
+				CAFile:          caFile,
+				Timeout:         time.Minute,
+			}
+			if _, err := CloneGit(context.Background(), GitSource{URL: server.URL + "/org/repo.git"}, opts); err == nil {
+				t.Fatal("expected clone to fail against the stub server")
+			}
+
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if recorder.requests == 0 {
+				t.Fatal("git did not reach the server")
+			}
+			if got := len(recorder.headers) > 0; got != tt.wantAuth {
+				t.Fatalf("authorization sent = %v, want %v (headers %v)", got, tt.wantAuth, recorder.headers)
+			}
+		})
+	}
+}
+
+func TestGitEnvScopesTokenToHost(t *testing.T) {
+	opts := GitOptions{Token: "s3cret", CredentialHosts: []string{"git.example.com"}}
+
+	tests := []struct {
+		url     string
+		wantKey string
+	}{
+		{"https://git.example.com/org/repo.git", "http.https://git.example.com/.extraHeader"},
+		{"https://GIT.example.com/org/repo.git", "http.https://git.example.com/.extraHeader"},
+		{"https://attacker.example.net/org/repo.git", ""},
+		{"https://git.example.com.attacker.net/org/repo.git", ""},
+		{"ssh://git@git.example.com/org/repo.git", ""},
+	}
+	for _, tt := range tests {
+		env, err := gitEnv(tt.url, t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		var keys []string
+		for _, kv := range env {
+			if strings.Contains(kv, "Authorization") {
+				keys = append(keys, kv)
+			}
+			if strings.HasPrefix(kv, "GIT_CONFIG_KEY_") && strings.HasSuffix(kv, "=http.extraHeader") {
+				t.Errorf("%s: unscoped http.extraHeader configured", tt.url)
+			}
+		}
+		if tt.wantKey == "" {
+			if len(keys) != 0 {
+				t.Errorf("%s: credentials configured for a host outside the allowlist", tt.url)
+			}
+			continue
+		}
+		found := false
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "GIT_CONFIG_KEY_") && strings.HasSuffix(kv, "="+tt.wantKey) {
+				found = true
+			}
+		}
+		if !found || len(keys) != 1 {
+			t.Errorf("%s: want a single %s, got %v", tt.url, tt.wantKey, keys)
+		}
+	}
+}
+
+func TestValidateGitURLAllowedHosts(t *testing.T) {
+	opts := GitOptions{
+		AllowedHosts:   []string{"github.com", "*.corp.example", "git.example.com:8443"},
+		KnownHostsFile: "/etc/cloudsecops/known_hosts",
+	}
+
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"https://github.com/org/repo.git", ""},
+		{"https://GitHub.com/org/repo.git", ""},
+		{"ssh://git@github.com/org/repo.git", ""},
+		{"git@github.com:org/repo.git", ""},
+		{"https://git.corp.example/org/repo.git", ""},
+		{"https://git.example.com:8443/org/repo.git", ""},
+		{"https://git.example.com/org/repo.git", "not allowed"},
+		{"https://corp.example/org/repo.git", "not allowed"},
+		{"https://github.com.attacker.net/org/repo.git", "not allowed"},
+		{"https://169.254.169.254/latest/meta-data", "not allowed"},
+		{"git@10.0.0.1:org/repo.git", "not allowed"},
+		{"https:///org/repo.git", "missing host"},
+		{"file:///tmp/repo.git", "local repositories are not allowed"},
+	}
+	for _, tt := range tests {
+		err := validateGitURL(tt.url, opts)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.url, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", tt.url, err, tt.wantErr)
+		}
+	}
+
+	if err := validateGitURL("https://github.com/org/repo.git", GitOptions{}); err == nil {
+		t.Error("remote repository allowed with an empty allowlist")
+	}
+	if err := validateGitURL("https://any.example.org/org/repo.git", GitOptions{AllowedHosts: []string{"*"}}); err != nil {
+		t.Errorf("wildcard allowlist: %v", err)
+	}
+}
+
+func TestValidateGitURLRequiresKnownHostsForSSH(t *testing.T) {
+	opts := GitOptions{AllowedHosts: []string{"github.com"}}
+	for _, url := range []string{"ssh://git@github.com/org/repo.git", "git@github.com:org/repo.git"} {
+		if err := validateGitURL(url, opts); err == nil || !strings.Contains(err.Error(), "known_hosts") {
+			t.Errorf("%s: err = %v, want known_hosts error", url, err)
+		}
+	}
+	if err := validateGitURL("https://github.com/org/repo.git", opts); err != nil {
+		t.Errorf("https does not need known_hosts: %v", err)
+	}
+}
+
+func TestGitEnvVerifiesSSHHostKeys(t *testing.T) {
+	opts := GitOptions{KnownHostsFile: "/etc/cloudsecops/known_hosts", SSHKeyPath: "/etc/cloudsecops/id_ed25519"}
+	env, err := gitEnv("ssh://git@github.com/org/repo.git", t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var command string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GIT_SSH_COMMAND=") {
+			command = strings.TrimPrefix(kv, "GIT_SSH_COMMAND=")
+		}
+	}
+	for _, want := range []string{"StrictHostKeyChecking=yes", "UserKnownHostsFile='/etc/cloudsecops/known_hosts'", "-i '/etc/cloudsecops/id_ed25519'"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("GIT_SSH_COMMAND = %q, want %s", command, want)
+		}
+	}
+	if strings.Contains(command, "accept-new") {
+		t.Errorf("GIT_SSH_COMMAND = %q trusts unknown host keys", command)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
 // ScanResult 扫描结果
@@ -19,6 +22,11 @@ type ScanResult struct {
 	Findings    []Finding   `json:"findings"`
 	Summary     Summary     `json:"summary"`
 	Status      string      `json:"status"`
+	Repository  string      `json:"repository,omitempty"`
+	Ref         string      `json:"ref,omitempty"`
+	CommitSHA   string      `json:"commit_sha,omitempty"`
+	UploadID    string      `json:"upload_id,omitempty"`
+	Platforms   []string    `json:"platforms,omitempty"` // 扫描覆盖的平台：aws, azure, gcp, kubernetes
 }
 
 // Finding 发现的问题
@@ -31,10 +39,14 @@ type Finding struct {
 	Line        int               `json:"line"`
 	Column      int               `json:"column"`
 	Resource    string            `json:"resource"`
+	Address     string            `json:"address,omitempty"` // Terraform资源地址，格式为 类型.名称
 	Rule        string            `json:"rule"`
 	CVSS        float64           `json:"cvss"`
 	References  []string          `json:"references"`
 	Metadata    map[string]string `json:"metadata"`
+	FilePath    string            `json:"file_path,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+	Compliance  []string          `json:"compliance,omitempty"` // 映射的合规控制项，格式为 框架:编号
 }
 
 // Summary 扫描摘要
@@ -71,10 +83,17 @@ func NewScanner() *Scanner {
 	}
 }
 
+// Rules 返回扫描器加载的规则
+func (s *Scanner) Rules() []Rule {
+	rules := make([]Rule, len(s.rules))
+	copy(rules, s.rules)
+	return rules
+}
+
 // ScanDirectory 扫描目录
 func (s *Scanner) ScanDirectory(dirPath string) (*ScanResult, error) {
 	result := &ScanResult{
-		ID:        fmt.Sprintf("scan_%d", time.Now().Unix()),
+		ID:        newScanID(),
 		Timestamp: time.Now(),
 		FilePath:  dirPath,
 		FileType:  "directory",
@@ -88,6 +107,14 @@ func (s *Scanner) ScanDirectory(dirPath string) (*ScanResult, error) {
 		}
 
 		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 跳过符号链接等非常规文件，避免读取工作区之外的内容
+		if !info.Mode().IsRegular() {
 			return nil
 		}
 
@@ -98,10 +125,18 @@ func (s *Scanner) ScanDirectory(dirPath string) (*ScanResult, error) {
 		}
 
 		// 扫描文件
-		findings, err := s.scanFile(path, fileType)
+		findings, platforms, err := s.scanFile(path, fileType)
 		if err != nil {
 			return err
 		}
+		result.Platforms = mergePlatforms(result.Platforms, platforms)
+
+		// 以扫描根目录为基准记录相对路径并生成指纹
+		relPath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			relPath = path
+		}
+		annotateFindings(findings, relPath)
 
 		result.Findings = append(result.Findings, findings...)
 		return nil
@@ -125,34 +160,61 @@ func (s *Scanner) ScanFile(filePath string) (*ScanResult, error) {
 		return nil, fmt.Errorf("unsupported file type: %s", filePath)
 	}
 
-	findings, err := s.scanFile(filePath, fileType)
+	findings, platforms, err := s.scanFile(filePath, fileType)
 	if err != nil {
 		return nil, err
 	}
+	annotateFindings(findings, filepath.Base(filePath))
 
 	result := &ScanResult{
-		ID:        fmt.Sprintf("scan_%d", time.Now().Unix()),
+		ID:        newScanID(),
 		Timestamp: time.Now(),
 		FilePath:  filePath,
 		FileType:  fileType,
 		Findings:  findings,
 		Summary:   s.generateSummary(findings),
 		Status:    "completed",
+		Platforms: platforms,
 	}
 
 	return result, nil
 }
 
-// scanFile 扫描文件内容
-func (s *Scanner) scanFile(filePath, fileType string) ([]Finding, error) {
+// scanFile 扫描文件内容，返回发现的问题和文件涉及的平台
+func (s *Scanner) scanFile(filePath, fileType string) ([]Finding, []string, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var findings []Finding
 	contentStr := string(content)
 
+	// Terraform文件按资源块逐个检查，使每个问题对应到具体的资源地址
+	if fileType == "terraform" {
+		if blocks := terraformBlocks(content, filePath); len(blocks) > 0 {
+			var platforms []string
+			for _, block := range blocks {
+				if platform := terraformPlatform(block.address); platform != "" {
+					platforms = mergePlatforms(platforms, []string{platform})
+				}
+			}
+			for _, rule := range s.rules {
+				if !contains(rule.FileTypes, fileType) {
+					continue
+				}
+				for _, block := range blocks {
+					for _, f := range rule.Check(block.source, filePath) {
+						f.Address = block.address
+						f.Line += block.line - 1
+						findings = append(findings, f)
+					}
+				}
+			}
+			return findings, platforms, nil
+		}
+	}
+
 	// 应用规则
 	for _, rule := range s.rules {
 		// 检查规则是否适用于此文件类型
@@ -165,7 +227,75 @@ func (s *Scanner) scanFile(filePath, fileType string) ([]Finding, error) {
 		findings = append(findings, ruleFindings...)
 	}
 
-	return findings, nil
+	var platforms []string
+	if fileType == "kubernetes" && strings.Contains(contentStr, "apiVersion:") && strings.Contains(contentStr, "kind:") {
+		platforms = []string{"kubernetes"}
+	}
+	return findings, platforms, nil
+}
+
+// terraformBlock Terraform文件中的一个resource或data块
+type terraformBlock struct {
+	address string
+	line    int
+	source  string
+}
+
+// terraformBlocks 解析Terraform文件中的resource和data块，解析失败时返回nil
+func terraformBlocks(content []byte, filePath string) []terraformBlock {
+	file, diags := hclsyntax.ParseConfig(content, filePath, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	var blocks []terraformBlock
+	for _, block := range body.Blocks {
+		if len(block.Labels) != 2 || (block.Type != "resource" && block.Type != "data") {
+			continue
+		}
+		address := block.Labels[0] + "." + block.Labels[1]
+		if block.Type == "data" {
+			address = "data." + address
+		}
+		r := block.Range()
+		blocks = append(blocks, terraformBlock{
+			address: address,
+			line:    r.Start.Line,
+			source:  string(content[r.Start.Byte:r.End.Byte]),
+		})
+	}
+	return blocks
+}
+
+// terraformPlatform 根据资源地址中的类型前缀判断云平台
+func terraformPlatform(address string) string {
+	resourceType := strings.TrimPrefix(address, "data.")
+	switch {
+	case strings.HasPrefix(resourceType, "aws_"):
+		return "aws"
+	case strings.HasPrefix(resourceType, "azurerm_") || strings.HasPrefix(resourceType, "azuread_"):
+		return "azure"
+	case strings.HasPrefix(resourceType, "google_"):
+		return "gcp"
+	case strings.HasPrefix(resourceType, "kubernetes_"):
+		return "kubernetes"
+	}
+	return ""
+}
+
+// mergePlatforms 合并平台列表，去重并排序
+func mergePlatforms(platforms, more []string) []string {
+	for _, p := range more {
+		if !contains(platforms, p) {
+			platforms = append(platforms, p)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
 }
 
 // generateSummary 生成扫描摘要
@@ -192,6 +322,19 @@ func (s *Scanner) generateSummary(findings []Finding) Summary {
 	return summary
 }
 
+// newScanID 生成扫描ID
+func newScanID() string {
+	return fmt.Sprintf("scan_%d", time.Now().UnixNano())
+}
+
+// annotateFindings 为发现的问题记录文件路径和指纹
+func annotateFindings(findings []Finding, relPath string) {
+	for i := range findings {
+		findings[i].FilePath = NormalizeLocation(relPath)
+		findings[i].Fingerprint = Fingerprint(findings[i])
+	}
+}
+
 // getFileType 获取文件类型
 func getFileType(filePath string) string {
 	ext := strings.ToLower(filepath.Ext(filePath))
@@ -0,0 +1,77 @@
+package iac
+
+import (
+	"sort"
+	"sync"
+)
+
+// ResultStore 内存中的扫描结果存储，超过容量时淘汰最早的结果
+type ResultStore struct {
+	mu       sync.RWMutex
+	capacity int
+	results  map[string]*ScanResult
+	order    []string
+}
+
+// NewResultStore 创建扫描结果存储
+func NewResultStore(capacity int) *ResultStore {
+	if capacity <= 0 {
+		capacity = 500
+	}
+	return &ResultStore{
+		capacity: capacity,
+		results:  make(map[string]*ScanResult),
+	}
+}
+
+// Save 保存扫描结果
+func (s *ResultStore) Save(result *ScanResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.results[result.ID]; !exists {
+		s.order = append(s.order, result.ID)
+	}
+	s.results[result.ID] = result
+
+	for len(s.order) > s.capacity {
+		delete(s.results, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get 根据ID获取扫描结果
+func (s *ResultStore) Get(id string) (*ScanResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result, ok := s.results[id]
+	return result, ok
+}
+
+// List 按时间倒序列出扫描结果
+func (s *ResultStore) List(limit, offset int) ([]*ScanResult, int) {
+	s.mu.RLock()
+	all := make([]*ScanResult, 0, len(s.results))
+	for _, result := range s.results {
+		all = append(all, result)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].Timestamp.Equal(all[j].Timestamp) {
+			return all[i].Timestamp.After(all[j].Timestamp)
+		}
+		return all[i].ID > all[j].ID
+	})
+
+	total := len(all)
+	if offset < 0 || offset >= total {
+		return []*ScanResult{}, total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return all[offset:end], total
+}
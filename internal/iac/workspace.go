@@ -0,0 +1,120 @@
+package iac
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WorkspaceManager 管理上传解压和仓库克隆使用的临时工作区，并定期回收过期目录
+type WorkspaceManager struct {
+	root   string
+	ttl    time.Duration
+	logger *logrus.Logger
+}
+
+// NewWorkspaceManager 创建工作区管理器
+func NewWorkspaceManager(root string, ttl time.Duration, logger *logrus.Logger) *WorkspaceManager {
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "cloudsecops-workspaces")
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &WorkspaceManager{
+		root:   root,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Root 返回工作区根目录
+func (m *WorkspaceManager) Root() string {
+	return m.root
+}
+
+// Create 创建新的工作区目录，返回工作区ID和路径
+func (m *WorkspaceManager) Create(prefix string) (string, string, error) {
+	if err := os.MkdirAll(m.root, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create workspace root: %w", err)
+	}
+	dir, err := os.MkdirTemp(m.root, prefix)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return filepath.Base(dir), dir, nil
+}
+
+// Path 返回工作区ID对应的路径
+func (m *WorkspaceManager) Path(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || id != filepath.Base(id) {
+		return "", fmt.Errorf("invalid workspace id: %s", id)
+	}
+	dir := filepath.Join(m.root, id)
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Remove 删除工作区
+func (m *WorkspaceManager) Remove(id string) error {
+	dir, err := m.Path(id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// Collect 删除超过保留时间的工作区，返回删除数量
+func (m *WorkspaceManager) Collect() (int, error) {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-m.ttl)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(m.root, entry.Name())); err != nil {
+			m.logger.WithError(err).WithField("workspace", entry.Name()).Warn("Failed to remove expired workspace")
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Run 按间隔执行垃圾回收，直到上下文取消
+func (m *WorkspaceManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := m.Collect()
+			if err != nil {
+				m.logger.WithError(err).Warn("Workspace garbage collection failed")
+				continue
+			}
+			if removed > 0 {
+				m.logger.WithField("removed", removed).Info("Removed expired workspaces")
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package iac
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWorkspaceManagerCollect(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	m := NewWorkspaceManager(t.TempDir(), time.Hour, logger)
+
+	_, expired, err := m.Create("upload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(expired, "main.tf"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, fresh, err := m.Create("git-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, almost, err := m.Create("upload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(expired, old, old); err != nil {
+		t.Fatal(err)
+	}
+	recent := time.Now().Add(-50 * time.Minute)
+	if err := os.Chtimes(almost, recent, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := m.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired workspace still exists: %v", err)
+	}
+	for _, dir := range []string{fresh, almost} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("workspace within TTL removed: %v", err)
+		}
+	}
+}
+
+func TestWorkspaceManagerCollectMissingRoot(t *testing.T) {
+	m := NewWorkspaceManager(filepath.Join(t.TempDir(), "missing"), time.Hour, logrus.New())
+	if removed, err := m.Collect(); removed != 0 || err != nil {
+		t.Errorf("Collect = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestWorkspaceManagerPath(t *testing.T) {
+	m := NewWorkspaceManager(t.TempDir(), time.Hour, logrus.New())
+	id, dir, err := m.Create("upload-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.Path(id); err != nil || got != dir {
+		t.Errorf("Path(%q) = %q, %v, want %q", id, got, err, dir)
+	}
+	for _, id := range []string{"", ".", "..", "../etc", "a/b"} {
+		if _, err := m.Path(id); err == nil {
+			t.Errorf("Path(%q) accepted", id)
+		}
+	}
+	if err := m.Remove(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("removed workspace still exists: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloudsecops/internal/iac"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// goldenRules 固定的规则列表，避免内置规则变化导致黄金文件失效
+var goldenRules = []iac.Rule{
+	{ID: "TF002", Title: "S3 Bucket Public Read", Description: "S3 bucket allows public read access", Severity: "critical", Category: "Access Control", FileTypes: []string{"terraform"}},
+	{ID: "TF004", Title: "S3 bucket without encryption", Description: "S3 bucket has no server-side encryption", Severity: "medium", Category: "Encryption", FileTypes: []string{"terraform"}},
+	{ID: "K8S001", Title: "Container Running as Root", Description: "Container may run as root", Severity: "high", Category: "Security Context", FileTypes: []string{"kubernetes"}},
+}
+
+func goldenFinding(rule, severity, resource, file string, line int) iac.Finding {
+	f := iac.Finding{
+		ID:          rule + "-" + resource,
+		Title:       rule + " finding",
+		Description: resource + " violates " + rule,
+		Severity:    severity,
+		Category:    "Access Control",
+		Line:        line,
+		Column:      1,
+		Resource:    resource,
+		Rule:        rule,
+		CVSS:        7.5,
+		FilePath:    file,
+	}
+	f.Fingerprint = iac.Fingerprint(f)
+	return f
+}
+
+func goldenScans() (*iac.ScanResult, *iac.ScanResult) {
+	public := goldenFinding("TF002", "critical", "aws_s3_bucket.data", "main.tf", 3)
+	public.Compliance = []string{"CIS-AWS:2.1.5", "PCI-DSS:7.2.1"}
+	unencrypted := goldenFinding("TF004", "medium", "aws_s3_bucket.data", "main.tf", 1)
+	root := goldenFinding("K8S001", "high", "Deployment/web", "deploy.yaml", 0)
+	// 规则列表中不存在的规则
+	legacy := goldenFinding("LEGACY01", "low", "aws_instance.web", "", 0)
+
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	base := &iac.ScanResult{
+		ID:        "scan_base",
+		Timestamp: ts,
+		FilePath:  "infra",
+		FileType:  "git",
+		Findings:  []iac.Finding{unencrypted, legacy},
+		Status:    "completed",
+		CommitSHA: "0e188c5bb2046f1c5ad3f5e8f0b1b2c3d4e5f607",
+		Summary:   iac.Summary{TotalFiles: 2, TotalFindings: 2, Medium: 1, Low: 1},
+	}
+	head := &iac.ScanResult{
+		ID:        "scan_head",
+		Timestamp: ts.Add(time.Hour),
+		FilePath:  "infra",
+		FileType:  "git",
+		Findings:  []iac.Finding{public, unencrypted, root},
+		Status:    "completed",
+		CommitSHA: "11c87d9b0bf5a3e6c2d1f0e9d8c7b6a5f4e3d2c1",
+		Platforms: []string{"aws", "kubernetes"},
+		Summary:   iac.Summary{TotalFiles: 2, TotalFindings: 3, Critical: 1, High: 1, Medium: 1},
+	}
+	return base, head
+}
+
+// checkGolden 比较输出与 testdata 中的黄金文件，使用 -update 重新生成
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s output differs from %s:\n%s", name, path, got)
+	}
+}
+
+func TestWriteScanGolden(t *testing.T) {
+	_, head := goldenScans()
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteScan(&buf, format, head, goldenRules); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "scan."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteScanGoldenNoFindings(t *testing.T) {
+	base, _ := goldenScans()
+	base.Findings = []iac.Finding{}
+	base.Summary = iac.Summary{TotalFiles: 2}
+	for _, format := range []string{FormatTable, FormatSARIF, FormatJUnit} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteScan(&buf, format, base, goldenRules); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "scan-empty."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteDiffGolden(t *testing.T) {
+	base, head := goldenScans()
+	diff := iac.DiffResults(base, head)
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteDiff(&buf, format, diff, goldenRules); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "diff."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	base, head := goldenScans()
+	if err := WriteScan(&bytes.Buffer{}, "html", head, nil); err == nil {
+		t.Error("WriteScan accepted an unsupported format")
+	}
+	if err := WriteDiff(&bytes.Buffer{}, "html", iac.DiffResults(base, head), nil); err == nil {
+		t.Error("WriteDiff accepted an unsupported format")
+	}
+}
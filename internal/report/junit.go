@@ -0,0 +1,98 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloudsecops/internal/iac"
+)
+
+// JUnit XML 输出结构
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit 每条规则对应一个测试用例，规则产生的问题作为该用例的失败详情
+func writeJUnit(w io.Writer, rules []iac.Rule, findings []iac.Finding) error {
+	byRule := make(map[string][]iac.Finding)
+	for _, f := range findings {
+		byRule[f.Rule] = append(byRule[f.Rule], f)
+	}
+
+	suite := junitTestSuite{Name: "cloudbreach"}
+	seen := make(map[string]bool)
+	addCase := func(id, title, category string) {
+		seen[id] = true
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("%s: %s", id, title),
+			ClassName: "cloudbreach." + strings.ReplaceAll(category, " ", "_"),
+		}
+		if ruleFindings := byRule[id]; len(ruleFindings) > 0 {
+			var body strings.Builder
+			for _, f := range ruleFindings {
+				fmt.Fprintf(&body, "[%s] %s:%d %s - %s\n", f.Severity, f.FilePath, f.Line, f.Resource, f.Description)
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d finding(s)", len(ruleFindings)),
+				Type:    ruleFindings[0].Severity,
+				Body:    body.String(),
+			}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		suite.Tests++
+	}
+
+	for _, rule := range rules {
+		addCase(rule.ID, rule.Title, rule.Category)
+	}
+	for _, f := range findings {
+		if !seen[f.Rule] {
+			addCase(f.Rule, f.Title, f.Category)
+		}
+	}
+
+	doc := junitTestSuites{
+		Name:     "cloudbreach",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
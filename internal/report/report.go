@@ -0,0 +1,98 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloudsecops/internal/iac"
+)
+
+// 输出格式
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+	FormatJUnit = "junit"
+)
+
+// Formats 支持的输出格式
+var Formats = []string{FormatTable, FormatJSON, FormatSARIF, FormatJUnit}
+
+// ValidFormat 检查输出格式是否受支持
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteScan 以指定格式输出扫描结果
+func WriteScan(w io.Writer, format string, result *iac.ScanResult, rules []iac.Rule) error {
+	switch format {
+	case FormatTable:
+		return writeScanTable(w, result)
+	case FormatJSON:
+		return writeJSON(w, result)
+	case FormatSARIF:
+		return writeSARIF(w, rules, result.Findings, nil)
+	case FormatJUnit:
+		return writeJUnit(w, rules, result.Findings)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// WriteDiff 以指定格式输出差异结果。SARIF中通过baselineState区分新增、未变化和已修复的问题，
+// JUnit只将新增问题视为失败
+func WriteDiff(w io.Writer, format string, diff *iac.DiffResult, rules []iac.Rule) error {
+	switch format {
+	case FormatTable:
+		return writeDiffTable(w, diff)
+	case FormatJSON:
+		return writeJSON(w, diff)
+	case FormatSARIF:
+		var states []string
+		var findings []iac.Finding
+		for _, group := range []struct {
+			state    string
+			findings []iac.Finding
+		}{
+			{"new", diff.New},
+			{"unchanged", diff.Unchanged},
+			{"absent", diff.Fixed},
+		} {
+			for _, f := range group.findings {
+				states = append(states, group.state)
+				findings = append(findings, f)
+			}
+		}
+		return writeSARIF(w, rules, findings, states)
+	case FormatJUnit:
+		return writeJUnit(w, rules, diff.New)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// writeJSON 输出格式化的JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// sarifLevel 将严重程度映射为SARIF级别
+func sarifLevel(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return "error"
+	case "medium":
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,34 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"cloudsecops/internal/iac"
+)
+
+func TestWriteDiffSARIFBaselineStatePerResult(t *testing.T) {
+	// 同一指纹在基线中出现一次、在当前扫描中出现两次：一个未变化，一个新增
+	f := iac.Finding{Rule: "TF002", Title: "S3 Bucket Public Read", Severity: "critical", Resource: "aws_s3_bucket", FilePath: "main.tf"}
+	f.Fingerprint = iac.Fingerprint(f)
+	base := &iac.ScanResult{ID: "base", Findings: []iac.Finding{f}}
+	head := &iac.ScanResult{ID: "head", Findings: []iac.Finding{f, f}}
+	diff := iac.DiffResults(base, head)
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, FormatSARIF, diff, nil); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	var states []string
+	for _, r := range log.Runs[0].Results {
+		states = append(states, r.BaselineState)
+	}
+	if len(states) != 2 || states[0] != "new" || states[1] != "unchanged" {
+		t.Errorf("baseline states = %v, want [new unchanged]", states)
+	}
+}
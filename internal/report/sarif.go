@@ -0,0 +1,176 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"cloudsecops/internal/iac"
+)
+
+// SARIF 2.1.0 输出结构（仅包含用到的字段）
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name,omitempty"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	FullDescription      sarifMessage           `json:"fullDescription"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations,omitempty"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	BaselineState       string                 `json:"baselineState,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// ruleCVSS 规则的默认CVSS评分，用于代码扫描平台的security-severity
+var ruleCVSS = map[string]float64{
+	"critical": 9.0,
+	"high":     7.5,
+	"medium":   5.0,
+	"low":      3.0,
+	"info":     0.0,
+}
+
+// writeSARIF 输出SARIF日志，states不为空时与findings一一对应，设置每个结果的baselineState。
+// 同一指纹的出现次数变化时会同时出现在未变化和新增（或已修复）中，因此不能按指纹查找
+func writeSARIF(w io.Writer, rules []iac.Rule, findings []iac.Finding, states []string) error {
+	driver := sarifDriver{
+		Name:           "cloudbreach",
+		InformationURI: "https://github.com/Yoomay11/CloudBreach",
+		Rules:          []sarifRule{},
+	}
+
+	known := make(map[string]bool)
+	for _, rule := range rules {
+		known[rule.ID] = true
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			Name:                 rule.Title,
+			ShortDescription:     sarifMessage{Text: rule.Title},
+			FullDescription:      sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+			Properties: map[string]interface{}{
+				"category":          rule.Category,
+				"severity":          rule.Severity,
+				"security-severity": fmt.Sprintf("%.1f", ruleCVSS[rule.Severity]),
+				"tags":              []string{"security", rule.Category},
+			},
+		})
+	}
+
+	// 结果中引用但规则列表中缺失的规则（例如来自旧版本的扫描结果）
+	var extra []string
+	for _, f := range findings {
+		if !known[f.Rule] {
+			known[f.Rule] = true
+			extra = append(extra, f.Rule)
+		}
+	}
+	sort.Strings(extra)
+	for _, id := range extra {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   id,
+			ShortDescription:     sarifMessage{Text: id},
+			FullDescription:      sarifMessage{Text: id},
+			DefaultConfiguration: sarifConfiguration{Level: "warning"},
+		})
+	}
+
+	results := []sarifResult{}
+	for i, f := range findings {
+		result := sarifResult{
+			RuleID:  f.Rule,
+			Level:   sarifLevel(f.Severity),
+			Message: sarifMessage{Text: f.Description},
+			Properties: map[string]interface{}{
+				"severity": f.Severity,
+				"cvss":     f.CVSS,
+				"resource": f.Resource,
+			},
+		}
+		if len(f.Compliance) > 0 {
+			result.Properties["compliance"] = f.Compliance
+		}
+		if f.FilePath != "" {
+			location := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: f.FilePath},
+				},
+			}
+			if f.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		if f.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{"cloudbreach/v1": f.Fingerprint}
+		}
+		if states != nil {
+			result.BaselineState = states[i]
+		}
+		results = append(results, result)
+	}
+
+	return writeJSON(w, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	})
+}
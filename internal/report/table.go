@@ -0,0 +1,101 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"cloudsecops/internal/iac"
+)
+
+// writeScanTable 以表格形式输出扫描结果
+func writeScanTable(w io.Writer, result *iac.ScanResult) error {
+	fmt.Fprintf(w, "Scan %s  %s (%s)\n", result.ID, result.FilePath, result.FileType)
+	if result.CommitSHA != "" {
+		fmt.Fprintf(w, "Commit %s\n", result.CommitSHA)
+	}
+	fmt.Fprintln(w)
+
+	if err := writeFindingsTable(w, "", result.Findings); err != nil {
+		return err
+	}
+
+	s := result.Summary
+	_, err := fmt.Fprintf(w, "\n%d findings: %d critical, %d high, %d medium, %d low, %d info\n",
+		s.TotalFindings, s.Critical, s.High, s.Medium, s.Low, s.Info)
+	return err
+}
+
+// writeDiffTable 以表格形式输出差异结果
+func writeDiffTable(w io.Writer, diff *iac.DiffResult) error {
+	fmt.Fprintf(w, "Diff %s -> %s\n\n", diffLabel(diff.Base, diff.BaseCommit), diffLabel(diff.Head, diff.HeadCommit))
+
+	var rows []iac.Finding
+	var states []string
+	for _, group := range []struct {
+		state    string
+		findings []iac.Finding
+	}{
+		{iac.DiffNew, diff.New},
+		{iac.DiffFixed, diff.Fixed},
+	} {
+		for _, f := range group.findings {
+			rows = append(rows, f)
+			states = append(states, strings.ToUpper(group.state))
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(rows) == 0 {
+		fmt.Fprintln(tw, "No new or fixed findings.")
+	} else {
+		fmt.Fprintln(tw, "STATUS\tSEVERITY\tRULE\tFILE\tRESOURCE\tTITLE")
+		for i, f := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", states[i], strings.ToUpper(f.Severity), f.Rule, location(f), f.Resource, f.Title)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d new, %d fixed, %d unchanged\n", diff.Summary.New, diff.Summary.Fixed, diff.Summary.Unchanged)
+	return err
+}
+
+// writeFindingsTable 输出问题列表
+func writeFindingsTable(w io.Writer, prefix string, findings []iac.Finding) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(findings) == 0 {
+		fmt.Fprintln(tw, prefix+"No findings.")
+		return tw.Flush()
+	}
+
+	fmt.Fprintln(tw, prefix+"SEVERITY\tRULE\tFILE\tRESOURCE\tTITLE")
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\t%s\n", prefix, strings.ToUpper(f.Severity), f.Rule, location(f), f.Resource, f.Title)
+	}
+	return tw.Flush()
+}
+
+// location 格式化问题位置
+func location(f iac.Finding) string {
+	if f.FilePath == "" {
+		return "-"
+	}
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d", f.FilePath, f.Line)
+	}
+	return f.FilePath
+}
+
+// diffLabel 格式化差异两端的标识
+func diffLabel(id, commit string) string {
+	if commit == "" {
+		return id
+	}
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("%s (%s)", id, commit)
+}
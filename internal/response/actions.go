@@ -0,0 +1,170 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/workload"
+
+	"golang.org/x/sys/unix"
+)
+
+// Blocker 在内核中阻断连接，由 ebpf.Monitor 实现
+type Blocker interface {
+	BlockConnection(block ebpf.ConnectionBlock) error
+}
+
+// executor 执行响应动作。各动作依赖的客户端在未配置时为nil，对应动作被跳过
+type executor struct {
+	procRoot string
+	nodeName string
+	runtime  *workload.RuntimeClient
+	kube     *workload.KubeClient
+	kubeErr  error
+	blocker  Blocker
+}
+
+func newExecutor(cfg *config.Config, blocker Blocker) *executor {
+	x := &executor{
+		procRoot: cfg.EBPF.ProcRoot,
+		nodeName: cfg.Workload.NodeName,
+		blocker:  blocker,
+	}
+	if cfg.Workload.RuntimeSocket != "" {
+		x.runtime = workload.NewRuntimeClient(cfg.Workload.RuntimeSocket)
+	}
+	if cfg.Workload.Kubernetes {
+		x.kube, x.kubeErr = workload.NewKubeClient(cfg.Workload)
+	} else {
+		x.kubeErr = errors.New("WORKLOAD_KUBERNETES is disabled")
+	}
+	return x
+}
+
+// target 检查动作是否适用于事件，返回动作对象的描述。不适用时返回跳过原因
+func (x *executor) target(a Action, e *ebpf.Event) (string, error) {
+	switch a.Type {
+	case ActionKill:
+		if e.PID <= 1 {
+			return "", fmt.Errorf("refusing to kill pid %d", e.PID)
+		}
+		if int(e.PID) == os.Getpid() {
+			return "", fmt.Errorf("refusing to kill the monitor itself")
+		}
+		return fmt.Sprintf("pid %d (%s)", e.PID, e.Comm), nil
+
+	case ActionPause:
+		if e.ContainerID == "" {
+			return "", fmt.Errorf("event is not from a container")
+		}
+		if x.runtime == nil {
+			return "", fmt.Errorf("CONTAINER_RUNTIME_SOCKET is not configured")
+		}
+		return "container " + workload.ShortID(e.ContainerID), nil
+
+	case ActionLabel:
+		if e.Workload == nil || e.Workload.PodName == "" {
+			return "", fmt.Errorf("event is not from a Kubernetes pod")
+		}
+		if x.kube == nil {
+			return "", fmt.Errorf("kubernetes API unavailable: %w", x.kubeErr)
+		}
+		return "pod " + e.Workload.Namespace + "/" + e.Workload.PodName, nil
+
+	case ActionCordon:
+		if e.Workload == nil || e.Workload.PodName == "" {
+			return "", fmt.Errorf("event is not from a Kubernetes pod")
+		}
+		if x.kube == nil {
+			return "", fmt.Errorf("kubernetes API unavailable: %w", x.kubeErr)
+		}
+		node := x.node(e)
+		if node == "" {
+			return "", fmt.Errorf("node of the pod is unknown, set NODE_NAME")
+		}
+		return "node " + node, nil
+
+	case ActionBlock:
+		block, err := connectionBlock(a, e)
+		if err != nil {
+			return "", err
+		}
+		if x.blocker == nil {
+			return "", ebpf.ErrBlockingUnavailable
+		}
+		return block.String(), nil
+	}
+	return "", fmt.Errorf("unknown action %q", a.Type)
+}
+
+// run 执行动作，调用前已通过 target 检查
+func (x *executor) run(ctx context.Context, a Action, e *ebpf.Event) error {
+	switch a.Type {
+	case ActionKill:
+		return x.kill(e)
+	case ActionPause:
+		return x.runtime.Pause(ctx, e.ContainerID)
+	case ActionLabel:
+		w := e.Workload
+		patch := map[string]interface{}{"metadata": map[string]interface{}{"labels": a.Labels}}
+		return x.kube.Patch(ctx, "/api/v1/namespaces/"+w.Namespace+"/pods/"+w.PodName, patch)
+	case ActionCordon:
+		patch := map[string]interface{}{"spec": map[string]interface{}{"unschedulable": true}}
+		return x.kube.Patch(ctx, "/api/v1/nodes/"+x.node(e), patch)
+	case ActionBlock:
+		block, err := connectionBlock(a, e)
+		if err != nil {
+			return err
+		}
+		return x.blocker.BlockConnection(block)
+	}
+	return fmt.Errorf("unknown action %q", a.Type)
+}
+
+// kill 结束进程。PID 在事件之后被复用时不执行，避免误杀新进程。
+// 事件中的PID 是宿主机PID，监控器需要运行在宿主机PID命名空间中
+func (x *executor) kill(e *ebpf.Event) error {
+	started, ok := ebpf.ProcessStartTime(x.procRoot, e.PID)
+	if !ok {
+		return fmt.Errorf("process %d has already exited", e.PID)
+	}
+	// 启动时间按时钟节拍换算，允许1秒误差
+	if started.Unix() > e.Timestamp+1 {
+		return fmt.Errorf("pid %d was reused after the event", e.PID)
+	}
+	if err := unix.Kill(int(e.PID), unix.SIGKILL); err != nil {
+		if errors.Is(err, unix.ESRCH) {
+			return fmt.Errorf("process %d has already exited", e.PID)
+		}
+		return fmt.Errorf("failed to kill process %d: %w", e.PID, err)
+	}
+	return nil
+}
+
+// node 返回Pod所在节点，工作负载元数据中没有时使用本节点名
+func (x *executor) node(e *ebpf.Event) string {
+	if e.Workload != nil && e.Workload.Node != "" {
+		return e.Workload.Node
+	}
+	return x.nodeName
+}
+
+// connectionBlock 从出站连接事件构造阻断项
+func connectionBlock(a Action, e *ebpf.Event) (ebpf.ConnectionBlock, error) {
+	n := e.Network
+	if n == nil || n.Direction != ebpf.DirectionOutbound || (n.Family != "ipv4" && n.Family != "ipv6") || n.DestAddr == "" {
+		return ebpf.ConnectionBlock{}, fmt.Errorf("event is not an outbound IP connection")
+	}
+	if e.CgroupID == 0 {
+		return ebpf.ConnectionBlock{}, fmt.Errorf("event has no cgroup ID")
+	}
+	block := ebpf.ConnectionBlock{CgroupID: e.CgroupID, Addr: n.DestAddr, Port: n.DestPort}
+	if a.AllPorts {
+		block.Port = 0
+	}
+	return block, nil
+}
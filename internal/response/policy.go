@@ -0,0 +1,113 @@
+package response
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 响应动作类型
+const (
+	ActionKill   = "kill"   // 结束触发事件的进程
+	ActionPause  = "pause"  // 通过本地容器运行时socket暂停容器
+	ActionLabel  = "label"  // 给Pod添加标签，供网络策略或运维流程隔离
+	ActionCordon = "cordon" // 将Pod所在节点标记为不可调度
+	ActionBlock  = "block"  // 在内核中阻断容器到对端地址的连接
+)
+
+// actionTypes 支持的动作类型
+var actionTypes = map[string]bool{
+	ActionKill:   true,
+	ActionPause:  true,
+	ActionLabel:  true,
+	ActionCordon: true,
+	ActionBlock:  true,
+}
+
+// defaultLabels label 动作未指定标签时添加的标签
+var defaultLabels = map[string]string{"cloudbreach.io/quarantine": "true"}
+
+// Action 绑定中的一个动作。YAML中可以只写动作名，也可以写成带参数的对象
+type Action struct {
+	Type     string            `json:"type" yaml:"type"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels"`       // label：添加到Pod的标签
+	AllPorts bool              `json:"all_ports,omitempty" yaml:"all_ports"` // block：阻断对端地址的所有端口
+}
+
+// UnmarshalYAML 接受 "kill" 或 {type: label, labels: {...}} 两种写法
+func (a *Action) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		a.Type = node.Value
+		return nil
+	}
+	type plain Action
+	return node.Decode((*plain)(a))
+}
+
+// Binding 检测规则与响应动作的绑定
+type Binding struct {
+	Rule     string   `json:"rule" yaml:"rule"` // 规则名，支持 * 和 ? 通配
+	Actions  []Action `json:"actions" yaml:"actions"`
+	Cooldown int      `json:"cooldown,omitempty" yaml:"cooldown"` // 秒，0 时使用 RESPONSE_DEFAULT_COOLDOWN
+	DryRun   bool     `json:"dry_run,omitempty" yaml:"dry_run"`   // 只记录将要执行的动作
+}
+
+// matches 判断规则名是否与绑定匹配
+func (b *Binding) matches(rule string) bool {
+	ok, _ := path.Match(b.Rule, rule)
+	return ok
+}
+
+// validate 检查绑定并补全默认值
+func (b *Binding) validate() error {
+	if b.Rule == "" {
+		return fmt.Errorf("rule is required")
+	}
+	if _, err := path.Match(b.Rule, ""); err != nil {
+		return fmt.Errorf("invalid rule pattern %q: %w", b.Rule, err)
+	}
+	if len(b.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	if b.Cooldown < 0 {
+		return fmt.Errorf("cooldown must not be negative")
+	}
+	for i := range b.Actions {
+		a := &b.Actions[i]
+		if !actionTypes[a.Type] {
+			return fmt.Errorf("unknown action %q, expected kill, pause, label, cordon or block", a.Type)
+		}
+		if a.Type == ActionLabel && len(a.Labels) == 0 {
+			a.Labels = defaultLabels
+		}
+		for key := range a.Labels {
+			if key == "" {
+				return fmt.Errorf("label action has an empty label key")
+			}
+		}
+	}
+	return nil
+}
+
+// loadPolicy 读取规则与响应动作的绑定文件，path 为空时没有绑定
+func loadPolicy(file string) ([]Binding, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response policy: %w", err)
+	}
+	var bindings []Binding
+	if err := yaml.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	for i := range bindings {
+		if err := bindings[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s: binding %d (%s): %w", file, i+1, bindings[i].Rule, err)
+		}
+	}
+	return bindings, nil
+}
@@ -0,0 +1,412 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 审计记录的状态
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusDryRun    = "dry_run" // 模拟执行，只记录
+	StatusSkipped   = "skipped" // 动作不适用于该事件，例如事件不属于容器
+)
+
+// 审计记录中的配置变更，与响应动作记录在同一审计日志中
+const (
+	ChangeDryRun = "set_dry_run"   // 切换模拟执行模式，Target 为新的取值
+	ChangeReload = "reload_policy" // 重新加载绑定文件，Target 为文件路径
+)
+
+// maxCooldowns 冷却表超过该大小时清理已过期的项
+const maxCooldowns = 4096
+
+// Record 审计记录，每个执行、模拟执行、跳过或失败的动作一条，以及通过API进行的配置变更。
+// 冷却期内被抑制的动作不记录，只计数
+type Record struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	Rule        string    `json:"rule,omitempty"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target,omitempty"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"` // 失败或跳过的原因
+	User        string    `json:"user,omitempty"`   // 发起配置变更的用户
+	Severity    string    `json:"severity,omitempty"`
+	EventTime   int64     `json:"event_time,omitempty"`
+	PID         uint32    `json:"pid,omitempty"`
+	Comm        string    `json:"comm,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Workload    string    `json:"workload,omitempty"`
+}
+
+// Status 响应动作状态
+type Status struct {
+	DryRun     bool              `json:"dry_run"`
+	Policy     string            `json:"policy,omitempty"`
+	Bindings   []Binding         `json:"bindings"`
+	Queued     int               `json:"queued"`
+	Dropped    uint64            `json:"dropped"`    // 队列已满而未处理的命中事件数
+	Suppressed uint64            `json:"suppressed"` // 冷却期内被抑制的动作数
+	Actions    map[string]uint64 `json:"actions"`    // 按状态统计的响应动作数，不含配置变更
+	LastError  string            `json:"last_error,omitempty"`
+}
+
+// Responder 按绑定对命中检测规则的事件执行响应动作。事件在处理路径上只做匹配和入队，
+// 动作由后台协程依次执行；同一绑定对同一目标的同一动作在冷却期内只执行一次
+type Responder struct {
+	cfg      config.ResponseConfig
+	log      *logrus.Logger
+	executor *executor
+	queue    chan ebpf.Event
+	timeout  time.Duration
+	cooldown time.Duration
+
+	dryRun     atomic.Bool
+	dropped    atomic.Uint64
+	suppressed atomic.Uint64
+
+	mu        sync.Mutex
+	bindings  []Binding
+	cooldowns map[string]time.Time
+	history   []Record
+	counts    map[string]uint64
+	seq       uint64
+	audit     *os.File
+	lastError string
+}
+
+// NewResponder 创建响应器并加载绑定文件，审计日志以追加方式打开
+func NewResponder(cfg *config.Config, blocker Blocker, log *logrus.Logger) (*Responder, error) {
+	rc := cfg.Response
+	if rc.QueueSize <= 0 {
+		rc.QueueSize = 1024
+	}
+	if rc.AuditHistory <= 0 {
+		rc.AuditHistory = 1000
+	}
+	if rc.Timeout <= 0 {
+		rc.Timeout = 10
+	}
+
+	bindings, err := loadPolicy(rc.PolicyPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &Responder{
+		cfg:       rc,
+		log:       log,
+		executor:  newExecutor(cfg, blocker),
+		queue:     make(chan ebpf.Event, rc.QueueSize),
+		timeout:   time.Duration(rc.Timeout) * time.Second,
+		cooldown:  time.Duration(rc.DefaultCooldown) * time.Second,
+		bindings:  bindings,
+		cooldowns: make(map[string]time.Time),
+		counts:    make(map[string]uint64),
+	}
+	r.dryRun.Store(rc.DryRun)
+
+	if rc.AuditPath != "" {
+		if err := os.MkdirAll(filepath.Dir(rc.AuditPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+		r.audit, err = os.OpenFile(rc.AuditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+	}
+
+	log.WithField("dry_run", rc.DryRun).Infof("Loaded %d response bindings", len(bindings))
+	return r, nil
+}
+
+// Write 命中已绑定规则的事件加入队列，不阻塞事件处理。只有内核事件源的事件触发响应：
+// 模拟器和回放事件中的PID、容器和连接不是本机当前的真实对象，对其执行动作会误伤无关进程
+func (r *Responder) Write(event ebpf.Event) {
+	if event.Source != ebpf.SourceKernel || event.Replay != "" || len(event.Detections) == 0 {
+		return
+	}
+	r.mu.Lock()
+	bound := false
+	for _, d := range event.Detections {
+		if r.bindingLocked(d.Rule) {
+			bound = true
+			break
+		}
+	}
+	r.mu.Unlock()
+	if !bound {
+		return
+	}
+
+	select {
+	case r.queue <- event:
+	default:
+		r.dropped.Add(1)
+		r.log.Warnf("Response queue is full, no action taken for %s", event.Detections[0].Rule)
+	}
+}
+
+// bindingLocked 判断规则是否有绑定，调用方需持有锁
+func (r *Responder) bindingLocked(rule string) bool {
+	for i := range r.bindings {
+		if r.bindings[i].matches(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run 依次处理队列中的事件，直到 ctx 取消。退出时未处理的事件被丢弃
+func (r *Responder) Run(ctx context.Context) {
+	defer r.closeAudit()
+	for {
+		select {
+		case event := <-r.queue:
+			r.handle(ctx, &event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handle 对事件命中的每条规则执行绑定的动作。同一事件中对同一目标的同一动作只执行一次
+func (r *Responder) handle(ctx context.Context, event *ebpf.Event) {
+	r.mu.Lock()
+	bindings := r.bindings
+	r.mu.Unlock()
+
+	done := make(map[string]bool)
+	for _, d := range event.Detections {
+		for i := range bindings {
+			b := &bindings[i]
+			if !b.matches(d.Rule) {
+				continue
+			}
+			for _, action := range b.Actions {
+				r.execute(ctx, b, action, d, event, done)
+			}
+		}
+	}
+}
+
+// execute 执行单个动作并写入审计记录
+func (r *Responder) execute(ctx context.Context, b *Binding, action Action, d ebpf.Detection, event *ebpf.Event, done map[string]bool) {
+	rec := Record{
+		Time:        time.Now().UTC(),
+		Rule:        d.Rule,
+		Action:      action.Type,
+		Severity:    d.Severity,
+		EventTime:   event.Timestamp,
+		PID:         event.PID,
+		Comm:        event.Comm,
+		ContainerID: event.ContainerID,
+		Workload:    event.Workload.Name(),
+	}
+
+	target, err := r.executor.target(action, event)
+	if err != nil {
+		rec.Status, rec.Reason = StatusSkipped, err.Error()
+		r.record(rec)
+		return
+	}
+	rec.Target = target
+	if key := action.Type + "\x00" + target; done[key] {
+		return
+	} else {
+		done[key] = true
+	}
+	if !r.acquire(b, action.Type, target, rec.Time) {
+		r.suppressed.Add(1)
+		return
+	}
+
+	if r.dryRun.Load() || b.DryRun {
+		rec.Status = StatusDryRun
+		r.record(rec)
+		return
+	}
+
+	actionCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	err = r.executor.run(actionCtx, action, event)
+	cancel()
+	if err != nil {
+		rec.Status, rec.Reason = StatusFailed, err.Error()
+	} else {
+		rec.Status = StatusSucceeded
+	}
+	r.record(rec)
+}
+
+// acquire 检查并开始冷却期，冷却期内返回false。失败的动作同样进入冷却期，避免反复重试
+func (r *Responder) acquire(b *Binding, action, target string, now time.Time) bool {
+	cooldown := r.cooldown
+	if b.Cooldown > 0 {
+		cooldown = time.Duration(b.Cooldown) * time.Second
+	}
+	key := b.Rule + "\x00" + action + "\x00" + target
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until, ok := r.cooldowns[key]; ok && now.Before(until) {
+		return false
+	}
+	if len(r.cooldowns) >= maxCooldowns {
+		for k, until := range r.cooldowns {
+			if !now.Before(until) {
+				delete(r.cooldowns, k)
+			}
+		}
+	}
+	r.cooldowns[key] = now.Add(cooldown)
+	return true
+}
+
+// record 保存动作的审计记录并计数
+func (r *Responder) record(rec Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counts[rec.Status]++
+	r.appendLocked(rec)
+
+	entry := r.log.WithFields(logrus.Fields{
+		"rule":   rec.Rule,
+		"action": rec.Action,
+		"target": rec.Target,
+		"status": rec.Status,
+	})
+	switch rec.Status {
+	case StatusFailed:
+		entry.Warnf("Response action failed: %s", rec.Reason)
+	case StatusSkipped:
+		entry.Debugf("Response action skipped: %s", rec.Reason)
+	default:
+		entry.Info("Response action taken")
+	}
+}
+
+// recordChange 保存配置变更的审计记录，不计入动作统计
+func (r *Responder) recordChange(rec Record) {
+	rec.Time = time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appendLocked(rec)
+
+	entry := r.log.WithFields(logrus.Fields{
+		"change": rec.Action,
+		"target": rec.Target,
+		"user":   rec.User,
+		"status": rec.Status,
+	})
+	if rec.Status == StatusFailed {
+		entry.Warnf("Response configuration change failed: %s", rec.Reason)
+	} else {
+		entry.Info("Response configuration changed")
+	}
+}
+
+// appendLocked 追加到审计日志，并保留最近的记录供API查询，调用方需持有锁
+func (r *Responder) appendLocked(rec Record) {
+	r.seq++
+	rec.ID = r.seq
+	if len(r.history) >= r.cfg.AuditHistory {
+		copy(r.history, r.history[1:])
+		r.history = r.history[:len(r.history)-1]
+	}
+	r.history = append(r.history, rec)
+
+	if r.audit != nil {
+		data, err := json.Marshal(rec)
+		if err == nil {
+			_, err = r.audit.Write(append(data, '\n'))
+		}
+		if err != nil {
+			r.lastError = err.Error()
+			r.log.Errorf("Failed to write response audit log: %v", err)
+		}
+	}
+}
+
+func (r *Responder) closeAudit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.audit != nil {
+		r.audit.Close()
+		r.audit = nil
+	}
+}
+
+// Records 返回最近的审计记录，按时间倒序。rule 和 status 为空时不过滤，limit 为0时不限制条数
+func (r *Responder) Records(rule, status string, limit int) []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := []Record{}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		rec := r.history[i]
+		if (rule != "" && rec.Rule != rule) || (status != "" && rec.Status != status) {
+			continue
+		}
+		records = append(records, rec)
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+	}
+	return records
+}
+
+// Status 返回响应动作状态
+func (r *Responder) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := Status{
+		DryRun:     r.dryRun.Load(),
+		Policy:     r.cfg.PolicyPath,
+		Bindings:   append([]Binding{}, r.bindings...),
+		Queued:     len(r.queue),
+		Dropped:    r.dropped.Load(),
+		Suppressed: r.suppressed.Load(),
+		Actions:    make(map[string]uint64, len(r.counts)),
+		LastError:  r.lastError,
+	}
+	for k, v := range r.counts {
+		status.Actions[k] = v
+	}
+	return status
+}
+
+// SetDryRun 切换模拟执行模式，变更写入审计日志
+func (r *Responder) SetDryRun(dryRun bool, user string) {
+	r.dryRun.Store(dryRun)
+	r.recordChange(Record{Action: ChangeDryRun, Target: strconv.FormatBool(dryRun), Status: StatusSucceeded, User: user})
+}
+
+// Reload 重新读取绑定文件，失败时保留原有绑定。冷却状态保留，成功和失败均写入审计日志
+func (r *Responder) Reload(user string) error {
+	rec := Record{Action: ChangeReload, Target: r.cfg.PolicyPath, User: user}
+	bindings, err := loadPolicy(r.cfg.PolicyPath)
+	if err != nil {
+		rec.Status, rec.Reason = StatusFailed, err.Error()
+		r.recordChange(rec)
+		return err
+	}
+	r.mu.Lock()
+	r.bindings = bindings
+	r.mu.Unlock()
+	rec.Status, rec.Reason = StatusSucceeded, fmt.Sprintf("%d bindings", len(bindings))
+	r.recordChange(rec)
+	return nil
+}
@@ -0,0 +1,280 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cloudsecops/internal/config"
+	"cloudsecops/internal/ebpf"
+	"cloudsecops/internal/logger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBlocker 记录阻断请求，代替内核中的阻断表
+type fakeBlocker struct {
+	mu     sync.Mutex
+	blocks []ebpf.ConnectionBlock
+}
+
+func (f *fakeBlocker) BlockConnection(block ebpf.ConnectionBlock) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocks = append(f.blocks, block)
+	return nil
+}
+
+func (f *fakeBlocker) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.blocks)
+}
+
+// detectAll 对每个事件都给出命中，使绑定一定匹配
+type detectAll struct{}
+
+func (detectAll) Evaluate(event *ebpf.Event) {
+	event.Detections = append(event.Detections, ebpf.Detection{Rule: "Outbound connection from shell", Severity: "critical"})
+}
+
+// outboundEvent 来自容器的出站连接，block 动作适用
+func outboundEvent() ebpf.Event {
+	return ebpf.Event{
+		Timestamp:   time.Now().Unix(),
+		PID:         5230,
+		Comm:        "sh",
+		EventType:   "network",
+		Severity:    "high",
+		ContainerID: "4c2b8e1f9a0d",
+		CgroupID:    4242,
+		Network: &ebpf.NetworkDetails{
+			Protocol:  "tcp",
+			Direction: ebpf.DirectionOutbound,
+			Family:    "ipv4",
+			DestAddr:  "203.0.113.50",
+			DestPort:  4444,
+		},
+	}
+}
+
+// newTestResponder 创建只绑定 block 动作、关闭模拟执行的响应器，即使过滤失效也不会结束本机进程
+func newTestResponder(t *testing.T) (*Responder, *fakeBlocker) {
+	t.Helper()
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policy, []byte("- rule: \"*\"\n  actions: [block]\n  cooldown: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Response = config.ResponseConfig{
+		Enabled:    true,
+		PolicyPath: policy,
+		AuditPath:  filepath.Join(dir, "audit.jsonl"),
+	}
+	cfg.Workload.RuntimeSocket = ""
+	cfg.Workload.Kubernetes = false
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	blocker := &fakeBlocker{}
+	r, err := NewResponder(cfg, blocker, log)
+	if err != nil {
+		t.Fatalf("NewResponder: %v", err)
+	}
+	return r, blocker
+}
+
+// runMonitor 用指定的事件源运行监控器直到事件源结束，事件经检测后交给响应器
+func runMonitor(t *testing.T, cfg config.EBPFConfig, r *Responder) {
+	t.Helper()
+	logger.GetLogger().SetOutput(io.Discard)
+	cfg.Profile.Dir = ""
+	cfg.Integrity.Enabled = false
+	monitor, err := ebpf.NewMonitor(cfg)
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	monitor.SetDetector(detectAll{})
+	monitor.AddSink(r)
+	if err := monitor.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for monitor.SourceStatus().State == ebpf.SourceStateRunning && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	monitor.Stop()
+	if status := monitor.SourceStatus(); status.State != ebpf.SourceStateCompleted {
+		t.Fatalf("source state = %s: %s", status.State, status.Error)
+	}
+}
+
+func TestSyntheticEventsNeverReachExecutor(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	event := outboundEvent()
+
+	scenario := ebpf.Scenario{Name: "test", Steps: []ebpf.ScenarioStep{{Repeat: 3, Event: event}}}
+	data, err := json.Marshal(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenarioPath := filepath.Join(dir, "scenario.json")
+	if err := os.WriteFile(scenarioPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 录制中的事件即使标记为内核事件，回放时也不应触发动作
+	event.Source = ebpf.SourceKernel
+	line, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayPath := filepath.Join(dir, "events.jsonl")
+	if err := os.WriteFile(replayPath, append(line, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"simulator", ebpf.SourceSimulator},
+		{"replay", ebpf.SourceReplay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, blocker := newTestResponder(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go r.Run(ctx)
+
+			ebpfCfg := cfg.EBPF
+			ebpfCfg.Source = tt.source
+			ebpfCfg.Scenario = scenarioPath
+			ebpfCfg.ReplayPath = replayPath
+			ebpfCfg.ReplaySpeed = 0
+			ebpfCfg.ReplayLoop = false
+			runMonitor(t, ebpfCfg, r)
+
+			// 内核事件作为对照：它被执行后，之前入队的事件都已处理完
+			kernel := outboundEvent()
+			kernel.Source = ebpf.SourceKernel
+			kernel.CgroupID = 1
+			kernel.Detections = []ebpf.Detection{{Rule: "Outbound connection from shell", Severity: "critical"}}
+			r.Write(kernel)
+			deadline := time.Now().Add(5 * time.Second)
+			for blocker.count() == 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			blocker.mu.Lock()
+			defer blocker.mu.Unlock()
+			if len(blocker.blocks) != 1 || blocker.blocks[0].CgroupID != 1 {
+				t.Fatalf("blocks = %+v, want only the kernel event's block", blocker.blocks)
+			}
+			if records := r.Records("", "", 0); len(records) != 1 {
+				t.Errorf("audit records = %+v, want only the kernel event", records)
+			}
+		})
+	}
+}
+
+func TestWriteIgnoresNonKernelEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		replay string
+		queued bool
+	}{
+		{"kernel", ebpf.SourceKernel, "", true},
+		{"simulator", ebpf.SourceSimulator, "", false},
+		{"replay source", ebpf.SourceReplay, "", false},
+		{"api replay of a kernel recording", ebpf.SourceKernel, "cap-1", false},
+		{"untagged", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestResponder(t)
+			event := outboundEvent()
+			event.Source, event.Replay = tt.source, tt.replay
+			event.Detections = []ebpf.Detection{{Rule: "Outbound connection from shell", Severity: "critical"}}
+			r.Write(event)
+			if got := len(r.queue) == 1; got != tt.queued {
+				t.Errorf("queued = %v, want %v", got, tt.queued)
+			}
+		})
+	}
+}
+
+func TestConfigChangesAreAudited(t *testing.T) {
+	r, _ := newTestResponder(t)
+	r.SetDryRun(true, "alice")
+	if err := r.Reload("bob"); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if err := os.WriteFile(r.cfg.PolicyPath, []byte("- rule: x\n  actions: [explode]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload("bob"); err == nil {
+		t.Fatal("expected reload of an invalid policy to fail")
+	}
+	r.closeAudit()
+
+	data, err := os.ReadFile(r.cfg.AuditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []Record
+	for _, line := range splitLines(data) {
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("invalid audit line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+
+	want := []struct{ action, status, user, target string }{
+		{ChangeDryRun, StatusSucceeded, "alice", "true"},
+		{ChangeReload, StatusSucceeded, "bob", r.cfg.PolicyPath},
+		{ChangeReload, StatusFailed, "bob", r.cfg.PolicyPath},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("audit records = %+v, want %d", records, len(want))
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec.Action != w.action || rec.Status != w.status || rec.User != w.user || rec.Target != w.target {
+			t.Errorf("record %d = %+v, want %+v", i, rec, w)
+		}
+	}
+	if status := r.Status(); len(status.Actions) != 0 {
+		t.Errorf("configuration changes counted as actions: %v", status.Actions)
+	}
+}
+
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			if i > start {
+				lines = append(lines, data[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return lines
+}
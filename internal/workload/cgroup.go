@@ -0,0 +1,194 @@
+package workload
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 容器运行时名称
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeCRIO       = "cri-o"
+	RuntimePodman     = "podman"
+	RuntimeCRI        = "cri" // kubelet cgroupfs 驱动下无法从路径判断具体运行时
+)
+
+var containerIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// scopePrefixes systemd cgroup 驱动下容器 scope 的前缀
+var scopePrefixes = []struct {
+	prefix  string
+	runtime string
+}{
+	{"docker-", RuntimeDocker},
+	{"cri-containerd-", RuntimeContainerd},
+	{"crio-", RuntimeCRIO},
+	{"libpod-", RuntimePodman},
+}
+
+// CgroupInfo 从cgroup路径中解析出的容器信息
+type CgroupInfo struct {
+	Runtime     string
+	ContainerID string
+	PodUID      string
+}
+
+// ParseCgroupPath 从cgroup路径解析容器ID，支持以下格式：
+//
+//	/docker/<id>
+//	/system.slice/docker-<id>.scope
+//	/kubepods/burstable/pod<uid>/<id>
+//	/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//	/kubepods.slice/.../crio-<id>.scope
+//	/machine.slice/libpod-<id>.scope
+//
+// 非容器进程返回 ok=false
+func ParseCgroupPath(path string) (CgroupInfo, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var info CgroupInfo
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := strings.TrimSuffix(segments[i], ".scope")
+		if info.ContainerID == "" {
+			if runtime, id, ok := parseContainerSegment(segment, segments[:i]); ok {
+				info.Runtime, info.ContainerID = runtime, id
+				continue
+			}
+		}
+		if uid := parsePodSegment(segments[i]); uid != "" {
+			info.PodUID = uid
+			break
+		}
+	}
+
+	return info, info.ContainerID != ""
+}
+
+// parseContainerSegment 解析单段路径中的容器ID
+func parseContainerSegment(segment string, parents []string) (string, string, bool) {
+	for _, p := range scopePrefixes {
+		if !strings.HasPrefix(segment, p.prefix) {
+			continue
+		}
+		id := strings.TrimPrefix(segment, p.prefix)
+		// crio-conmon-<id> 和 libpod-conmon-<id> 是监控进程，不属于容器本身
+		if containerIDPattern.MatchString(id) {
+			return p.runtime, id, true
+		}
+	}
+
+	if !containerIDPattern.MatchString(segment) {
+		return "", "", false
+	}
+	for _, parent := range parents {
+		switch {
+		case parent == "docker":
+			return RuntimeDocker, segment, true
+		case strings.HasPrefix(parent, "kubepods"):
+			return RuntimeCRI, segment, true
+		}
+	}
+	return "", segment, true
+}
+
+// parsePodSegment 解析 pod<uid> 段，systemd 驱动下UID中的"-"被替换为"_"
+func parsePodSegment(segment string) string {
+	segment = strings.TrimSuffix(segment, ".slice")
+	idx := strings.LastIndex(segment, "pod")
+	if idx < 0 || (idx > 0 && segment[idx-1] != '-') {
+		return ""
+	}
+	uid := strings.ReplaceAll(segment[idx+len("pod"):], "_", "-")
+	if len(uid) != 36 {
+		return ""
+	}
+	return uid
+}
+
+// ReadProcCgroup 读取进程的cgroup路径。优先返回包含容器ID的路径，
+// 否则返回cgroup v2统一层级的路径
+func ReadProcCgroup(procRoot string, pid uint32) (string, error) {
+	file, err := os.Open(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var unified string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 格式：hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if _, ok := ParseCgroupPath(parts[2]); ok {
+			return parts[2], nil
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			unified = parts[2]
+		}
+	}
+	return unified, scanner.Err()
+}
+
+// cgroupIndex cgroup ID 到路径的索引。cgroup v2 中 bpf_get_current_cgroup_id
+// 返回的ID即cgroup目录的inode号，进程退出后仍可据此找到所属容器
+type cgroupIndex struct {
+	root     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	paths    map[uint64]string
+	lastScan time.Time
+}
+
+func newCgroupIndex(root string) *cgroupIndex {
+	return &cgroupIndex{root: root, interval: time.Second, paths: make(map[uint64]string)}
+}
+
+// lookup 查找cgroup ID对应的路径，未命中时重新扫描（限制频率）
+func (c *cgroupIndex) lookup(id uint64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if path, ok := c.paths[id]; ok {
+		return path, true
+	}
+	if time.Since(c.lastScan) < c.interval {
+		return "", false
+	}
+	c.scan()
+	path, ok := c.paths[id]
+	return path, ok
+}
+
+// scan 遍历cgroup文件系统重建索引
+func (c *cgroupIndex) scan() {
+	c.lastScan = time.Now()
+	paths := make(map[uint64]string, len(c.paths))
+	filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			rel, _ := filepath.Rel(c.root, path)
+			paths[stat.Ino] = "/" + filepath.ToSlash(rel)
+		}
+		return nil
+	})
+	c.paths = paths
+}
@@ -0,0 +1,201 @@
+package workload
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	testContainerID = "3f4b6a2c1e9d8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a"
+	testPodUID      = "8d5e2c3a-1b4f-4e6d-9a7c-0f1e2d3c4b5a"
+)
+
+// systemdPodUID systemd 驱动下 slice 名称中的Pod UID
+var systemdPodUID = strings.ReplaceAll(testPodUID, "-", "_")
+
+func TestParseCgroupPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want CgroupInfo
+		ok   bool
+	}{
+		{
+			name: "docker cgroupfs",
+			path: "/docker/" + testContainerID,
+			want: CgroupInfo{Runtime: RuntimeDocker, ContainerID: testContainerID},
+			ok:   true,
+		},
+		{
+			name: "docker systemd",
+			path: "/system.slice/docker-" + testContainerID + ".scope",
+			want: CgroupInfo{Runtime: RuntimeDocker, ContainerID: testContainerID},
+			ok:   true,
+		},
+		{
+			name: "kubelet cgroupfs",
+			path: "/kubepods/burstable/pod" + testPodUID + "/" + testContainerID,
+			want: CgroupInfo{Runtime: RuntimeCRI, ContainerID: testContainerID, PodUID: testPodUID},
+			ok:   true,
+		},
+		{
+			name: "kubelet cgroupfs guaranteed pod in kind",
+			path: "/kubelet/kubepods/pod" + testPodUID + "/" + testContainerID,
+			want: CgroupInfo{Runtime: RuntimeCRI, ContainerID: testContainerID, PodUID: testPodUID},
+			ok:   true,
+		},
+		{
+			name: "cri-containerd systemd",
+			path: "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdPodUID + ".slice/cri-containerd-" + testContainerID + ".scope",
+			want: CgroupInfo{Runtime: RuntimeContainerd, ContainerID: testContainerID, PodUID: testPodUID},
+			ok:   true,
+		},
+		{
+			name: "cri-containerd systemd guaranteed pod",
+			path: "/kubepods.slice/kubepods-pod" + systemdPodUID + ".slice/cri-containerd-" + testContainerID + ".scope",
+			want: CgroupInfo{Runtime: RuntimeContainerd, ContainerID: testContainerID, PodUID: testPodUID},
+			ok:   true,
+		},
+		{
+			name: "crio systemd",
+			path: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + systemdPodUID + ".slice/crio-" + testContainerID + ".scope",
+			want: CgroupInfo{Runtime: RuntimeCRIO, ContainerID: testContainerID, PodUID: testPodUID},
+			ok:   true,
+		},
+		{
+			// conmon 是容器的监控进程，不属于容器本身
+			name: "crio conmon",
+			path: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + systemdPodUID + ".slice/crio-conmon-" + testContainerID + ".scope",
+			want: CgroupInfo{PodUID: testPodUID},
+		},
+		{
+			name: "podman",
+			path: "/machine.slice/libpod-" + testContainerID + ".scope",
+			want: CgroupInfo{Runtime: RuntimePodman, ContainerID: testContainerID},
+			ok:   true,
+		},
+		{
+			name: "podman conmon",
+			path: "/machine.slice/libpod-conmon-" + testContainerID + ".scope",
+		},
+		{
+			name: "podman rootless container",
+			path: "/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + testContainerID + ".scope/container",
+			want: CgroupInfo{Runtime: RuntimePodman, ContainerID: testContainerID},
+			ok:   true,
+		},
+		{
+			name: "unknown runtime",
+			path: "/custom/" + testContainerID,
+			want: CgroupInfo{ContainerID: testContainerID},
+			ok:   true,
+		},
+		{name: "root cgroup", path: "/"},
+		{name: "host session", path: "/user.slice/user-1000.slice/session-3.scope"},
+		{name: "host service", path: "/system.slice/containerd.service"},
+		{name: "short container id", path: "/docker/" + testContainerID[:12]},
+		{name: "uppercase container id", path: "/docker/" + strings.ToUpper(testContainerID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCgroupPath(tt.path)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseCgroupPath(%q) = %+v, %v, want %+v, %v", tt.path, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParsePodSegment(t *testing.T) {
+	tests := map[string]string{
+		"pod" + testPodUID: testPodUID,
+		"kubepods-burstable-pod" + systemdPodUID + ".slice":      testPodUID,
+		"kubepods-besteffort-pod" + systemdPodUID + ".slice":     testPodUID,
+		"kubepods-pod" + systemdPodUID + ".slice":                testPodUID,
+		"kubepods-burstable.slice":                               "",
+		"kubepods.slice":                                         "",
+		"pod1234":                                                "",
+		"ipod" + testPodUID:                                      "",
+		"kubepods-burstable-pod" + systemdPodUID[:20] + ".slice": "",
+	}
+	for segment, want := range tests {
+		if got := parsePodSegment(segment); got != want {
+			t.Errorf("parsePodSegment(%q) = %q, want %q", segment, got, want)
+		}
+	}
+}
+
+// writeProcCgroup 在模拟的 /proc 中写入进程的cgroup文件
+func writeProcCgroup(t *testing.T, procRoot string, pid uint32, content string) {
+	t.Helper()
+	dir := filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadProcCgroup(t *testing.T) {
+	procRoot := t.TempDir()
+	dockerV1 := "/docker/" + testContainerID
+	kubeV2 := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdPodUID + ".slice/cri-containerd-" + testContainerID + ".scope"
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "cgroup v1",
+			content: "12:pids:" + dockerV1 + "\n" +
+				"11:cpu,cpuacct:" + dockerV1 + "\n" +
+				"1:name=systemd:" + dockerV1 + "\n",
+			want: dockerV1,
+		},
+		{
+			name:    "cgroup v2",
+			content: "0::" + kubeV2 + "\n",
+			want:    kubeV2,
+		},
+		{
+			// 混合模式下统一层级只有systemd的路径，容器路径在v1控制器中
+			name:    "hybrid",
+			content: "5:memory:" + dockerV1 + "\n1:name=systemd:/system.slice/docker.service\n0::/\n",
+			want:    dockerV1,
+		},
+		{
+			name:    "host process on cgroup v2",
+			content: "0::/user.slice/user-1000.slice/session-3.scope\n",
+			want:    "/user.slice/user-1000.slice/session-3.scope",
+		},
+		{
+			name:    "host process on cgroup v1",
+			content: "12:pids:/user.slice\n1:name=systemd:/init.scope\n",
+			want:    "",
+		},
+		{
+			name:    "malformed lines",
+			content: "garbage\n\n0::" + kubeV2 + "\n",
+			want:    kubeV2,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pid := uint32(100 + i)
+			writeProcCgroup(t, procRoot, pid, tt.content)
+			got, err := ReadProcCgroup(procRoot, pid)
+			if err != nil || got != tt.want {
+				t.Errorf("ReadProcCgroup = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadProcCgroup(procRoot, 99999); !os.IsNotExist(err) {
+		t.Errorf("missing process: err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,356 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloudsecops/internal/config"
+)
+
+// errWatchExpired watch 使用的 resourceVersion 已过期，需要重新列举
+var errWatchExpired = errors.New("watch resource version expired")
+
+// kubePod Pod对象中用到的字段
+type kubePod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		UID             string            `json:"uid"`
+		Labels          map[string]string `json:"labels"`
+		ResourceVersion string            `json:"resourceVersion"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		InitContainerStatuses      []kubeContainerStatus `json:"initContainerStatuses"`
+		ContainerStatuses          []kubeContainerStatus `json:"containerStatuses"`
+		EphemeralContainerStatuses []kubeContainerStatus `json:"ephemeralContainerStatuses"`
+	} `json:"status"`
+}
+
+type kubeContainerStatus struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	ContainerID string `json:"containerID"` // 形如 containerd://<id>
+}
+
+type kubePodList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []kubePod `json:"items"`
+}
+
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// podMeta Pod级元数据及其容器
+type podMeta struct {
+	pod        *Workload
+	containers []*Workload
+}
+
+// KubeClient 使用 ServiceAccount 令牌访问Kubernetes API
+type KubeClient struct {
+	server    string
+	tokenPath string
+	client    *http.Client
+}
+
+// NewKubeClient 创建Kubernetes API客户端，未指定API地址时使用集群内配置
+func NewKubeClient(cfg config.WorkloadConfig) (*KubeClient, error) {
+	server := cfg.KubeAPIServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("not running in a cluster and KUBE_API_SERVER is not set")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+	if _, err := os.Stat(cfg.KubeTokenPath); err != nil {
+		return nil, fmt.Errorf("service account token unavailable: %w", err)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.KubeCAPath != "" {
+		ca, err := os.ReadFile(cfg.KubeCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.KubeCAPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &KubeClient{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenPath: cfg.KubeTokenPath,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				TLSClientConfig:     tlsConfig,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+	}, nil
+}
+
+// Do 发送带 ServiceAccount 令牌的请求，返回任意状态码的响应。令牌会定期轮换，每次请求重新读取
+func (c *KubeClient) Do(ctx context.Context, method, path string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	token, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.client.Do(req)
+}
+
+// Patch 以 JSON merge patch 修改对象，path 如 /api/v1/namespaces/default/pods/web
+func (c *KubeClient) Patch(ctx context.Context, path string, patch interface{}) error {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(ctx, http.MethodPatch, path, nil, "application/merge-patch+json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return kubeError(resp)
+	}
+	return nil
+}
+
+// kubeError 读取错误响应中的说明
+func kubeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("kubernetes API returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// kubernetesProvider 通过Kubernetes API list+watch 维护本节点的Pod缓存
+type kubernetesProvider struct {
+	client   *KubeClient
+	nodeName string
+	backoff  time.Duration
+}
+
+// newKubernetesProvider 创建Kubernetes元数据提供方
+func newKubernetesProvider(cfg config.WorkloadConfig) (*kubernetesProvider, error) {
+	client, err := NewKubeClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kubernetesProvider{client: client, nodeName: cfg.NodeName, backoff: 5 * time.Second}, nil
+}
+
+func (k *kubernetesProvider) Name() string { return "kubernetes" }
+
+// Run 先列举Pod建立完整缓存，再从返回的 resourceVersion 开始watch增量；
+// 连接中断时从断点继续，版本过期时重新列举
+func (k *kubernetesProvider) Run(ctx context.Context, r *Resolver) error {
+	version := ""
+	for ctx.Err() == nil {
+		if version == "" {
+			v, err := k.list(ctx, r)
+			if err != nil {
+				r.setError(k.Name(), err)
+				r.log.Warnf("Failed to list pods: %v", err)
+				sleep(ctx, k.backoff)
+				continue
+			}
+			version = v
+		}
+
+		v, err := k.watch(ctx, r, version)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, errWatchExpired):
+			version = ""
+		case err != nil:
+			r.setError(k.Name(), err)
+			r.log.Warnf("Pod watch interrupted: %v", err)
+			version = v
+			sleep(ctx, k.backoff)
+		default:
+			version = v
+		}
+	}
+	return nil
+}
+
+// list 列举Pod并替换缓存，返回列表的 resourceVersion
+func (k *kubernetesProvider) list(ctx context.Context, r *Resolver) (string, error) {
+	resp, err := k.get(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list kubePodList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("failed to decode pod list: %w", err)
+	}
+
+	pods := make([]*podMeta, 0, len(list.Items))
+	for i := range list.Items {
+		pods = append(pods, k.podMeta(&list.Items[i]))
+	}
+	r.setPods(k.Name(), pods)
+	r.log.Infof("Synced %d pods from Kubernetes API", len(pods))
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch 处理watch事件流直到服务端关闭连接，返回最后处理到的 resourceVersion
+func (k *kubernetesProvider) watch(ctx context.Context, r *Resolver, version string) (string, error) {
+	resp, err := k.get(ctx, url.Values{
+		"watch":               {"true"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {"300"},
+	})
+	if err != nil {
+		return version, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event kubeWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return version, nil
+			}
+			return version, fmt.Errorf("failed to decode watch event: %w", err)
+		}
+
+		if event.Type == "ERROR" {
+			var status kubeStatus
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return "", errWatchExpired
+			}
+			return version, fmt.Errorf("watch error %d: %s", status.Code, status.Message)
+		}
+
+		var pod kubePod
+		if err := json.Unmarshal(event.Object, &pod); err != nil {
+			return version, fmt.Errorf("failed to decode pod: %w", err)
+		}
+		version = pod.Metadata.ResourceVersion
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			r.updatePod(k.Name(), k.podMeta(&pod))
+		case "DELETED":
+			r.deletePod(k.Name(), pod.Metadata.UID)
+		}
+	}
+}
+
+// get 列举或watch Pod，配置了节点名时只关注本节点的Pod，非200的响应作为错误返回
+func (k *kubernetesProvider) get(ctx context.Context, query url.Values) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if k.nodeName != "" {
+		query.Set("fieldSelector", "spec.nodeName="+k.nodeName)
+	}
+	resp, err := k.client.Do(ctx, http.MethodGet, "/api/v1/pods", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusGone {
+		resp.Body.Close()
+		return nil, errWatchExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, kubeError(resp)
+	}
+	return resp, nil
+}
+
+// podMeta 将Pod对象转换为缓存条目
+func (k *kubernetesProvider) podMeta(pod *kubePod) *podMeta {
+	base := &Workload{
+		PodName:   pod.Metadata.Name,
+		PodUID:    pod.Metadata.UID,
+		Namespace: pod.Metadata.Namespace,
+		Labels:    pod.Metadata.Labels,
+		Node:      pod.Spec.NodeName,
+	}
+
+	meta := &podMeta{pod: base}
+	statuses := [][]kubeContainerStatus{
+		pod.Status.InitContainerStatuses,
+		pod.Status.ContainerStatuses,
+		pod.Status.EphemeralContainerStatuses,
+	}
+	for _, list := range statuses {
+		for _, status := range list {
+			runtime, id, ok := strings.Cut(status.ContainerID, "://")
+			if !ok || id == "" {
+				continue
+			}
+			w := *base
+			w.ContainerID = id
+			w.Runtime = runtime
+			w.ContainerName = status.Name
+			w.Image = status.Image
+			meta.containers = append(meta.containers, &w)
+		}
+	}
+	return meta
+}
+
+// sleep 等待指定时间或 ctx 取消
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
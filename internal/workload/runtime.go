@@ -0,0 +1,151 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Docker创建的Kubernetes容器（dockershim、cri-dockerd）携带的标签
+const (
+	labelPodName      = "io.kubernetes.pod.name"
+	labelPodNamespace = "io.kubernetes.pod.namespace"
+	labelPodUID       = "io.kubernetes.pod.uid"
+	labelContainer    = "io.kubernetes.container.name"
+)
+
+// runtimeContainer Docker Engine API 容器列表项
+type runtimeContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// RuntimeClient 通过本地socket访问 Docker Engine API，适用于 dockerd、cri-dockerd 和 podman 的兼容socket
+type RuntimeClient struct {
+	socket string
+	client *http.Client
+}
+
+// NewRuntimeClient 创建容器运行时客户端
+func NewRuntimeClient(socket string) *RuntimeClient {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &RuntimeClient{
+		socket: socket,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Pause 暂停容器中的所有进程，容器已暂停时不报错
+func (c *RuntimeClient) Pause(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://runtime/containers/"+url.PathEscape(id)+"/pause", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusConflict && strings.Contains(string(body), "already paused"):
+		return nil
+	}
+	return fmt.Errorf("container runtime returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// runtimeProvider 通过本地容器运行时socket定期同步容器元数据
+type runtimeProvider struct {
+	runtime  *RuntimeClient
+	interval time.Duration
+}
+
+func newRuntimeProvider(socket string, interval time.Duration) *runtimeProvider {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &runtimeProvider{runtime: NewRuntimeClient(socket), interval: interval}
+}
+
+func (p *runtimeProvider) Name() string { return "runtime" }
+
+func (p *runtimeProvider) Run(ctx context.Context, r *Resolver) error {
+	for {
+		containers, err := p.list(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			r.setError(p.Name(), err)
+			r.log.Warnf("Failed to list containers from %s: %v", p.runtime.socket, err)
+		} else {
+			r.setRuntimeContainers(p.Name(), containers)
+		}
+
+		sleep(ctx, p.interval)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// list 列出运行中的容器
+func (p *runtimeProvider) list(ctx context.Context) ([]*Workload, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://runtime/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.runtime.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("container runtime returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var items []runtimeContainer
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to decode container list: %w", err)
+	}
+
+	workloads := make([]*Workload, 0, len(items))
+	for _, item := range items {
+		w := &Workload{
+			ContainerID: item.ID,
+			Runtime:     RuntimeDocker,
+			Image:       item.Image,
+			Labels:      item.Labels,
+			PodName:     item.Labels[labelPodName],
+			Namespace:   item.Labels[labelPodNamespace],
+			PodUID:      item.Labels[labelPodUID],
+		}
+		if name := item.Labels[labelContainer]; name != "" {
+			w.ContainerName = name
+		} else if len(item.Names) > 0 {
+			w.ContainerName = strings.TrimPrefix(item.Names[0], "/")
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads, nil
+}
@@ -0,0 +1,312 @@
+package workload
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloudsecops/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Workload 事件所属的工作负载。解析结果在缓存中共享，调用方不应修改
+type Workload struct {
+	ContainerID   string            `json:"container_id"`
+	Runtime       string            `json:"runtime,omitempty"`
+	ContainerName string            `json:"container_name,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	PodName       string            `json:"pod_name,omitempty"`
+	PodUID        string            `json:"pod_uid,omitempty"`
+	Namespace     string            `json:"namespace,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Node          string            `json:"node,omitempty"`
+}
+
+// Name 返回便于阅读的工作负载名称：namespace/pod/container，非Kubernetes容器返回容器名
+func (w *Workload) Name() string {
+	if w == nil {
+		return ""
+	}
+	if w.PodName != "" {
+		name := w.Namespace + "/" + w.PodName
+		if w.ContainerName != "" {
+			name += "/" + w.ContainerName
+		}
+		return name
+	}
+	if w.ContainerName != "" {
+		return w.ContainerName
+	}
+	return ShortID(w.ContainerID)
+}
+
+// ShortID 返回容器ID的前12位
+func ShortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// ProviderStatus 元数据提供方状态
+type ProviderStatus struct {
+	Name     string `json:"name"`
+	State    string `json:"state"` // syncing、synced 或 error
+	Objects  int    `json:"objects"`
+	LastSync int64  `json:"last_sync,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Status 解析器状态
+type Status struct {
+	Containers int              `json:"containers"`
+	Pods       int              `json:"pods"`
+	Providers  []ProviderStatus `json:"providers"`
+}
+
+// provider 工作负载元数据来源
+type provider interface {
+	Name() string
+	Run(ctx context.Context, r *Resolver) error
+}
+
+// maxCgroupCache cgroup ID 解析结果缓存上限，超过后整体清空
+const maxCgroupCache = 8192
+
+// Resolver 将进程解析为所属工作负载。容器ID来自cgroup路径，
+// Pod、镜像和标签等元数据由Kubernetes API watch 或本地容器运行时socket维护的缓存提供
+type Resolver struct {
+	cfg       config.WorkloadConfig
+	log       *logrus.Logger
+	cgroups   *cgroupIndex
+	providers []provider
+
+	mu            sync.RWMutex
+	byCgroup      map[uint64]CgroupInfo
+	pods          map[string]*Workload // Pod UID -> Pod级元数据
+	podContainers map[string][]string  // Pod UID -> 容器ID
+	kubeEntries   map[string]*Workload // 容器ID -> Kubernetes元数据
+	runtimeItems  map[string]*Workload // 容器ID -> 容器运行时元数据
+	status        map[string]*ProviderStatus
+}
+
+// NewResolver 创建工作负载解析器
+func NewResolver(cfg config.WorkloadConfig, log *logrus.Logger) *Resolver {
+	r := &Resolver{
+		cfg:           cfg,
+		log:           log,
+		cgroups:       newCgroupIndex(cfg.CgroupRoot),
+		byCgroup:      make(map[uint64]CgroupInfo),
+		pods:          make(map[string]*Workload),
+		podContainers: make(map[string][]string),
+		kubeEntries:   make(map[string]*Workload),
+		runtimeItems:  make(map[string]*Workload),
+		status:        make(map[string]*ProviderStatus),
+	}
+
+	if cfg.Kubernetes {
+		kube, err := newKubernetesProvider(cfg)
+		if err != nil {
+			log.Warnf("Kubernetes workload metadata disabled: %v", err)
+		} else {
+			r.providers = append(r.providers, kube)
+		}
+	}
+	if cfg.RuntimeSocket != "" {
+		r.providers = append(r.providers, newRuntimeProvider(cfg.RuntimeSocket, time.Duration(cfg.ResyncInterval)*time.Second))
+	}
+	for _, p := range r.providers {
+		r.status[p.Name()] = &ProviderStatus{Name: p.Name(), State: "syncing"}
+	}
+
+	return r
+}
+
+// Run 启动所有元数据提供方，直到 ctx 取消
+func (r *Resolver) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range r.providers {
+		wg.Add(1)
+		go func(p provider) {
+			defer wg.Done()
+			if err := p.Run(ctx, r); err != nil && ctx.Err() == nil {
+				r.log.Errorf("Workload provider %s stopped: %v", p.Name(), err)
+				r.setError(p.Name(), err)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Resolve 解析事件所属的工作负载。containerID 已知时直接查缓存，
+// 否则依次通过cgroup ID 和 /proc/<pid>/cgroup 确定容器。宿主机进程返回nil
+func (r *Resolver) Resolve(pid uint32, cgroupID uint64, containerID string) *Workload {
+	info := CgroupInfo{ContainerID: containerID}
+	if info.ContainerID == "" {
+		info = r.cgroupInfo(pid, cgroupID)
+	}
+	if info.ContainerID == "" {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if w, ok := r.kubeEntries[info.ContainerID]; ok {
+		return w
+	}
+	if w, ok := r.runtimeItems[info.ContainerID]; ok {
+		return w
+	}
+
+	// 缓存尚未收到该容器（例如刚启动），尽量用Pod级元数据补全
+	w := &Workload{
+		ContainerID: info.ContainerID,
+		Runtime:     info.Runtime,
+		PodUID:      info.PodUID,
+		Node:        r.cfg.NodeName,
+	}
+	if pod, ok := r.pods[info.PodUID]; ok {
+		w.PodName, w.Namespace, w.Labels, w.Node = pod.PodName, pod.Namespace, pod.Labels, pod.Node
+	}
+	return w
+}
+
+// cgroupInfo 确定进程所属容器，结果按cgroup ID 缓存
+func (r *Resolver) cgroupInfo(pid uint32, cgroupID uint64) CgroupInfo {
+	if cgroupID != 0 {
+		r.mu.RLock()
+		info, ok := r.byCgroup[cgroupID]
+		r.mu.RUnlock()
+		if ok {
+			return info
+		}
+	}
+
+	var info CgroupInfo
+	found := false
+	if cgroupID != 0 {
+		if path, ok := r.cgroups.lookup(cgroupID); ok {
+			info, _ = ParseCgroupPath(path)
+			found = true
+		}
+	}
+	if !found && pid != 0 {
+		if path, err := ReadProcCgroup(r.cfg.ProcRoot, pid); err == nil {
+			info, _ = ParseCgroupPath(path)
+			found = true
+		}
+	}
+
+	if found && cgroupID != 0 {
+		r.mu.Lock()
+		if len(r.byCgroup) >= maxCgroupCache {
+			r.byCgroup = make(map[uint64]CgroupInfo)
+		}
+		r.byCgroup[cgroupID] = info
+		r.mu.Unlock()
+	}
+	return info
+}
+
+// Status 返回解析器状态
+func (r *Resolver) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status := Status{
+		Containers: len(r.kubeEntries) + len(r.runtimeItems),
+		Pods:       len(r.pods),
+		Providers:  make([]ProviderStatus, 0, len(r.providers)),
+	}
+	for _, p := range r.providers {
+		status.Providers = append(status.Providers, *r.status[p.Name()])
+	}
+	return status
+}
+
+// setPods 用完整的Pod列表替换Kubernetes缓存
+func (r *Resolver) setPods(source string, pods []*podMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pods = make(map[string]*Workload, len(pods))
+	r.podContainers = make(map[string][]string, len(pods))
+	r.kubeEntries = make(map[string]*Workload)
+	for _, pod := range pods {
+		r.putPodLocked(pod)
+	}
+	r.synced(source, len(r.pods))
+}
+
+// updatePod 新增或更新单个Pod
+func (r *Resolver) updatePod(source string, pod *podMeta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deletePodLocked(pod.pod.PodUID)
+	r.putPodLocked(pod)
+	r.synced(source, len(r.pods))
+}
+
+// deletePod 删除Pod及其容器
+func (r *Resolver) deletePod(source, uid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deletePodLocked(uid)
+	r.synced(source, len(r.pods))
+}
+
+func (r *Resolver) putPodLocked(pod *podMeta) {
+	uid := pod.pod.PodUID
+	r.pods[uid] = pod.pod
+	ids := make([]string, 0, len(pod.containers))
+	for _, c := range pod.containers {
+		r.kubeEntries[c.ContainerID] = c
+		ids = append(ids, c.ContainerID)
+	}
+	r.podContainers[uid] = ids
+}
+
+func (r *Resolver) deletePodLocked(uid string) {
+	for _, id := range r.podContainers[uid] {
+		delete(r.kubeEntries, id)
+	}
+	delete(r.podContainers, uid)
+	delete(r.pods, uid)
+}
+
+// setRuntimeContainers 用容器运行时的完整容器列表替换缓存
+func (r *Resolver) setRuntimeContainers(source string, containers []*Workload) {
+	items := make(map[string]*Workload, len(containers))
+	for _, c := range containers {
+		items[c.ContainerID] = c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runtimeItems = items
+	r.synced(source, len(items))
+}
+
+// synced 记录同步成功，调用方需持有写锁
+func (r *Resolver) synced(source string, objects int) {
+	if status, ok := r.status[source]; ok {
+		status.State = "synced"
+		status.Objects = objects
+		status.LastSync = time.Now().Unix()
+		status.Error = ""
+	}
+}
+
+// setError 记录提供方错误
+func (r *Resolver) setError(source string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status, ok := r.status[source]; ok {
+		status.State = "error"
+		status.Error = err.Error()
+	}
+}
@@ -0,0 +1,211 @@
+package workload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"cloudsecops/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeProvider 同步固定的Pod和容器列表后等待取消，err 非空时同步后返回该错误
+type fakeProvider struct {
+	name       string
+	pods       []*podMeta
+	containers []*Workload
+	err        error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Run(ctx context.Context, r *Resolver) error {
+	if p.pods != nil {
+		r.setPods(p.name, p.pods)
+	}
+	if p.containers != nil {
+		r.setRuntimeContainers(p.name, p.containers)
+	}
+	if p.err != nil {
+		return p.err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// newTestResolver 创建使用临时 /proc 和cgroup根目录及指定提供方的解析器，并等待所有提供方完成首次同步
+func newTestResolver(t *testing.T, providers ...provider) (*Resolver, config.WorkloadConfig) {
+	t.Helper()
+	cfg := config.WorkloadConfig{ProcRoot: t.TempDir(), CgroupRoot: t.TempDir(), NodeName: "node-1"}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	r := NewResolver(cfg, logger)
+	r.providers = providers
+	for _, p := range providers {
+		r.status[p.Name()] = &ProviderStatus{Name: p.Name(), State: "syncing"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		syncing := false
+		for _, s := range r.Status().Providers {
+			syncing = syncing || s.State == "syncing"
+		}
+		if !syncing {
+			return r, cfg
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("providers did not sync")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+const (
+	kubeContainerID    = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	runtimeContainerID = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	newContainerID     = "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+)
+
+func testPod() *podMeta {
+	pod := &Workload{PodName: "web-0", PodUID: testPodUID, Namespace: "prod", Labels: map[string]string{"app": "web"}, Node: "node-1"}
+	container := &Workload{ContainerID: kubeContainerID, Runtime: RuntimeContainerd, ContainerName: "nginx", Image: "nginx:1.25", PodName: "web-0", PodUID: testPodUID, Namespace: "prod", Node: "node-1"}
+	return &podMeta{pod: pod, containers: []*Workload{container}}
+}
+
+func TestResolverResolve(t *testing.T) {
+	kube := &fakeProvider{name: "kubernetes", pods: []*podMeta{testPod()}}
+	runtime := &fakeProvider{name: "runtime", containers: []*Workload{{ContainerID: runtimeContainerID, Runtime: RuntimeDocker, ContainerName: "redis", Image: "redis:7"}}}
+	r, cfg := newTestResolver(t, kube, runtime)
+
+	podCgroup := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdPodUID + ".slice/cri-containerd-"
+	writeProcCgroup(t, cfg.ProcRoot, 10, "0::"+podCgroup+kubeContainerID+".scope\n")
+	writeProcCgroup(t, cfg.ProcRoot, 11, "0::/system.slice/docker-"+runtimeContainerID+".scope\n")
+	// 已调度到Pod但尚未出现在缓存中的容器
+	writeProcCgroup(t, cfg.ProcRoot, 12, "0::"+podCgroup+newContainerID+".scope\n")
+	writeProcCgroup(t, cfg.ProcRoot, 13, "0::/user.slice/user-1000.slice/session-3.scope\n")
+
+	tests := []struct {
+		name        string
+		pid         uint32
+		containerID string
+		want        string // Workload.Name()，宿主机进程为空
+		runtime     string
+	}{
+		{"kubernetes container by pid", 10, "", "prod/web-0/nginx", RuntimeContainerd},
+		{"kubernetes container by id", 0, kubeContainerID, "prod/web-0/nginx", RuntimeContainerd},
+		{"runtime container", 11, "", "redis", RuntimeDocker},
+		{"new container in known pod", 12, "", "prod/web-0", RuntimeContainerd},
+		{"host process", 13, "", "", ""},
+		{"unknown process", 99, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := r.Resolve(tt.pid, 0, tt.containerID)
+			if got := w.Name(); got != tt.want {
+				t.Errorf("Resolve(%d) = %q, want %q", tt.pid, got, tt.want)
+			}
+			if w != nil && w.Runtime != tt.runtime {
+				t.Errorf("runtime = %q, want %q", w.Runtime, tt.runtime)
+			}
+		})
+	}
+
+	w := r.Resolve(12, 0, "")
+	if w.ContainerID != newContainerID || w.PodUID != testPodUID || w.Labels["app"] != "web" || w.Node != "node-1" {
+		t.Errorf("pod-level fallback = %+v", w)
+	}
+
+	status := r.Status()
+	if status.Containers != 2 || status.Pods != 1 || len(status.Providers) != 2 {
+		t.Errorf("status = %+v", status)
+	}
+	for _, p := range status.Providers {
+		if p.State != "synced" || p.Objects != 1 {
+			t.Errorf("provider status = %+v, want synced with 1 object", p)
+		}
+	}
+}
+
+func TestResolverPodUpdates(t *testing.T) {
+	r, _ := newTestResolver(t, &fakeProvider{name: "kubernetes", pods: []*podMeta{testPod()}})
+
+	updated := testPod()
+	updated.containers[0].ContainerName = "nginx-v2"
+	r.updatePod("kubernetes", updated)
+	if got := r.Resolve(0, 0, kubeContainerID).Name(); got != "prod/web-0/nginx-v2" {
+		t.Errorf("after update: %q", got)
+	}
+
+	r.deletePod("kubernetes", testPodUID)
+	w := r.Resolve(0, 0, kubeContainerID)
+	if w.PodName != "" || w.ContainerID != kubeContainerID {
+		t.Errorf("after delete: %+v, want only the container ID", w)
+	}
+	if status := r.Status(); status.Pods != 0 || status.Containers != 0 {
+		t.Errorf("status after delete = %+v", status)
+	}
+}
+
+func TestResolverCgroupID(t *testing.T) {
+	r, cfg := newTestResolver(t, &fakeProvider{name: "kubernetes", pods: []*podMeta{testPod()}})
+
+	rel := filepath.Join("kubepods.slice", "kubepods-burstable.slice", "kubepods-burstable-pod"+systemdPodUID+".slice", "cri-containerd-"+kubeContainerID+".scope")
+	dir := filepath.Join(cfg.CgroupRoot, rel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroupID := info.Sys().(*syscall.Stat_t).Ino
+
+	// 进程已退出，只能通过cgroup目录的inode号找到容器
+	if got := r.Resolve(12345, cgroupID, "").Name(); got != "prod/web-0/nginx" {
+		t.Errorf("Resolve by cgroup ID = %q, want prod/web-0/nginx", got)
+	}
+
+	// 之后按cgroup ID 使用缓存，目录删除后仍能解析
+	if err := os.RemoveAll(filepath.Join(cfg.CgroupRoot, "kubepods.slice")); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Resolve(0, cgroupID, "").Name(); got != "prod/web-0/nginx" {
+		t.Errorf("cached cgroup ID = %q, want prod/web-0/nginx", got)
+	}
+}
+
+func TestResolverProviderError(t *testing.T) {
+	r, _ := newTestResolver(t, &fakeProvider{name: "runtime", containers: []*Workload{}, err: errors.New("socket closed")})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := r.Status().Providers[0]
+		if status.State == "error" {
+			if status.Error != "socket closed" {
+				t.Errorf("error = %q", status.Error)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v, want error", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RoleAdmin 管理员角色，可以修改响应动作配置和手动阻断连接
+const RoleAdmin = "admin"
+
 // Service JWT认证服务
 type Service struct {
 	secret []byte
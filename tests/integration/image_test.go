@@ -0,0 +1,73 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// run 执行命令并返回标准输出，失败时附带标准错误
+func run(t *testing.T, name string, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String()
+}
+
+// image 返回待测镜像，未通过 CLOUDBREACH_IMAGE 指定时从仓库根目录构建
+func image(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not installed")
+	}
+	if name := os.Getenv("CLOUDBREACH_IMAGE"); name != "" {
+		return name
+	}
+	const name = "cloudsecops/backend:integration"
+	run(t, "docker", "build", "-t", name, "../..")
+	return name
+}
+
+// gitScanScript 检查镜像中的eBPF对象文件，然后在容器中创建包含公开存储桶的仓库，并以服务端相同的克隆流程扫描
+const gitScanScript = `set -e
+ssh -V
+test -s /root/internal/ebpf/programs/monitor_bpfel.o
+git init --quiet --bare /tmp/repo.git
+git init --quiet /tmp/work
+cd /tmp/work
+printf 'resource "aws_s3_bucket" "data" {\n  bucket = "data"\n  acl    = "public-read"\n}\n' > main.tf
+git add main.tf
+git -c user.name=test -c user.email=test@example.com commit --quiet -m initial
+git push --quiet /tmp/repo.git HEAD:refs/heads/main
+cloudbreach scan file:///tmp/repo.git --ref main --format json --fail-on none
+`
+
+func TestImageScansGitRepository(t *testing.T) {
+	name := image(t)
+	out := run(t, "docker", "run", "--rm", "--entrypoint", "sh", name, "-c", gitScanScript)
+
+	var result struct {
+		FileType  string            `json:"file_type"`
+		CommitSHA string            `json:"commit_sha"`
+		Findings  []json.RawMessage `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("scan output is not JSON: %v\n%s", err, out)
+	}
+	if result.FileType != "git" || len(result.CommitSHA) != 40 {
+		t.Errorf("file type = %q, commit = %q, want a git scan", result.FileType, result.CommitSHA)
+	}
+	if len(result.Findings) == 0 {
+		t.Error("expected findings for the public bucket")
+	}
+}